@@ -7,6 +7,9 @@ OpenFiler provides OpenFile() similar to the "os" package when you need to write
 Writer provides a WriteFile() similar to the "os" package when you want to write an entire file
 at once.
 
+StreamWriter provides a WriteFileFrom() for writing a file from an io.Reader without holding the
+entire file in memory.
+
 OFOption provides a generic Option type for implementations of OpenFile() to use.
 
 This package also introduces a Merge() function to allow merging of filesystem content into
@@ -49,9 +52,26 @@ optmizing that code for production.
 package fs
 
 import (
+	"errors"
+	"io"
 	"io/fs"
 )
 
+// Errors wrapped by the implementations in this module, so that callers can check for them
+// with errors.Is() instead of matching error strings.
+var (
+	// ErrReadOnly is wrapped when writing to a file system that has been locked from writing,
+	// such as a simple.FS after RO().
+	ErrReadOnly = errors.New("file system is read only")
+	// ErrUnsupportedFlag is wrapped when OpenFile() is passed flags, or a combination of flags,
+	// that the implementation does not support.
+	ErrUnsupportedFlag = errors.New("unsupported open flag")
+	// ErrLockLost is wrapped when writing to a file whose lock, such as a blob lease, has expired.
+	ErrLockLost = errors.New("lost lock on file")
+	// ErrNotDirectory is wrapped when a path that must be a directory is a file.
+	ErrNotDirectory = errors.New("not a directory")
+)
+
 // OFOption is an option for the OpenFiler.OpenFile() call. The passed "o" arg
 // is implementation dependent.
 type OFOption func(o interface{}) error
@@ -79,6 +99,17 @@ type Writer interface {
 	WriteFile(name string, data []byte, perm fs.FileMode) error
 }
 
+// StreamWriter provides a filesystem that can write a file from an io.Reader without holding the
+// entire content in memory. Writer implementations that can stream to their backend should
+// implement this.
+type StreamWriter interface {
+	// WriteFileFrom writes the content read from r until io.EOF to the file at name. If reading r
+	// fails, the returned error wraps the read error and the implementation should not leave
+	// a partial file behind if it is able to avoid it. The FileMode may or may not be honored
+	// by the implementation.
+	WriteFileFrom(name string, r io.Reader, perm fs.FileMode) error
+}
+
 // MkdirAllFS provides a filesystem that impelments MkdirAll(). An FS not implementing this is
 // expected to create the directory structure on a file write.
 type MkdirAllFS interface {
@@ -90,6 +121,15 @@ type MkdirAllFS interface {
 	MkdirAll(path string, perm fs.FileMode) error
 }
 
+// ContentTyper provides a filesystem that can report the content type of a file, such as for
+// the Content-Type header when serving the file over HTTP.
+type ContentTyper interface {
+	// ContentType returns the MIME type of the file at name, such as "application/json".
+	// Implementations that do not store a content type detect it from the file, such as with
+	// DetectContentType() or http.DetectContentType().
+	ContentType(name string) (string, error)
+}
+
 // Remove provides a filesystem that implements Remove() and RemoveAll().
 type Remove interface {
 	// Remove removes the named file or (empty) directory. If there is an error, it will be of type *PathError.
@@ -0,0 +1,300 @@
+/*
+Package fstesting provides a shared set of conformance tests for io/fs.FS implementations
+in this module, so that every backend can be validated the same way.
+
+Example use inside a _test.go file:
+
+	func TestConformance(t *testing.T) {
+		fsys := simple.New()
+		files := map[string][]byte{
+			"dir/file.txt": []byte("hello"),
+			"root.txt":     []byte("world"),
+		}
+		for name, content := range files {
+			if err := fsys.WriteFile(name, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		fstesting.Run(t, fsys, files)
+	}
+*/
+package fstesting
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// These are the names of the subtests run by Run(). They can be passed to Skip().
+const (
+	CheckOpen     = "Open"
+	CheckReadFile = "ReadFile"
+	CheckStat     = "Stat"
+	CheckSeek     = "Seek"
+	CheckReadDir  = "ReadDir"
+	CheckTestFS   = "TestFS"
+)
+
+type options struct {
+	noDirs bool
+	skip   map[string]string
+}
+
+// Option is an optional argument to Run().
+type Option func(o *options)
+
+// NoDirs indicates the fs.FS does not support directories, such as a key/value store.
+// This skips directory checks and testing/fstest.TestFS(), which requires directories.
+func NoDirs() Option {
+	return func(o *options) {
+		o.noDirs = true
+	}
+}
+
+// Skip skips the named checks (such as CheckTestFS) with reason. This is used to record known
+// contract violations in a backend without failing its tests, until they are fixed.
+func Skip(reason string, checks ...string) Option {
+	return func(o *options) {
+		if o.skip == nil {
+			o.skip = map[string]string{}
+		}
+		for _, check := range checks {
+			o.skip[check] = reason
+		}
+	}
+}
+
+// Run runs the conformance tests against fsys. files is the set of files and their content
+// that have already been written to fsys. fsys must not contain any other files. Each group
+// of checks is run as a subtest of t.
+func Run(t *testing.T, fsys fs.FS, files map[string][]byte, opts ...Option) {
+	t.Helper()
+
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	run := func(check string, f func(t *testing.T)) {
+		t.Run(check, func(t *testing.T) {
+			if reason, ok := o.skip[check]; ok {
+				t.Skip(reason)
+			}
+			f(t)
+		})
+	}
+
+	run(CheckOpen, func(t *testing.T) {
+		for _, name := range names {
+			testOpen(t, fsys, name, files[name])
+		}
+		if _, err := fsys.Open("does/not/exist"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(does/not/exist): got err == %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	run(CheckReadFile, func(t *testing.T) {
+		for _, name := range names {
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				t.Errorf("ReadFile(%s): got err == %s, want err == nil", name, err)
+				continue
+			}
+			if !bytes.Equal(b, files[name]) {
+				t.Errorf("ReadFile(%s): got %q, want %q", name, b, files[name])
+			}
+		}
+	})
+
+	run(CheckStat, func(t *testing.T) {
+		for _, name := range names {
+			fi, err := fs.Stat(fsys, name)
+			if err != nil {
+				t.Errorf("Stat(%s): got err == %s, want err == nil", name, err)
+				continue
+			}
+			checkFileInfo(t, "Stat", name, fi, files[name])
+		}
+		if _, err := fs.Stat(fsys, "does/not/exist"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(does/not/exist): got err == %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	run(CheckSeek, func(t *testing.T) {
+		for _, name := range names {
+			testSeek(t, fsys, name, files[name])
+		}
+	})
+
+	if o.noDirs {
+		return
+	}
+
+	run(CheckReadDir, func(t *testing.T) {
+		for dir, want := range dirEntries(names) {
+			fi, err := fs.Stat(fsys, dir)
+			if err != nil {
+				t.Errorf("Stat(%s): got err == %s, want err == nil", dir, err)
+				continue
+			}
+			if !fi.IsDir() || !fi.Mode().IsDir() {
+				t.Errorf("Stat(%s): got IsDir() == %v, Mode() == %v, want a directory", dir, fi.IsDir(), fi.Mode())
+			}
+
+			entries, err := fs.ReadDir(fsys, dir)
+			if err != nil {
+				t.Errorf("ReadDir(%s): got err == %s, want err == nil", dir, err)
+				continue
+			}
+			got := make([]string, 0, len(entries))
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if !equal(got, want) {
+				t.Errorf("ReadDir(%s): got %v, want %v", dir, got, want)
+			}
+		}
+	})
+
+	run(CheckTestFS, func(t *testing.T) {
+		if err := fstest.TestFS(fsys, names...); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func testOpen(t *testing.T, fsys fs.FS, name string, want []byte) {
+	t.Helper()
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Errorf("Open(%s): got err == %s, want err == nil", name, err)
+		return
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Errorf("Open(%s).Read(): got err == %s, want err == nil", name, err)
+		return
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("Open(%s).Read(): got %q, want %q", name, b, want)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Errorf("Open(%s).Stat(): got err == %s, want err == nil", name, err)
+		return
+	}
+	checkFileInfo(t, "Open.Stat", name, fi, want)
+}
+
+func testSeek(t *testing.T, fsys fs.FS, name string, want []byte) {
+	t.Helper()
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Errorf("Open(%s): got err == %s, want err == nil", name, err)
+		return
+	}
+	defer f.Close()
+
+	s, ok := f.(io.Seeker)
+	if !ok {
+		return
+	}
+
+	mid := int64(len(want) / 2)
+	off, err := s.Seek(mid, io.SeekStart)
+	if err != nil {
+		t.Errorf("Seek(%s, %d, io.SeekStart): got err == %s, want err == nil", name, mid, err)
+		return
+	}
+	if off != mid {
+		t.Errorf("Seek(%s, %d, io.SeekStart): got offset %d, want %d", name, mid, off, mid)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Errorf("Seek(%s): read after seek got err == %s, want err == nil", name, err)
+		return
+	}
+	if !bytes.Equal(b, want[mid:]) {
+		t.Errorf("Seek(%s): read after seek got %q, want %q", name, b, want[mid:])
+	}
+
+	off, err = s.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Errorf("Seek(%s, 0, io.SeekEnd): got err == %s, want err == nil", name, err)
+		return
+	}
+	if off != int64(len(want)) {
+		t.Errorf("Seek(%s, 0, io.SeekEnd): got offset %d, want %d", name, off, len(want))
+	}
+}
+
+func checkFileInfo(t *testing.T, op, name string, fi fs.FileInfo, content []byte) {
+	t.Helper()
+
+	if fi.Name() != path.Base(name) {
+		t.Errorf("%s(%s): got Name() %q, want %q", op, name, fi.Name(), path.Base(name))
+	}
+	if fi.Size() != int64(len(content)) {
+		t.Errorf("%s(%s): got Size() %d, want %d", op, name, fi.Size(), len(content))
+	}
+	if fi.IsDir() || fi.Mode().IsDir() {
+		t.Errorf("%s(%s): got IsDir() == %v, Mode() == %v, want a regular file", op, name, fi.IsDir(), fi.Mode())
+	}
+}
+
+// dirEntries returns every directory that contains a file in names, including ".",
+// mapped to the sorted names of its entries.
+func dirEntries(names []string) map[string][]string {
+	children := map[string]map[string]bool{}
+	add := func(dir, child string) {
+		if children[dir] == nil {
+			children[dir] = map[string]bool{}
+		}
+		children[dir][child] = true
+	}
+
+	for _, name := range names {
+		for p := name; p != "."; p = path.Dir(p) {
+			add(path.Dir(p), path.Base(p))
+		}
+	}
+
+	m := make(map[string][]string, len(children))
+	for dir, c := range children {
+		for child := range c {
+			m[dir] = append(m[dir], child)
+		}
+		sort.Strings(m[dir])
+	}
+	return m
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	jsfs "github.com/gopherfs/fs"
+)
+
+// errIncomplete is passed to a streaming cache fill when the file was not completely read.
+var errIncomplete = errors.New("file was not completely read from storage")
+
+// backfillFile wraps a file opened from storage and writes its content to the cache
+// once it has been completely read. See WithOpenBackfill().
+type backfillFile struct {
+	fs.File
+
+	fsys *FS
+	name string
+	buf  bytes.Buffer
+	// done is set once the file has been backfilled or can no longer be.
+	done bool
+
+	// sw is set if the cache is a jsfs.StreamWriter. The content is then written to pw
+	// as it is read instead of being buffered in buf.
+	sw jsfs.StreamWriter
+	pw *io.PipeWriter
+	// read is the number of bytes written to pw.
+	read int64
+}
+
+func newBackfillFile(f *FS, file fs.File, name string) *backfillFile {
+	b := &backfillFile{File: file, fsys: f, name: name}
+	if sw, ok := f.cache.(jsfs.StreamWriter); ok {
+		b.sw = sw
+	}
+	return b
+}
+
+// Read implements io.Reader.
+func (b *backfillFile) Read(p []byte) (int, error) {
+	if b.sw != nil && b.pw == nil && !b.done {
+		b.startStream()
+	}
+
+	n, err := b.File.Read(p)
+	if b.done {
+		return n, err
+	}
+
+	if b.pw != nil {
+		b.tee(p[:n], err)
+		return n, err
+	}
+
+	b.buf.Write(p[:n])
+	switch {
+	case err == io.EOF:
+		b.done = true
+		b.fill()
+	case err != nil:
+		b.done = true
+		b.buf = bytes.Buffer{}
+	}
+	return n, err
+}
+
+// fill writes the buffered content to the cache if all of the file was read.
+func (b *backfillFile) fill() {
+	defer func() { b.buf = bytes.Buffer{} }()
+
+	fi, err := b.File.Stat()
+	if err != nil || fi.Size() != int64(b.buf.Len()) {
+		return
+	}
+	b.fsys.backfill(b.name, b.buf.Bytes())
+}
+
+// startStream starts writing to the cache with WriteFileFrom() in a separate goroutine.
+// If WithMaxFillWorkers() was used and all workers are busy, the file is not backfilled.
+func (b *backfillFile) startStream() {
+	f := b.fsys
+	if f.fillSem != nil {
+		select {
+		case f.fillSem <- struct{}{}:
+		default:
+			b.done = true
+			return
+		}
+	}
+
+	pr, pw := io.Pipe()
+	b.pw = pw
+
+	f.fills.Add(1)
+	go func() {
+		defer f.fills.Done()
+		if f.fillSem != nil {
+			defer func() { <-f.fillSem }()
+		}
+		err := b.sw.WriteFileFrom(b.name, pr, 0644)
+		// Unblocks Read() if the cache stopped reading before the end of the content.
+		pr.CloseWithError(err)
+		if err != nil && !errors.Is(err, errIncomplete) {
+			f.Log.Printf("problem writing file to cache(%T): %s", f.cache, err)
+		}
+	}()
+}
+
+// tee writes the content read from storage to the cache fill. At io.EOF the fill is
+// completed if all of the file was read. On any other error the fill is aborted.
+func (b *backfillFile) tee(p []byte, err error) {
+	if len(p) > 0 {
+		if _, werr := b.pw.Write(p); werr != nil {
+			// The fill has failed, there is no reason to keep writing to it.
+			b.done = true
+			return
+		}
+		b.read += int64(len(p))
+	}
+
+	switch {
+	case err == io.EOF:
+		b.done = true
+		fi, serr := b.File.Stat()
+		if serr != nil || fi.Size() != b.read {
+			b.pw.CloseWithError(errIncomplete)
+			return
+		}
+		b.pw.Close()
+	case err != nil:
+		b.abort()
+	}
+}
+
+// abort stops a streaming fill, which causes the cache to discard the partial file.
+func (b *backfillFile) abort() {
+	b.done = true
+	if b.pw != nil {
+		b.pw.CloseWithError(errIncomplete)
+	}
+}
+
+// Seek implements io.Seeker if the file from storage does. Once called, the file will
+// not be written to the cache.
+func (b *backfillFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := b.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: b.name, Err: fmt.Errorf("%T does not support Seek()", b.File)}
+	}
+	b.abort()
+	b.buf = bytes.Buffer{}
+	return s.Seek(offset, whence)
+}
+
+// Close implements fs.File.Close(). If the file was not read to io.EOF, it is not written
+// to the cache.
+func (b *backfillFile) Close() error {
+	if !b.done {
+		b.abort()
+		b.buf = bytes.Buffer{}
+	}
+	return b.File.Close()
+}
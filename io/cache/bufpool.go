@@ -0,0 +1,48 @@
+package cache
+
+import "sync"
+
+// defaultMaxPooledSize is the default for BufferPool.MaxSize.
+const defaultMaxPooledSize = 1 << 20
+
+// BufferPool is a pool of buffers that a CacheFS can use for the content of files it reads,
+// instead of allocating a new buffer for every read. See redis.WithBufferPool() and
+// groupcache.WithBufferPool(). A BufferPool can be shared by multiple CacheFS and is safe
+// for concurrent use. The zero value is ready to use.
+type BufferPool struct {
+	// MaxSize is the largest capacity of a buffer that is kept for reuse. Larger buffers are
+	// left to the garbage collector, so that a few large files do not keep memory in use.
+	// Defaults to 1 MiB.
+	MaxSize int
+
+	pool sync.Pool
+}
+
+// Get returns a buffer with a length of size. Its content is undefined. The buffer should be
+// passed to Put() when it is no longer used. Pointers are used so that Put() does not allocate.
+func (p *BufferPool) Get(size int) *[]byte {
+	b, ok := p.pool.Get().(*[]byte)
+	if !ok {
+		b = new([]byte)
+	}
+	if cap(*b) < size {
+		*b = make([]byte, size)
+	}
+	*b = (*b)[:size]
+	return b
+}
+
+// Put returns b to the pool. b must not be used after this.
+func (p *BufferPool) Put(b *[]byte) {
+	if b == nil {
+		return
+	}
+	max := p.MaxSize
+	if max <= 0 {
+		max = defaultMaxPooledSize
+	}
+	if cap(*b) > max {
+		return
+	}
+	p.pool.Put(b)
+}
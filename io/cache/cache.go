@@ -83,17 +83,28 @@ Get a file from our cache:
 package cache
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	jsfs "github.com/gopherfs/fs"
+	"golang.org/x/sync/singleflight"
 )
 
-// Simply here to make sure our FS implements CacheFS.
-var _ CacheFS = &FS{}
+// Simply here to make sure our FS implements these interfaces.
+var (
+	_ CacheFS       = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+	_ HealthChecker = &FS{}
+)
 
 var inTest bool
 
@@ -110,6 +121,13 @@ type CacheFS interface {
 	fs.StatFS
 }
 
+// CacheFSContext is a CacheFS that can read a file with a Context. This allows a read to be
+// canceled and to respect the deadline of the request that caused it, such as a groupcache fill.
+type CacheFSContext interface {
+	CacheFS
+	ReadFileContext(ctx context.Context, name string) ([]byte, error)
+}
+
 // SetFiller provides a function for setting a jsfs.Writer implementaiton that
 // does cache fills on misses. Some CacheFS implementation need this because they
 // support automatic cache fill mechanisms instead of just Getter()/Setter() methods.
@@ -117,6 +135,26 @@ type SetFiller interface {
 	SetFiller(fsys CacheFS)
 }
 
+// HealthChecker is implemented by a CacheFS that can check that its backend can be reached,
+// such as for readiness probes.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Clock provides the current time to a CacheFS that expires files. Tests can provide a Clock
+// that they advance to test expiration without sleeping. See disk.WithClock().
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is a Clock that returns time.Now(). It is the default Clock.
+type RealClock struct{}
+
+// Now implements Clock.Now().
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
 // FS implemenents io/fs.FS to provide a cache reader and writer.
 type FS struct {
 	cache, store CacheFS
@@ -129,31 +167,134 @@ type FS struct {
 	// This is only set during testing and exists due to the lack of Context on
 	// the interfaces.
 	FilledBy string
+
+	// storeReads deduplicates concurrent ReadFile() calls to store for the same file.
+	storeReads singleflight.Group
+	// fillMu protects FilledBy.
+	fillMu sync.Mutex
+	// fills tracks backfill goroutines that have not finished. See Wait().
+	fills sync.WaitGroup
+	// fillSem limits the number of backfill goroutines if WithMaxFillWorkers() was used.
+	fillSem chan struct{}
+
+	// negative holds names that were not found, if WithNegativeCache() was used.
+	negative *negativeCache
+
+	// openBackfill is set by WithOpenBackfill().
+	openBackfill bool
+
+	// written holds hashes of content written to storage, if WithSkipUnchanged() was used.
+	written *writtenHashes
+
+	// writePolicy is set by WithWritePolicy().
+	writePolicy WritePolicy
+	// writeBacks holds the writes to storage queued by the WriteBack policy.
+	writeBacks writeBackQueue
+
+	// tracer is set by WithTracer(). cacheType and storeType are the types of the
+	// layers used as span attributes and are only set if tracer is set.
+	tracer               Tracer
+	cacheType, storeType string
 }
 
-// New is the constructor for FS.
-func New(cache CacheFS, store CacheFS) (*FS, error) {
-	if v, ok := cache.(SetFiller); ok {
-		v.SetFiller(store)
+// Option is an optional argument to New().
+type Option func(f *FS) error
+
+// WithNegativeCache causes ReadFile() to remember names that were not found in storage
+// for ttl. During that time, ReadFile() for the name returns fs.ErrNotExist without
+// querying the cache or storage. WriteFile() on the FS removes the name from the negative cache,
+// but files written directly to storage will not be seen until ttl expires.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(f *FS) error {
+		if ttl <= 0 {
+			return fmt.Errorf("WithNegativeCache(ttl: %v) must have ttl > 0", ttl)
+		}
+		f.negative = newNegativeCache(ttl)
+		return nil
+	}
+}
+
+// WithOpenBackfill causes files that Open() reads from storage to be written to the cache
+// once they have been read to io.EOF, like ReadFile() does. If the cache implements
+// jsfs.StreamWriter, the content is streamed to WriteFileFrom() as it is read, so reads from
+// storage are slowed to the speed of the cache. Otherwise the file's content is buffered in
+// memory while it is read. Files that are only partially read, that fail to read, that have
+// Seek() called on them or are closed before io.EOF are not written to the cache. Files
+// returned by Open() from storage then only support the fs.File methods and Seek().
+func WithOpenBackfill() Option {
+	return func(f *FS) error {
+		f.openBackfill = true
+		return nil
+	}
+}
+
+// WithMaxFillWorkers limits the number of cache fills that can run at the same time to n.
+// When n fills are running, fills for further cache misses are dropped instead of queued,
+// so a burst of misses cannot build up an unbounded backlog of writes to the cache. Those
+// files are read from storage again on their next miss. By default the number of fills is not limited.
+func WithMaxFillWorkers(n int) Option {
+	return func(f *FS) error {
+		if n < 1 {
+			return fmt.Errorf("WithMaxFillWorkers(%d) must have n > 0", n)
+		}
+		f.fillSem = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// WithSkipUnchanged causes WriteFile() to skip writing to storage when the content is the same
+// as the content last written for that name by this FS, which saves requests to expensive
+// storage such as blob storage. The content is still written to the cache layer. A SHA-256 hash
+// of the content written for every name is kept in memory. Files changed in storage by anything
+// other than this FS are not detected, so only use this when this FS is the only writer.
+func WithSkipUnchanged() Option {
+	return func(f *FS) error {
+		f.written = newWrittenHashes()
+		return nil
 	}
+}
 
-	return &FS{
+// New is the constructor for FS.
+func New(cache CacheFS, store CacheFS, options ...Option) (*FS, error) {
+	f := &FS{
 		cache: cache,
 		store: store,
 		Log:   log.New(os.Stderr, "", log.LstdFlags),
-	}, nil
+	}
+	for _, o := range options {
+		if err := o(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.tracer != nil {
+		f.cacheType = fmt.Sprintf("%T", cache)
+		f.storeType = fmt.Sprintf("%T", store)
+	}
+
+	if v, ok := cache.(SetFiller); ok {
+		v.SetFiller(store)
+	}
+	return f, nil
 }
 
 // Open opens a file for reading. The file will be served out of cache to start
 // and if not available it will be served out of storage. Using Open() does NOT
-// cause a non-cached file to be cache.
+// cause a non-cached file to be cache, unless WithOpenBackfill() is used.
 func (f *FS) Open(name string) (fs.File, error) {
 	file, err := f.cache.Open(name)
 	if err == nil {
 		return file, nil
 	}
 
-	return f.store.Open(name)
+	file, err = f.store.Open(name)
+	if err != nil || !f.openBackfill {
+		return file, err
+	}
+	if fi, err := file.Stat(); err != nil || fi.IsDir() {
+		return file, nil
+	}
+	return newBackfillFile(f, file, name), nil
 }
 
 // OpenFile implements fs.OpenFiler.OpenFile(). This pulls from the storage FS and therefore you pass
@@ -166,31 +307,113 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 // ReadFile reads a file. This checks the cache first and then checks storage.
 // If the file is found in storage, a call to the cache's WriteFile() is made
 // in a separate go routine so that it is served out of cache in the future.
-func (f *FS) ReadFile(name string) ([]byte, error) {
-	b, err := f.cache.ReadFile(name)
+// Use Wait() or Flush() to wait for that write to complete.
+// Concurrent cache misses for the same name share a single read from storage
+// (and a single cache fill), so those callers receive the same []byte and must
+// not modify it. Errors from storage are not cached.
+func (f *FS) ReadFile(name string) (b []byte, err error) {
+	ctx, span := f.startSpan(context.Background(), SpanReadFile)
+	defer func() { span.End(err) }()
+	span.SetAttribute(AttrName, name)
+
+	if f.negative != nil && f.negative.has(name) {
+		span.SetAttribute(AttrResult, ResultMiss)
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+
+	cacheSpan := f.startLayerSpan(ctx, f.cacheType)
+	b, err = f.cache.ReadFile(name)
+	endLayerSpan(cacheSpan, err)
 	if err == nil {
+		span.SetAttribute(AttrResult, ResultHit)
 		f.recordFill(f.cache)
 		return b, nil
 	}
+	span.SetAttribute(AttrResult, ResultMiss)
 
-	b, err = f.store.ReadFile(name)
+	v, err, _ := f.storeReads.Do(name, func() (interface{}, error) {
+		var gen uint64
+		if f.negative != nil {
+			gen = f.negative.generation()
+		}
+
+		storeSpan := f.startLayerSpan(ctx, f.storeType)
+		b, err := f.store.ReadFile(name)
+		endLayerSpan(storeSpan, err)
+		if err != nil {
+			if f.negative != nil && errors.Is(err, fs.ErrNotExist) {
+				f.negative.add(name, gen)
+			}
+			return nil, err
+		}
+		f.recordFill(f.store)
+
+		f.backfill(name, b)
+		return b, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	f.recordFill(f.store)
+	return v.([]byte), nil
+}
 
-	go func() {
-		if err := f.cache.WriteFile(name, b, 0644); err != nil {
-			f.Log.Printf("problem writing file to cache(%T): %s", f.cache, err)
+// WriteFile implememnts jsfs.Writer.WriteFile(). Which layers are written depends on the
+// WritePolicy, see WithWritePolicy(). If WithSkipUnchanged() was used and content has not
+// changed, content is written to the cache instead of storage.
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) (err error) {
+	_, span := f.startSpan(context.Background(), SpanWriteFile)
+	defer func() { span.End(err) }()
+	span.SetAttribute(AttrName, name)
+
+	if f.negative != nil {
+		defer f.negative.remove(name)
+	}
+
+	switch f.writePolicy {
+	case WriteThrough:
+		span.SetAttribute(AttrLayer, f.storeType)
+		if _, err := f.writeStore(name, content, perm); err != nil {
+			return err
 		}
-	}()
+		if err := f.cache.WriteFile(name, content, perm); err != nil {
+			return fmt.Errorf("file(%s) was written to storage, but not to cache(%T): %w", name, f.cache, err)
+		}
+		return nil
+	case WriteBack:
+		span.SetAttribute(AttrLayer, f.cacheType)
+		if err := f.cache.WriteFile(name, content, perm); err != nil {
+			return err
+		}
+		// The caller can change content once we return.
+		f.writeBack(name, append([]byte(nil), content...), perm)
+		return nil
+	}
 
-	return b, nil
+	skipped, err := f.writeStore(name, content, perm)
+	if skipped {
+		span.SetAttribute(AttrLayer, f.cacheType)
+		return f.cache.WriteFile(name, content, perm)
+	}
+	span.SetAttribute(AttrLayer, f.storeType)
+	return err
 }
 
-// WriteFile implememnts jsfs.Writer.WriteFile().
-func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
-	return f.store.WriteFile(name, content, perm)
+// writeStore writes content to storage. If WithSkipUnchanged() was used and content has not
+// changed, nothing is written and skipped is true.
+func (f *FS) writeStore(name string, content []byte, perm fs.FileMode) (skipped bool, err error) {
+	if f.written == nil {
+		return false, f.store.WriteFile(name, content, perm)
+	}
+
+	sum := sha256.Sum256(content)
+	if f.written.unchanged(name, sum) {
+		return true, nil
+	}
+
+	f.written.start(name)
+	err = f.store.WriteFile(name, content, perm)
+	f.written.done(name, sum, err == nil)
+	return false, err
 }
 
 // Stat implememnts fs.StatFS.Stat().
@@ -202,15 +425,111 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 	return f.store.Stat(name)
 }
 
+// Wait blocks until all cache fills started by this FS have completed, as well as writes to
+// storage queued by the WriteBack policy. Fills and writes started while Wait() is blocked may
+// or may not be waited for. A streaming fill from a file returned by Open() completes when
+// the file is read to io.EOF or closed.
+func (f *FS) Wait() {
+	f.fills.Wait()
+	f.writeBacks.wg.Wait()
+}
+
+// Flush is like Wait(), but also waits on cache fills in the cache and storage layers
+// if they are an *FS. When Flush() returns after a ReadFile(), the file is in every cache layer.
+func (f *FS) Flush() {
+	for _, layer := range []CacheFS{f.cache, f.store} {
+		if v, ok := layer.(*FS); ok {
+			v.Flush()
+		}
+	}
+	f.Wait()
+}
+
+// HealthCheck implements HealthChecker. It checks the cache and then the storage layer if they
+// implement HealthChecker and returns the first error. Layers that do not are assumed healthy.
+// As FS implements HealthChecker, multi-level caches check every layer.
+func (f *FS) HealthCheck(ctx context.Context) error {
+	if v, ok := f.cache.(HealthChecker); ok {
+		if err := v.HealthCheck(ctx); err != nil {
+			return fmt.Errorf("cache layer(%T) is unhealthy: %w", f.cache, err)
+		}
+	}
+	if v, ok := f.store.(HealthChecker); ok {
+		if err := v.HealthCheck(ctx); err != nil {
+			return fmt.Errorf("storage layer(%T) is unhealthy: %w", f.store, err)
+		}
+	}
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir(). The entries are the union of the directory in the
+// cache and storage, sorted by name, so that fs.WalkDir() sees files that are only in storage.
+// If both have an entry with the same name, the cache's entry is used. Layers that cannot read
+// directories, such as some caches, are skipped as long as the other layer can read it.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var out []fs.DirEntry
+	var lastErr error
+	found := false
+	for _, layer := range []CacheFS{f.cache, f.store} {
+		entries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+		for _, e := range entries {
+			if seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			out = append(out, e)
+		}
+	}
+	if !found {
+		return nil, lastErr
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// backfill writes content to the cache in a separate goroutine.
+// If WithMaxFillWorkers() was used and all workers are busy, the fill is dropped.
+func (f *FS) backfill(name string, content []byte) {
+	if f.fillSem != nil {
+		select {
+		case f.fillSem <- struct{}{}:
+		default:
+			return
+		}
+	}
+
+	f.fills.Add(1)
+	go func() {
+		defer f.fills.Done()
+		if f.fillSem != nil {
+			defer func() { <-f.fillSem }()
+		}
+		if err := f.cache.WriteFile(name, content, 0644); err != nil {
+			f.Log.Printf("problem writing file to cache(%T): %s", f.cache, err)
+		}
+	}()
+}
+
 func (f *FS) recordFill(s CacheFS) {
 	if !inTest {
 		return
 	}
 
+	filledBy := fmt.Sprintf("%T", s)
 	if v, ok := s.(*FS); ok {
-		f.FilledBy = v.FilledBy
-		return
+		v.fillMu.Lock()
+		filledBy = v.FilledBy
+		v.fillMu.Unlock()
 	}
 
-	f.FilledBy = fmt.Sprintf("%T", s)
+	f.fillMu.Lock()
+	f.FilledBy = filledBy
+	f.fillMu.Unlock()
 }
@@ -0,0 +1,939 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// lockedFS is a CacheFS that wraps a simple.FS so that it can be read while it is
+// being written to by a cache fill.
+type lockedFS struct {
+	mu  sync.RWMutex
+	mem *simple.FS
+}
+
+func newLockedFS() *lockedFS {
+	return &lockedFS{mem: simple.New()}
+}
+
+func (l *lockedFS) Open(name string) (fs.File, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mem.Open(name)
+}
+
+func (l *lockedFS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mem.OpenFile(name, perm, options...)
+}
+
+func (l *lockedFS) ReadFile(name string) ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mem.ReadFile(name)
+}
+
+func (l *lockedFS) Stat(name string) (fs.FileInfo, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mem.Stat(name)
+}
+
+func (l *lockedFS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mem.WriteFile(name, content, perm)
+}
+
+// countingStore is a CacheFS that counts calls to ReadFile(). If gate is not nil,
+// ReadFile() blocks until gate is closed.
+type countingStore struct {
+	*simple.FS
+
+	reads int32
+	gate  chan struct{}
+}
+
+func (c *countingStore) ReadFile(name string) ([]byte, error) {
+	atomic.AddInt32(&c.reads, 1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	return c.FS.ReadFile(name)
+}
+
+func TestReadFileSingleFlight(t *testing.T) {
+	const readers = 100
+
+	store := &countingStore{FS: simple.New(), gate: make(chan struct{})}
+	if err := store.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	c, err := New(newLockedFS(), store)
+	if err != nil {
+		panic(err)
+	}
+
+	started := sync.WaitGroup{}
+	done := sync.WaitGroup{}
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			started.Done()
+			b, err := c.ReadFile("file")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(b) != "content" {
+				t.Errorf("TestReadFileSingleFlight: got content %q, want %q", b, "content")
+			}
+		}()
+	}
+	started.Wait()
+	// Give the readers time to block on the in flight store read.
+	time.Sleep(100 * time.Millisecond)
+	close(store.gate)
+	done.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("TestReadFileSingleFlight: got err == %s, want err == nil", err)
+	}
+	if got := atomic.LoadInt32(&store.reads); got != 1 {
+		t.Errorf("TestReadFileSingleFlight: store was read %d times, want 1", got)
+	}
+}
+
+func TestReadFileErrorNotCached(t *testing.T) {
+	store := &countingStore{FS: simple.New()}
+
+	c, err := New(newLockedFS(), store)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := c.ReadFile("file"); err == nil {
+		t.Fatalf("TestReadFileErrorNotCached: got err == nil, want err != nil")
+	}
+
+	if err := store.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	b, err := c.ReadFile("file")
+	if err != nil {
+		t.Fatalf("TestReadFileErrorNotCached: got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestReadFileErrorNotCached: got content %q, want %q", b, "content")
+	}
+	if got := atomic.LoadInt32(&store.reads); got != 2 {
+		t.Errorf("TestReadFileErrorNotCached: store was read %d times, want 2", got)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	const ttl = time.Minute
+
+	store := &countingStore{FS: simple.New()}
+	c, err := New(newLockedFS(), store, WithNegativeCache(ttl))
+	if err != nil {
+		panic(err)
+	}
+	now := time.Now()
+	c.negative.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("TestNegativeCache(read %d): got err == %v, want fs.ErrNotExist", i, err)
+		}
+	}
+	if got := atomic.LoadInt32(&store.reads); got != 1 {
+		t.Errorf("TestNegativeCache(within ttl): store was read %d times, want 1", got)
+	}
+
+	now = now.Add(ttl)
+	for i := 0; i < 3; i++ {
+		c.ReadFile("missing")
+	}
+	if got := atomic.LoadInt32(&store.reads); got != 2 {
+		t.Errorf("TestNegativeCache(after ttl): store was read %d times, want 2", got)
+	}
+
+	if err := c.WriteFile("missing", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	b, err := c.ReadFile("missing")
+	if err != nil {
+		t.Fatalf("TestNegativeCache(after WriteFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestNegativeCache(after WriteFile): got content %q, want %q", b, "content")
+	}
+
+	if _, err := New(newLockedFS(), store, WithNegativeCache(0)); err == nil {
+		t.Errorf("TestNegativeCache(ttl 0): got err == nil, want err != nil")
+	}
+}
+
+type fakeSpanKey struct{}
+
+type fakeSpan struct {
+	name   string
+	parent string
+	attrs  map[string]string
+	ended  bool
+	err    error
+}
+
+func (s *fakeSpan) SetAttribute(key, value string) {
+	s.attrs[key] = value
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+// fakeTracer records all spans it starts.
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (f *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := &fakeSpan{name: name, attrs: map[string]string{}}
+	if p, ok := ctx.Value(fakeSpanKey{}).(*fakeSpan); ok {
+		s.parent = p.name
+	}
+	f.spans = append(f.spans, s)
+	return context.WithValue(ctx, fakeSpanKey{}, s), s
+}
+
+func TestTracer(t *testing.T) {
+	cacheLayer := newLockedFS()
+	store := simple.New()
+	if err := store.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	if err := cacheLayer.WriteFile("cached", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	const (
+		cacheType = "*cache.lockedFS"
+		storeType = "*simple.FS"
+	)
+
+	tests := []struct {
+		desc    string
+		name    string
+		write   bool
+		wantErr bool
+		want    []fakeSpan
+	}{
+		{
+			desc: "hit",
+			name: "cached",
+			want: []fakeSpan{
+				{name: SpanReadFile, attrs: map[string]string{AttrName: "cached", AttrResult: ResultHit}},
+				{name: SpanLayerReadFile, parent: SpanReadFile, attrs: map[string]string{AttrLayer: cacheType, AttrResult: ResultHit}},
+			},
+		},
+		{
+			desc: "miss",
+			name: "file",
+			want: []fakeSpan{
+				{name: SpanReadFile, attrs: map[string]string{AttrName: "file", AttrResult: ResultMiss}},
+				{name: SpanLayerReadFile, parent: SpanReadFile, attrs: map[string]string{AttrLayer: cacheType, AttrResult: ResultMiss}},
+				{name: SpanLayerReadFile, parent: SpanReadFile, attrs: map[string]string{AttrLayer: storeType, AttrResult: ResultHit}},
+			},
+		},
+		{
+			desc:    "not found",
+			name:    "missing",
+			wantErr: true,
+			want: []fakeSpan{
+				{name: SpanReadFile, attrs: map[string]string{AttrName: "missing", AttrResult: ResultMiss}},
+				{name: SpanLayerReadFile, parent: SpanReadFile, attrs: map[string]string{AttrLayer: cacheType, AttrResult: ResultMiss}},
+				{name: SpanLayerReadFile, parent: SpanReadFile, attrs: map[string]string{AttrLayer: storeType, AttrResult: ResultMiss}},
+			},
+		},
+		{
+			desc:  "write",
+			name:  "written",
+			write: true,
+			want: []fakeSpan{
+				{name: SpanWriteFile, attrs: map[string]string{AttrName: "written", AttrLayer: storeType}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		tracer := &fakeTracer{}
+		c, err := New(cacheLayer, store, WithTracer(tracer))
+		if err != nil {
+			panic(err)
+		}
+
+		if test.write {
+			err = c.WriteFile(test.name, []byte("content"), 0644)
+		} else {
+			_, err = c.ReadFile(test.name)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("TestTracer(%s): got err == %v, want err != nil == %v", test.desc, err, test.wantErr)
+			continue
+		}
+
+		tracer.mu.Lock()
+		if len(tracer.spans) != len(test.want) {
+			t.Errorf("TestTracer(%s): got %d spans, want %d", test.desc, len(tracer.spans), len(test.want))
+			tracer.mu.Unlock()
+			continue
+		}
+		for i, got := range tracer.spans {
+			want := test.want[i]
+			if got.name != want.name || got.parent != want.parent {
+				t.Errorf("TestTracer(%s): span %d: got name %q, parent %q, want name %q, parent %q", test.desc, i, got.name, got.parent, want.name, want.parent)
+			}
+			if diff := pretty.Compare(want.attrs, got.attrs); diff != "" {
+				t.Errorf("TestTracer(%s): span %d(%s): attributes -want/+got:\n%s", test.desc, i, got.name, diff)
+			}
+			if !got.ended {
+				t.Errorf("TestTracer(%s): span %d(%s) was not ended", test.desc, i, got.name)
+			}
+		}
+		if test.wantErr && tracer.spans[0].err == nil {
+			t.Errorf("TestTracer(%s): top span was not ended with the error", test.desc)
+		}
+		tracer.mu.Unlock()
+	}
+}
+
+func TestOpenBackfill(t *testing.T) {
+	content := []byte("content")
+
+	tests := []struct {
+		desc     string
+		options  []Option
+		read     func(f fs.File) error
+		wantFill bool
+	}{
+		{
+			desc:     "full read",
+			options:  []Option{WithOpenBackfill()},
+			read:     func(f fs.File) error { _, err := io.ReadAll(f); return err },
+			wantFill: true,
+		},
+		{
+			desc:    "partial read",
+			options: []Option{WithOpenBackfill()},
+			read:    func(f fs.File) error { _, err := f.Read(make([]byte, 3)); return err },
+		},
+		{
+			desc: "without option",
+			read: func(f fs.File) error { _, err := io.ReadAll(f); return err },
+		},
+	}
+
+	for _, test := range tests {
+		cacheLayer := newLockedFS()
+		store := simple.New()
+		if err := store.WriteFile("file", content, 0644); err != nil {
+			panic(err)
+		}
+		c, err := New(cacheLayer, store, test.options...)
+		if err != nil {
+			panic(err)
+		}
+
+		f, err := c.Open("file")
+		if err != nil {
+			t.Fatalf("TestOpenBackfill(%s): Open() got err == %s, want err == nil", test.desc, err)
+		}
+		if err := test.read(f); err != nil {
+			t.Fatalf("TestOpenBackfill(%s): read got err == %s, want err == nil", test.desc, err)
+		}
+		f.Close()
+
+		// The cache is backfilled in the background.
+		var got []byte
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if got, err = cacheLayer.ReadFile("file"); err == nil {
+				break
+			}
+		}
+		switch {
+		case test.wantFill && err != nil:
+			t.Errorf("TestOpenBackfill(%s): file was not written to the cache", test.desc)
+		case test.wantFill && string(got) != string(content):
+			t.Errorf("TestOpenBackfill(%s): got cached content %q, want %q", test.desc, got, content)
+		case !test.wantFill && err == nil:
+			t.Errorf("TestOpenBackfill(%s): file was written to the cache", test.desc)
+		}
+	}
+}
+
+// streamFS is a lockedFS that implements jsfs.StreamWriter. It reads from the io.Reader
+// passed to WriteFileFrom() with a countingReader and only writes the file if reading
+// succeeds.
+type streamFS struct {
+	*lockedFS
+
+	mu sync.Mutex
+	// maxRead is the most bytes returned by a single Read() from the io.Reader.
+	maxRead int
+}
+
+func (s *streamFS) WriteFileFrom(name string, r io.Reader, perm fs.FileMode) error {
+	cr := &countingReader{r: r}
+	b, err := io.ReadAll(cr)
+
+	s.mu.Lock()
+	if cr.max > s.maxRead {
+		s.maxRead = cr.max
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return s.lockedFS.WriteFile(name, b, perm)
+}
+
+// countingReader records the most bytes returned by a single Read().
+type countingReader struct {
+	r   io.Reader
+	max int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > c.max {
+		c.max = n
+	}
+	return n, err
+}
+
+func TestOpenBackfillStream(t *testing.T) {
+	const (
+		size    = 8 << 20
+		bufSize = 32 << 10
+	)
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	tests := []struct {
+		desc     string
+		read     func(f fs.File) error
+		wantFill bool
+	}{
+		{
+			desc: "full read",
+			read: func(f fs.File) error {
+				_, err := io.CopyBuffer(io.Discard, struct{ io.Reader }{f}, make([]byte, bufSize))
+				return err
+			},
+			wantFill: true,
+		},
+		{
+			desc: "partial read",
+			read: func(f fs.File) error { _, err := io.ReadFull(f, make([]byte, bufSize)); return err },
+		},
+		{
+			desc: "seek after read",
+			read: func(f fs.File) error {
+				if _, err := io.ReadFull(f, make([]byte, bufSize)); err != nil {
+					return err
+				}
+				if _, err := f.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := io.ReadAll(f)
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		cacheLayer := &streamFS{lockedFS: newLockedFS()}
+		store := simple.New()
+		if err := store.WriteFile("file", content, 0644); err != nil {
+			panic(err)
+		}
+		c, err := New(cacheLayer, store, WithOpenBackfill())
+		if err != nil {
+			panic(err)
+		}
+
+		f, err := c.Open("file")
+		if err != nil {
+			t.Fatalf("TestOpenBackfillStream(%s): Open() got err == %s, want err == nil", test.desc, err)
+		}
+		if err := test.read(f); err != nil {
+			t.Fatalf("TestOpenBackfillStream(%s): read got err == %s, want err == nil", test.desc, err)
+		}
+		if n := f.(*backfillFile).buf.Cap(); n != 0 {
+			t.Errorf("TestOpenBackfillStream(%s): file buffered %d bytes, want 0", test.desc, n)
+		}
+		f.Close()
+		c.Wait()
+
+		if cacheLayer.maxRead > bufSize {
+			t.Errorf("TestOpenBackfillStream(%s): cache read %d bytes at once, want <= %d", test.desc, cacheLayer.maxRead, bufSize)
+		}
+		got, err := cacheLayer.ReadFile("file")
+		switch {
+		case test.wantFill && err != nil:
+			t.Errorf("TestOpenBackfillStream(%s): file was not written to the cache", test.desc)
+		case test.wantFill && string(got) != string(content):
+			t.Errorf("TestOpenBackfillStream(%s): cached content does not match storage (%d bytes, want %d)", test.desc, len(got), len(content))
+		case !test.wantFill && err == nil:
+			t.Errorf("TestOpenBackfillStream(%s): partially read file was written to the cache", test.desc)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	diskLayer := newLockedFS()
+	store := simple.New()
+	if err := store.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	lower, err := New(diskLayer, store)
+	if err != nil {
+		panic(err)
+	}
+
+	memLayer := newLockedFS()
+	upper, err := New(memLayer, lower)
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := upper.ReadFile("file"); err != nil {
+		t.Fatalf("TestFlush: got err == %s, want err == nil", err)
+	}
+	upper.Flush()
+
+	for _, layer := range []*lockedFS{memLayer, diskLayer} {
+		b, err := layer.ReadFile("file")
+		if err != nil {
+			t.Fatalf("TestFlush: file was not in cache layer after Flush(): %s", err)
+		}
+		if string(b) != "content" {
+			t.Errorf("TestFlush: got cached content %q, want %q", b, "content")
+		}
+	}
+}
+
+// slowFillFS is a CacheFS that records the maximum number of concurrent WriteFile() calls.
+type slowFillFS struct {
+	*lockedFS
+
+	active, max, writes int32
+}
+
+func (s *slowFillFS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	n := atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+	for {
+		m := atomic.LoadInt32(&s.max)
+		if n <= m || atomic.CompareAndSwapInt32(&s.max, m, n) {
+			break
+		}
+	}
+	atomic.AddInt32(&s.writes, 1)
+	time.Sleep(10 * time.Millisecond)
+	return s.lockedFS.WriteFile(name, content, perm)
+}
+
+func TestMaxFillWorkers(t *testing.T) {
+	const (
+		workers = 3
+		misses  = 100
+	)
+
+	store := simple.New()
+	for i := 0; i < misses; i++ {
+		if err := store.WriteFile(fmt.Sprintf("file%d", i), []byte("content"), 0644); err != nil {
+			panic(err)
+		}
+	}
+	cacheLayer := &slowFillFS{lockedFS: newLockedFS()}
+
+	c, err := New(cacheLayer, store, WithMaxFillWorkers(workers))
+	if err != nil {
+		panic(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < misses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := c.ReadFile(fmt.Sprintf("file%d", i)); err != nil {
+				t.Errorf("TestMaxFillWorkers: got err == %s, want err == nil", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.Wait()
+
+	if got := atomic.LoadInt32(&cacheLayer.max); got > workers {
+		t.Errorf("TestMaxFillWorkers: got %d concurrent fills, want <= %d", got, workers)
+	}
+	if got := atomic.LoadInt32(&cacheLayer.writes); got == 0 || got > misses {
+		t.Errorf("TestMaxFillWorkers: got %d fills, want between 1 and %d", got, misses)
+	}
+
+	if _, err := New(cacheLayer, store, WithMaxFillWorkers(0)); err == nil {
+		t.Errorf("TestMaxFillWorkers(0): got err == nil, want err != nil")
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	store := simple.New()
+	for _, name := range []string{"dir/a", "dir/b", "top"} {
+		if err := store.WriteFile(name, []byte(name), 0644); err != nil {
+			panic(err)
+		}
+	}
+	cacheWithDirs := simple.New()
+	for _, name := range []string{"dir/a", "cacheonly/c"} {
+		if err := cacheWithDirs.WriteFile(name, []byte(name), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	tests := []struct {
+		desc  string
+		cache CacheFS
+		want  []string
+	}{
+		{
+			desc:  "cache without ReadDir",
+			cache: newLockedFS(),
+			want:  []string{"dir/a", "dir/b", "top"},
+		},
+		{
+			desc:  "union of cache and store",
+			cache: cacheWithDirs,
+			want:  []string{"cacheonly/c", "dir/a", "dir/b", "top"},
+		},
+	}
+
+	for _, test := range tests {
+		c, err := New(test.cache, store)
+		if err != nil {
+			panic(err)
+		}
+
+		var got []string
+		err = fs.WalkDir(c, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				got = append(got, p)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("TestReadDir(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestReadDir(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	c, err := New(newLockedFS(), store)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := c.ReadDir("missing"); err == nil {
+		t.Errorf("TestReadDir(missing): got err == nil, want err != nil")
+	}
+}
+
+// healthFS is a CacheFS that implements HealthChecker.
+type healthFS struct {
+	*lockedFS
+	err error
+}
+
+func (h healthFS) HealthCheck(ctx context.Context) error {
+	return h.err
+}
+
+func TestHealthCheck(t *testing.T) {
+	errDown := errors.New("down")
+
+	tests := []struct {
+		desc         string
+		cache, store CacheFS
+		wantErr      error
+	}{
+		{desc: "layers without HealthCheck", cache: newLockedFS(), store: newLockedFS()},
+		{desc: "healthy layers", cache: healthFS{lockedFS: newLockedFS()}, store: healthFS{lockedFS: newLockedFS()}},
+		{desc: "unhealthy cache", cache: healthFS{lockedFS: newLockedFS(), err: errDown}, store: newLockedFS(), wantErr: errDown},
+		{desc: "unhealthy store", cache: newLockedFS(), store: healthFS{lockedFS: newLockedFS(), err: errDown}, wantErr: errDown},
+	}
+
+	for _, test := range tests {
+		c, err := New(test.cache, test.store)
+		if err != nil {
+			panic(err)
+		}
+		// Wrap in another layer to check that nested FS layers are checked.
+		top, err := New(newLockedFS(), c)
+		if err != nil {
+			panic(err)
+		}
+
+		err = top.HealthCheck(context.Background())
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("TestHealthCheck(%s): got err == %s, want err == nil", test.desc, err)
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("TestHealthCheck(%s): got err == %v, want %v", test.desc, err, test.wantErr)
+		}
+	}
+}
+
+// mapFS is a CacheFS that allows files to be overwritten and counts calls to WriteFile().
+type mapFS struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	writes int
+}
+
+func newMapFS() *mapFS {
+	return &mapFS{files: map[string][]byte{}}
+}
+
+func (m *mapFS) Open(name string) (fs.File, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mapFS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mapFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return b, nil
+}
+
+func (m *mapFS) Stat(name string) (fs.FileInfo, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mapFS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writes++
+	m.files[name] = append([]byte{}, content...)
+	return nil
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	cache := newMapFS()
+	store := newMapFS()
+
+	c, err := New(cache, store, WithSkipUnchanged())
+	if err != nil {
+		panic(err)
+	}
+
+	writes := []struct {
+		desc            string
+		content         string
+		wantStoreWrites int
+		wantCacheWrites int
+	}{
+		{desc: "first write", content: "v1", wantStoreWrites: 1},
+		{desc: "same content", content: "v1", wantStoreWrites: 1, wantCacheWrites: 1},
+		{desc: "changed content", content: "v2", wantStoreWrites: 2, wantCacheWrites: 1},
+		{desc: "changed back", content: "v1", wantStoreWrites: 3, wantCacheWrites: 1},
+		{desc: "same content again", content: "v1", wantStoreWrites: 3, wantCacheWrites: 2},
+	}
+
+	for _, w := range writes {
+		if err := c.WriteFile("file", []byte(w.content), 0644); err != nil {
+			t.Fatalf("TestSkipUnchanged(%s): got err == %s, want err == nil", w.desc, err)
+		}
+		if store.writes != w.wantStoreWrites {
+			t.Errorf("TestSkipUnchanged(%s): got %d store writes, want %d", w.desc, store.writes, w.wantStoreWrites)
+		}
+		if cache.writes != w.wantCacheWrites {
+			t.Errorf("TestSkipUnchanged(%s): got %d cache writes, want %d", w.desc, cache.writes, w.wantCacheWrites)
+		}
+		if b, _ := store.ReadFile("file"); string(b) != w.content {
+			t.Errorf("TestSkipUnchanged(%s): got store content %q, want %q", w.desc, b, w.content)
+		}
+	}
+
+	// Without the option, every write goes to storage.
+	store = newMapFS()
+	c, err = New(newMapFS(), store)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.WriteFile("file", []byte("v1"), 0644); err != nil {
+			panic(err)
+		}
+	}
+	if store.writes != 2 {
+		t.Errorf("TestSkipUnchanged(option not set): got %d store writes, want 2", store.writes)
+	}
+}
+
+// gatedFS is a mapFS whose writes block until gate is closed.
+type gatedFS struct {
+	*mapFS
+	gate chan struct{}
+}
+
+func (g *gatedFS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	<-g.gate
+	return g.mapFS.WriteFile(name, content, perm)
+}
+
+func TestWritePolicy(t *testing.T) {
+	tests := []struct {
+		desc   string
+		policy WritePolicy
+		// wantCache and wantStore are if the layer has the file when WriteFile() returns.
+		wantCache, wantStore bool
+	}{
+		{desc: "default", policy: WriteAround, wantStore: true},
+		{desc: "WriteAround", policy: WriteAround, wantStore: true},
+		{desc: "WriteThrough", policy: WriteThrough, wantCache: true, wantStore: true},
+		{desc: "WriteBack", policy: WriteBack, wantCache: true},
+	}
+
+	for _, test := range tests {
+		cacheLayer := newMapFS()
+		store := &gatedFS{mapFS: newMapFS(), gate: make(chan struct{})}
+		if test.policy != WriteBack {
+			close(store.gate)
+		}
+
+		var options []Option
+		if test.desc != "default" {
+			options = append(options, WithWritePolicy(test.policy))
+		}
+		c, err := New(cacheLayer, store, options...)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := c.WriteFile("file", []byte("content"), 0644); err != nil {
+			t.Fatalf("TestWritePolicy(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		_, err = cacheLayer.ReadFile("file")
+		if gotCache := err == nil; gotCache != test.wantCache {
+			t.Errorf("TestWritePolicy(%s): cache has file == %v, want %v", test.desc, gotCache, test.wantCache)
+		}
+		_, err = store.ReadFile("file")
+		if gotStore := err == nil; gotStore != test.wantStore {
+			t.Errorf("TestWritePolicy(%s): store has file == %v, want %v", test.desc, gotStore, test.wantStore)
+		}
+
+		if test.policy == WriteBack {
+			close(store.gate)
+			c.Wait()
+			if b, err := store.ReadFile("file"); err != nil || string(b) != "content" {
+				t.Errorf("TestWritePolicy(%s): after Wait() store has %q, %v, want %q", test.desc, b, err, "content")
+			}
+		}
+	}
+
+	if _, err := New(newMapFS(), newMapFS(), WithWritePolicy(WritePolicy(100))); err == nil {
+		t.Errorf("TestWritePolicy(invalid policy): got err == nil, want err != nil")
+	}
+}
+
+func TestWriteBackLatest(t *testing.T) {
+	cacheLayer := newMapFS()
+	store := &gatedFS{mapFS: newMapFS(), gate: make(chan struct{})}
+	c, err := New(cacheLayer, store, WithWritePolicy(WriteBack))
+	if err != nil {
+		panic(err)
+	}
+
+	// The first write is blocked in the store, the others are queued behind it.
+	for _, content := range []string{"v1", "v2", "v3"} {
+		if err := c.WriteFile("file", []byte(content), 0644); err != nil {
+			t.Fatalf("TestWriteBackLatest(%s): got err == %s, want err == nil", content, err)
+		}
+	}
+	if b, err := c.ReadFile("file"); err != nil || string(b) != "v3" {
+		t.Errorf("TestWriteBackLatest: ReadFile() before the store is written got %q, %v, want %q", b, err, "v3")
+	}
+
+	close(store.gate)
+	c.Wait()
+
+	if b, _ := store.ReadFile("file"); string(b) != "v3" {
+		t.Errorf("TestWriteBackLatest: store has %q, want %q", b, "v3")
+	}
+	// v1 may or may not have been written before v2 and v3 were queued, but v2 is always
+	// replaced by v3 while it waits.
+	if store.writes > 2 {
+		t.Errorf("TestWriteBackLatest: got %d store writes, want <= 2", store.writes)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	p := &BufferPool{MaxSize: 8}
+
+	for _, size := range []int{0, 4, 8, 2, 16} {
+		b := p.Get(size)
+		if len(*b) != size {
+			t.Errorf("TestBufferPool(Get(%d)): got len %d, want %d", size, len(*b), size)
+		}
+		p.Put(b)
+	}
+
+	large := p.Get(16)
+	p.Put(large)
+	if b := p.Get(0); b == large {
+		t.Errorf("TestBufferPool: got a buffer with cap %d > MaxSize back from the pool", cap(*b))
+	}
+
+	// Put() of nil is ignored.
+	p.Put(nil)
+}
@@ -0,0 +1,124 @@
+/*
+Package codec provides a typed wrapper around a cache.CacheFS that stores values as encoded
+files, so structured values can be cached without handling the encoding at each call.
+
+Example:
+
+	type User struct {
+		Name  string
+		Email string
+	}
+
+	users, err := codec.New[User](cacheFS, codec.JSON[User]{})
+	if err != nil {
+		// Do something
+	}
+
+	if err := users.Put("users/jdoe", User{Name: "John Doe", Email: "jdoe@example.com"}); err != nil {
+		// Do something
+	}
+
+	u, err := users.Get("users/jdoe")
+	if err != nil {
+		// Do something
+	}
+
+Other encodings, such as protocol buffers, can be used by implementing Codec.
+*/
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gopherfs/fs/io/cache"
+)
+
+// Codec encodes values of type T to bytes and decodes them back.
+type Codec[T any] interface {
+	// Marshal encodes v.
+	Marshal(v T) ([]byte, error)
+	// Unmarshal decodes b, which was encoded with Marshal().
+	Unmarshal(b []byte) (T, error)
+}
+
+// JSON is a Codec that uses encoding/json.
+type JSON[T any] struct{}
+
+// Marshal implements Codec.Marshal().
+func (JSON[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec.Unmarshal().
+func (JSON[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// Gob is a Codec that uses encoding/gob. Each value is encoded on its own, so the type
+// information is stored with every value.
+type Gob[T any] struct{}
+
+// Marshal implements Codec.Marshal().
+func (Gob[T]) Marshal(v T) ([]byte, error) {
+	buff := bytes.Buffer{}
+	if err := gob.NewEncoder(&buff).Encode(v); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// Unmarshal implements Codec.Unmarshal().
+func (Gob[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// Cache stores values of type T in a cache.CacheFS using a Codec.
+type Cache[T any] struct {
+	inner cache.CacheFS
+	codec Codec[T]
+}
+
+// New is the constructor for Cache. inner stores the encoded values.
+func New[T any](inner cache.CacheFS, codec Codec[T]) (*Cache[T], error) {
+	if inner == nil {
+		return nil, errors.New("codec.New(): inner cannot be nil")
+	}
+	if codec == nil {
+		return nil, errors.New("codec.New(): codec cannot be nil")
+	}
+	return &Cache[T]{inner: inner, codec: codec}, nil
+}
+
+// Get reads the file at name and decodes it. Errors from reading the file are returned
+// unchanged, so errors.Is(err, fs.ErrNotExist) can be used to detect a miss.
+func (c *Cache[T]) Get(name string) (T, error) {
+	b, err := c.inner.ReadFile(name)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := c.codec.Unmarshal(b)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("codec: could not decode file(%s): %w", name, err)
+	}
+	return v, nil
+}
+
+// Put encodes v and writes it to name with WriteFile(). Some CacheFS implementations
+// return fs.ErrExist if name already exists.
+func (c *Cache[T]) Put(name string, v T) error {
+	b, err := c.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("codec: could not encode file(%s): %w", name, err)
+	}
+	return c.inner.WriteFile(name, b, 0644)
+}
@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+type user struct {
+	Name   string
+	Age    int
+	Groups []string
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := user{Name: "John Doe", Age: 42, Groups: []string{"admin", "users"}}
+
+	tests := []struct {
+		desc  string
+		codec Codec[user]
+	}{
+		{desc: "JSON", codec: JSON[user]{}},
+		{desc: "Gob", codec: Gob[user]{}},
+	}
+
+	for _, test := range tests {
+		c, err := New[user](simple.New(), test.codec)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := c.Put("users/jdoe", want); err != nil {
+			t.Errorf("TestRoundTrip(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		got, err := c.Get("users/jdoe")
+		if err != nil {
+			t.Errorf("TestRoundTrip(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestRoundTrip(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	mem := simple.New()
+	if err := mem.WriteFile("bad", []byte("not json"), 0644); err != nil {
+		panic(err)
+	}
+
+	c, err := New[user](mem, JSON[user]{})
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := c.Get("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestGetErrors(missing): got err == %v, want fs.ErrNotExist", err)
+	}
+	if _, err := c.Get("bad"); err == nil {
+		t.Errorf("TestGetErrors(bad): got err == nil, want err != nil")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New[user](nil, JSON[user]{}); err == nil {
+		t.Errorf("TestNew(nil inner): got err == nil, want err != nil")
+	}
+	if _, err := New[user](simple.New(), nil); err == nil {
+		t.Errorf("TestNew(nil codec): got err == nil, want err != nil")
+	}
+}
@@ -0,0 +1,380 @@
+/*
+Package config builds a cache.FS from a declarative JSON description of its layers, so that
+a multi-level cache can be changed without changing code.
+
+Layers are listed from the first place a file is looked for to the storage that holds the
+source of truth. This config creates an in-memory cache that pulls from a disk cache which
+pulls from Redis which pulls from Azure Blob Storage:
+
+	{
+		"layers": [
+			{"type": "simple"},
+			{"type": "disk", "disk": {"expireFiles": "30m", "expireCheck": "1m"}},
+			{"type": "redis", "redis": {"addr": "127.0.0.1:6379", "expireFiles": "5m"}},
+			{"type": "blob", "blob": {"account": "myaccount", "container": "files"}}
+		]
+	}
+
+Load it with:
+
+	f, err := os.Open("cache.json")
+	if err != nil {
+		// Do something
+	}
+	defer f.Close()
+
+	cacheFS, err := config.FromConfig(f)
+	if err != nil {
+		// Do something
+	}
+
+Supported layer types are "simple", "os", "disk", "kv", "redis", "groupcache" and "blob".
+Layers such as "disk" and "kv" run goroutines to expire files for the life of the program.
+*/
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	gc "github.com/golang/groupcache"
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/cache/disk"
+	"github.com/gopherfs/fs/io/cache/groupcache"
+	"github.com/gopherfs/fs/io/cache/groupcache/peerpicker"
+	"github.com/gopherfs/fs/io/cache/kv"
+	"github.com/gopherfs/fs/io/cache/redis"
+	"github.com/gopherfs/fs/io/cloud/azure/blob"
+	"github.com/gopherfs/fs/io/cloud/azure/blob/auth/msi"
+	"github.com/gopherfs/fs/io/mem/simple"
+	osfs "github.com/gopherfs/fs/io/os"
+)
+
+// Config describes a cache.FS.
+type Config struct {
+	// Layers are ordered from the first layer a file is looked for in to the storage layer.
+	// There must be at least two.
+	Layers []Layer `json:"layers"`
+}
+
+// Layer describes a single layer. Type selects the layer and the field with the same name
+// as Type holds its settings. Only "simple" may omit its settings.
+type Layer struct {
+	Type string `json:"type"`
+
+	OS         *OS         `json:"os,omitempty"`
+	Disk       *Disk       `json:"disk,omitempty"`
+	KV         *KV         `json:"kv,omitempty"`
+	Redis      *Redis      `json:"redis,omitempty"`
+	Groupcache *Groupcache `json:"groupcache,omitempty"`
+	Blob       *Blob       `json:"blob,omitempty"`
+}
+
+// OS is a layer using the os package, see io/os.
+type OS struct {
+	// Root is the directory that names are relative to.
+	Root string `json:"root"`
+}
+
+// Disk is a disk cache, see io/cache/disk.
+type Disk struct {
+	// Location is the directory to store files in. If empty, a temporary directory is created.
+	Location    string   `json:"location"`
+	ExpireFiles Duration `json:"expireFiles"`
+	ExpireCheck Duration `json:"expireCheck"`
+}
+
+// KV is a cache using an embedded bbolt database, see io/cache/kv.
+type KV struct {
+	// Path is the path of the database file.
+	Path        string   `json:"path"`
+	ExpireFiles Duration `json:"expireFiles"`
+	ExpireCheck Duration `json:"expireCheck"`
+}
+
+// Redis is a Redis cache, see io/cache/redis.
+type Redis struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	// ExpireFiles is the TTL set on all files. If not set, files do not expire.
+	ExpireFiles Duration `json:"expireFiles"`
+}
+
+// Groupcache is a groupcache layer, see io/cache/groupcache. Unless WithPeerPicker() is
+// used, peers are found with peerpicker.New(Port).
+type Groupcache struct {
+	Port   int     `json:"port"`
+	Groups []Group `json:"groups"`
+}
+
+// Group is a groupcache group.
+type Group struct {
+	Name        string `json:"name"`
+	SizeInBytes int64  `json:"sizeInBytes"`
+}
+
+// Blob is an Azure Blob Storage layer, see io/cloud/azure/blob. Unless WithBlobCredential()
+// is used, this authenticates with MSI using AppID or the system assigned identity if AppID is empty.
+type Blob struct {
+	Account   string `json:"account"`
+	Container string `json:"container"`
+	AppID     string `json:"appID"`
+}
+
+// Duration is a time.Duration that is stored in JSON as a string such as "5m".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type buildOptions struct {
+	picker    gc.PeerPicker
+	blobCred  azblob.Credential
+	cacheOpts []cache.Option
+}
+
+// Option is an optional argument for FromConfig().
+type Option func(o *buildOptions) error
+
+// WithPeerPicker sets the PeerPicker used by a "groupcache" layer instead of creating
+// a peerpicker.LAN.
+func WithPeerPicker(p gc.PeerPicker) Option {
+	return func(o *buildOptions) error {
+		o.picker = p
+		return nil
+	}
+}
+
+// WithBlobCredential sets the credential used by "blob" layers instead of using MSI.
+func WithBlobCredential(cred azblob.Credential) Option {
+	return func(o *buildOptions) error {
+		o.blobCred = cred
+		return nil
+	}
+}
+
+// WithCacheOptions passes options to every cache.New() call used to join the layers.
+func WithCacheOptions(options ...cache.Option) Option {
+	return func(o *buildOptions) error {
+		o.cacheOpts = append(o.cacheOpts, options...)
+		return nil
+	}
+}
+
+// FromConfig reads a JSON encoded Config from r and builds the cache.FS it describes.
+// Unknown fields are an error.
+func FromConfig(r io.Reader, options ...Option) (*cache.FS, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("could not decode config: %w", err)
+	}
+	return New(c, options...)
+}
+
+// New builds the cache.FS described by c.
+func New(c Config, options ...Option) (*cache.FS, error) {
+	opts := buildOptions{}
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	layers, err := buildLayers(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each layer uses the cache.FS made of the layers below it as its storage.
+	store := layers[len(layers)-1]
+	for i := len(layers) - 2; i >= 0; i-- {
+		f, err := cache.New(layers[i], store, opts.cacheOpts...)
+		if err != nil {
+			closeLayers(layers)
+			return nil, fmt.Errorf("layer %d(%s): %w", i, c.Layers[i].Type, err)
+		}
+		store = f
+	}
+	return store.(*cache.FS), nil
+}
+
+// buildLayers creates each layer in c.
+func buildLayers(c Config, opts buildOptions) ([]cache.CacheFS, error) {
+	if len(c.Layers) < 2 {
+		return nil, fmt.Errorf("config must have at least 2 layers, had %d", len(c.Layers))
+	}
+
+	layers := make([]cache.CacheFS, 0, len(c.Layers))
+	for i, l := range c.Layers {
+		layer, err := buildLayer(l, opts)
+		if err != nil {
+			closeLayers(layers)
+			return nil, fmt.Errorf("layer %d(%s): %w", i, l.Type, err)
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// closeLayers closes the layers that have a Close() method, such as the file lock of a "kv"
+// layer, the expiration goroutine of a "disk" layer and the server of a "groupcache" layer.
+// This is used when the cache.FS cannot be built, as the caller never receives the layers.
+func closeLayers(layers []cache.CacheFS) {
+	for _, l := range layers {
+		switch c := l.(type) {
+		case io.Closer:
+			c.Close()
+		case interface{ Close() }:
+			c.Close()
+		}
+	}
+}
+
+func buildLayer(l Layer, opts buildOptions) (cache.CacheFS, error) {
+	switch l.Type {
+	case "simple":
+		return simple.New(), nil
+	case "os":
+		if l.OS == nil {
+			return nil, fmt.Errorf(`missing "os" settings`)
+		}
+		return osfs.New(osfs.WithRoot(l.OS.Root))
+	case "disk":
+		if l.Disk == nil {
+			return nil, fmt.Errorf(`missing "disk" settings`)
+		}
+		var dOpts []disk.Option
+		if l.Disk.ExpireFiles > 0 {
+			dOpts = append(dOpts, disk.WithExpireFiles(time.Duration(l.Disk.ExpireFiles)))
+		}
+		if l.Disk.ExpireCheck > 0 {
+			dOpts = append(dOpts, disk.WithExpireCheck(time.Duration(l.Disk.ExpireCheck)))
+		}
+		return disk.New(l.Disk.Location, dOpts...)
+	case "kv":
+		if l.KV == nil {
+			return nil, fmt.Errorf(`missing "kv" settings`)
+		}
+		var kOpts []kv.Option
+		if l.KV.ExpireFiles > 0 {
+			kOpts = append(kOpts, kv.WithExpireFiles(time.Duration(l.KV.ExpireFiles)))
+		}
+		if l.KV.ExpireCheck > 0 {
+			kOpts = append(kOpts, kv.WithExpireCheck(time.Duration(l.KV.ExpireCheck)))
+		}
+		return kv.NewBolt(l.KV.Path, kOpts...)
+	case "redis":
+		if l.Redis == nil {
+			return nil, fmt.Errorf(`missing "redis" settings`)
+		}
+		var rOpts []redis.Option
+		if l.Redis.ExpireFiles > 0 {
+			rOpts = append(rOpts, redis.WithWriteFileOFOptions(nil, redis.ExpireFiles(time.Duration(l.Redis.ExpireFiles))))
+		}
+		return redis.New(redis.Args{Addr: l.Redis.Addr, Password: l.Redis.Password, DB: l.Redis.DB}, rOpts...)
+	case "groupcache":
+		return buildGroupcache(l.Groupcache, opts)
+	case "blob":
+		return buildBlob(l.Blob, opts)
+	}
+	return nil, fmt.Errorf("unknown layer type %q", l.Type)
+}
+
+func buildGroupcache(c *Groupcache, opts buildOptions) (cache.CacheFS, error) {
+	if c == nil {
+		return nil, fmt.Errorf(`missing "groupcache" settings`)
+	}
+	if len(c.Groups) == 0 {
+		return nil, fmt.Errorf("must have at least one group")
+	}
+
+	picker := opts.picker
+	var lan *peerpicker.LAN
+	if picker == nil {
+		var err error
+		lan, err = peerpicker.New(c.Port)
+		if err != nil {
+			return nil, err
+		}
+		picker = lan
+	}
+
+	g, err := newGroupcache(picker, c.Groups)
+	if err != nil {
+		if lan != nil {
+			lan.Close()
+		}
+		return nil, err
+	}
+	if lan != nil {
+		return groupcacheLayer{FS: g, lan: lan}, nil
+	}
+	return g, nil
+}
+
+func newGroupcache(picker gc.PeerPicker, groups []Group) (*groupcache.FS, error) {
+	g, err := groupcache.New(picker)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if err := g.NewGroup(group.Name, group.SizeInBytes); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// groupcacheLayer is a "groupcache" layer that uses a peerpicker.LAN created for it.
+type groupcacheLayer struct {
+	*groupcache.FS
+	lan *peerpicker.LAN
+}
+
+// Close stops the peerpicker.LAN used by the layer.
+func (g groupcacheLayer) Close() {
+	g.lan.Close()
+}
+
+func buildBlob(c *Blob, opts buildOptions) (cache.CacheFS, error) {
+	if c == nil {
+		return nil, fmt.Errorf(`missing "blob" settings`)
+	}
+
+	cred := opts.blobCred
+	if cred == nil {
+		var method msi.AuthMethod = msi.SystemAssigned{}
+		if c.AppID != "" {
+			method = msi.AppID{ID: c.AppID}
+		}
+		token, err := msi.Token(method)
+		if err != nil {
+			return nil, err
+		}
+		cred = *token
+	}
+	return blob.New(c.Account, c.Container, cred)
+}
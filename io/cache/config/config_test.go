@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	gc "github.com/golang/groupcache"
+	"github.com/gopherfs/fs/io/cache/disk"
+	"github.com/gopherfs/fs/io/cache/kv"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+type noPeers struct{}
+
+func (noPeers) PickPeer(key string) (gc.ProtoGetter, bool) { return nil, false }
+
+func TestBuildLayers(t *testing.T) {
+	dir := t.TempDir()
+
+	sample := fmt.Sprintf(`{
+		"layers": [
+			{"type": "simple"},
+			{"type": "groupcache", "groupcache": {"groups": [{"name": "files", "sizeInBytes": 1048576}]}},
+			{"type": "disk", "disk": {"location": %q, "expireFiles": "30m", "expireCheck": "1m"}},
+			{"type": "kv", "kv": {"path": %q, "expireFiles": "1h"}},
+			{"type": "redis", "redis": {"addr": "127.0.0.1:6379", "expireFiles": "5m"}},
+			{"type": "blob", "blob": {"account": "account", "container": "container"}}
+		]
+	}`, dir, filepath.Join(dir, "cache.db"))
+
+	var c Config
+	if err := json.Unmarshal([]byte(sample), &c); err != nil {
+		t.Fatalf("TestBuildLayers(Unmarshal): got err == %s, want err == nil", err)
+	}
+
+	opts := buildOptions{picker: noPeers{}, blobCred: azblob.NewAnonymousCredential()}
+	layers, err := buildLayers(c, opts)
+	if err != nil {
+		t.Fatalf("TestBuildLayers: got err == %s, want err == nil", err)
+	}
+	defer func() {
+		layers[2].(*disk.FS).Close()
+		layers[3].(*kv.FS).Close()
+	}()
+
+	var got []string
+	for _, l := range layers {
+		got = append(got, fmt.Sprintf("%T", l))
+	}
+	want := []string{
+		"*simple.FS",
+		"*groupcache.FS",
+		"*disk.FS",
+		"*kv.FS",
+		"*redis.FS",
+		"*blob.FS",
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestBuildLayers: layer types -want/+got:\n%s", diff)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	sample := fmt.Sprintf(`{
+		"layers": [
+			{"type": "simple"},
+			{"type": "simple"},
+			{"type": "os", "os": {"root": %q}}
+		]
+	}`, dir)
+
+	fsys, err := FromConfig(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("TestFromConfig: got err == %s, want err == nil", err)
+	}
+
+	// WriteFile goes to the storage layer and ReadFile reads it through the caches.
+	if err := fsys.WriteFile("file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("TestFromConfig(WriteFile): got err == %s, want err == nil", err)
+	}
+	b, err := fsys.ReadFile("file.txt")
+	if err != nil {
+		t.Fatalf("TestFromConfig(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestFromConfig(ReadFile): got %q, want %q", b, "content")
+	}
+	fsys.Flush()
+}
+
+func TestFromConfigErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config string
+	}{
+		{desc: "one layer", config: `{"layers": [{"type": "simple"}]}`},
+		{desc: "unknown type", config: `{"layers": [{"type": "simple"}, {"type": "tape"}]}`},
+		{desc: "missing settings", config: `{"layers": [{"type": "simple"}, {"type": "disk"}]}`},
+		{desc: "unknown field", config: `{"layers": [{"type": "simple"}, {"type": "simple", "size": 1}]}`},
+		{desc: "bad duration", config: `{"layers": [{"type": "simple"}, {"type": "disk", "disk": {"expireFiles": "soon"}}]}`},
+	}
+
+	for _, test := range tests {
+		if _, err := FromConfig(strings.NewReader(test.config)); err == nil {
+			t.Errorf("TestFromConfigErrors(%s): got err == nil, want err != nil", test.desc)
+		}
+	}
+}
+
+func TestBuildLayersCloses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.db")
+
+	sample := fmt.Sprintf(`{
+		"layers": [
+			{"type": "kv", "kv": {"path": %q}},
+			{"type": "disk"}
+		]
+	}`, path)
+
+	var c Config
+	if err := json.Unmarshal([]byte(sample), &c); err != nil {
+		t.Fatalf("TestBuildLayersCloses(Unmarshal): got err == %s, want err == nil", err)
+	}
+
+	if _, err := buildLayers(c, buildOptions{}); err == nil {
+		t.Fatalf("TestBuildLayersCloses: got err == nil, want err != nil")
+	}
+
+	// The "kv" layer holds a lock on its file until it is closed.
+	f, err := kv.NewBolt(path)
+	if err != nil {
+		t.Fatalf("TestBuildLayersCloses(NewBolt): got err == %s, want err == nil", err)
+	}
+	f.Close()
+}
@@ -0,0 +1,87 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// ErrChecksum is wrapped by the error returned when reading a cached file whose content does not
+// match the checksum recorded when it was written. See WithChecksum().
+var ErrChecksum = errors.New("cached file does not match its checksum")
+
+// checksumSuffix is appended to the path of a file to get the path of its checksum. url.PathEscape()
+// never produces a "%" that isn't followed by two hex digits, so no escaped name ends with this.
+const checksumSuffix = "%crc32"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WithChecksum stores a CRC32 checksum of each file written with WriteFile() in a companion file
+// and verifies it when the file is read with ReadFile(), Open() or OpenFile(). If the content does
+// not match, the file is removed from the cache and the read returns an error wrapping ErrChecksum.
+// This detects corruption such as truncated writes or bit-rot. Open() must read the entire file
+// to verify it. Files without a checksum, such as files written with OpenFile() or before
+// WithChecksum() was used, are not verified.
+func WithChecksum() Option {
+	return func(f *FS) error {
+		f.checksum = true
+		return nil
+	}
+}
+
+func checksumPath(p string) string {
+	return p + checksumSuffix
+}
+
+func isChecksumFile(p string) bool {
+	return strings.HasSuffix(p, checksumSuffix)
+}
+
+// writeChecksum writes the checksum of content for the file at disk path p.
+func (f *FS) writeChecksum(p string, content []byte) error {
+	sum := fmt.Sprintf("%08x", crc32.Checksum(content, crcTable))
+	return f.fs.WriteFile(checksumPath(p), []byte(sum), 0600)
+}
+
+// removeChecksum removes the checksum for the file at disk path p if it exists.
+func (f *FS) removeChecksum(p string) error {
+	if err := f.fs.Remove(checksumPath(p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// verifyFile reads file to verify its checksum and then seeks back to the start of file.
+func (f *FS) verifyFile(name string, file fs.File) error {
+	h := crc32.New(crcTable)
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if _, err := file.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return f.verify(name, h.Sum32())
+}
+
+// verify checks that sum is the checksum recorded for name. If it is not, name is removed
+// from the cache.
+func (f *FS) verify(name string, sum uint32) error {
+	b, err := f.fs.ReadFile(checksumPath(f.diskFilePath(name)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	want, err := strconv.ParseUint(string(b), 16, 32)
+	if err != nil || uint32(want) != sum {
+		f.index.remove(name)
+		return &fs.PathError{Op: "read", Path: name, Err: ErrChecksum}
+	}
+	return nil
+}
@@ -17,13 +17,19 @@ Example use:
 package disk
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,7 +40,10 @@ import (
 
 const replaceWith = `_-_-_`
 
-var _ cache.CacheFS = &FS{}
+var (
+	_ cache.CacheFS = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+)
 
 // FS provides a disk cache based on the johnsiilver/fs/os package. FS must have
 // Close() called to stop internal goroutines.
@@ -50,6 +59,22 @@ type FS struct {
 
 	writeFileOFOptions []writeFileOptions
 
+	// transform and reverse convert between names and paths relative to location.
+	// See WithNameTransform(). These are nil until New() picks the layout if not set by an option.
+	transform, reverse func(string) string
+	flat               bool
+
+	// checksum is set by WithChecksum().
+	checksum bool
+	// onEvict is set by WithOnEvict().
+	onEvict func(name string)
+	// clock is set by WithClock().
+	clock cache.Clock
+	// adoptExisting is set by WithAdoptExisting().
+	adoptExisting bool
+
+	counters counters
+
 	closeCh   chan struct{}
 	checkTime time.Duration
 }
@@ -81,6 +106,78 @@ func WithLogger(l jsfs.Logger) Option {
 	}
 }
 
+// WithNameTransform sets how names are converted to the path of the file on disk. fn converts
+// a name to a slash separated path relative to the cache location and reverse converts that path
+// back to the name, which is used by ReadDir(). fn must not return paths that escape the cache
+// location and must return different paths for different names. fn may return paths containing
+// directories, such as sharding files into directories based on a hash of the name, which are
+// created as needed. fn must not return paths ending in "%crc32", which is used by WithChecksum().
+// This overrides WithFlatLayout() and the default sharded layout.
+func WithNameTransform(fn func(string) string, reverse func(string) string) Option {
+	return func(f *FS) error {
+		if fn == nil || reverse == nil {
+			return fmt.Errorf("WithNameTransform() requires non-nil fn and reverse")
+		}
+		f.transform = fn
+		f.reverse = reverse
+		return nil
+	}
+}
+
+// WithFlatLayout stores all files directly in the cache location instead of sharding them
+// into sub-directories. Names are escaped into a single file name with url.PathEscape(),
+// so "a/b" is stored as "a%2Fb". A flat directory with many files is slow on many filesystems.
+//
+// By default, new caches shard files into two levels of sub-directories based on a hash of the
+// name, such as "3f/a2/a%2Fb". A cache location that already contains files stored in the
+// flat layout continues to use it. This includes caches written by older versions of this
+// package, which stored "a/b" as "a_slash_b". Their files keep that naming.
+func WithFlatLayout() Option {
+	return func(f *FS) error {
+		f.flat = true
+		return nil
+	}
+}
+
+// WithClock sets the Clock used to decide when files expire. This allows tests to advance
+// time instead of sleeping until files expire. Defaults to cache.RealClock{}. The interval
+// set by WithExpireCheck() still uses real time.
+func WithClock(c cache.Clock) Option {
+	return func(f *FS) error {
+		if c == nil {
+			return fmt.Errorf("WithClock() requires a non-nil Clock")
+		}
+		f.clock = c
+		return nil
+	}
+}
+
+// WithAdoptExisting causes New() to add the files already in the cache location, such as files
+// cached before a restart, to the cache. Each file expires as if it had just been written.
+// Without this, files already in the location can still be read but are never expired.
+// The location is walked when New() is called, so this slows New() for large caches.
+func WithAdoptExisting() Option {
+	return func(f *FS) error {
+		f.adoptExisting = true
+		return nil
+	}
+}
+
+// WithOnEvict sets fn to be called with the name of each file that is removed because it
+// expired. fn is called after the file has been removed from disk and is not called if
+// removing it failed. The name is the name the file was written with, not its path on disk.
+// fn is called from the goroutine that expires files, so a slow fn delays further expiration.
+// fn may call methods on the FS.
+func WithOnEvict(fn func(name string)) Option {
+	return func(f *FS) error {
+		if fn == nil {
+			return fmt.Errorf("WithOnEvict() requires a non-nil fn")
+		}
+		f.onEvict = fn
+		return nil
+	}
+}
+
 type writeFileOptions struct {
 	regex   *regexp.Regexp
 	options []jsfs.OFOption
@@ -103,7 +200,8 @@ func WithWriteFileOFOptions(regex *regexp.Regexp, options ...jsfs.OFOption) Opti
 // If location == "", a new cache root is setup in TEMPDIR with prepended name
 // "diskcache_". It is the responsibility of the caller to cleanup the disk.
 func New(location string, options ...Option) (*FS, error) {
-	if location == "" {
+	newCache := location == ""
+	if newCache {
 		var err error
 		location, err = ioutil.TempDir("", "diskcache_")
 		if err != nil {
@@ -115,7 +213,7 @@ func New(location string, options ...Option) (*FS, error) {
 			return nil, err
 		}
 		if !fi.IsDir() {
-			return nil, fmt.Errorf("location(%s) was not a directory", location)
+			return nil, fmt.Errorf("location(%s) was %w", location, jsfs.ErrNotDirectory)
 		}
 	}
 
@@ -125,6 +223,8 @@ func New(location string, options ...Option) (*FS, error) {
 		expireDuration: 30 * time.Minute,
 		openTimeout:    3 * time.Second,
 		checkTime:      1 * time.Minute,
+		clock:          cache.RealClock{},
+		closeCh:        make(chan struct{}),
 	}
 
 	for _, o := range options {
@@ -133,12 +233,40 @@ func New(location string, options ...Option) (*FS, error) {
 		}
 	}
 
+	if sys.transform == nil {
+		legacy := false
+		if !newCache {
+			flat, slash, err := hasFlatFiles(location)
+			if err != nil {
+				return nil, err
+			}
+			sys.flat = sys.flat || flat
+			legacy = slash
+		}
+		switch {
+		case legacy:
+			sys.flat = true
+			sys.transform, sys.reverse = slashTransform, slashUntransform
+		case sys.flat:
+			sys.transform, sys.reverse = nameTransform, nameUntransform
+		default:
+			sys.transform, sys.reverse = shardTransform, shardUntransform
+		}
+	}
+
 	fs, err := osfs.New(osfs.WithLogger(sys.logger))
 	if err != nil {
 		return nil, err
 	}
 	sys.fs = fs
-	sys.index = newIndex(location, sys.logger, sys.expireDuration)
+	sys.index = newIndex(sys.diskFilePath, sys.logger, sys.expireDuration, sys.clock)
+	sys.index.onEvict = sys.onEvict
+
+	if sys.adoptExisting && !newCache {
+		if err := sys.adopt(); err != nil {
+			return nil, fmt.Errorf("could not adopt existing files in location(%s): %w", location, err)
+		}
+	}
 
 	go sys.expireLoop()
 
@@ -155,12 +283,20 @@ func (f *FS) Location() string {
 }
 
 // Open implements fs.FS.Open(). fs.File is an *johnsiilver/fs/os/File.
+// If WithChecksum() is used, the file is read to verify its checksum before it is returned.
 func (f *FS) Open(name string) (fs.File, error) {
 	file, err := f.fs.Open(f.diskFilePath(name))
 	if err != nil {
 		return nil, err
 	}
 
+	if f.checksum {
+		if err := f.verifyFile(name, file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	f.counters.reads.Add(1)
 	return file, nil
 }
 
@@ -203,22 +339,65 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 		}
 	}
 
-	file, err := f.fs.OpenFile(f.diskFilePath(name), perms, opts.toOsOFOptions()...)
+	p := f.diskFilePath(name)
+	if isFlagSet(opts.flags, os.O_CREATE) {
+		if err := f.mkParent(p); err != nil {
+			return nil, err
+		}
+	}
+
+	writing := isFlagSet(opts.flags, os.O_WRONLY|os.O_RDWR)
+	if f.checksum && writing {
+		// We can't know the content written to the file, so it is no longer verified.
+		if err := f.removeChecksum(p); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := f.fs.OpenFile(p, perms, opts.toOsOFOptions()...)
 	if err != nil {
 		return nil, err
 	}
+	if f.checksum && !writing {
+		if err := f.verifyFile(name, file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
 
-	f.index.addOrUpdate(name)
+	var size int64
+	if fi, err := file.Stat(); err == nil {
+		size = fi.Size()
+	}
+	f.index.addOrUpdate(name, size)
 
+	if writing {
+		f.counters.writes.Add(1)
+	} else {
+		f.counters.reads.Add(1)
+	}
 	return file, nil
 }
 
 // ReadFile implements fs.ReadFileFS.ReadFile().
 func (f *FS) ReadFile(name string) ([]byte, error) {
+	if f.checksum {
+		b, err := f.fs.ReadFile(f.diskFilePath(name))
+		if err != nil {
+			return nil, err
+		}
+		if err := f.verify(name, crc32.Checksum(b, crcTable)); err != nil {
+			return nil, err
+		}
+		f.counters.reads.Add(1)
+		return b, nil
+	}
+
 	file, err := f.Open(name)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	return io.ReadAll(file)
 }
@@ -228,16 +407,50 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 }
 
 func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	if err := f.mkParent(f.diskFilePath(name)); err != nil {
+		return err
+	}
 	if err := f.fs.WriteFile(f.diskFilePath(name), content, perm); err != nil {
 		f.logger.Println("happened here: ", err)
 		return err
 	}
+	if f.checksum {
+		if err := f.writeChecksum(f.diskFilePath(name), content); err != nil {
+			return err
+		}
+	}
 	f.logger.Println("worked file: ", f.diskFilePath(name))
-	f.index.addOrUpdate(name)
+	f.index.addOrUpdate(name, int64(len(content)))
+	f.counters.writes.Add(1)
 
 	return nil
 }
 
+// adopt adds the files in the cache location to the index. See WithAdoptExisting().
+func (f *FS) adopt() error {
+	return filepath.WalkDir(
+		f.location,
+		func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.IsDir() || isChecksumFile(p) {
+				return nil
+			}
+			diskName, err := filepath.Rel(f.location, p)
+			if err != nil {
+				return err
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return err
+			}
+			f.index.addOrUpdate(f.reverse(filepath.ToSlash(diskName)), fi.Size())
+			return nil
+		},
+	)
+}
+
 func (f *FS) expireLoop() {
 	for {
 		select {
@@ -250,9 +463,213 @@ func (f *FS) expireLoop() {
 }
 
 func (f *FS) diskFilePath(name string) string {
-	return filepath.Join(f.location, nameTransform(name))
+	return filepath.Join(f.location, filepath.FromSlash(f.transform(name)))
 }
 
+// mkParent creates the parent directory of the file at p if the name transform stores
+// files in sub-directories.
+func (f *FS) mkParent(p string) error {
+	dir := filepath.Dir(p)
+	if dir == filepath.Clean(f.location) {
+		return nil
+	}
+	return f.fs.MkdirAll(dir, 0700)
+}
+
+func isFlagSet(flags, flag int) bool {
+	return flags&flag != 0
+}
+
+// hasFlatFiles reports if location contains files stored with the flat layout. slash is true
+// if any of them were named by slashTransform(), which older versions of this package used.
+func hasFlatFiles(location string) (flat, slash bool, err error) {
+	entries, err := os.ReadDir(location)
+	if err != nil {
+		return false, false, err
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			flat = true
+			if strings.Contains(e.Name(), slashSep) {
+				return true, true, nil
+			}
+		}
+	}
+	return flat, false, nil
+}
+
+// slashSep replaces "/" in names stored by slashTransform().
+const slashSep = "_slash_"
+
+// slashTransform is the name transform older versions of this package used. It is only used for
+// a cache location that already contains files named by it.
+func slashTransform(name string) string {
+	return strings.Replace(name, "/", slashSep, -1)
+}
+
+// slashUntransform reverses slashTransform().
+func slashUntransform(name string) string {
+	return strings.Replace(name, slashSep, "/", -1)
+}
+
+// shardTransform is the default name transform. It stores the escaped name in two levels of
+// directories named after the start of the SHA256 hash of the name.
+func shardTransform(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	h := hex.EncodeToString(sum[:2])
+	return path.Join(h[0:2], h[2:4], nameTransform(name))
+}
+
+// shardUntransform reverses shardTransform().
+func shardUntransform(p string) string {
+	return nameUntransform(path.Base(p))
+}
+
+// nameTransform is the name transform used by WithFlatLayout(). It escapes name into a single file name.
 func nameTransform(name string) string {
-	return strings.Replace(name, "/", "_slash_", -1)
+	name = url.PathEscape(name)
+	// "." and ".." are not escaped by url.PathEscape(), but refer to directories.
+	switch name {
+	case ".", "..":
+		return strings.Replace(name, ".", "%2E", -1)
+	}
+	return name
+}
+
+// nameUntransform reverses nameTransform().
+func nameUntransform(name string) string {
+	n, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return n
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir(). Files are not stored on disk under their names
+// (see WithNameTransform()), so the directories returned are reconstructed from the names of
+// the cached files. A directory only exists while it contains a cached file.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := strings.Trim(name, "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := map[string]bool{}
+	var out []fs.DirEntry
+	err := filepath.WalkDir(
+		f.location,
+		func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.IsDir() || isChecksumFile(p) {
+				return nil
+			}
+			diskName, err := filepath.Rel(f.location, p)
+			if err != nil {
+				return err
+			}
+			logical := f.reverse(filepath.ToSlash(diskName))
+			if !strings.HasPrefix(logical, prefix) {
+				return nil
+			}
+			rel := strings.TrimPrefix(logical, prefix)
+			if i := strings.Index(rel, "/"); i >= 0 {
+				dir := rel[:i]
+				if !seen[dir] {
+					seen[dir] = true
+					out = append(out, dirEntry{name: dir})
+				}
+				return nil
+			}
+			out = append(out, fileEntry{DirEntry: e, name: rel})
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) == 0 && prefix != "" {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
 }
+
+// fileEntry is an fs.DirEntry for a cached file that uses the file's logical name.
+type fileEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (f fileEntry) Name() string {
+	return f.name
+}
+
+func (f fileEntry) Info() (fs.FileInfo, error) {
+	fi, err := f.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{FileInfo: fi, name: f.name}, nil
+}
+
+type fileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (f fileInfo) Name() string {
+	return f.name
+}
+
+// dirEntry is an fs.DirEntry for a directory reconstructed from cached file names.
+type dirEntry struct {
+	name string
+}
+
+func (d dirEntry) Name() string {
+	return d.name
+}
+
+func (d dirEntry) IsDir() bool {
+	return true
+}
+
+func (d dirEntry) Type() fs.FileMode {
+	return fs.ModeDir
+}
+
+func (d dirEntry) Info() (fs.FileInfo, error) {
+	return dirInfo{name: d.name}, nil
+}
+
+type dirInfo struct {
+	name string
+}
+
+func (d dirInfo) Name() string {
+	return d.name
+}
+
+func (d dirInfo) Size() int64 {
+	return 0
+}
+
+func (d dirInfo) Mode() fs.FileMode {
+	return fs.ModeDir | 0700
+}
+
+func (d dirInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (d dirInfo) IsDir() bool {
+	return true
+}
+
+func (d dirInfo) Sys() interface{} { return nil }
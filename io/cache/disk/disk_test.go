@@ -1,9 +1,24 @@
 package disk
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/fstesting"
 	"github.com/kylelemons/godebug/pretty"
 )
 
@@ -75,3 +90,644 @@ func TestFS(t *testing.T) {
 	}
 
 }
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"myfile/is/here": []byte("content"),
+		"my.jpg":         []byte("jpeg content"),
+	}
+
+	diskFS, err := New("")
+	if err != nil {
+		t.Fatalf("TestConformance: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	for name, content := range files {
+		if err := diskFS.WriteFile(name, content, 0644); err != nil {
+			t.Fatalf("TestConformance(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	fstesting.Run(
+		t,
+		diskFS,
+		files,
+		fstesting.NoDirs(),
+		fstesting.Skip("FileInfo.Name() is the transformed on-disk name", fstesting.CheckOpen, fstesting.CheckStat),
+	)
+}
+
+//go:embed disk.go index.go
+var embedFS embed.FS
+
+func TestMergeEmbed(t *testing.T) {
+	diskFS, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("TestMergeEmbed: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	if err := jsfs.Merge(diskFS, embedFS, ""); err != nil {
+		t.Fatalf("TestMergeEmbed: got err == %s, want err == nil", err)
+	}
+
+	for _, name := range []string{"disk.go", "index.go"} {
+		want, err := embedFS.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		got, err := diskFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestMergeEmbed(%s): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("TestMergeEmbed(%s): content did not match", name)
+		}
+		fi, err := diskFS.Stat(name)
+		if err != nil {
+			t.Fatalf("TestMergeEmbed(%s): Stat got err == %s, want err == nil", name, err)
+		}
+		if fi.Mode().Perm() != 0644 {
+			t.Errorf("TestMergeEmbed(%s): got mode %v, want %v", name, fi.Mode().Perm(), fs.FileMode(0644))
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	diskFS, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("TestReadDir: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	for _, name := range []string{"a/b", "a/c", "a/d/e", "f"} {
+		if err := diskFS.WriteFile(name, []byte("content"), 0644); err != nil {
+			t.Fatalf("TestReadDir(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want map[string]bool // name: isDir
+		err  bool
+	}{
+		{name: ".", want: map[string]bool{"a": true, "f": false}},
+		{name: "a", want: map[string]bool{"b": false, "c": false, "d": true}},
+		{name: "a/d", want: map[string]bool{"e": false}},
+		{name: "missing", err: true},
+	}
+
+	for _, test := range tests {
+		entries, err := diskFS.ReadDir(test.name)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestReadDir(%s): got err == nil, want err != nil", test.name)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestReadDir(%s): got err == %s, want err == nil", test.name, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		got := map[string]bool{}
+		for _, e := range entries {
+			got[e.Name()] = e.IsDir()
+			fi, err := e.Info()
+			if err != nil {
+				t.Errorf("TestReadDir(%s): Info(%s) got err == %s, want err == nil", test.name, e.Name(), err)
+				continue
+			}
+			if fi.Name() != e.Name() || fi.IsDir() != e.IsDir() {
+				t.Errorf("TestReadDir(%s): Info(%s) did not match the entry", test.name, e.Name())
+			}
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestReadDir(%s): -want/+got:\n%s", test.name, diff)
+		}
+	}
+}
+
+// shard stores files in two levels of directories based on a hash of the name.
+func shard(name string) string {
+	h := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	return path.Join(h[0:2], h[2:4], url.PathEscape(name))
+}
+
+func unshard(p string) string {
+	name, err := url.PathUnescape(path.Base(p))
+	if err != nil {
+		panic(err)
+	}
+	return name
+}
+
+func TestNameTransform(t *testing.T) {
+	location := t.TempDir()
+	diskFS, err := New(location, WithNameTransform(shard, unshard))
+	if err != nil {
+		t.Fatalf("TestNameTransform: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	names := []string{"a/b", "a/c", "d"}
+	for _, name := range names {
+		if err := diskFS.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("TestNameTransform(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(location, filepath.FromSlash(shard(name)))); err != nil {
+			t.Errorf("TestNameTransform(%s): file was not stored at the transformed path: %s", name, err)
+		}
+		b, err := diskFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestNameTransform(ReadFile %s): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != name {
+			t.Errorf("TestNameTransform(ReadFile %s): got %q, want %q", name, b, name)
+		}
+	}
+
+	got, err := jsfs.List(diskFS, ".")
+	if err != nil {
+		t.Fatalf("TestNameTransform(List): got err == %s, want err == nil", err)
+	}
+	if diff := pretty.Compare(names, got); diff != "" {
+		t.Errorf("TestNameTransform(List): -want/+got:\n%s", diff)
+	}
+
+	if _, err := New(location, WithNameTransform(shard, nil)); err == nil {
+		t.Errorf("TestNameTransform(nil reverse): got err == nil, want err != nil")
+	}
+}
+
+func TestDefaultNameTransform(t *testing.T) {
+	diskFS, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("TestDefaultNameTransform: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	// These all collided or escaped the cache location with older transforms.
+	names := []string{"a/b", "a_slash_b", "a%2Fb", "..", "."}
+	for _, name := range names {
+		if err := diskFS.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("TestDefaultNameTransform(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+	for _, name := range names {
+		b, err := diskFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestDefaultNameTransform(ReadFile %s): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != name {
+			t.Errorf("TestDefaultNameTransform(ReadFile %s): got %q, want %q", name, b, name)
+		}
+		if got := nameUntransform(nameTransform(name)); got != name {
+			t.Errorf("TestDefaultNameTransform(%s): reversed to %q", name, got)
+		}
+	}
+}
+
+func TestShardedLayout(t *testing.T) {
+	location := t.TempDir()
+	diskFS, err := New(location)
+	if err != nil {
+		t.Fatalf("TestShardedLayout: got err == %s, want err == nil", err)
+	}
+	defer diskFS.Close()
+
+	var names []string
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("dir%d/file%d", i%10, i)
+		names = append(names, name)
+		if err := diskFS.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("TestShardedLayout(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	entries, err := os.ReadDir(location)
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			t.Errorf("TestShardedLayout: found file(%s) in the cache location, want only shard directories", e.Name())
+		}
+	}
+
+	for _, name := range names {
+		b, err := diskFS.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestShardedLayout(ReadFile %s): got err == %s, want err == nil", name, err)
+		}
+		if string(b) != name {
+			t.Fatalf("TestShardedLayout(ReadFile %s): got %q, want %q", name, b, name)
+		}
+	}
+
+	got, err := jsfs.List(diskFS, ".")
+	if err != nil {
+		t.Fatalf("TestShardedLayout(List): got err == %s, want err == nil", err)
+	}
+	sort.Strings(names)
+	if diff := pretty.Compare(names, got); diff != "" {
+		t.Errorf("TestShardedLayout(List): -want/+got:\n%s", diff)
+	}
+
+	// Expiring a file must remove it from its shard directory.
+	diskFS.index.expireItem(diskFS.index.byName[names[0]])
+	if _, err := diskFS.Stat(names[0]); err == nil {
+		t.Errorf("TestShardedLayout(expire): file(%s) still exists", names[0])
+	}
+}
+
+func TestFlatLayout(t *testing.T) {
+	tests := []struct {
+		desc       string
+		existing   string // A file already in the location.
+		options    []Option
+		wantFlat   bool
+		wantLegacy bool // "a/b" is stored as "a_slash_b".
+	}{
+		{desc: "empty location is sharded"},
+		{desc: "WithFlatLayout", options: []Option{WithFlatLayout()}, wantFlat: true},
+		{desc: "existing flat cache stays flat", existing: "old%2Ffile", wantFlat: true},
+		{desc: "existing _slash_ cache keeps its names", existing: "old_slash_file", wantLegacy: true},
+		{desc: "WithFlatLayout and existing _slash_ cache", existing: "old_slash_file", options: []Option{WithFlatLayout()}, wantLegacy: true},
+	}
+
+	for _, test := range tests {
+		location := t.TempDir()
+		if test.existing != "" {
+			if err := os.WriteFile(filepath.Join(location, test.existing), []byte("old"), 0644); err != nil {
+				panic(err)
+			}
+		}
+
+		diskFS, err := New(location, test.options...)
+		if err != nil {
+			t.Fatalf("TestFlatLayout(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		defer diskFS.Close()
+
+		if err := diskFS.WriteFile("a/b", []byte("content"), 0644); err != nil {
+			t.Fatalf("TestFlatLayout(%s): WriteFile got err == %s, want err == nil", test.desc, err)
+		}
+		_, err = os.Stat(filepath.Join(location, "a%2Fb"))
+		if gotFlat := err == nil; gotFlat != test.wantFlat {
+			t.Errorf("TestFlatLayout(%s): got flat layout == %v, want %v", test.desc, gotFlat, test.wantFlat)
+		}
+		_, err = os.Stat(filepath.Join(location, "a_slash_b"))
+		if gotLegacy := err == nil; gotLegacy != test.wantLegacy {
+			t.Errorf("TestFlatLayout(%s): got _slash_ names == %v, want %v", test.desc, gotLegacy, test.wantLegacy)
+		}
+
+		if test.existing != "" {
+			b, err := diskFS.ReadFile("old/file")
+			if err != nil || string(b) != "old" {
+				t.Errorf("TestFlatLayout(%s): could not read existing file: %q, %v", test.desc, b, err)
+			}
+			entries, err := diskFS.ReadDir("old")
+			if err != nil || len(entries) != 1 || entries[0].Name() != "file" {
+				t.Errorf("TestFlatLayout(%s): ReadDir(old) got %v, %v, want the existing file", test.desc, entries, err)
+			}
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		desc string
+		read func(fsys *FS, name string) ([]byte, error)
+	}{
+		{
+			desc: "ReadFile",
+			read: func(fsys *FS, name string) ([]byte, error) { return fsys.ReadFile(name) },
+		},
+		{
+			desc: "Open",
+			read: func(fsys *FS, name string) ([]byte, error) {
+				f, err := fsys.Open(name)
+				if err != nil {
+					return nil, err
+				}
+				defer f.Close()
+				return io.ReadAll(f)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		diskFS, err := New(t.TempDir(), WithChecksum())
+		if err != nil {
+			t.Fatalf("TestChecksum(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		defer diskFS.Close()
+
+		const name = "dir/file"
+		if err := diskFS.WriteFile(name, []byte("content"), 0644); err != nil {
+			t.Fatalf("TestChecksum(%s): WriteFile got err == %s, want err == nil", test.desc, err)
+		}
+
+		b, err := test.read(diskFS, name)
+		if err != nil {
+			t.Fatalf("TestChecksum(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if string(b) != "content" {
+			t.Fatalf("TestChecksum(%s): got %q, want %q", test.desc, b, "content")
+		}
+
+		// The listing must not include the checksum files.
+		got, err := jsfs.List(diskFS, ".")
+		if err != nil {
+			t.Fatalf("TestChecksum(%s): List got err == %s, want err == nil", test.desc, err)
+		}
+		if diff := pretty.Compare([]string{name}, got); diff != "" {
+			t.Errorf("TestChecksum(%s): List -want/+got:\n%s", test.desc, diff)
+		}
+
+		// Corrupt the file on disk.
+		if err := os.WriteFile(diskFS.diskFilePath(name), []byte("cont"), 0644); err != nil {
+			panic(err)
+		}
+
+		if _, err := test.read(diskFS, name); !errors.Is(err, ErrChecksum) {
+			t.Errorf("TestChecksum(%s): after corruption got err == %v, want ErrChecksum", test.desc, err)
+		}
+		if _, err := os.Stat(diskFS.diskFilePath(name)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestChecksum(%s): corrupt file was not removed from disk", test.desc)
+		}
+		if _, err := os.Stat(checksumPath(diskFS.diskFilePath(name))); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestChecksum(%s): checksum of corrupt file was not removed from disk", test.desc)
+		}
+		if _, ok := diskFS.index.byName[name]; ok {
+			t.Errorf("TestChecksum(%s): corrupt file was not removed from the index", test.desc)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	diskFS, err := New(
+		"",
+		WithExpireCheck(50*time.Millisecond),
+		WithExpireFiles(500*time.Millisecond),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(diskFS.Location())
+	defer diskFS.Close()
+
+	if err := diskFS.WriteFile("a", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestMetrics(WriteFile): got err == %s, want err == nil", err)
+	}
+	if err := diskFS.WriteFile("b", []byte("world!"), 0644); err != nil {
+		t.Fatalf("TestMetrics(WriteFile): got err == %s, want err == nil", err)
+	}
+	// Overwriting a file must replace its size, not add to it.
+	if err := diskFS.WriteFile("a", []byte("hi"), 0644); err != nil {
+		t.Fatalf("TestMetrics(WriteFile): got err == %s, want err == nil", err)
+	}
+	if _, err := diskFS.ReadFile("b"); err != nil {
+		t.Fatalf("TestMetrics(ReadFile): got err == %s, want err == nil", err)
+	}
+
+	want := Metrics{Entries: 2, Bytes: 8, Reads: 1, Writes: 3}
+	if diff := pretty.Compare(want, diskFS.Metrics()); diff != "" {
+		t.Errorf("TestMetrics(after writes): -want/+got:\n%s", diff)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	want = Metrics{Reads: 1, Writes: 3, Expirations: 2}
+	if diff := pretty.Compare(want, diskFS.Metrics()); diff != "" {
+		t.Errorf("TestMetrics(after expiration): -want/+got:\n%s", diff)
+	}
+}
+
+func TestExpireOnlyOld(t *testing.T) {
+	diskFS, err := New(
+		"",
+		WithExpireCheck(50*time.Millisecond),
+		WithExpireFiles(1*time.Hour),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(diskFS.Location())
+	defer diskFS.Close()
+
+	if err := diskFS.WriteFile("a", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestExpireOnlyOld(WriteFile): got err == %s, want err == nil", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if _, err := diskFS.Stat("a"); err != nil {
+		t.Errorf("TestExpireOnlyOld: file expired before its expiration time: %s", err)
+	}
+	if got := diskFS.Metrics().Expirations; got != 0 {
+		t.Errorf("TestExpireOnlyOld: got %d expirations, want 0", got)
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		evicted []string
+	)
+	var diskFS *FS
+	diskFS, err := New(
+		"",
+		WithExpireCheck(50*time.Millisecond),
+		WithExpireFiles(100*time.Millisecond),
+		WithOnEvict(func(name string) {
+			// Calling back into the FS must not deadlock.
+			if _, err := diskFS.Stat(name); err == nil {
+				t.Errorf("TestOnEvict: evicted file(%s) can still be found", name)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			evicted = append(evicted, name)
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(diskFS.Location())
+	defer diskFS.Close()
+
+	want := []string{"a", "dir/b.txt"}
+	for _, name := range want {
+		if err := diskFS.WriteFile(name, []byte("hello"), 0644); err != nil {
+			t.Fatalf("TestOnEvict(WriteFile(%s)): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	var got []string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		mu.Lock()
+		got = append([]string(nil), evicted...)
+		mu.Unlock()
+		if len(got) >= len(want) {
+			break
+		}
+	}
+	sort.Strings(got)
+
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestOnEvict: evicted names: -want/+got:\n%s", diff)
+	}
+}
+
+// fakeClock is a cache.Clock that only changes when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	diskFS, err := New(
+		"",
+		WithClock(clock),
+		WithExpireFiles(time.Minute),
+		// Expiration is checked by the test, so the expire loop never runs.
+		WithExpireCheck(time.Hour),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(diskFS.Location())
+	defer diskFS.Close()
+
+	for _, name := range []string{"a", "b"} {
+		if err := diskFS.WriteFile(name, []byte("hello"), 0644); err != nil {
+			t.Fatalf("TestClock(WriteFile(%s)): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	exists := func(name string) bool {
+		_, err := diskFS.Stat(name)
+		return err == nil
+	}
+
+	// Rewriting "b" half way through resets its expiration.
+	clock.advance(30 * time.Second)
+	if err := diskFS.WriteFile("b", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestClock(WriteFile(b) again): got err == %s, want err == nil", err)
+	}
+	diskFS.index.deleteOld()
+	if !exists("a") || !exists("b") {
+		t.Fatalf("TestClock(before expiration): files expired early")
+	}
+
+	clock.advance(30 * time.Second)
+	diskFS.index.deleteOld()
+	if exists("a") {
+		t.Errorf("TestClock(after a's expiration): a did not expire")
+	}
+	if !exists("b") {
+		t.Errorf("TestClock(after a's expiration): b expired early")
+	}
+
+	clock.advance(30 * time.Second)
+	diskFS.index.deleteOld()
+	if exists("b") {
+		t.Errorf("TestClock(after b's expiration): b did not expire")
+	}
+	if got := diskFS.Metrics().Expirations; got != 2 {
+		t.Errorf("TestClock: got %d expirations, want 2", got)
+	}
+
+	if _, err := New("", WithClock(nil)); err == nil {
+		t.Errorf("TestClock(WithClock(nil)): got err == nil, want err != nil")
+	}
+}
+
+func TestAdoptExisting(t *testing.T) {
+	// Write files with an FS, as if they were cached before a restart.
+	prev, err := New("", WithChecksum())
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(prev.Location())
+	files := map[string]string{"a": "hello", "dir/b": "world"}
+	for name, content := range files {
+		if err := prev.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+	prev.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newFS := func(options ...Option) *FS {
+		options = append(
+			options,
+			WithChecksum(),
+			WithClock(clock),
+			WithExpireFiles(time.Minute),
+			// Expiration is checked by the test, so the expire loop never runs.
+			WithExpireCheck(time.Hour),
+		)
+		diskFS, err := New(prev.Location(), options...)
+		if err != nil {
+			panic(err)
+		}
+		return diskFS
+	}
+
+	// Without WithAdoptExisting(), existing files are not in the cache index.
+	ignored := newFS()
+	defer ignored.Close()
+	if got := ignored.Metrics().Entries; got != 0 {
+		t.Errorf("TestAdoptExisting(without option): got %d entries, want 0", got)
+	}
+
+	diskFS := newFS(WithAdoptExisting())
+	defer diskFS.Close()
+
+	if got := diskFS.Metrics(); got.Entries != 2 || got.Bytes != 10 {
+		t.Errorf("TestAdoptExisting: got %d entries of %d bytes, want 2 entries of 10 bytes", got.Entries, got.Bytes)
+	}
+	for name, content := range files {
+		b, err := diskFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestAdoptExisting(ReadFile(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("TestAdoptExisting(ReadFile(%s)): got %q, want %q", name, b, content)
+		}
+	}
+
+	clock.advance(2 * time.Minute)
+	diskFS.index.deleteOld()
+	for name := range files {
+		if _, err := diskFS.Stat(name); err == nil {
+			t.Errorf("TestAdoptExisting(%s): file did not expire", name)
+		}
+	}
+	if got := diskFS.Metrics().Expirations; got != 2 {
+		t.Errorf("TestAdoptExisting: got %d expirations, want 2", got)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Package diskprom provides a prometheus.Collector that exports the Metrics of a disk.FS.
+
+Example use:
+
+	diskFS, err := disk.New("")
+	if err != nil {
+		// Do something
+	}
+	prometheus.MustRegister(diskprom.New(diskFS, "myapp"))
+*/
+package diskprom
+
+import (
+	"github.com/gopherfs/fs/io/cache/disk"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector for a disk.FS.
+type Collector struct {
+	fsys *disk.FS
+
+	entries     *prometheus.Desc
+	bytes       *prometheus.Desc
+	reads       *prometheus.Desc
+	writes      *prometheus.Desc
+	expirations *prometheus.Desc
+}
+
+// New returns a Collector for fsys. Metric names are prefixed with namespace, which can be empty.
+// Use a prometheus.WrapRegistererWith() to tell apart multiple disk.FS in the same registry.
+func New(fsys *disk.FS, namespace string) *Collector {
+	name := func(n string) string {
+		return prometheus.BuildFQName(namespace, "disk_cache", n)
+	}
+	return &Collector{
+		fsys:        fsys,
+		entries:     prometheus.NewDesc(name("entries"), "Number of files in the cache.", nil, nil),
+		bytes:       prometheus.NewDesc(name("bytes"), "Total size of the files in the cache.", nil, nil),
+		reads:       prometheus.NewDesc(name("reads_total"), "Number of files opened for reading.", nil, nil),
+		writes:      prometheus.NewDesc(name("writes_total"), "Number of files written.", nil, nil),
+		expirations: prometheus.NewDesc(name("expirations_total"), "Number of files removed because they expired.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.Describe().
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+	ch <- c.bytes
+	ch <- c.reads
+	ch <- c.writes
+	ch <- c.expirations
+}
+
+// Collect implements prometheus.Collector.Collect().
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.fsys.Metrics()
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(m.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(m.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.reads, prometheus.CounterValue, float64(m.Reads))
+	ch <- prometheus.MustNewConstMetric(c.writes, prometheus.CounterValue, float64(m.Writes))
+	ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(m.Expirations))
+}
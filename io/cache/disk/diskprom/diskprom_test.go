@@ -0,0 +1,57 @@
+package diskprom
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gopherfs/fs/io/cache/disk"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	diskFS, err := disk.New("")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(diskFS.Location())
+	defer diskFS.Close()
+
+	if err := diskFS.WriteFile("a", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestCollector(WriteFile): got err == %s, want err == nil", err)
+	}
+	if _, err := diskFS.ReadFile("a"); err != nil {
+		t.Fatalf("TestCollector(ReadFile): got err == %s, want err == nil", err)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(New(diskFS, "test")); err != nil {
+		t.Fatalf("TestCollector(Register): got err == %s, want err == nil", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("TestCollector(Gather): got err == %s, want err == nil", err)
+	}
+
+	got := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			switch {
+			case m.GetGauge() != nil:
+				got[f.GetName()] = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				got[f.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	want := map[string]float64{
+		"test_disk_cache_entries":           1,
+		"test_disk_cache_bytes":             5,
+		"test_disk_cache_reads_total":       1,
+		"test_disk_cache_writes_total":      1,
+		"test_disk_cache_expirations_total": 0,
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestCollector: -want/+got:\n%s", diff)
+	}
+}
@@ -1,13 +1,15 @@
 package disk
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
 
 	"github.com/petar/GoLLRB/llrb"
 )
@@ -15,20 +17,31 @@ import (
 type index struct {
 	sync.Mutex
 
-	logger    jsfs.Logger
-	location  string
+	logger jsfs.Logger
+	// diskPath returns the path of a file on disk from its name.
+	diskPath  func(name string) string
 	olderThan time.Duration
-	expires   *llrb.LLRB
-	byName    map[string]expireKey
+	clock     cache.Clock
+	// onEvict is called with the name of each expired file that was removed. It may be nil.
+	onEvict func(name string)
+	expires *llrb.LLRB
+	byName  map[string]expireKey
+
+	// sizes holds the size of each file in byName and bytes is their total.
+	sizes       map[string]int64
+	bytes       int64
+	expirations uint64
 }
 
-func newIndex(location string, logger jsfs.Logger, olderThan time.Duration) *index {
+func newIndex(diskPath func(name string) string, logger jsfs.Logger, olderThan time.Duration, clock cache.Clock) *index {
 	return &index{
 		logger:    logger,
+		clock:     clock,
 		expires:   llrb.New(),
-		location:  location,
+		diskPath:  diskPath,
 		olderThan: olderThan,
 		byName:    map[string]expireKey{},
+		sizes:     map[string]int64{},
 	}
 }
 
@@ -39,7 +52,7 @@ func (i *index) add(name string) error {
 	if _, ok := i.byName[name]; ok {
 		return fmt.Errorf("key exists")
 	}
-	k := expireKey{Time: time.Now().Add(i.olderThan), name: name}
+	k := expireKey{Time: i.clock.Now().Add(i.olderThan), name: name}
 	i.byName[name] = k
 	i.expires.InsertNoReplace(k)
 	return nil
@@ -55,45 +68,116 @@ func (i *index) update(name string) error {
 	}
 	i.expires.Delete(k)
 
-	k.Time = time.Now().Add(i.olderThan)
+	k.Time = i.clock.Now().Add(i.olderThan)
 	i.byName[name] = k
 
 	i.expires.InsertNoReplace(k)
 	return nil
 }
 
-func (i *index) addOrUpdate(name string) {
+// addOrUpdate adds name to the index or resets its expiration. size is the size of the file.
+func (i *index) addOrUpdate(name string, size int64) {
 	i.Lock()
 	defer i.Unlock()
 
+	i.bytes += size - i.sizes[name]
+	i.sizes[name] = size
+
 	k, ok := i.byName[name]
 	if ok {
 		i.expires.Delete(k)
-		k.Time = time.Now().Add(i.olderThan)
+		k.Time = i.clock.Now().Add(i.olderThan)
 
 	} else {
-		k = expireKey{Time: time.Now().Add(i.olderThan), name: name}
+		k = expireKey{Time: i.clock.Now().Add(i.olderThan), name: name}
 	}
 	i.byName[name] = k
 	i.expires.InsertNoReplace(k)
 }
 
+// deleteOld removes all files whose expiration time has passed. onEvict is called for the
+// removed files after i is unlocked, so that it can call back into the FS.
 func (i *index) deleteOld() {
-	i.expires.AscendLessThan(
-		expireKey{Time: time.Now().Add(-i.olderThan)},
-		i.expireItem,
+	for _, name := range i.expireOld() {
+		i.onEvict(name)
+	}
+}
+
+// expireOld removes all files whose expiration time has passed. If onEvict is set, it
+// returns the names of the files that were removed from disk.
+func (i *index) expireOld() []string {
+	i.Lock()
+	defer i.Unlock()
+
+	// expireKey sorts newest first, so these are the keys at or before now.
+	var expired []expireKey
+	i.expires.AscendGreaterOrEqual(
+		expireKey{Time: i.clock.Now()},
+		func(item llrb.Item) bool {
+			expired = append(expired, item.(expireKey))
+			return true
+		},
 	)
+	var evicted []string
+	for _, ek := range expired {
+		if i.expireItem(ek) && i.onEvict != nil {
+			evicted = append(evicted, ek.name)
+		}
+	}
+	return evicted
 }
 
-func (i *index) expireItem(item llrb.Item) bool {
-	ek := item.(expireKey)
+// expireItem removes an expired file from the index and disk. It returns true if the file
+// was removed from disk. i must be locked.
+func (i *index) expireItem(ek expireKey) bool {
 	i.expires.Delete(ek)
-	name := filepath.Join(i.location, nameTransform(ek.name))
-	if err := os.Remove(name); err != nil {
+	i.forget(ek.name)
+	i.expirations++
+	return i.removeFiles(ek.name)
+}
+
+// forget removes name from byName and its size from the total. i must be locked.
+func (i *index) forget(name string) {
+	delete(i.byName, name)
+	i.bytes -= i.sizes[name]
+	delete(i.sizes, name)
+}
+
+// stats returns the number of files in the index, their total size and the number of
+// files that have expired.
+func (i *index) stats() (entries int, bytes int64, expirations uint64) {
+	i.Lock()
+	defer i.Unlock()
+
+	return len(i.byName), i.bytes, i.expirations
+}
+
+// remove removes name from the index and deletes its files from disk.
+func (i *index) remove(name string) {
+	i.Lock()
+	defer i.Unlock()
+
+	if k, ok := i.byName[name]; ok {
+		i.expires.Delete(k)
+		i.forget(name)
+	}
+	i.removeFiles(name)
+}
+
+// removeFiles deletes the file for name and its checksum, if it has one, from disk. It
+// returns true if the file was removed.
+func (i *index) removeFiles(name string) bool {
+	p := i.diskPath(name)
+	removed := true
+	if err := os.Remove(p); err != nil {
 		i.logger.Println("error removing file: ", err)
+		removed = false
+	}
+	if err := os.Remove(checksumPath(p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		i.logger.Println("error removing checksum: ", err)
 	}
-	//log.Printf("Removing expired: %s(%s)", ek.name, name)
-	return true
+	//log.Printf("Removing expired: %s(%s)", name, p)
+	return removed
 }
 
 type expireKey struct {
@@ -102,6 +186,12 @@ type expireKey struct {
 	name string
 }
 
+// Less sorts newest first. Keys with the same time are sorted by name, so that files that
+// expire at the same time are distinct items.
 func (e expireKey) Less(than llrb.Item) bool {
-	return than.(expireKey).Before(e.Time)
+	o := than.(expireKey)
+	if !e.Time.Equal(o.Time) {
+		return o.Before(e.Time)
+	}
+	return e.name < o.name
 }
@@ -0,0 +1,36 @@
+package disk
+
+import "sync/atomic"
+
+// Metrics are counters and gauges about an FS. Use FS.Metrics() to retrieve them.
+type Metrics struct {
+	// Entries is the number of files currently in the cache.
+	Entries int64
+	// Bytes is the total size of the files currently in the cache.
+	Bytes int64
+
+	// Reads is the number of files opened for reading with Open(), ReadFile() or OpenFile().
+	Reads uint64
+	// Writes is the number of files written with WriteFile() or opened for writing with OpenFile().
+	Writes uint64
+	// Expirations is the number of files that have been removed because they expired.
+	Expirations uint64
+}
+
+// counters are the FS counters that are not tracked by the index.
+type counters struct {
+	reads  atomic.Uint64
+	writes atomic.Uint64
+}
+
+// Metrics returns the current Metrics for the FS.
+func (f *FS) Metrics() Metrics {
+	entries, bytes, expirations := f.index.stats()
+	return Metrics{
+		Entries:     int64(entries),
+		Bytes:       bytes,
+		Reads:       f.counters.reads.Load(),
+		Writes:      f.counters.writes.Load(),
+		Expirations: expirations,
+	}
+}
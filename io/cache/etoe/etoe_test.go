@@ -93,9 +93,9 @@ func TestETOE(t *testing.T) {
 
 	fetch("fifth fill", networkCache, content, "*os.FS", t)
 
-	// Allow disk writes to occur so we don't get a weird error like:
+	// Wait for the cache fills so we don't get a weird error like:
 	// "invalid argument" because our cleanup runs when the fill goroutine hasn't occurred.
-	time.Sleep(2 * time.Second)
+	networkCache.Flush()
 }
 
 func fetch(desc string, c *cache.FS, expectContent []byte, expectFill string, t *testing.T) {
@@ -12,9 +12,12 @@ package groupcache
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,28 +28,72 @@ import (
 	"github.com/gopherfs/fs/io/cache"
 )
 
-var _ cache.CacheFS = &FS{}
+var (
+	_ cache.CacheFS       = &FS{}
+	_ cache.HealthChecker = &FS{}
+)
 
 // FS represents a fs.FS that implements OpenFile() and allows reading and writing to a groupcache.
 type FS struct {
 	picker groupcache.PeerPicker
 	mu     sync.Mutex
 	groups map[string]*groupcache.Group
+	// sizes holds the sizeInBytes passed to NewGroup() for each group in groups.
+	sizes map[string]int64
+	// generations holds the number of times a <group>/<key> in each bucket was removed.
+	// See Remove() and genBucket().
+	generations [genBuckets]uint64
 
 	openTimeout time.Duration
+	// bufPool is set by WithBufferPool(). It is nil if buffers are not pooled.
+	bufPool *cache.BufferPool
 
 	filler cache.CacheFS
 }
 
+// Option is an optional argument for the New() constructor.
+type Option func(f *FS) error
+
+// WithBufferPool causes files opened with Open() to hold their content in a buffer from p,
+// which is returned to p on Close(). Without this, every Open() allocates a copy of the cached
+// value. Stat() also uses p, as it only keeps the file's metadata.
+//
+// This is only safe if callers do not use a file or any slice read from it after calling Close(),
+// as the buffer will hold the content of another file. Close() must be called to reuse a buffer.
+// ReadFile() never uses p, as the caller keeps the returned slice.
+func WithBufferPool(p *cache.BufferPool) Option {
+	return func(f *FS) error {
+		if p == nil {
+			return fmt.Errorf("WithBufferPool() requires a non-nil BufferPool")
+		}
+		f.bufPool = p
+		return nil
+	}
+}
+
 // New creates a new FS.
-func New(picker groupcache.PeerPicker) (*FS, error) {
+func New(picker groupcache.PeerPicker, options ...Option) (*FS, error) {
 	f := &FS{
 		picker:      picker,
 		groups:      map[string]*groupcache.Group{},
+		sizes:       map[string]int64{},
 		openTimeout: 3 * time.Second,
 	}
+	for _, o := range options {
+		if err := o(f); err != nil {
+			return nil, err
+		}
+	}
 
 	groupcache.RegisterPeerPicker(f.registation)
+	if pr, ok := picker.(PeerRemover); ok {
+		pr.OnRemove(
+			func(group, key string) {
+				// This node may not have the group, in which case there is nothing to remove.
+				f.removeLocal(group, key)
+			},
+		)
+	}
 	return f, nil
 }
 
@@ -69,27 +116,105 @@ func (f *FS) NewGroup(name string, sizeInBytes int64) error {
 		return err
 	}
 
+	// groupcache panics if a group name is registered twice, which includes groups removed
+	// with RemoveGroup().
+	if groupcache.GetGroup(name) != nil {
+		return fmt.Errorf("cannot create top directory(%s): groupcache already has a group with that name", name)
+	}
+
 	f.groups[name] = groupcache.NewGroup(
 		name,
 		sizeInBytes,
 		groupcache.GetterFunc(
 			func(ctx groupcache.Context, key string, dest groupcache.Sink) error {
-				b, err := f.filler.ReadFile(key)
+				key = baseKey(key)
+				b, err := f.fill(ctx, key)
 				if err != nil {
 					return err
 				}
-				return dest.SetBytes(b)
+				var modTime time.Time
+				if fi, err := f.filler.Stat(key); err == nil {
+					modTime = fi.ModTime()
+				}
+				return dest.SetBytes(encodeValue(modTime, b))
 			},
 		),
 	)
+	f.sizes[name] = sizeInBytes
 	return nil
 }
 
-// SetFiller implements cache.SetFiller.SetFiller().
+// fill reads key from the filler. If the filler is a cache.CacheFSContext, ctx is passed to
+// it, so the fill is canceled along with the request that caused it.
+func (f *FS) fill(ctx context.Context, key string) ([]byte, error) {
+	if fc, ok := f.filler.(cache.CacheFSContext); ok {
+		return fc.ReadFileContext(ctx, key)
+	}
+	return f.filler.ReadFile(key)
+}
+
+// GroupConfig is the configuration of a group created with NewGroup().
+type GroupConfig struct {
+	// Name is the name of the group.
+	Name string
+	// MaxBytes is the sizeInBytes the group was created with.
+	MaxBytes int64
+}
+
+// GroupInfo returns the configuration of each group in the FS, sorted by name. Groups
+// removed with RemoveGroup() are not included.
+func (f *FS) GroupInfo() []GroupConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info := make([]GroupConfig, 0, len(f.groups))
+	for name := range f.groups {
+		info = append(info, GroupConfig{Name: name, MaxBytes: f.sizes[name]})
+	}
+	sort.Slice(info, func(i, j int) bool { return info[i].Name < info[j].Name })
+	return info
+}
+
+// RemoveGroup removes the group from the FS. Following calls to Open() for files in the
+// group will fail. groupcache does not support removing a group from the process, so the
+// group's cache memory is not freed until nothing references the group and a group with
+// the same name cannot be created again with NewGroup().
+func (f *FS) RemoveGroup(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.groups[name]; !ok {
+		return fmt.Errorf("cannot remove top directory(%s): does not exist", name)
+	}
+	delete(f.groups, name)
+	delete(f.sizes, name)
+	return nil
+}
+
+// SetFiller implements cache.SetFiller.SetFiller(). If fsys implements cache.CacheFSContext,
+// cache fills use ReadFileContext() with the Context of the Open() that caused the fill.
 func (f *FS) SetFiller(fsys cache.CacheFS) {
 	f.filler = fsys
 }
 
+// HealthCheck implements cache.HealthChecker. It checks that SetFiller() has been called and,
+// if the PeerPicker has a Healthy() method such as peerpicker.LAN, that it reports healthy.
+func (f *FS) HealthCheck(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.filler == nil {
+		return errors.New("groupcache.FS: SetFiller() has not been called")
+	}
+	if f.picker == nil {
+		return errors.New("groupcache.FS: no PeerPicker")
+	}
+	if v, ok := f.picker.(interface{ Healthy() bool }); ok && !v.Healthy() {
+		return errors.New("groupcache.FS: PeerPicker is not healthy")
+	}
+	return nil
+}
+
 func isValid(s string) error {
 	for i := 0; i < len(s); i++ {
 		if s[i] > unicode.MaxASCII {
@@ -110,34 +235,115 @@ func isValid(s string) error {
 	return nil
 }
 
+// splitName splits name into the group and the key within that group. Leading "./" and "/"
+// are removed before splitting.
+func splitName(name string) (group, key string, err error) {
+	n := strings.TrimPrefix(name, "./")
+	n = strings.TrimPrefix(n, "/")
+
+	switch n {
+	case "", ".":
+		return "", "", fmt.Errorf("groupcache.FS: no group in path(%s)", name)
+	}
+
+	sp := strings.SplitN(n, "/", 2)
+	if sp[0] == "" {
+		return "", "", fmt.Errorf("groupcache.FS: no group in path(%s)", name)
+	}
+	if len(sp) == 1 || sp[1] == "" {
+		return "", "", fmt.Errorf("groupcache.FS: path(%s) only contains group(%s), must be <group>/<key>", name, sp[0])
+	}
+	return sp[0], sp[1], nil
+}
+
+// Open implements fs.FS.Open(). name must be in the form <group>/<key>.
 func (f *FS) Open(name string) (fs.File, error) {
+	r, err := f.open(name, f.bufPool)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens name for reading. If pool is not nil, the content is held in a buffer from pool
+// until Close().
+func (f *FS) open(name string, pool *cache.BufferPool) (*readFile, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
 	defer cancel()
 
-	sp := strings.Split(name, "/")
-	if len(sp) == 1 {
-		return nil, fmt.Errorf("invalid path(%s)", name)
+	groupName, key, err := splitName(name)
+	if err != nil {
+		return nil, err
 	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	group, ok := f.groups[sp[0]]
+	group, ok := f.groups[groupName]
 	if !ok {
-		return nil, fmt.Errorf("groupcache.FS: group(%s) from path(%s) does not exist", sp[0], name)
+		return nil, fmt.Errorf("groupcache.FS: group(%s) from path(%s) does not exist", groupName, name)
 	}
 
-	var data []byte
-	err := group.Get(ctx, strings.Join(sp[1:], "/"), groupcache.AllocatingByteSliceSink(&data))
+	var (
+		data []byte
+		buf  *[]byte
+	)
+	if pool != nil {
+		// A ByteView of a cached value is not a copy, so only the copy into buf is made.
+		var view groupcache.ByteView
+		if err := group.Get(ctx, f.genKey(groupName, key), groupcache.ByteViewSink(&view)); err != nil {
+			return nil, err
+		}
+		buf = pool.Get(view.Len())
+		view.Copy(*buf)
+		data = *buf
+	} else {
+		err = group.Get(ctx, f.genKey(groupName, key), groupcache.AllocatingByteSliceSink(&data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	modTime, content, err := decodeValue(data)
 	if err != nil {
-		return nil, err
+		pool.Put(buf)
+		return nil, fmt.Errorf("groupcache.FS: path(%s): %w", name, err)
 	}
 
 	return &readFile{
-		content: data,
-		fi:      fileInfo{name: name, size: int64(len(data))},
+		content: content,
+		fi:      fileInfo{name: name, size: int64(len(content)), modTime: modTime},
+		buf:     buf,
+		pool:    pool,
 	}, nil
 }
 
+// modTimeLen is the length of the modification time header stored before the content
+// of each value in a group.
+const modTimeLen = 8
+
+// encodeValue encodes content with its modification time for storage in a group. This allows
+// the modification time to be shared with peers along with the content. A zero modTime is stored as 0.
+func encodeValue(modTime time.Time, content []byte) []byte {
+	var n int64
+	if !modTime.IsZero() {
+		n = modTime.UnixNano()
+	}
+	b := make([]byte, modTimeLen+len(content))
+	binary.BigEndian.PutUint64(b, uint64(n))
+	copy(b[modTimeLen:], content)
+	return b
+}
+
+// decodeValue decodes a value stored with encodeValue().
+func decodeValue(b []byte) (modTime time.Time, content []byte, err error) {
+	if len(b) < modTimeLen {
+		return time.Time{}, nil, fmt.Errorf("cached value is too short(%d bytes) to contain a modification time", len(b))
+	}
+	if n := int64(binary.BigEndian.Uint64(b)); n != 0 {
+		modTime = time.Unix(0, n)
+	}
+	return modTime, b[modTimeLen:], nil
+}
+
 // OpenFile implements fs.OpenFiler.OpenFile().
 // When writing a file, the file is not written until Close() is called on the file.
 // Perms are ignored by OpenFile.
@@ -159,40 +365,36 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 
 // ReadFile implements fs.ReadFileFS.ReadFile().
 func (f *FS) ReadFile(name string) ([]byte, error) {
-	file, err := f.Open(name)
+	r, err := f.open(name, nil)
 	if err != nil {
 		return nil, err
 	}
-	r := file.(*readFile)
 	return r.content, nil
 }
 
-// Stat implements fs.StatFS.Stat(). The FileInfo returned name and size can be used,
-// but the others are static values. ModTime will always be the zero value. It should
-// be noted that this is simple a bad wrapper on Open(), so the content is read
-// as I did not see a way to query Redis for just the key size (and to be honest,
-// I didn't dig to hard).
+// Stat implements fs.StatFS.Stat(). The FileInfo returned name, size and ModTime can be used,
+// but the others are static values. ModTime is taken from the filler's Stat() when the
+// value is loaded into the cache and is the zero value if that failed. It should
+// be noted that this is simple a bad wrapper on Open(), so the content is read.
 func (f *FS) Stat(name string) (fs.FileInfo, error) {
-	file, err := f.Open(name)
+	rf, err := f.open(name, f.bufPool)
 	if err != nil {
 		return nil, err
 	}
-	rf := file.(*readFile)
+	defer rf.Close()
+
 	return rf.fi, nil
 }
 
 // WriteFile writes a file to name with content. This uses O_WRONLY | O_CREATE | O_TRUNC, so
 // it will overrite an existing entry. If you passed WithWriteFileOFOptions(), it will
-// use those options if name matches a regex. Passed perm must be 0644.
+// use those options if name matches a regex. Passed perm must be a regular file mode,
+// but the permission bits are ignored.
 func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 	if !perm.IsRegular() {
 		return fmt.Errorf("non-regular file (perm mode bits are set)")
 	}
 
-	if perm != 0644 {
-		return fmt.Errorf("only support mode 0644")
-	}
-
 	file, err := f.OpenFile(name, 0644)
 	if err != nil {
 		return err
@@ -210,6 +412,10 @@ type readFile struct {
 	content []byte
 	fi      fileInfo
 	index   int
+
+	// buf holds content if it came from pool. It is returned to pool on Close().
+	buf  *[]byte
+	pool *cache.BufferPool
 }
 
 func (f *readFile) Stat() (fs.FileInfo, error) {
@@ -226,13 +432,35 @@ func (f *readFile) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// ReadAt implements io.ReaderAt. It does not change the offset used by Read().
+func (f *readFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.fi.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(f.content)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, f.content[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
 func (f *readFile) Close() error {
+	if f.buf != nil {
+		f.pool.Put(f.buf)
+		f.buf = nil
+		f.content = nil
+	}
 	return nil
 }
 
 type fileInfo struct {
-	name string
-	size int64
+	name    string
+	size    int64
+	modTime time.Time
 }
 
 func (f fileInfo) Name() string {
@@ -248,7 +476,7 @@ func (f fileInfo) Mode() fs.FileMode {
 }
 
 func (f fileInfo) ModTime() time.Time {
-	return time.Time{}
+	return f.modTime
 }
 
 func (f fileInfo) IsDir() bool {
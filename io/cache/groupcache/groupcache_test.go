@@ -0,0 +1,511 @@
+package groupcache
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache"
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		desc      string
+		name      string
+		wantGroup string
+		wantKey   string
+		err       bool
+	}{
+		{desc: "group and key", name: "group/key", wantGroup: "group", wantKey: "key"},
+		{desc: "key with slashes", name: "group/path/to/key", wantGroup: "group", wantKey: "path/to/key"},
+		{desc: "leading slash", name: "/group/key", wantGroup: "group", wantKey: "key"},
+		{desc: "dot prefixed", name: "./group/key", wantGroup: "group", wantKey: "key"},
+		{desc: "group only", name: "group", err: true},
+		{desc: "group only with trailing slash", name: "group/", err: true},
+		{desc: "group only with leading slash", name: "/group", err: true},
+		{desc: "dot", name: ".", err: true},
+		{desc: "empty", name: "", err: true},
+		{desc: "slash", name: "/", err: true},
+		{desc: "double slash", name: "//key", err: true},
+	}
+
+	for _, test := range tests {
+		group, key, err := splitName(test.name)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestSplitName(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestSplitName(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if group != test.wantGroup {
+			t.Errorf("TestSplitName(%s): got group %q, want %q", test.desc, group, test.wantGroup)
+		}
+		if key != test.wantKey {
+			t.Errorf("TestSplitName(%s): got key %q, want %q", test.desc, key, test.wantKey)
+		}
+	}
+}
+
+type noPeers struct{}
+
+func (noPeers) PickPeer(key string) (groupcache.ProtoGetter, bool) { return nil, false }
+
+var (
+	testFSOnce sync.Once
+	testFS     *FS
+	testFiller *simple.FS
+)
+
+// getTestFS returns an FS shared by all tests, as groupcache only allows registering
+// a PeerPicker once.
+func getTestFS() (*FS, *simple.FS) {
+	testFSOnce.Do(func() {
+		var err error
+		testFS, err = New(noPeers{})
+		if err != nil {
+			panic(err)
+		}
+		testFiller = simple.New()
+		testFS.SetFiller(testFiller)
+	})
+	return testFS, testFiller
+}
+
+func TestModTime(t *testing.T) {
+	fsys, filler := getTestFS()
+
+	if err := fsys.NewGroup("modtime", 1<<20); err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	if err := filler.WriteFile("modtimekey", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	fi, err := fsys.Stat("modtime/modtimekey")
+	if err != nil {
+		t.Fatalf("TestModTime: got err == %s, want err == nil", err)
+	}
+	if fi.Size() != int64(len("content")) {
+		t.Errorf("TestModTime: got Size() %d, want %d", fi.Size(), len("content"))
+	}
+	if fi.ModTime().Before(start) || fi.ModTime().After(time.Now()) {
+		t.Errorf("TestModTime: got ModTime() %v, want between %v and now", fi.ModTime(), start)
+	}
+
+	b, err := fsys.ReadFile("modtime/modtimekey")
+	if err != nil {
+		t.Fatalf("TestModTime(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestModTime(ReadFile): got %q, want %q", string(b), "content")
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	if _, _, err := decodeValue([]byte("short")); err == nil {
+		t.Errorf("TestDecodeValue(short value): got err == nil, want err != nil")
+	}
+
+	modTime, content, err := decodeValue(encodeValue(time.Time{}, []byte("content")))
+	if err != nil {
+		t.Fatalf("TestDecodeValue(zero time): got err == %s, want err == nil", err)
+	}
+	if !modTime.IsZero() || string(content) != "content" {
+		t.Errorf("TestDecodeValue(zero time): got (%v, %q), want (zero time, %q)", modTime, content, "content")
+	}
+}
+
+func TestRemoveGroup(t *testing.T) {
+	fsys, filler := getTestFS()
+
+	if err := fsys.NewGroup("removed", 1<<20); err != nil {
+		panic(err)
+	}
+	if err := filler.WriteFile("removedkey", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	if _, err := fsys.ReadFile("removed/removedkey"); err != nil {
+		t.Fatalf("TestRemoveGroup(ReadFile before remove): got err == %s, want err == nil", err)
+	}
+
+	if err := fsys.RemoveGroup("removed"); err != nil {
+		t.Fatalf("TestRemoveGroup: got err == %s, want err == nil", err)
+	}
+	if _, err := fsys.Open("removed/removedkey"); err == nil {
+		t.Errorf("TestRemoveGroup(Open after remove): got err == nil, want err != nil")
+	}
+	if err := fsys.RemoveGroup("removed"); err == nil {
+		t.Errorf("TestRemoveGroup(remove twice): got err == nil, want err != nil")
+	}
+	if err := fsys.NewGroup("removed", 1<<20); err == nil {
+		t.Errorf("TestRemoveGroup(NewGroup with removed name): got err == nil, want err != nil")
+	}
+}
+
+func TestGroupInfo(t *testing.T) {
+	fsys, _ := getTestFS()
+
+	if err := fsys.NewGroup("infosmall", 1<<20); err != nil {
+		panic(err)
+	}
+	if err := fsys.NewGroup("infolarge", 64<<20); err != nil {
+		panic(err)
+	}
+
+	// The FS is shared with other tests, so only the groups created here are checked.
+	var got []GroupConfig
+	for _, gc := range fsys.GroupInfo() {
+		if strings.HasPrefix(gc.Name, "info") {
+			got = append(got, gc)
+		}
+	}
+	want := []GroupConfig{
+		{Name: "infolarge", MaxBytes: 64 << 20},
+		{Name: "infosmall", MaxBytes: 1 << 20},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestGroupInfo: -want/+got:\n%s", diff)
+	}
+
+	if err := fsys.RemoveGroup("infosmall"); err != nil {
+		panic(err)
+	}
+	for _, gc := range fsys.GroupInfo() {
+		if gc.Name == "infosmall" {
+			t.Errorf("TestGroupInfo(after RemoveGroup): got group infosmall, want it removed")
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	fsys, filler := getTestFS()
+
+	if err := fsys.NewGroup("remove", 1<<20); err != nil {
+		panic(err)
+	}
+	if err := filler.WriteFile("removekey", []byte("first"), 0644); err != nil {
+		panic(err)
+	}
+
+	read := func() string {
+		b, err := fsys.ReadFile("remove/removekey")
+		if err != nil {
+			t.Fatalf("TestRemove(ReadFile): got err == %s, want err == nil", err)
+		}
+		return string(b)
+	}
+	if got := read(); got != "first" {
+		t.Fatalf("TestRemove(first read): got %q, want %q", got, "first")
+	}
+
+	// Change the file in the filler. The cached content is returned until Remove() is called.
+	if err := filler.Remove("removekey"); err != nil {
+		panic(err)
+	}
+	if err := filler.WriteFile("removekey", []byte("second"), 0644); err != nil {
+		panic(err)
+	}
+	if got := read(); got != "first" {
+		t.Fatalf("TestRemove(before Remove): got %q, want cached %q", got, "first")
+	}
+
+	if err := fsys.Remove("remove/removekey"); err != nil {
+		t.Fatalf("TestRemove: got err == %s, want err == nil", err)
+	}
+	if got := read(); got != "second" {
+		t.Errorf("TestRemove(after Remove): got %q, want %q", got, "second")
+	}
+
+	fi, err := fsys.Stat("remove/removekey")
+	if err != nil {
+		t.Fatalf("TestRemove(Stat): got err == %s, want err == nil", err)
+	}
+	if fi.Name() != "remove/removekey" {
+		t.Errorf("TestRemove(Stat): got Name() %q, want %q", fi.Name(), "remove/removekey")
+	}
+
+	if err := fsys.Remove("nogroup/removekey"); err == nil {
+		t.Errorf("TestRemove(group does not exist): got err == nil, want err != nil")
+	}
+	if err := fsys.Remove("remove"); err == nil {
+		t.Errorf("TestRemove(no key): got err == nil, want err != nil")
+	}
+}
+
+// blockingFiller is a cache.CacheFSContext whose ReadFileContext() blocks until ctx is done.
+type blockingFiller struct {
+	*simple.FS
+
+	canceled chan error
+}
+
+func (b blockingFiller) ReadFileContext(ctx context.Context, name string) ([]byte, error) {
+	<-ctx.Done()
+	b.canceled <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestFillContext(t *testing.T) {
+	// This registers the PeerPicker used by the groups created below.
+	getTestFS()
+
+	filler := blockingFiller{FS: simple.New(), canceled: make(chan error, 1)}
+	// This is built directly, as New() can only be called once in a binary.
+	fsys := &FS{
+		picker:      noPeers{},
+		groups:      map[string]*groupcache.Group{},
+		sizes:       map[string]int64{},
+		openTimeout: 10 * time.Millisecond,
+		filler:      filler,
+	}
+	if err := fsys.NewGroup("fillcontext", 1<<20); err != nil {
+		panic(err)
+	}
+
+	_, err := fsys.Open("fillcontext/key")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestFillContext(Open): got err == %v, want context.DeadlineExceeded", err)
+	}
+
+	select {
+	case err := <-filler.canceled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("TestFillContext(filler): got ctx.Err() == %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("TestFillContext(filler): fill was not canceled")
+	}
+}
+
+//go:embed groupcache.go
+var embedFS embed.FS
+
+func TestMergeEmbed(t *testing.T) {
+	fsys, filler := getTestFS()
+
+	if err := fsys.NewGroup("merge", 1<<20); err != nil {
+		panic(err)
+	}
+	// Writes are passed to the filler, which groupcache then reads from on a miss.
+	if err := jsfs.Merge(fsys, embedFS, "merge/"); err != nil {
+		t.Fatalf("TestMergeEmbed: got err == %s, want err == nil", err)
+	}
+
+	want, err := embedFS.ReadFile("groupcache.go")
+	if err != nil {
+		panic(err)
+	}
+	got, err := filler.ReadFile("merge/groupcache.go")
+	if err != nil {
+		t.Fatalf("TestMergeEmbed: got err == %s, want err == nil", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("TestMergeEmbed: content did not match")
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	content := []byte("the unforgettable fire")
+
+	fsys, filler := getTestFS()
+	if err := fsys.NewGroup("readat", 1<<20); err != nil {
+		panic(err)
+	}
+	if err := filler.WriteFile("readatkey", content, 0644); err != nil {
+		panic(err)
+	}
+	const name = "readat/readatkey"
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		t.Fatalf("TestReadAt(Open): got err == %s, want err == nil", err)
+	}
+	ra, ok := file.(io.ReaderAt)
+	if !ok {
+		t.Fatalf("TestReadAt: %T does not implement io.ReaderAt", file)
+	}
+
+	tests := []struct {
+		desc    string
+		off     int64
+		size    int
+		wantErr error
+	}{
+		{desc: "start", off: 0, size: 3},
+		{desc: "middle", off: 4, size: 13},
+		{desc: "exactly to end", off: 18, size: 4},
+		{desc: "past end", off: 18, size: 10, wantErr: io.EOF},
+		{desc: "at end", off: int64(len(content)), size: 1, wantErr: io.EOF},
+		{desc: "beyond end", off: 100, size: 1, wantErr: io.EOF},
+	}
+
+	for _, test := range tests {
+		b := make([]byte, test.size)
+		n, err := ra.ReadAt(b, test.off)
+		if err != test.wantErr {
+			t.Errorf("TestReadAt(%s): got err == %v, want err == %v", test.desc, err, test.wantErr)
+		}
+
+		want := []byte{}
+		if test.off < int64(len(content)) {
+			want = content[test.off:]
+			if len(want) > test.size {
+				want = want[:test.size]
+			}
+		}
+		if string(b[:n]) != string(want) {
+			t.Errorf("TestReadAt(%s): got %q, want %q", test.desc, b[:n], want)
+		}
+	}
+
+	if _, err := ra.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("TestReadAt(negative offset): got err == nil, want err != nil")
+	}
+
+	// ReadAt must not change the offset used by Read.
+	all, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("TestReadAt(ReadAll): got err == %s, want err == nil", err)
+	}
+	if string(all) != string(content) {
+		t.Errorf("TestReadAt(ReadAll): got %q, want %q", all, content)
+	}
+}
+
+type unhealthyPeers struct {
+	noPeers
+}
+
+func (unhealthyPeers) Healthy() bool { return false }
+
+func TestHealthCheck(t *testing.T) {
+	gc, _ := getTestFS()
+
+	tests := []struct {
+		desc string
+		fs   *FS
+		err  bool
+	}{
+		{desc: "filler set", fs: gc},
+		// These are built directly, as New() can only be called once in a binary.
+		{desc: "no filler", fs: &FS{picker: noPeers{}}, err: true},
+		{desc: "unhealthy picker", fs: &FS{picker: unhealthyPeers{}, filler: simple.New()}, err: true},
+	}
+
+	for _, test := range tests {
+		err := test.fs.HealthCheck(context.Background())
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestHealthCheck(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.err:
+			t.Errorf("TestHealthCheck(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	if _, err := New(noPeers{}, WithBufferPool(nil)); err == nil {
+		t.Errorf("TestBufferPool(nil pool): got err == nil, want err != nil")
+	}
+
+	fsys, filler := getTestFS()
+	fsys.bufPool = &cache.BufferPool{}
+	defer func() { fsys.bufPool = nil }()
+
+	if err := fsys.NewGroup("bufpool", 1<<20); err != nil {
+		panic(err)
+	}
+	files := map[string]string{"bufpoolA": "content of file a", "bufpoolB": "b"}
+	for name, content := range files {
+		if err := filler.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	// ReadFile() must not use the pool, as the returned slice is kept after buffers are reused.
+	kept, err := fsys.ReadFile("bufpool/bufpoolA")
+	if err != nil {
+		t.Fatalf("TestBufferPool(ReadFile): got err == %s, want err == nil", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for name, content := range files {
+			name = "bufpool/" + name
+			file, err := fsys.Open(name)
+			if err != nil {
+				t.Fatalf("TestBufferPool(Open(%s)): got err == %s, want err == nil", name, err)
+			}
+			b, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("TestBufferPool(Read(%s)): got err == %s, want err == nil", name, err)
+			}
+			if string(b) != content {
+				t.Errorf("TestBufferPool(Read(%s)): got %q, want %q", name, b, content)
+			}
+			if err := file.Close(); err != nil {
+				t.Errorf("TestBufferPool(Close(%s)): got err == %s, want err == nil", name, err)
+			}
+			// Close() twice must not return the buffer to the pool twice.
+			file.Close()
+
+			fi, err := fsys.Stat(name)
+			if err != nil {
+				t.Fatalf("TestBufferPool(Stat(%s)): got err == %s, want err == nil", name, err)
+			}
+			if fi.Size() != int64(len(content)) {
+				t.Errorf("TestBufferPool(Stat(%s)): got Size() %d, want %d", name, fi.Size(), len(content))
+			}
+		}
+	}
+
+	if string(kept) != files["bufpoolA"] {
+		t.Errorf("TestBufferPool(ReadFile): content changed after buffers were reused: got %q, want %q", kept, files["bufpoolA"])
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	fsys, filler := getTestFS()
+
+	// A benchmark can be run more than once, but a group can only be created once.
+	if groupcache.GetGroup("benchopen") == nil {
+		if err := fsys.NewGroup("benchopen", 1<<20); err != nil {
+			panic(err)
+		}
+		if err := filler.WriteFile("benchopenkey", bytes.Repeat([]byte("x"), 64*1024), 0644); err != nil {
+			panic(err)
+		}
+	}
+	defer func() { fsys.bufPool = nil }()
+
+	for _, pool := range []*cache.BufferPool{nil, {}} {
+		fsys.bufPool = pool
+		b.Run(fmt.Sprintf("pooled=%v", pool != nil), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				file, err := fsys.Open("benchopen/benchopenkey")
+				if err != nil {
+					b.Fatal(err)
+				}
+				file.Close()
+			}
+		})
+	}
+}
@@ -14,17 +14,42 @@ Example:
 	if err != nil {
 		// Do something
 	}
+
+If broadcast discovery is not available, such as in Kubernetes, peers can be discovered
+using DNS SRV (or A/AAAA) records:
+
+	picker, err := peerpicker.NewFromSRV("groupcache.default.svc.cluster.local", 7586, 30*time.Second)
+	if err != nil {
+		// Do something
+	}
+
+Peers can communicate using mutual TLS by passing WithTLS() to either constructor:
+
+	picker, err := peerpicker.New(7586, peerpicker.WithTLS(tlsConfig))
+	if err != nil {
+		// Do something
+	}
+
+Nodes with more memory can be assigned more keys with WithWeight():
+
+	picker, err := peerpicker.New(7586, peerpicker.WithWeight(4))
+	if err != nil {
+		// Do something
+	}
 */
 package peerpicker
 
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"maps"
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -51,18 +76,44 @@ type LAN struct {
 	isPeer   IsPeer
 	closed   chan struct{}
 	serv     *http.Server
+	// self is the base URL of this node in the HTTPPool.
+	self string
 
 	peers      atomic.Value //[]string
 	setPeersCh chan []peerdiscovery.Discovered
-
-	logger jsfs.Logger
+	// peerWeights holds the weight of each peer in peers. See WithWeight().
+	peerWeights atomic.Value // map[string]int
+
+	// listening is set while the http server is accepting connections.
+	listening atomic.Bool
+	// lastDiscovery is the UnixNano time of the last successful peer discovery.
+	lastDiscovery atomic.Int64
+	// errs receives errors that stop the http server. See Errors().
+	errs chan error
+
+	tlsConfig *tls.Config
+	// ifaceName is set by WithInterface().
+	ifaceName string
+	// weight is set by WithWeight().
+	weight int
+	// onRemove is set by OnRemove().
+	onRemove atomic.Value // func(group, key string)
+
+	// These are used when peers are discovered with DNS. See NewFromSRV().
+	resolver Resolver
+	srvName  string
+	port     int
+	refresh  time.Duration
+
+	logger  jsfs.Logger
+	verbose bool
 }
 
 // Option is optional settings for the New() constructor.
 type Option func(l *LAN) error
 
 // WithSettings allows passing your own settings for peer discovery. If not specified
-// this will go with our own default values for ipv4 and ipv6 (if setup). We default
+// this will go with our own default values for the IP version of iam. We default
 // to port 9999. iam in the net.IP that you wish to broadcast as. This defaults to
 // an IPv6 address on hosts with IPv6.
 func WithSettings(iam net.IP, settings []peerdiscovery.Settings, isPeer IsPeer) Option {
@@ -78,6 +129,22 @@ func WithSettings(iam net.IP, settings []peerdiscovery.Settings, isPeer IsPeer)
 	}
 }
 
+// WithInterface causes this node to use an address of the network interface name, such as
+// "eth0", instead of the first usable address on the machine. This is the address sent to
+// peers during discovery and the address the http server used with groupcache listens on.
+// An IPv6 address is used if the interface has one, otherwise an IPv4 address is used.
+// Discovery only broadcasts using the IP version of that address, but broadcasts are
+// sent on all interfaces that support multicast. This cannot be used with WithSettings().
+func WithInterface(name string) Option {
+	return func(l *LAN) error {
+		if name == "" {
+			return fmt.Errorf("WithInterface() name cannot be empty")
+		}
+		l.ifaceName = name
+		return nil
+	}
+}
+
 // WithLogger specifies a logger for us to use.
 func WithLogger(logger jsfs.Logger) Option {
 	return func(l *LAN) error {
@@ -86,11 +153,51 @@ func WithLogger(logger jsfs.Logger) Option {
 	}
 }
 
+// WithVerbose causes details of each peer discovery, such as the peers found, to be logged.
+func WithVerbose() Option {
+	return func(l *LAN) error {
+		l.verbose = true
+		return nil
+	}
+}
+
+// WithTLS causes peers to communicate using HTTPS with cfg. cfg is used both to serve
+// requests from peers and as the client config when making requests to peers, so it must
+// contain the certificates needed for both sides. For mutual TLS, set cfg.ClientAuth,
+// cfg.ClientCAs and cfg.RootCAs. All peers must use TLS if any peer does.
+func WithTLS(cfg *tls.Config) Option {
+	return func(l *LAN) error {
+		if cfg == nil {
+			return fmt.Errorf("WithTLS() cfg cannot be nil")
+		}
+		l.tlsConfig = cfg
+		return nil
+	}
+}
+
 // New creates a New *LAN instance listening on 'port' for groupcache connections.
 func New(port int, options ...Option) (*LAN, error) {
+	l, err := newLAN(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.defaultSettings(); err != nil {
+		return nil, err
+	}
+
+	l.serve(l.scheme()+urlHost(l.iam), port)
+	go l.discovery()
+
+	return l, nil
+}
+
+func newLAN(options []Option) (*LAN, error) {
 	l := &LAN{
 		logger:     jsfs.DefaultLogger{},
+		closed:     make(chan struct{}),
 		setPeersCh: make(chan []peerdiscovery.Discovered, 1),
+		errs:       make(chan error, 1),
+		weight:     1,
 	}
 
 	for _, o := range options {
@@ -98,29 +205,112 @@ func New(port int, options ...Option) (*LAN, error) {
 			return nil, err
 		}
 	}
-	l.defaultSettings()
+	if l.ifaceName != "" && l.iam != "" {
+		return nil, fmt.Errorf("WithInterface() and WithSettings() cannot be used together")
+	}
+	return l, nil
+}
 
-	l.HTTPPool = groupcache.NewHTTPPoolOpts(
-		"http://"+l.iam,
-		&groupcache.HTTPPoolOptions{},
-	)
+// serve sets up the HTTPPool with self as the base URL and serves it on port.
+func (l *LAN) serve(self string, port int) {
+	l.setupPool(self)
+	l.listen(port)
+}
+
+// setupPool creates the HTTPPool with self as the base URL.
+func (l *LAN) setupPool(self string) {
+	l.self = self
+	l.HTTPPool = groupcache.NewHTTPPoolOpts(self, l.poolOptions())
+	l.setupTLS()
+}
+
+// listen serves l.HTTPPool on port in a separate goroutine.
+func (l *LAN) listen(port int) {
+	l.newServer(net.JoinHostPort(l.iam, strconv.Itoa(port)))
+	go func() {
+		ln, err := net.Listen("tcp", l.serv.Addr)
+		if err != nil {
+			l.serverErr(err)
+			return
+		}
+		l.serveOn(ln)
+	}()
+}
 
+// listenOn is like listen(), but serves on ln. This allows tests to use a port picked by the OS.
+func (l *LAN) listenOn(ln net.Listener) {
+	l.newServer(ln.Addr().String())
+	go l.serveOn(ln)
+}
+
+// newServer sets l.serv to the http server used with groupcache, listening on addr.
+func (l *LAN) newServer(addr string) {
 	l.serv = &http.Server{
-		Addr:           fmt.Sprintf("%s:%d", l.iam, port),
-		Handler:        l.HTTPPool,
+		Addr:           addr,
+		Handler:        l.handler(),
 		ReadTimeout:    3 * time.Second,
 		WriteTimeout:   3 * time.Second,
 		MaxHeaderBytes: 1 << 20,
+		TLSConfig:      l.tlsConfig,
 	}
-	go func() {
-		l.logger.Println("groupcache peerpicker serving on: ", l.serv.Addr)
-		if err := l.serv.ListenAndServe(); err != nil {
-			l.logger.Printf("groupcache peerpicker stopped(%s)", l.serv.Addr)
-		}
-	}()
-	go l.discovery()
+}
 
-	return l, nil
+// serveOn serves l.serv on ln until the server is closed.
+func (l *LAN) serveOn(ln net.Listener) {
+	l.listening.Store(true)
+	defer l.listening.Store(false)
+	l.logger.Println("groupcache peerpicker serving on: ", l.serv.Addr)
+
+	var err error
+	if l.tlsConfig != nil {
+		// The certificates are provided by l.tlsConfig.
+		err = l.serv.ServeTLS(ln, "", "")
+	} else {
+		err = l.serv.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
+		l.serverErr(err)
+	}
+}
+
+// serverErr logs err and sends it on l.errs if there is room.
+func (l *LAN) serverErr(err error) {
+	l.logger.Printf("groupcache peerpicker stopped(%s): %s", l.serv.Addr, err)
+	select {
+	case l.errs <- err:
+	default:
+	}
+}
+
+// setupTLS sets the HTTPPool to use our TLS config when talking to peers. If WithTLS()
+// was not passed, this does nothing.
+func (l *LAN) setupTLS() {
+	if l.tlsConfig == nil {
+		return
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = l.tlsConfig.Clone()
+
+	l.HTTPPool.Transport = func(groupcache.Context) http.RoundTripper {
+		return transport
+	}
+}
+
+// urlHost returns addr in the form used as the host of a URL, which adds brackets to IPv6 addresses.
+func urlHost(addr string) string {
+	if strings.Contains(addr, ":") {
+		return "[" + addr + "]"
+	}
+	return addr
+}
+
+// scheme returns the URL scheme prefix used for peers.
+func (l *LAN) scheme() string {
+	if l.tlsConfig != nil {
+		return "https://"
+	}
+	return "http://"
 }
 
 // Close stops peer discovery and shuts down the http server used with groupcache.
@@ -129,6 +319,34 @@ func (l *LAN) Close() {
 	l.serv.Shutdown(context.Background())
 }
 
+// Healthy returns true if the http server used with groupcache is accepting connections and
+// peer discovery has succeeded at least once. It returns false after Close() is called.
+func (l *LAN) Healthy() bool {
+	select {
+	case <-l.closed:
+		return false
+	default:
+	}
+	return l.listening.Load() && !l.LastDiscovery().IsZero()
+}
+
+// LastDiscovery returns the time peer discovery last succeeded. This is the zero value
+// if it has not succeeded yet.
+func (l *LAN) LastDiscovery() time.Time {
+	n := l.lastDiscovery.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Errors returns a channel that receives the error that caused the http server used with
+// groupcache to stop, such as being unable to listen on its port. This is not sent when Close()
+// is called. Errors are dropped if the channel is full.
+func (l *LAN) Errors() <-chan error {
+	return l.errs
+}
+
 // Peers retrieves the list of peers. This is only useful for debugging and monitoring.
 // Changing a peer in this list may result in unintended behavior.
 func (l *LAN) Peers() []string {
@@ -145,42 +363,16 @@ func (l *LAN) defaultSettings() error {
 		delay     = 500 * time.Millisecond
 	)
 
-	var ipv4, ipv6 bool
-
-	if l.iam != "" {
-		ip := net.ParseIP(l.iam)
-		if ip.To4() != nil {
-			ipv4 = true
-		} else {
-			ipv6 = true
-		}
-	} else {
-		addrs, err := net.InterfaceAddrs()
-		if err != nil {
-			return err
-		}
-		for _, addr := range addrs {
-			ip := addr.(*net.IPNet).IP
-			if ip.IsLoopback() || ip.IsMulticast() || ip.IsUnspecified() {
-				continue
-			}
-
-			if ip.To4() == nil {
-				ipv6 = true
-				if l.iam == "" {
-					l.iam = ip.String()
-				}
-				continue
-			}
-			ipv4 = true
-			if !ipv6 && l.iam == "" {
-				l.iam = ip.String()
-			}
-		}
+	ipv4, ipv6, err := l.findIAm()
+	if err != nil {
+		return err
 	}
 
 	if l.payload == nil {
 		l.payload = []byte(fmt.Sprintf(`groupcache:%s`, l.iam))
+		if l.weight > 1 {
+			l.payload = append(l.payload, []byte(fmt.Sprintf("#%d", l.weight))...)
+		}
 	}
 	l.peerKey = bytes.Split(l.payload, []byte(":"))[0]
 	if l.isPeer == nil {
@@ -220,8 +412,74 @@ func (l *LAN) defaultSettings() error {
 	return nil
 }
 
+// findIAm determines if our address is IPv4 or IPv6. If l.iam is not set, it is set to the first
+// usable IPv6 address or, if there is none, the first usable IPv4 address on the machine or
+// on the interface passed to WithInterface().
+func (l *LAN) findIAm() (ipv4, ipv6 bool, err error) {
+	if l.iam == "" {
+		addrs, err := l.interfaceAddrs()
+		if err != nil {
+			return false, false, err
+		}
+		l.iam = pickIAm(addrs, l.ifaceName != "")
+		if l.iam == "" {
+			if l.ifaceName != "" {
+				return false, false, fmt.Errorf("interface(%s) has no usable IP address", l.ifaceName)
+			}
+			return false, false, nil
+		}
+	}
+
+	if net.ParseIP(l.iam).To4() != nil {
+		return true, false, nil
+	}
+	return false, true, nil
+}
+
+// interfaceAddrs returns the addresses of the interface passed to WithInterface() or, if it
+// was not used, all addresses on the machine.
+func (l *LAN) interfaceAddrs() ([]net.Addr, error) {
+	if l.ifaceName == "" {
+		return net.InterfaceAddrs()
+	}
+	iface, err := net.InterfaceByName(l.ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("WithInterface(%s): %w", l.ifaceName, err)
+	}
+	return iface.Addrs()
+}
+
+// pickIAm returns the first usable IPv6 address in addrs or, if there is none, the first
+// usable IPv4 address. Link-local addresses are not usable, as they need a zone to reach. Loopback
+// addresses are only used if allowLoopback is set. It returns "" if no address is usable.
+func pickIAm(addrs []net.Addr, allowLoopback bool) string {
+	var ipv4 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsMulticast() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip.IsLoopback() && !allowLoopback {
+			continue
+		}
+
+		if ip.To4() == nil {
+			return ip.String()
+		}
+		if ipv4 == "" {
+			ipv4 = ip.String()
+		}
+	}
+	return ipv4
+}
+
 func (l *LAN) defaultIsPeer(peer peerdiscovery.Discovered) (bool, string) {
-	entries := bytes.Split(peer.Payload, []byte(":"))
+	// IPv6 addresses contain ":", so only the peer key is split off.
+	entries := bytes.SplitN(peer.Payload, []byte(":"), 2)
 	if len(entries) < 2 {
 		return false, ""
 	}
@@ -246,12 +504,13 @@ func (l *LAN) discovery() {
 		case <-tick.C:
 		}
 
-		log.Println("did peer discovery")
+		l.debugf("groupcache peerdiscovery: did peer discovery")
 		peers, err := peerdiscovery.Discover(l.settings...)
 		if err != nil {
 			l.logger.Printf("groupcache peerdiscovery: %s", err)
 			continue
 		}
+		l.lastDiscovery.Store(time.Now().UnixNano())
 
 		l.setPeersCh <- peers
 	}
@@ -259,42 +518,79 @@ func (l *LAN) discovery() {
 
 func (l *LAN) setPeers() {
 	for peers := range l.setPeersCh {
-		log.Println("setPeers")
 		peerList := []string{}
+		weights := map[string]int{}
 
 		for _, peer := range peers {
 			if isPeer, peerAddr := l.isPeer(peer); isPeer {
+				peerAddr, weight, err := splitWeight(peerAddr)
+				if err != nil {
+					l.logger.Printf("groupcache peerdiscovery: %s, using weight 1", err)
+				}
 				if peerAddr == l.iam {
 					continue
 				}
-				peerList = append(peerList, "http://"+peerAddr)
+				peerURL := l.scheme() + urlHost(peerAddr)
+				peerList = append(peerList, peerURL)
+				weights[peerURL] = weight
 			} else {
-				log.Printf("saw peer I discounted: %s, %s", peer.Address, string(peer.Payload))
+				l.debugf("groupcache peerdiscovery: saw peer I discounted: %s, %s", peer.Address, string(peer.Payload))
 			}
 		}
-		log.Println("peerList is: ", peerList)
+		l.debugf("groupcache peerdiscovery: peerList is: %v", peerList)
 
-		peerList = sort.StringSlice(peerList)
-		var prevPeers []string
+		l.updatePeers(peerList, weights)
+	}
+}
 
-		if i := l.peers.Load(); i != nil {
-			prevPeers = i.([]string)
-		}
+// debugf logs to our logger if WithVerbose() was used.
+func (l *LAN) debugf(format string, v ...interface{}) {
+	if l.verbose {
+		l.logger.Printf(format, v...)
+	}
+}
 
-		// If we don't have the same length of peers, we know the peer list is different.
-		if len(peerList) != len(prevPeers) {
-			l.peers.Store(peerList)
-			l.HTTPPool.Set(peerList...)
-			return
+// updatePeers sets the HTTPPool's peers to peerList if it differs from the current peers.
+// weights holds the weight of each peer. If nil, all peers have a weight of 1.
+func (l *LAN) updatePeers(peerList []string, weights map[string]int) {
+	sort.Strings(peerList)
+	if weights == nil {
+		weights = map[string]int{}
+		for _, peer := range peerList {
+			weights[peer] = 1
 		}
+	}
+	var prevPeers []string
 
-		// If any peer at an index is different, update our set of peers.
-		for i, addr := range peerList {
-			if prevPeers[i] != addr {
-				l.peers.Store(peerList)
-				l.HTTPPool.Set(peerList...)
-				break
-			}
+	if i := l.peers.Load(); i != nil {
+		prevPeers = i.([]string)
+	}
+
+	// If the weights changed, the peers need to be placed again.
+	if !maps.Equal(weights, l.weights()) {
+		l.setPool(peerList, weights)
+		return
+	}
+
+	// If we don't have the same length of peers, we know the peer list is different.
+	if len(peerList) != len(prevPeers) {
+		l.setPool(peerList, weights)
+		return
+	}
+
+	// If any peer at an index is different, update our set of peers.
+	for i, addr := range peerList {
+		if prevPeers[i] != addr {
+			l.setPool(peerList, weights)
+			return
 		}
 	}
 }
+
+// setPool stores peerList and weights and sets the HTTPPool's peers. The weights must be stored
+// before HTTPPool.Set() is called, as they are used by hash() to place the peers.
+func (l *LAN) setPool(peerList []string, weights map[string]int) {
+	l.peerWeights.Store(weights)
+	l.peers.Store(peerList)
+	l.HTTPPool.Set(peerList...)
+}
@@ -2,13 +2,33 @@ package peerpicker
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/schollz/peerdiscovery"
 )
 
 func loopbackSetup() {
@@ -100,3 +120,452 @@ func executeApp(iam, peer string) (*exec.Cmd, *bytes.Buffer, error) {
 	}
 	return cmd, buff, nil
 }
+
+func ipNet(s string) *net.IPNet {
+	return &net.IPNet{IP: net.ParseIP(s), Mask: net.CIDRMask(24, 32)}
+}
+
+func TestPickIAm(t *testing.T) {
+	tests := []struct {
+		desc          string
+		addrs         []net.Addr
+		allowLoopback bool
+		want          string
+	}{
+		{desc: "no addresses"},
+		{
+			desc:  "IPv6 is preferred even if IPv4 is first",
+			addrs: []net.Addr{ipNet("192.0.2.2"), ipNet("fd00::2")},
+			want:  "fd00::2",
+		},
+		{
+			desc:  "first IPv4 without IPv6",
+			addrs: []net.Addr{ipNet("192.0.2.2"), ipNet("192.0.2.3")},
+			want:  "192.0.2.2",
+		},
+		{
+			desc:  "link-local is skipped",
+			addrs: []net.Addr{ipNet("fe80::1"), ipNet("192.0.2.2")},
+			want:  "192.0.2.2",
+		},
+		{
+			desc:  "loopback is skipped",
+			addrs: []net.Addr{ipNet("::1"), ipNet("127.0.0.1")},
+		},
+		{
+			desc:          "loopback is allowed",
+			addrs:         []net.Addr{ipNet("127.0.0.1")},
+			allowLoopback: true,
+			want:          "127.0.0.1",
+		},
+	}
+
+	for _, test := range tests {
+		if got := pickIAm(test.addrs, test.allowLoopback); got != test.want {
+			t.Errorf("TestPickIAm(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestWithInterface(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		panic(err)
+	}
+	var loopback *net.Interface
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagLoopback != 0 && ifaces[i].Flags&net.FlagUp != 0 {
+			loopback = &ifaces[i]
+			break
+		}
+	}
+	if loopback == nil {
+		t.Skip("no loopback interface")
+	}
+
+	l, err := newLAN([]Option{WithInterface(loopback.Name)})
+	if err != nil {
+		panic(err)
+	}
+	ipv4, ipv6, err := l.findIAm()
+	if err != nil {
+		t.Fatalf("TestWithInterface: got err == %s, want err == nil", err)
+	}
+
+	addrs, err := loopback.Addrs()
+	if err != nil {
+		panic(err)
+	}
+	found := false
+	for _, addr := range addrs {
+		if addr.(*net.IPNet).IP.String() == l.iam {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("TestWithInterface: got iam %q, want an address of %s: %v", l.iam, loopback.Name, addrs)
+	}
+	isIPv4 := net.ParseIP(l.iam).To4() != nil
+	if ipv4 != isIPv4 || ipv6 == isIPv4 {
+		t.Errorf("TestWithInterface: got ipv4 == %v, ipv6 == %v for iam %q, want only the family of iam", ipv4, ipv6, l.iam)
+	}
+
+	l, err = newLAN([]Option{WithInterface("does-not-exist0")})
+	if err != nil {
+		panic(err)
+	}
+	if _, _, err := l.findIAm(); err == nil {
+		t.Errorf("TestWithInterface(unknown interface): got err == nil, want err != nil")
+	}
+
+	if _, err := newLAN([]Option{WithInterface("")}); err == nil {
+		t.Errorf("TestWithInterface(empty name): got err == nil, want err != nil")
+	}
+	if _, err := newLAN([]Option{WithInterface(loopback.Name), WithSettings(net.ParseIP("127.0.0.1"), nil, nil)}); err == nil {
+		t.Errorf("TestWithInterface(with WithSettings): got err == nil, want err != nil")
+	}
+}
+
+func TestDualStackSettings(t *testing.T) {
+	tests := []struct {
+		desc string
+		iam  string
+		want peerdiscovery.IPVersion
+	}{
+		{desc: "IPv4", iam: "192.0.2.2", want: peerdiscovery.IPv4},
+		{desc: "IPv6", iam: "fd00::2", want: peerdiscovery.IPv6},
+	}
+
+	for _, test := range tests {
+		l, err := newLAN([]Option{WithSettings(net.ParseIP(test.iam), nil, nil)})
+		if err != nil {
+			panic(err)
+		}
+		if err := l.defaultSettings(); err != nil {
+			t.Errorf("TestDualStackSettings(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if len(l.settings) != 1 || l.settings[0].IPVersion != test.want {
+			t.Errorf("TestDualStackSettings(%s): got %d settings, want a single setting for IP version %d", test.desc, len(l.settings), test.want)
+		}
+	}
+}
+
+func TestSetPeersIPv6(t *testing.T) {
+	l := testLAN(WithLogger(&captureLogger{}))
+
+	l.setPeersCh <- []peerdiscovery.Discovered{
+		{Address: "fd00::3", Payload: []byte("groupcache:fd00::3")},
+		{Address: "fd00::4", Payload: []byte("groupcache:fd00::4#2")},
+		{Address: "192.0.2.5", Payload: []byte("groupcache:192.0.2.5")},
+	}
+	close(l.setPeersCh)
+	l.setPeers()
+
+	want := []string{"http://192.0.2.5", "http://[fd00::3]", "http://[fd00::4]"}
+	if diff := pretty.Compare(want, l.Peers()); diff != "" {
+		t.Errorf("TestSetPeersIPv6: -want/+got:\n%s", diff)
+	}
+	if got := l.peerWeight("http://[fd00::4]"); got != 2 {
+		t.Errorf("TestSetPeersIPv6: got weight %d for http://[fd00::4], want 2", got)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	resolver := &fakeResolver{}
+
+	// groupcache only allows a single HTTPPool to be created per binary, so we use a zero
+	// value HTTPPool instead of calling NewFromSRV().
+	l, err := newLAN([]Option{WithResolver(resolver)})
+	if err != nil {
+		panic(err)
+	}
+	l.HTTPPool = &groupcache.HTTPPool{}
+	l.iam = "127.0.0.1"
+	l.srvName = "groupcache.default.svc.cluster.local"
+	ln := listenLocal()
+	l.port = ln.Addr().(*net.TCPAddr).Port
+	l.refresh = 1 * time.Second
+	l.listenOn(ln)
+
+	for deadline := time.Now().Add(10 * time.Second); !l.listening.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestHealthy: server never started listening")
+		}
+	}
+
+	if l.Healthy() {
+		t.Errorf("TestHealthy(before discovery): got Healthy() == true, want false")
+	}
+	if !l.LastDiscovery().IsZero() {
+		t.Errorf("TestHealthy(before discovery): got LastDiscovery() == %v, want zero value", l.LastDiscovery())
+	}
+
+	start := time.Now()
+	resolver.srvs = []*net.SRV{{Target: "10.0.0.11", Port: 8001}}
+	if err := l.srvRefresh(); err != nil {
+		t.Fatalf("TestHealthy: srvRefresh got err == %s, want err == nil", err)
+	}
+	if !l.Healthy() {
+		t.Errorf("TestHealthy(after discovery): got Healthy() == false, want true")
+	}
+	if l.LastDiscovery().Before(start) {
+		t.Errorf("TestHealthy(after discovery): got LastDiscovery() == %v, want after %v", l.LastDiscovery(), start)
+	}
+
+	l.Close()
+	if l.Healthy() {
+		t.Errorf("TestHealthy(after Close): got Healthy() == true, want false")
+	}
+	select {
+	case err := <-l.Errors():
+		t.Errorf("TestHealthy(after Close): got server error %v, want none", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	// Occupy the port so that the server cannot listen on it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer ln.Close()
+
+	l, err := newLAN(nil)
+	if err != nil {
+		panic(err)
+	}
+	l.HTTPPool = &groupcache.HTTPPool{}
+	l.iam = "127.0.0.1"
+	l.listen(ln.Addr().(*net.TCPAddr).Port)
+
+	select {
+	case err := <-l.Errors():
+		if err == nil {
+			t.Errorf("TestServerErrors: got nil error, want listen error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("TestServerErrors: did not receive the listen error")
+	}
+	if l.Healthy() {
+		t.Errorf("TestServerErrors: got Healthy() == true, want false")
+	}
+}
+
+// captureLogger is a jsfs.Logger that records all messages.
+type captureLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (c *captureLogger) Println(v ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, fmt.Sprintln(v...))
+}
+
+func (c *captureLogger) Printf(format string, v ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, fmt.Sprintf(format, v...))
+}
+
+func TestSetPeersLogging(t *testing.T) {
+	stdlog := &bytes.Buffer{}
+	log.SetOutput(stdlog)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		desc    string
+		options []Option
+		want    []string
+	}{
+		{desc: "quiet by default"},
+		{
+			desc:    "WithVerbose",
+			options: []Option{WithVerbose()},
+			want:    []string{"saw peer I discounted", "peerList is"},
+		},
+	}
+
+	for _, test := range tests {
+		logger := &captureLogger{}
+		l, err := newLAN(append([]Option{WithLogger(logger)}, test.options...))
+		if err != nil {
+			panic(err)
+		}
+		// groupcache only allows a single HTTPPool to be created per binary.
+		l.HTTPPool = &groupcache.HTTPPool{}
+		l.iam = "127.0.0.1"
+		l.payload = []byte("groupcache:127.0.0.1")
+		l.peerKey = []byte("groupcache")
+		l.isPeer = l.defaultIsPeer
+
+		l.setPeersCh <- []peerdiscovery.Discovered{
+			{Address: "127.0.0.2", Payload: []byte("groupcache:127.0.0.2")},
+			{Address: "127.0.0.3", Payload: []byte("other")},
+		}
+		close(l.setPeersCh)
+		l.setPeers()
+
+		if len(logger.msgs) != len(test.want) {
+			t.Errorf("TestSetPeersLogging(%s): got messages %q, want messages containing %q", test.desc, logger.msgs, test.want)
+		} else {
+			for i, want := range test.want {
+				if !strings.Contains(logger.msgs[i], want) {
+					t.Errorf("TestSetPeersLogging(%s): got message %q, want it to contain %q", test.desc, logger.msgs[i], want)
+				}
+			}
+		}
+		if stdlog.Len() != 0 {
+			t.Errorf("TestSetPeersLogging(%s): got stdlib log output %q, want none", test.desc, stdlog.String())
+		}
+		if got := fmt.Sprint(l.Peers()); got != "[http://127.0.0.2]" {
+			t.Errorf("TestSetPeersLogging(%s): got peers %s, want [http://127.0.0.2]", test.desc, got)
+		}
+	}
+}
+
+// selfSignedTLS creates a *tls.Config for 127.0.0.1 that requires and verifies client
+// certificates signed by the same self-signed certificate.
+func selfSignedTLS() *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "peerpicker test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// listenLocal returns a listener on a port of 127.0.0.1 picked by the OS. The listener is passed
+// to LAN.listenOn(), so that no other process can take the port before it is served.
+func listenLocal() net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	return ln
+}
+
+var (
+	tlsServerOnce sync.Once
+	tlsServer     *LAN
+	tlsServerCfg  *tls.Config
+)
+
+// getTLSServer returns a LAN that serves groupcache with TLS on 127.0.0.1 and the config it uses.
+// groupcache only allows a single HTTPPool to be created per binary, so this is the only LAN
+// with a real HTTPPool and is shared by the tests that need one. It is never closed.
+func getTLSServer() (*LAN, *tls.Config) {
+	tlsServerOnce.Do(func() {
+		tlsServerCfg = selfSignedTLS()
+		ln := listenLocal()
+
+		var err error
+		tlsServer, err = newLAN([]Option{WithTLS(tlsServerCfg)})
+		if err != nil {
+			panic(err)
+		}
+		tlsServer.iam = "127.0.0.1"
+		tlsServer.port = ln.Addr().(*net.TCPAddr).Port
+		tlsServer.setupPool(tlsServer.scheme() + ln.Addr().String())
+		tlsServer.listenOn(ln)
+	})
+	return tlsServer, tlsServerCfg
+}
+
+func TestTLS(t *testing.T) {
+	const content = "hello over tls"
+
+	// This peer serves the group.
+	server, cfg := getTLSServer()
+	port := server.port
+
+	// A group can only be created once per binary, but the test can run more than once.
+	if groupcache.GetGroup("tlstest") == nil {
+		groupcache.NewGroup(
+			"tlstest",
+			1<<20,
+			groupcache.GetterFunc(
+				func(ctx groupcache.Context, key string, dest groupcache.Sink) error {
+					return dest.SetString(content)
+				},
+			),
+		)
+	}
+
+	// This peer only acts as a client, using the same transport setup as a real peer.
+	client, err := newLAN([]Option{WithTLS(cfg)})
+	if err != nil {
+		panic(err)
+	}
+	client.HTTPPool = &groupcache.HTTPPool{}
+	client.setupTLS()
+	transport := client.HTTPPool.Transport(nil)
+
+	u := client.scheme() + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/_groupcache/tlstest/key"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp *http.Response
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			panic(err)
+		}
+		resp, err = transport.RoundTrip(req)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("TestTLS: got err == %s, want err == nil", err)
+		}
+		// The server may not be listening yet.
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("TestTLS: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("TestTLS: problem reading body: %s", err)
+	}
+	got := &pb.GetResponse{}
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatalf("TestTLS: problem unmarshaling response: %s", err)
+	}
+	if string(got.Value) != content {
+		t.Fatalf("TestTLS: got %q, want %q", string(got.Value), content)
+	}
+}
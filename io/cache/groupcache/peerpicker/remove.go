@@ -0,0 +1,102 @@
+package peerpicker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// removePath is the path of the endpoint peers use to ask this node to remove a key. It is
+// served next to the HTTPPool, in the form removePath + <group> + "/" + <key>.
+const removePath = "/_groupcache_remove/"
+
+// OnRemove implements groupcache.PeerRemover.OnRemove(). fn is called when a peer asks this
+// node to remove a key. Anything that can reach this node's port can send these requests,
+// which cause the key to be read from the filler again; use WithTLS() to restrict this to peers.
+func (l *LAN) OnRemove(fn func(group, key string)) {
+	l.onRemove.Store(fn)
+}
+
+// RemoveFromPeers implements groupcache.PeerRemover.RemoveFromPeers(). Each peer is asked to
+// remove the key. An error is returned for each peer that did not confirm the removal.
+func (l *LAN) RemoveFromPeers(ctx context.Context, group, key string) error {
+	var errs []error
+	for _, peer := range l.Peers() {
+		if peer == l.self {
+			continue
+		}
+		if err := l.removeFromPeer(ctx, peer, group, key); err != nil {
+			errs = append(errs, fmt.Errorf("peer(%s): %w", peer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *LAN) removeFromPeer(ctx context.Context, peer, group, key string) error {
+	u := peer + removePath + url.QueryEscape(group) + "/" + url.QueryEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+
+	tr := http.DefaultTransport
+	if l.HTTPPool != nil && l.HTTPPool.Transport != nil {
+		tr = l.HTTPPool.Transport(ctx)
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("server returned: %s", resp.Status)
+	}
+	return nil
+}
+
+// handler returns the http.Handler for the server used with groupcache. It serves removals
+// from peers and passes all other requests to the HTTPPool.
+func (l *LAN) handler() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, removePath) {
+				l.serveRemove(w, r)
+				return
+			}
+			l.HTTPPool.ServeHTTP(w, r)
+		},
+	)
+}
+
+func (l *LAN) serveRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// r.URL.Path has already been unescaped, which would change keys containing "/" or "+".
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), removePath), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	group, err := url.QueryUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "bad group", http.StatusBadRequest)
+		return
+	}
+	key, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		http.Error(w, "bad key", http.StatusBadRequest)
+		return
+	}
+
+	if fn, ok := l.onRemove.Load().(func(group, key string)); ok {
+		fn(group, key)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
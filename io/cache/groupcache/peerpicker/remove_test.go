@@ -0,0 +1,88 @@
+package peerpicker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	gcfs "github.com/gopherfs/fs/io/cache/groupcache"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var _ gcfs.PeerRemover = &LAN{}
+
+func TestRemoveFromPeers(t *testing.T) {
+	type removal struct {
+		Group, Key string
+	}
+	var (
+		mu      sync.Mutex
+		removed []removal
+	)
+
+	peer := testLAN()
+	peer.OnRemove(
+		func(group, key string) {
+			mu.Lock()
+			defer mu.Unlock()
+			removed = append(removed, removal{Group: group, Key: key})
+		},
+	)
+	srv := httptest.NewServer(peer.handler())
+	defer srv.Close()
+
+	// This peer has stopped, so its removal fails.
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stopped.Close()
+
+	l := testLAN()
+	l.self = "http://127.0.0.1:1"
+	l.updatePeers([]string{srv.URL, stopped.URL, l.self}, nil)
+
+	err := l.RemoveFromPeers(context.Background(), "group", "dir/a+b c")
+	if err == nil {
+		t.Errorf("TestRemoveFromPeers(stopped peer): got err == nil, want err != nil")
+	}
+
+	want := []removal{{Group: "group", Key: "dir/a+b c"}}
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := pretty.Compare(want, removed); diff != "" {
+		t.Errorf("TestRemoveFromPeers: -want/+got:\n%s", diff)
+	}
+}
+
+func TestServeRemove(t *testing.T) {
+	l := testLAN()
+	srv := httptest.NewServer(l.handler())
+	defer srv.Close()
+
+	tests := []struct {
+		desc   string
+		method string
+		path   string
+		want   int
+	}{
+		{desc: "no OnRemove", method: http.MethodDelete, path: removePath + "group/key", want: http.StatusNoContent},
+		{desc: "wrong method", method: http.MethodGet, path: removePath + "group/key", want: http.StatusMethodNotAllowed},
+		{desc: "no key", method: http.MethodDelete, path: removePath + "group", want: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, srv.URL+test.path, nil)
+		if err != nil {
+			panic(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("TestServeRemove(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("TestServeRemove(%s): got status %d, want %d", test.desc, resp.StatusCode, test.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package peerpicker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver provides the DNS lookups used by NewFromSRV(). *net.Resolver implements Resolver.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// WithResolver sets the Resolver used by NewFromSRV(). Defaults to net.DefaultResolver.
+func WithResolver(r Resolver) Option {
+	return func(l *LAN) error {
+		l.resolver = r
+		return nil
+	}
+}
+
+// NewFromSRV creates a new *LAN instance listening on 'port' for groupcache connections
+// that discovers peers with DNS instead of LAN broadcasts. This works in environments such
+// as Kubernetes (using a headless service) where broadcast and multicast are not available.
+//
+// Every 'refresh' interval, 'service' is looked up as an SRV record and each target is resolved
+// to an address, which with the record's port becomes a peer. If no SRV records are found,
+// 'service' is looked up as an A/AAAA record and each address is used with 'port'. The result
+// should include this node's address with 'port', as groupcache only recognizes itself by its
+// URL. This node's address can be set with WithSettings() and otherwise is the first usable
+// address on the machine.
+func NewFromSRV(service string, port int, refresh time.Duration, options ...Option) (*LAN, error) {
+	if service == "" {
+		return nil, fmt.Errorf("service must not be empty")
+	}
+	if refresh <= 0 {
+		return nil, fmt.Errorf("refresh must be > 0")
+	}
+
+	l, err := newLAN(options)
+	if err != nil {
+		return nil, err
+	}
+	l.srvName = service
+	l.port = port
+	l.refresh = refresh
+	if l.resolver == nil {
+		l.resolver = net.DefaultResolver
+	}
+
+	if _, _, err := l.findIAm(); err != nil {
+		return nil, err
+	}
+	if l.iam == "" {
+		return nil, fmt.Errorf("could not find an IP address for this machine")
+	}
+
+	l.serve(l.scheme()+net.JoinHostPort(l.iam, strconv.Itoa(port)), port)
+	go l.srvDiscovery()
+
+	return l, nil
+}
+
+func (l *LAN) srvDiscovery() {
+	tick := time.NewTicker(l.refresh)
+	defer tick.Stop()
+
+	for {
+		if err := l.srvRefresh(); err != nil {
+			l.logger.Printf("groupcache peerdiscovery(%s): %s", l.srvName, err)
+		}
+
+		select {
+		case <-l.closed:
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// srvRefresh looks up our peers in DNS and updates the HTTPPool if they have changed.
+func (l *LAN) srvRefresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.refresh)
+	defer cancel()
+
+	peerList, err := l.lookupPeers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(peerList) == 0 {
+		return fmt.Errorf("no peers found")
+	}
+	l.lastDiscovery.Store(time.Now().UnixNano())
+	l.updatePeers(peerList, nil)
+	return nil
+}
+
+func (l *LAN) lookupPeers(ctx context.Context) ([]string, error) {
+	var peerList []string
+
+	_, srvs, err := l.resolver.LookupSRV(ctx, "", "", l.srvName)
+	if err == nil && len(srvs) > 0 {
+		for _, srv := range srvs {
+			addr, err := l.resolveTarget(ctx, strings.TrimSuffix(srv.Target, "."))
+			if err != nil {
+				// One peer that cannot be resolved should not stop us from finding the others.
+				l.logger.Printf("groupcache peerdiscovery(%s): could not resolve target(%s): %s", l.srvName, srv.Target, err)
+				continue
+			}
+			peerList = append(peerList, l.scheme()+net.JoinHostPort(addr, strconv.Itoa(int(srv.Port))))
+		}
+		return peerList, nil
+	}
+
+	hosts, err := l.resolver.LookupHost(ctx, l.srvName)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		peerList = append(peerList, l.scheme()+net.JoinHostPort(host, strconv.Itoa(l.port)))
+	}
+	return peerList, nil
+}
+
+// resolveTarget returns the address of an SRV target. Peers are identified by their URL and
+// this node uses its IP address, so the hostname of a target cannot be used. If target has
+// addresses of both IP families, one of the same family as this node is preferred.
+func (l *LAN) resolveTarget(ctx context.Context, target string) (string, error) {
+	if net.ParseIP(target) != nil {
+		return target, nil
+	}
+	addrs, err := l.resolver.LookupHost(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no addresses found")
+	}
+
+	ipv4 := net.ParseIP(l.iam).To4() != nil
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && (ip.To4() != nil) == ipv4 {
+			return addr, nil
+		}
+	}
+	return addrs[0], nil
+}
@@ -0,0 +1,207 @@
+package peerpicker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+type fakeResolver struct {
+	srvs []*net.SRV
+	// hosts are the addresses of the service, which are used if there are no srvs.
+	hosts []string
+	// targets are the addresses of the targets in srvs.
+	targets map[string][]string
+}
+
+func (f *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if len(f.srvs) == 0 {
+		return "", nil, errors.New("no such host")
+	}
+	return name, f.srvs, nil
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := f.targets[host]; ok {
+		return addrs, nil
+	}
+	if len(f.hosts) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return f.hosts, nil
+}
+
+func TestSRVRefresh(t *testing.T) {
+	resolver := &fakeResolver{
+		targets: map[string][]string{
+			"peer-a.groupcache.local": {"fd00::11", "10.0.0.11"},
+			"peer-b.groupcache.local": {"10.0.0.12"},
+			"peer-c.groupcache.local": {"fd00::13"},
+			"peer-d.groupcache.local": {"10.0.0.14"},
+		},
+	}
+
+	// groupcache only allows a single HTTPPool to be created per binary, so we use a zero
+	// value HTTPPool instead of calling NewFromSRV().
+	l, err := newLAN([]Option{WithResolver(resolver)})
+	if err != nil {
+		panic(err)
+	}
+	l.HTTPPool = &groupcache.HTTPPool{}
+	l.iam = "10.0.0.1"
+	l.srvName = "groupcache.default.svc.cluster.local"
+	l.port = 8000
+	l.refresh = 1 * time.Second
+
+	tests := []struct {
+		desc  string
+		srvs  []*net.SRV
+		hosts []string
+		want  []string
+		err   bool
+	}{
+		{
+			desc: "no records",
+			err:  true,
+		},
+		{
+			desc: "SRV records",
+			srvs: []*net.SRV{
+				{Target: "peer-b.groupcache.local.", Port: 8001},
+				{Target: "peer-a.groupcache.local.", Port: 8001},
+			},
+			// peer-a has an address of the same IP family as this node, which is preferred.
+			want: []string{
+				"http://10.0.0.11:8001",
+				"http://10.0.0.12:8001",
+			},
+		},
+		{
+			desc: "SRV record added",
+			srvs: []*net.SRV{
+				{Target: "peer-b.groupcache.local.", Port: 8001},
+				{Target: "peer-a.groupcache.local.", Port: 8001},
+				{Target: "peer-c.groupcache.local.", Port: 8001},
+			},
+			want: []string{
+				"http://10.0.0.11:8001",
+				"http://10.0.0.12:8001",
+				"http://[fd00::13]:8001",
+			},
+		},
+		{
+			desc: "SRV record replaced",
+			srvs: []*net.SRV{
+				{Target: "peer-d.groupcache.local.", Port: 8001},
+				{Target: "peer-a.groupcache.local.", Port: 8001},
+				{Target: "peer-c.groupcache.local.", Port: 8001},
+			},
+			want: []string{
+				"http://10.0.0.11:8001",
+				"http://10.0.0.14:8001",
+				"http://[fd00::13]:8001",
+			},
+		},
+		{
+			desc: "target that cannot be resolved is skipped",
+			srvs: []*net.SRV{
+				{Target: "peer-a.groupcache.local.", Port: 8001},
+				{Target: "missing.groupcache.local.", Port: 8001},
+				{Target: "10.0.0.15", Port: 8001},
+			},
+			want: []string{
+				"http://10.0.0.11:8001",
+				"http://10.0.0.15:8001",
+			},
+		},
+		{
+			desc:  "fallback to host records",
+			hosts: []string{"10.0.0.2", "10.0.0.1", "fd00::1"},
+			want: []string{
+				"http://10.0.0.1:8000",
+				"http://10.0.0.2:8000",
+				"http://[fd00::1]:8000",
+			},
+		},
+		{
+			desc: "lookup failure keeps previous peers",
+			err:  true,
+			want: []string{
+				"http://10.0.0.1:8000",
+				"http://10.0.0.2:8000",
+				"http://[fd00::1]:8000",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		resolver.srvs = test.srvs
+		resolver.hosts = test.hosts
+
+		err := l.srvRefresh()
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestSRVRefresh(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestSRVRefresh(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, l.Peers()); diff != "" {
+			t.Errorf("TestSRVRefresh(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestSRVSelf(t *testing.T) {
+	// groupcache only allows a single HTTPPool to be created per binary, so this test uses
+	// the server shared with other tests, which expect it to have no peers.
+	l, _ := getTLSServer()
+	defer l.updatePeers(nil, nil)
+
+	self := net.JoinHostPort("127.0.0.1", strconv.Itoa(l.port))
+	l.resolver = &fakeResolver{
+		srvs: []*net.SRV{
+			{Target: "self.groupcache.local.", Port: uint16(l.port)},
+			{Target: "peer-b.groupcache.local.", Port: uint16(l.port)},
+		},
+		targets: map[string][]string{
+			"self.groupcache.local":   {"::1", "127.0.0.1"},
+			"peer-b.groupcache.local": {"127.0.0.2"},
+		},
+	}
+	l.srvName = "groupcache.default.svc.cluster.local"
+	l.refresh = 1 * time.Second
+
+	if err := l.srvRefresh(); err != nil {
+		t.Fatalf("TestSRVSelf: got err == %s, want err == nil", err)
+	}
+	want := []string{"https://" + self, "https://127.0.0.2:" + strconv.Itoa(l.port)}
+	if diff := pretty.Compare(want, l.Peers()); diff != "" {
+		t.Fatalf("TestSRVSelf: -want/+got:\n%s", diff)
+	}
+
+	m := ring(l, l.Peers())
+	owned := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		wantRemote := m.Get(key) != l.self
+		if !wantRemote {
+			owned++
+		}
+		if _, ok := l.PickPeer(key); ok != wantRemote {
+			t.Errorf("TestSRVSelf(%s): got PickPeer() ok == %v, want %v", key, ok, wantRemote)
+		}
+	}
+	if owned == 0 {
+		t.Errorf("TestSRVSelf: this node did not own any keys, peers: %v", l.Peers())
+	}
+}
@@ -0,0 +1,108 @@
+package peerpicker
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/golang/groupcache"
+)
+
+// MaxWeight is the largest weight that can be passed to WithWeight().
+const MaxWeight = 32
+
+// weightReplicas is the number of points a peer has on the consistent hash per unit of weight.
+// This is groupcache's default number of replicas, so peers with a weight of 1 are placed
+// exactly as they are without weights.
+const weightReplicas = 50
+
+// WithWeight sets the weight of this node, which must be between 1 and MaxWeight. A node
+// receives keys in proportion to its weight, so a node with a weight of 4 is assigned about four
+// times as many keys as a node with a weight of 1. This is used when nodes have different
+// capacities. Defaults to 1.
+//
+// The weight is sent to peers in the discovery payload as [peer key]:[iam address]#[weight],
+// such as "groupcache:10.0.0.1#4". An IsPeer passed to WithSettings() can provide the weight
+// of a peer by returning its address in the same form. Peers found with NewFromSRV() have
+// a weight of 1.
+func WithWeight(weight int) Option {
+	return func(l *LAN) error {
+		if weight < 1 || weight > MaxWeight {
+			return fmt.Errorf("WithWeight(%d): weight must be between 1 and %d", weight, MaxWeight)
+		}
+		l.weight = weight
+		return nil
+	}
+}
+
+// poolOptions returns the HTTPPoolOptions that make the HTTPPool use peer weights. Every peer
+// is given enough replicas for MaxWeight and hash() maps the replicas beyond a peer's weight
+// onto the peer's other replicas, so they do not add points to the consistent hash.
+func (l *LAN) poolOptions() *groupcache.HTTPPoolOptions {
+	return &groupcache.HTTPPoolOptions{
+		Replicas: weightReplicas * MaxWeight,
+		HashFn:   l.hash,
+	}
+}
+
+// hash is the consistent hash function used by the HTTPPool. The HTTPPool hashes
+// [replica number][peer] to place each peer replica and hashes keys to find their peer.
+func (l *LAN) hash(data []byte) uint32 {
+	if replica, peer, ok := l.splitReplica(data); ok {
+		if n := l.peerWeight(peer) * weightReplicas; replica >= n {
+			data = []byte(strconv.Itoa(replica%n) + peer)
+		}
+	}
+	return crc32.ChecksumIEEE(data)
+}
+
+// splitReplica splits data into the replica number and peer if data is a replica of a
+// current peer.
+func (l *LAN) splitReplica(data []byte) (replica int, peer string, ok bool) {
+	i := bytes.Index(data, []byte(l.scheme()))
+	if i < 1 {
+		return 0, "", false
+	}
+	replica, err := strconv.Atoi(string(data[:i]))
+	if err != nil || replica < 0 {
+		return 0, "", false
+	}
+	peer = string(data[i:])
+	if _, ok := l.weights()[peer]; !ok {
+		return 0, "", false
+	}
+	return replica, peer, true
+}
+
+// weights returns the weight of each current peer.
+func (l *LAN) weights() map[string]int {
+	w := l.peerWeights.Load()
+	if w == nil {
+		return nil
+	}
+	return w.(map[string]int)
+}
+
+// peerWeight returns the weight of peer, which is 1 if it does not have one.
+func (l *LAN) peerWeight(peer string) int {
+	if w, ok := l.weights()[peer]; ok {
+		return w
+	}
+	return 1
+}
+
+// splitWeight splits an address returned by IsPeer in the form [address]#[weight] into the
+// address and its weight. An address without a weight has a weight of 1.
+func splitWeight(addr string) (string, int, error) {
+	i := strings.LastIndex(addr, "#")
+	if i < 0 {
+		return addr, 1, nil
+	}
+	weight, err := strconv.Atoi(addr[i+1:])
+	if err != nil || weight < 1 || weight > MaxWeight {
+		return addr[:i], 1, fmt.Errorf("peer(%s) has invalid weight(%s)", addr[:i], addr[i+1:])
+	}
+	return addr[:i], weight, nil
+}
@@ -0,0 +1,158 @@
+package peerpicker
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/golang/groupcache"
+	"github.com/golang/groupcache/consistenthash"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/schollz/peerdiscovery"
+)
+
+// testLAN returns a *LAN that can be used without a network. groupcache only allows a
+// single HTTPPool to be created per binary, so a zero value HTTPPool is used.
+func testLAN(options ...Option) *LAN {
+	l, err := newLAN(options)
+	if err != nil {
+		panic(err)
+	}
+	l.HTTPPool = &groupcache.HTTPPool{}
+	l.iam = "127.0.0.1"
+	l.peerKey = []byte("groupcache")
+	l.isPeer = l.defaultIsPeer
+	return l
+}
+
+// ring returns the consistent hash the HTTPPool builds for peers with l.poolOptions().
+func ring(l *LAN, peers []string) *consistenthash.Map {
+	opts := l.poolOptions()
+	m := consistenthash.New(opts.Replicas, opts.HashFn)
+	m.Add(peers...)
+	return m
+}
+
+func TestWeightDistribution(t *testing.T) {
+	const keys = 100000
+
+	tests := []struct {
+		desc   string
+		weight int
+	}{
+		{desc: "weight 2", weight: 2},
+		{desc: "weight 4", weight: 4},
+	}
+
+	for _, test := range tests {
+		// A single peer's share varies with where its points land on the consistent hash,
+		// so the share of a group of heavy peers is compared to a group of light peers.
+		var peers []string
+		weights := map[string]int{}
+		for i := 1; i <= 16; i++ {
+			peer := fmt.Sprintf("http://10.0.0.%d", i)
+			peers = append(peers, peer)
+			weights[peer] = 1
+			if i%2 == 0 {
+				weights[peer] = test.weight
+			}
+		}
+
+		l := testLAN()
+		l.updatePeers(peers, weights)
+		m := ring(l, peers)
+
+		heavy := 0
+		for i := 0; i < keys; i++ {
+			if weights[m.Get(fmt.Sprintf("key-%d", i))] != 1 {
+				heavy++
+			}
+		}
+
+		got := float64(heavy) / keys
+		want := float64(test.weight) / float64(test.weight+1)
+		// crc32 does not spread the points of similar peer names evenly, so this allows for some error.
+		if math.Abs(got-want) > 0.08 {
+			t.Errorf("TestWeightDistribution(%s): got heavy peers share %.2f, want about %.2f", test.desc, got, want)
+		}
+	}
+}
+
+func TestWeightOneMatchesDefault(t *testing.T) {
+	l := testLAN()
+	peers := []string{"http://10.0.0.1", "http://10.0.0.2", "http://10.0.0.3"}
+	l.updatePeers(peers, nil)
+
+	// Peers with a weight of 1 must be placed like groupcache places them without weights,
+	// so that nodes with and without weight support agree.
+	weighted := ring(l, peers)
+	def := consistenthash.New(weightReplicas, nil)
+	def.Add(peers...)
+
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if got, want := weighted.Get(key), def.Get(key); got != want {
+			t.Fatalf("TestWeightOneMatchesDefault(%s): got peer %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestSetPeersWeights(t *testing.T) {
+	l := testLAN(WithLogger(&captureLogger{}))
+
+	l.setPeersCh <- []peerdiscovery.Discovered{
+		{Address: "127.0.0.1", Payload: []byte("groupcache:127.0.0.1#8")},
+		{Address: "127.0.0.2", Payload: []byte("groupcache:127.0.0.2#4")},
+		{Address: "127.0.0.3", Payload: []byte("groupcache:127.0.0.3")},
+		{Address: "127.0.0.4", Payload: []byte("groupcache:127.0.0.4#100")},
+	}
+	close(l.setPeersCh)
+	l.setPeers()
+
+	want := map[string]int{
+		"http://127.0.0.2": 4,
+		"http://127.0.0.3": 1,
+		"http://127.0.0.4": 1,
+	}
+	if diff := pretty.Compare(want, l.weights()); diff != "" {
+		t.Errorf("TestSetPeersWeights: -want/+got:\n%s", diff)
+	}
+	if diff := pretty.Compare([]string{"http://127.0.0.2", "http://127.0.0.3", "http://127.0.0.4"}, l.Peers()); diff != "" {
+		t.Errorf("TestSetPeersWeights(Peers): -want/+got:\n%s", diff)
+	}
+}
+
+func TestWithWeight(t *testing.T) {
+	for _, weight := range []int{0, -1, MaxWeight + 1} {
+		if _, err := newLAN([]Option{WithWeight(weight)}); err == nil {
+			t.Errorf("TestWithWeight(%d): got err == nil, want err != nil", weight)
+		}
+	}
+
+	tests := []struct {
+		desc    string
+		options []Option
+		want    string
+	}{
+		{desc: "default", want: "groupcache:127.0.0.1"},
+		{desc: "weight 1", options: []Option{WithWeight(1)}, want: "groupcache:127.0.0.1"},
+		{desc: "weight 4", options: []Option{WithWeight(4)}, want: "groupcache:127.0.0.1#4"},
+	}
+
+	for _, test := range tests {
+		options := append([]Option{WithSettings(net.ParseIP("127.0.0.1"), nil, nil)}, test.options...)
+		l, err := newLAN(options)
+		if err != nil {
+			t.Errorf("TestWithWeight(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if err := l.defaultSettings(); err != nil {
+			t.Errorf("TestWithWeight(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got := string(l.payload); got != test.want {
+			t.Errorf("TestWithWeight(%s): got payload %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
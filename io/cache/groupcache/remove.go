@@ -0,0 +1,98 @@
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// PeerRemover is implemented by a groupcache.PeerPicker that can ask its peers to remove keys,
+// such as peerpicker.LAN. If the PeerPicker passed to New() implements this, Remove() is sent
+// to peers.
+type PeerRemover interface {
+	// RemoveFromPeers asks every peer to remove key from group.
+	RemoveFromPeers(ctx context.Context, group, key string) error
+	// OnRemove sets fn to be called when a peer asks this node to remove key from group.
+	OnRemove(fn func(group, key string))
+}
+
+// genSep separates a key from its generation in the key used with groupcache. It is not
+// a valid character in names passed to Remove(), so it cannot be confused with part of a key.
+const genSep = "\x00gen="
+
+// genBuckets is the number of generations kept by an FS. Keys are hashed into buckets, so the
+// memory used does not grow with the number of keys removed. Removing a key also changes the
+// generation of the other keys in its bucket, which only causes an extra cache miss for them.
+const genBuckets = 4096
+
+// Remove makes the next Open() of name read the file from the filler instead of returning
+// the cached content, such as after the file changed in the filler. name must be in the form
+// <group>/<key>.
+//
+// groupcache cannot remove cached values, so this is done by changing the key used for name.
+// The old value stays in memory until groupcache evicts it. If the PeerPicker passed to New()
+// implements PeerRemover, peers are asked to do the same. This is best effort and eventually
+// consistent: peers that cannot be reached or have not processed the request yet still return
+// the old content and an error is returned after name was removed locally.
+func (f *FS) Remove(name string) error {
+	groupName, key, err := splitName(name)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(key, genSep) {
+		return fmt.Errorf("groupcache.FS: path(%s) contains an invalid character", name)
+	}
+	if err := f.removeLocal(groupName, key); err != nil {
+		return err
+	}
+
+	pr, ok := f.picker.(PeerRemover)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
+	defer cancel()
+
+	if err := pr.RemoveFromPeers(ctx, groupName, key); err != nil {
+		return fmt.Errorf("groupcache.FS: path(%s) was removed locally, but not from all peers: %w", name, err)
+	}
+	return nil
+}
+
+// removeLocal changes the generation of key in group, so that the next Get() of it misses the cache.
+func (f *FS) removeLocal(groupName, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.groups[groupName]; !ok {
+		return fmt.Errorf("groupcache.FS: group(%s) does not exist", groupName)
+	}
+	f.generations[genBucket(groupName, key)]++
+	return nil
+}
+
+// genBucket returns the index in FS.generations used for key in group.
+func genBucket(groupName, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(groupName + "/" + key))
+	return int(h.Sum32() % genBuckets)
+}
+
+// genKey returns the key used with groupcache for key in group. f.mu must be locked.
+func (f *FS) genKey(groupName, key string) string {
+	gen := f.generations[genBucket(groupName, key)]
+	if gen == 0 {
+		return key
+	}
+	return key + genSep + strconv.FormatUint(gen, 10)
+}
+
+// baseKey removes the generation added by genKey() from key.
+func baseKey(key string) string {
+	if i := strings.LastIndex(key, genSep); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
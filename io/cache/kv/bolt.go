@@ -0,0 +1,83 @@
+package kv
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ Store = &Bolt{}
+
+// boltBucket is the bucket that Bolt stores files in.
+var boltBucket = []byte("files")
+
+// Bolt is a Store that uses a bbolt database.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the bbolt database at path, creating it if it does not exist. A bbolt
+// database can only be opened by one process at a time, so this fails if another process
+// has it open.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open bbolt database(%s): %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Get implements Store.Get().
+func (b *Bolt) Get(key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if v == nil {
+			return fs.ErrNotExist
+		}
+		// v is only valid for the life of the transaction.
+		value = make([]byte, len(v))
+		copy(value, v)
+		return nil
+	})
+	return value, err
+}
+
+// Put implements Store.Put().
+func (b *Bolt) Put(key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), value)
+	})
+}
+
+// Delete implements Store.Delete().
+func (b *Bolt) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+// Range implements Store.Range().
+func (b *Bolt) Range(fn func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// Close implements Store.Close().
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,516 @@
+/*
+Package kv provides an io/fs.FS that stores files in an embedded key/value store that can be
+used in our cache.FS package. Unlike the disk cache, all files are kept in a single database
+file, which survives restarts without the overhead of a file per cache entry.
+
+By default this uses a bbolt database:
+
+	kvFS, err := kv.NewBolt(
+		"/var/cache/app/cache.db",
+		kv.WithExpireCheck(1 * time.Minute),
+		kv.WithExpireFiles(30 * time.Minute),
+	)
+	if err != nil {
+		// Do something
+	}
+	defer kvFS.Close()
+
+	if err := kvFS.WriteFile("gopher.jpg", gopherBytes, 0644); err != nil {
+		// Do something
+	}
+
+Other stores can be used by implementing Store and passing it to New().
+*/
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+)
+
+var _ cache.CacheFS = &FS{}
+
+// Store is a key/value store that FS keeps files in. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the value stored at key. If key does not exist, the error must wrap
+	// fs.ErrNotExist. The Store must not modify the returned slice.
+	Get(key string) ([]byte, error)
+	// Put stores value at key, replacing any existing value.
+	Put(key string, value []byte) error
+	// Delete removes key. Removing a key that does not exist is not an error.
+	Delete(key string) error
+	// Range calls fn for every key and value in the Store. value is only valid until fn returns
+	// and fn must not modify the Store. If fn returns an error, Range stops and returns it.
+	Range(fn func(key string, value []byte) error) error
+	// Close closes the Store.
+	Close() error
+}
+
+// FS provides an io.FS implementation that stores files in a Store. FS must have
+// Close() called to stop internal goroutines and close the Store.
+type FS struct {
+	store  Store
+	logger jsfs.Logger
+
+	expireDuration time.Duration
+	checkTime      time.Duration
+
+	// mu prevents the expiration sweep from removing a file that was rewritten after
+	// the sweep found it expired.
+	mu sync.Mutex
+
+	closeCh chan struct{}
+}
+
+// Option is an optional argument for the New() constructor.
+type Option func(f *FS) error
+
+// WithExpireCheck changes at what interval we remove expired files from the Store.
+// Expired files cannot be read even before they are removed. Defaults to 1 minute.
+func WithExpireCheck(d time.Duration) Option {
+	return func(f *FS) error {
+		if d <= 0 {
+			return fmt.Errorf("WithExpireCheck(%v) must be > 0", d)
+		}
+		f.checkTime = d
+		return nil
+	}
+}
+
+// WithExpireFiles sets how long files written with WriteFile() are kept. If d <= 0, files
+// do not expire. This can be changed for a file with ExpireFiles() when using OpenFile().
+// Defaults to 30 minutes.
+func WithExpireFiles(d time.Duration) Option {
+	return func(f *FS) error {
+		f.expireDuration = d
+		return nil
+	}
+}
+
+// WithLogger allows setting a customer Logger. Defaults to using the
+// stdlib logger.
+func WithLogger(l jsfs.Logger) Option {
+	return func(f *FS) error {
+		f.logger = l
+		return nil
+	}
+}
+
+// New creates a new FS that stores files in store. Close() on the FS closes store.
+func New(store Store, options ...Option) (*FS, error) {
+	if store == nil {
+		return nil, errors.New("kv.New() requires a non-nil Store")
+	}
+
+	sys := &FS{
+		store:          store,
+		logger:         jsfs.DefaultLogger{},
+		expireDuration: 30 * time.Minute,
+		checkTime:      1 * time.Minute,
+		closeCh:        make(chan struct{}),
+	}
+
+	for _, o := range options {
+		if err := o(sys); err != nil {
+			return nil, err
+		}
+	}
+
+	go sys.expireLoop()
+
+	return sys, nil
+}
+
+// NewBolt creates a new FS that stores files in the bbolt database at path, which is created
+// if it does not exist. See OpenBolt().
+func NewBolt(path string, options ...Option) (*FS, error) {
+	store, err := OpenBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := New(store, options...)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close stops the expiration sweep and closes the Store.
+func (f *FS) Close() error {
+	close(f.closeCh)
+	return f.store.Close()
+}
+
+// Open implements fs.FS.Open(). If name does not exist or has expired, the error wraps fs.ErrNotExist.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.get(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &readFile{
+		content: e.content,
+		fi:      fileInfo{name: path.Base(name), size: int64(len(e.content)), mode: e.mode, modTime: e.modTime},
+	}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	e, err := f.get(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return e.content, nil
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.get(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fileInfo{name: path.Base(name), size: int64(len(e.content)), mode: e.mode, modTime: e.modTime}, nil
+}
+
+type ofOptions struct {
+	flags       int
+	expireFiles time.Duration
+	expireSet   bool
+}
+
+func (o *ofOptions) defaults() {
+	o.flags = os.O_RDONLY
+}
+
+// ExpireFiles expires the file written with OpenFile() at duration d instead of the
+// duration set with WithExpireFiles(). If d <= 0, the file does not expire.
+func ExpireFiles(d time.Duration) jsfs.OFOption {
+	return func(o interface{}) error {
+		opts, ok := o.(*ofOptions)
+		if !ok {
+			return fmt.Errorf("bug: kv.ofOptions was not passed(%T)", o)
+		}
+		opts.expireFiles = d
+		opts.expireSet = true
+		return nil
+	}
+}
+
+// Flags allows the passing of os.O_RDONLY/os.O_WRONLY/O_EXCL/O_TRUNC/O_CREATE flags to OpenFile().
+// By default this is O_RDONLY.
+func Flags(flags int) jsfs.OFOption {
+	return func(o interface{}) error {
+		opts, ok := o.(*ofOptions)
+		if !ok {
+			return fmt.Errorf("bug: kv.ofOptions was not passed(%T)", o)
+		}
+		opts.flags = flags
+		return nil
+	}
+}
+
+// OpenFile implements fs.OpenFiler.OpenFile(). We support os.O_CREATE, os.O_EXCL, os.O_RDONLY, os.O_WRONLY,
+// and os.O_TRUNC. If OpenFile is passed O_RDONLY, this calls Open() and ignores all options.
+// When writing a file, the file is not written until Close() is called on the file.
+func (f *FS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	opts := ofOptions{}
+	opts.defaults()
+
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// os.O_RDONLY is 0, so it is set when neither os.O_WRONLY or os.O_RDWR is.
+	if opts.flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f.Open(name)
+	}
+
+	if !isFlagSet(opts.flags, os.O_WRONLY) {
+		return nil, fmt.Errorf("must set either O_RDONLY or O_WRONLY: %w", jsfs.ErrUnsupportedFlag)
+	}
+
+	_, err := f.get(name)
+	switch {
+	case err == nil:
+		if isFlagSet(opts.flags, os.O_EXCL) {
+			return nil, &fs.PathError{Op: "openfile", Path: name, Err: fs.ErrExist}
+		}
+		if !isFlagSet(opts.flags, os.O_TRUNC) {
+			return nil, fmt.Errorf("did not receive O_TRUNC when file exists. kv only supports truncation: %w", jsfs.ErrUnsupportedFlag)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if !isFlagSet(opts.flags, os.O_CREATE) {
+			return nil, fmt.Errorf("file (%s) did not exist and did not receive O_CREATE", name)
+		}
+	default:
+		return nil, err
+	}
+
+	ttl := f.expireDuration
+	if opts.expireSet {
+		ttl = opts.expireFiles
+	}
+
+	return &writeFile{
+		fs:      f,
+		name:    name,
+		perm:    perm.Perm(),
+		ttl:     ttl,
+		content: &bytes.Buffer{},
+	}, nil
+}
+
+// WriteFile implements jsfs.Writer.WriteFile(). The file expires after the duration set
+// with WithExpireFiles().
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	if !perm.IsRegular() {
+		return fmt.Errorf("non-regular file (perm mode bits are set)")
+	}
+	return f.put(name, content, perm.Perm(), f.expireDuration)
+}
+
+// Remove removes the file at name. Removing a file that does not exist is not an error.
+func (f *FS) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.store.Delete(name)
+}
+
+// get returns the unexpired entry at name.
+func (f *FS) get(name string) (entry, error) {
+	b, err := f.store.Get(name)
+	if err != nil {
+		return entry{}, err
+	}
+	e, err := decodeEntry(b)
+	if err != nil {
+		return entry{}, fmt.Errorf("file(%s): %w", name, err)
+	}
+	if e.expired(time.Now()) {
+		return entry{}, fs.ErrNotExist
+	}
+	return e, nil
+}
+
+// put stores content at name. If ttl > 0, the file expires after ttl.
+func (f *FS) put(name string, content []byte, perm fs.FileMode, ttl time.Duration) error {
+	now := time.Now()
+	e := entry{modTime: now, mode: perm, content: content}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.store.Put(name, e.encode())
+}
+
+func (f *FS) expireLoop() {
+	for {
+		select {
+		case <-f.closeCh:
+			return
+		case <-time.After(f.checkTime):
+			f.deleteExpired()
+		}
+	}
+}
+
+// deleteExpired removes all expired files from the Store.
+func (f *FS) deleteExpired() {
+	now := time.Now()
+
+	var expired []string
+	err := f.store.Range(
+		func(key string, value []byte) error {
+			e, err := decodeEntry(value)
+			if err != nil || e.expired(now) {
+				expired = append(expired, key)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		f.logger.Printf("kv: problem finding expired files: %s", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range expired {
+		// The file may have been written again since Range() saw it.
+		b, err := f.store.Get(key)
+		if err != nil {
+			continue
+		}
+		if e, err := decodeEntry(b); err == nil && !e.expired(now) {
+			continue
+		}
+		if err := f.store.Delete(key); err != nil {
+			f.logger.Printf("kv: problem removing expired file(%s): %s", key, err)
+		}
+	}
+}
+
+func isFlagSet(flags, flag int) bool {
+	return flags&flag != 0
+}
+
+// headerLen is the length of the expiration time, modification time and mode stored
+// before the content of each value.
+const headerLen = 8 + 8 + 4
+
+// entry is a file as stored in the Store.
+type entry struct {
+	// expires is when the file expires. The zero value means it does not expire.
+	expires time.Time
+	modTime time.Time
+	mode    fs.FileMode
+	content []byte
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+func (e entry) encode() []byte {
+	b := make([]byte, headerLen+len(e.content))
+	var expires int64
+	if !e.expires.IsZero() {
+		expires = e.expires.UnixNano()
+	}
+	binary.BigEndian.PutUint64(b[0:8], uint64(expires))
+	binary.BigEndian.PutUint64(b[8:16], uint64(e.modTime.UnixNano()))
+	binary.BigEndian.PutUint32(b[16:20], uint32(e.mode))
+	copy(b[headerLen:], e.content)
+	return b
+}
+
+func decodeEntry(b []byte) (entry, error) {
+	if len(b) < headerLen {
+		return entry{}, fmt.Errorf("stored value is %d bytes, smaller than the %d byte header", len(b), headerLen)
+	}
+	e := entry{
+		modTime: time.Unix(0, int64(binary.BigEndian.Uint64(b[8:16]))),
+		mode:    fs.FileMode(binary.BigEndian.Uint32(b[16:20])),
+		content: b[headerLen:],
+	}
+	if expires := int64(binary.BigEndian.Uint64(b[0:8])); expires != 0 {
+		e.expires = time.Unix(0, expires)
+	}
+	return e, nil
+}
+
+type readFile struct {
+	content []byte
+	fi      fileInfo
+	index   int
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *readFile) Read(b []byte) (int, error) {
+	if f.index >= len(f.content) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, f.content[f.index:])
+	f.index += n
+	return n, nil
+}
+
+func (f *readFile) Close() error {
+	return nil
+}
+
+type writeFile struct {
+	fs      *FS
+	name    string
+	perm    fs.FileMode
+	ttl     time.Duration
+	content *bytes.Buffer
+
+	sync.Mutex
+	closed bool
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	return nil, fmt.Errorf("Stat() not supported on a writeable fs.File")
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	return 0, fmt.Errorf("Read() not supported on writeable fs.File")
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.content.Write(b)
+}
+
+func (f *writeFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("file is closed")
+	}
+	if err := f.fs.put(f.name, f.content.Bytes(), f.perm, f.ttl); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f fileInfo) Name() string {
+	return f.name
+}
+
+func (f fileInfo) Size() int64 {
+	return f.size
+}
+
+func (f fileInfo) Mode() fs.FileMode {
+	return f.mode
+}
+
+func (f fileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f fileInfo) IsDir() bool {
+	return false
+}
+
+func (f fileInfo) Sys() interface{} {
+	return nil
+}
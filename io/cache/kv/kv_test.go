@@ -0,0 +1,212 @@
+package kv
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopherfs/fs/fstesting"
+)
+
+// mapStore is an in-memory Store.
+type mapStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{values: map[string][]byte{}}
+}
+
+func (m *mapStore) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.values[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return v, nil
+}
+
+func (m *mapStore) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[key] = value
+	return nil
+}
+
+func (m *mapStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.values, key)
+	return nil
+}
+
+func (m *mapStore) Range(fn func(key string, value []byte) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, v := range m.values {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mapStore) Close() error {
+	return nil
+}
+
+func (m *mapStore) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.values)
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	const content = "joshua tree"
+
+	kvFS, err := NewBolt(path)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := kvFS.WriteFile("dir/file.txt", []byte(content), 0640); err != nil {
+		t.Fatalf("TestRoundTrip(WriteFile): got err == %s, want err == nil", err)
+	}
+
+	file, err := kvFS.OpenFile("dir/streamed.txt", 0644, Flags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestRoundTrip(OpenFile): got err == %s, want err == nil", err)
+	}
+	if _, err := file.(io.Writer).Write([]byte(content)); err != nil {
+		t.Fatalf("TestRoundTrip(Write): got err == %s, want err == nil", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("TestRoundTrip(Close): got err == %s, want err == nil", err)
+	}
+
+	// Without Flags(), OpenFile() opens the file for reading.
+	rfile, err := kvFS.OpenFile("dir/file.txt", 0644)
+	if err != nil {
+		t.Fatalf("TestRoundTrip(OpenFile without flags): got err == %s, want err == nil", err)
+	}
+	b, err := io.ReadAll(rfile)
+	rfile.Close()
+	if err != nil || string(b) != content {
+		t.Errorf("TestRoundTrip(OpenFile without flags): got %q, %v, want %q, nil", b, err, content)
+	}
+
+	if _, err := kvFS.OpenFile("dir/file.txt", 0644, Flags(os.O_WRONLY|os.O_CREATE|os.O_EXCL)); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("TestRoundTrip(OpenFile O_EXCL): got err == %v, want fs.ErrExist", err)
+	}
+
+	// Reopen the database to make sure files survive a restart.
+	if err := kvFS.Close(); err != nil {
+		t.Fatalf("TestRoundTrip(Close FS): got err == %s, want err == nil", err)
+	}
+	kvFS, err = NewBolt(path)
+	if err != nil {
+		t.Fatalf("TestRoundTrip(reopen): got err == %s, want err == nil", err)
+	}
+	defer kvFS.Close()
+
+	for _, name := range []string{"dir/file.txt", "dir/streamed.txt"} {
+		b, err := kvFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestRoundTrip(ReadFile(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("TestRoundTrip(ReadFile(%s)): got %q, want %q", name, b, content)
+		}
+	}
+
+	fi, err := kvFS.Stat("dir/file.txt")
+	if err != nil {
+		t.Fatalf("TestRoundTrip(Stat): got err == %s, want err == nil", err)
+	}
+	if fi.Size() != int64(len(content)) || fi.Mode() != 0640 || fi.ModTime().IsZero() {
+		t.Errorf("TestRoundTrip(Stat): got size %d, mode %v, modTime %v, want size %d, mode %v, non-zero modTime", fi.Size(), fi.Mode(), fi.ModTime(), len(content), fs.FileMode(0640))
+	}
+
+	if err := kvFS.Remove("dir/file.txt"); err != nil {
+		t.Fatalf("TestRoundTrip(Remove): got err == %s, want err == nil", err)
+	}
+	if _, err := kvFS.Open("dir/file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestRoundTrip(Open after Remove): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	store := newMapStore()
+	kvFS, err := New(store, WithExpireFiles(100*time.Millisecond), WithExpireCheck(50*time.Millisecond))
+	if err != nil {
+		panic(err)
+	}
+	defer kvFS.Close()
+
+	if err := kvFS.WriteFile("expires", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	file, err := kvFS.OpenFile("forever", 0644, Flags(os.O_WRONLY|os.O_CREATE), ExpireFiles(0))
+	if err != nil {
+		panic(err)
+	}
+	if err := file.Close(); err != nil {
+		panic(err)
+	}
+
+	if _, err := kvFS.ReadFile("expires"); err != nil {
+		t.Fatalf("TestExpire(before expiration): got err == %s, want err == nil", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := kvFS.ReadFile("expires"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestExpire(after expiration): got err == %v, want fs.ErrNotExist", err)
+	}
+
+	// Wait for the sweeper to remove the expired file from the store.
+	deadline := time.Now().Add(2 * time.Second)
+	for store.len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := store.Get("expires"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestExpire(sweep): expired file was not removed from the Store")
+	}
+	if _, err := kvFS.ReadFile("forever"); err != nil {
+		t.Errorf("TestExpire(ExpireFiles(0)): got err == %s, want err == nil", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"conformance/path/to/file": []byte("content"),
+		"conformance/root":         []byte("root content"),
+	}
+
+	kvFS, err := New(newMapStore())
+	if err != nil {
+		panic(err)
+	}
+	defer kvFS.Close()
+
+	for name, content := range files {
+		if err := kvFS.WriteFile(name, content, 0644); err != nil {
+			t.Fatalf("TestConformance(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	fstesting.Run(t, kvFS, files, fstesting.NoDirs())
+}
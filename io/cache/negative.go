@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// negativeCache remembers names that were not found in storage for a ttl.
+type negativeCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]time.Time // name -> expiration
+	lastSweep time.Time
+	// writes is incremented on every invalidation. This prevents a read that started
+	// before a write from recording a stale not found result.
+	writes uint64
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	return &negativeCache{ttl: ttl, now: time.Now, entries: map[string]time.Time{}}
+}
+
+// has returns true if name was recently not found.
+func (n *negativeCache) has(name string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	exp, ok := n.entries[name]
+	if !ok {
+		return false
+	}
+	if n.now().Before(exp) {
+		return true
+	}
+	delete(n.entries, name)
+	return false
+}
+
+// generation returns a value that must be passed to add(). This must be called before
+// the read from storage starts.
+func (n *negativeCache) generation() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.writes
+}
+
+// add records that name was not found. If an invalidation has happened since gen was
+// retrieved, this does nothing.
+func (n *negativeCache) add(name string, gen uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if gen != n.writes {
+		return
+	}
+
+	now := n.now()
+	// Remove expired entries periodically so that lookups of many different missing
+	// names don't grow the map forever.
+	if now.Sub(n.lastSweep) > n.ttl {
+		for k, exp := range n.entries {
+			if !now.Before(exp) {
+				delete(n.entries, k)
+			}
+		}
+		n.lastSweep = now
+	}
+	n.entries[name] = now.Add(n.ttl)
+}
+
+// remove removes any entry for name.
+func (n *negativeCache) remove(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.writes++
+	delete(n.entries, name)
+}
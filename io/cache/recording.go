@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+
+	jsfs "github.com/gopherfs/fs"
+	"golang.org/x/sync/errgroup"
+)
+
+var _ CacheFS = &RecordingFS{}
+
+// RecordingFS wraps a CacheFS and records the names of files read with ReadFile(). This can
+// be used to find what files are being accessed in order to warm a cache with Prefetch().
+// Only the most recent reads are kept.
+type RecordingFS struct {
+	fsys CacheFS
+
+	mu     sync.Mutex
+	recent []string
+	next   int
+	full   bool
+}
+
+// NewRecordingFS is the constructor for RecordingFS. size is the number of recent
+// ReadFile() names that are kept.
+func NewRecordingFS(fsys CacheFS, size int) (*RecordingFS, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("NewRecordingFS(size: %d) must have size > 0", size)
+	}
+	return &RecordingFS{fsys: fsys, recent: make([]string, size)}, nil
+}
+
+// Open implements fs.FS.Open(). This is not recorded.
+func (r *RecordingFS) Open(name string) (fs.File, error) {
+	return r.fsys.Open(name)
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile(). This is not recorded.
+func (r *RecordingFS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	return r.fsys.OpenFile(name, perm, options...)
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile(). name is recorded whether or not the read succeeds.
+func (r *RecordingFS) ReadFile(name string) ([]byte, error) {
+	r.record(name)
+	return r.fsys.ReadFile(name)
+}
+
+// Stat implements fs.StatFS.Stat(). This is not recorded.
+func (r *RecordingFS) Stat(name string) (fs.FileInfo, error) {
+	return r.fsys.Stat(name)
+}
+
+// WriteFile implements jsfs.Writer.WriteFile().
+func (r *RecordingFS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	return r.fsys.WriteFile(name, content, perm)
+}
+
+// SetFiller implements SetFiller.SetFiller() if the wrapped CacheFS implements SetFiller.
+// Otherwise this does nothing.
+func (r *RecordingFS) SetFiller(fsys CacheFS) {
+	if v, ok := r.fsys.(SetFiller); ok {
+		v.SetFiller(fsys)
+	}
+}
+
+func (r *RecordingFS) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recent[r.next] = name
+	r.next++
+	if r.next == len(r.recent) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Recent returns the names of the most recent ReadFile() calls, oldest first.
+func (r *RecordingFS) Recent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]string{}, r.recent[:r.next]...)
+	}
+	out := make([]string, 0, len(r.recent))
+	out = append(out, r.recent[r.next:]...)
+	return append(out, r.recent[:r.next]...)
+}
+
+// prefetchConcurrency is the maximum number of concurrent reads done by Prefetch().
+const prefetchConcurrency = 10
+
+// Prefetch concurrently reads names from the wrapped CacheFS so that they are pulled
+// into the cache before they are needed. Prefetched names are not recorded. This returns
+// the first error encountered, but all names are still read.
+func (r *RecordingFS) Prefetch(names ...string) error {
+	g := errgroup.Group{}
+	g.SetLimit(prefetchConcurrency)
+
+	for _, name := range names {
+		name := name
+		g.Go(func() error {
+			if _, err := r.fsys.ReadFile(name); err != nil {
+				return fmt.Errorf("prefetch of file(%s) failed: %w", name, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
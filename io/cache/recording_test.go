@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestRecent(t *testing.T) {
+	store := simple.New()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := store.WriteFile(name, []byte(name), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	tests := []struct {
+		desc  string
+		reads []string
+		want  []string
+	}{
+		{desc: "no reads", want: []string{}},
+		{desc: "less than size", reads: []string{"a", "b"}, want: []string{"a", "b"}},
+		{desc: "exactly size", reads: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{desc: "wraps", reads: []string{"a", "b", "c", "d", "a"}, want: []string{"c", "d", "a"}},
+		{desc: "records misses", reads: []string{"a", "missing"}, want: []string{"a", "missing"}},
+	}
+
+	for _, test := range tests {
+		r, err := NewRecordingFS(store, 3)
+		if err != nil {
+			panic(err)
+		}
+		for _, name := range test.reads {
+			r.ReadFile(name)
+		}
+		if diff := pretty.Compare(test.want, r.Recent()); diff != "" {
+			t.Errorf("TestRecent(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	if _, err := NewRecordingFS(store, 0); err == nil {
+		t.Errorf("TestRecent(size 0): got err == nil, want err != nil")
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	top := newLockedFS()
+	store := simple.New()
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		if err := store.WriteFile(name, []byte(name), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	c, err := New(top, store)
+	if err != nil {
+		panic(err)
+	}
+	r, err := NewRecordingFS(c, 10)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := r.Prefetch(names...); err != nil {
+		t.Fatalf("TestPrefetch: got err == %s, want err == nil", err)
+	}
+	if len(r.Recent()) != 0 {
+		t.Errorf("TestPrefetch: prefetched names were recorded: %v", r.Recent())
+	}
+
+	// The cache is backfilled in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for _, name := range names {
+		for {
+			if _, err := top.Stat(name); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("TestPrefetch: file(%s) was never written to the top cache layer", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if err := r.Prefetch("missing"); err == nil {
+		t.Errorf("TestPrefetch(missing file): got err == nil, want err != nil")
+	}
+}
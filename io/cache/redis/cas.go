@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// versionPrefix is prepended to a file's name to get the key that stores the version
+// of a file written with WriteFileCAS().
+const versionPrefix = "__version__:"
+
+func versionKey(name string) string {
+	return versionPrefix + name
+}
+
+// VersionMismatchError is returned by WriteFileCAS() when the file's current version
+// is not the expected version.
+type VersionMismatchError struct {
+	// Name is the name of the file.
+	Name string
+	// Expected is the version passed to WriteFileCAS().
+	Expected int64
+	// Current is the version of the file when WriteFileCAS() was attempted.
+	Current int64
+}
+
+// Error implements error.Error().
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("file(%s) is at version %d, expected version %d", e.Name, e.Current, e.Expected)
+}
+
+// casScriptSrc atomically checks the version of a file and, if it matches, writes the file's
+// content, modification time and new version. It returns {1, newVersion} on success
+// or {0, currentVersion} on a version mismatch.
+//
+// KEYS: file, version key, modtime key
+// ARGV: expected version, content, modtime, ttl in milliseconds (0 is no expiration, -1 keeps the ttl)
+const casScriptSrc = `
+local cur = tonumber(redis.call("GET", KEYS[2]) or "0")
+if cur ~= tonumber(ARGV[1]) then
+	return {0, cur}
+end
+local ver = cur + 1
+local ttl = tonumber(ARGV[4])
+local vals = {ARGV[2], ver, ARGV[3]}
+for i, key in ipairs(KEYS) do
+	if ttl > 0 then
+		redis.call("SET", key, vals[i], "PX", ttl)
+	elseif ttl < 0 then
+		redis.call("SET", key, vals[i], "KEEPTTL")
+	else
+		redis.call("SET", key, vals[i])
+	end
+end
+return {1, ver}
+`
+
+var casScript = redis.NewScript(casScriptSrc)
+
+// WriteFileCAS writes content to name only if the file's current version is expectedVersion,
+// returning the file's new version. This allows optimistic concurrency, where a client reads
+// a file and its Version(), modifies the content and writes it back. If another client wrote
+// the file in between, this returns a *VersionMismatchError and the caller should read the file
+// and try again. The check and the write happen atomically in a Lua script on the server.
+//
+// A file that does not exist or has never been written with WriteFileCAS() is at version 0.
+// WriteFile() does not change a file's version, so files coordinated with WriteFileCAS() should
+// not also be written with WriteFile(). Remove() resets the version and Rename() moves it with
+// the file. The options from WithWriteFileOFOptions() are applied as they are with WriteFile().
+// This is not supported with WithHashStorage() or with Redis Cluster, as the file and its
+// metadata are stored in keys that may hash to different slots.
+func (f *FS) WriteFileCAS(name string, content []byte, expectedVersion int64, perm fs.FileMode) (newVersion int64, err error) {
+	if f.hashStorage {
+		return 0, fmt.Errorf("WriteFileCAS() is not supported with WithHashStorage()")
+	}
+	if !perm.IsRegular() {
+		return 0, fmt.Errorf("non-regular file (perm mode bits are set)")
+	}
+
+	opts := ofOptions{}
+	opts.defaults()
+	for _, o := range f.writeOFOptions(name) {
+		if err := o(&opts); err != nil {
+			return 0, err
+		}
+	}
+
+	var ttl int64
+	switch {
+	case opts.expireFiles == redis.KeepTTL:
+		ttl = -1
+	case opts.expireFiles > 0:
+		ttl = opts.expireFiles.Milliseconds()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.writeTimeout)
+	defer cancel()
+
+	result, err := casScript.Run(
+		ctx,
+		f.client,
+		[]string{name, versionKey(name), modTimeKey(name)},
+		expectedVersion, content, f.clock.Now().UnixNano(), ttl,
+	).Int64Slice()
+	if err != nil {
+		return 0, fmt.Errorf("could not write file(%s): %w", name, err)
+	}
+	if len(result) != 2 {
+		return 0, fmt.Errorf("bug: WriteFileCAS script returned %v", result)
+	}
+	if result[0] == 0 {
+		return 0, &VersionMismatchError{Name: name, Expected: expectedVersion, Current: result[1]}
+	}
+	return result[1], nil
+}
+
+// Version returns the version of the file at name as used by WriteFileCAS(). This is 0 if the
+// file does not exist or was never written with WriteFileCAS().
+func (f *FS) Version(name string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
+	defer cancel()
+
+	v, err := f.client.Get(ctx, versionKey(name)).Int64()
+	switch {
+	case err == redis.Nil:
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("could not get version of file(%s): %w", name, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,564 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var errWrongType = fakeRedisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// fakeRedisError implements redis.Error.
+type fakeRedisError string
+
+func (e fakeRedisError) Error() string { return string(e) }
+func (e fakeRedisError) RedisError()   {}
+
+type fakeValue struct {
+	content []byte
+	hash    map[string]string
+	ttl     time.Duration
+}
+
+// fakeClient is an in-memory redis.Cmdable that implements the commands used by FS.
+// Calling any other command will panic.
+type fakeClient struct {
+	redis.Cmdable
+
+	mu       sync.Mutex
+	values   map[string]fakeValue
+	commands []string
+	// timeouts are the time remaining until the context deadline for each command.
+	// This is 0 if the context had no deadline.
+	timeouts []time.Duration
+	// pingErr is returned by Ping().
+	pingErr error
+	// cursors maps SCAN cursors to the last key returned.
+	cursors map[uint64]string
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{values: map[string]fakeValue{}}
+}
+
+func (c *fakeClient) record(ctx context.Context, cmd string, args ...string) {
+	c.commands = append(c.commands, fmt.Sprint(cmd, args))
+	if d, ok := ctx.Deadline(); ok {
+		c.timeouts = append(c.timeouts, time.Until(d))
+	} else {
+		c.timeouts = append(c.timeouts, 0)
+	}
+}
+
+func (c *fakeClient) Ping(ctx context.Context) *redis.StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "ping")
+
+	cmd := redis.NewStatusCmd(ctx)
+	if c.pingErr != nil {
+		cmd.SetErr(c.pingErr)
+		return cmd
+	}
+	cmd.SetVal("PONG")
+	return cmd
+}
+
+func (c *fakeClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "get", key)
+
+	v, ok := c.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	if v.hash != nil {
+		return redis.NewStringResult("", errWrongType)
+	}
+	return redis.NewStringResult(string(v.content), nil)
+}
+
+func (c *fakeClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "set", key)
+
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = append([]byte{}, v...)
+	case string:
+		b = []byte(v)
+	case int64:
+		b = []byte(strconv.FormatInt(v, 10))
+	default:
+		return redis.NewStatusResult("", fmt.Errorf("fakeClient: unsupported value type %T", value))
+	}
+
+	ttl := expiration
+	if expiration == redis.KeepTTL {
+		ttl = c.values[key].ttl
+	}
+	c.values[key] = fakeValue{content: b, ttl: ttl}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (c *fakeClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "del", keys...)
+
+	var n int64
+	for _, k := range keys {
+		if _, ok := c.values[k]; ok {
+			delete(c.values, k)
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// Scan implements SCAN. Keys are scanned in sorted order and a cursor resumes after the
+// last key seen, so keys deleted during a scan do not cause others to be skipped. Only
+// patterns of a literal prefix followed by "*" are supported.
+func (c *fakeClient) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "scan", strconv.FormatUint(cursor, 10), match)
+
+	if !strings.HasSuffix(match, "*") {
+		panic(fmt.Sprintf("fakeClient: unsupported SCAN pattern %q", match))
+	}
+	prefix := unescapeGlob(strings.TrimSuffix(match, "*"))
+
+	var after string
+	if cursor != 0 {
+		after = c.cursors[cursor]
+	}
+	all := make([]string, 0, len(c.values))
+	for k := range c.values {
+		if cursor == 0 || k > after {
+			all = append(all, k)
+		}
+	}
+	sort.Strings(all)
+
+	if int64(len(all)) > count {
+		all = all[:count]
+	}
+	var keys []string
+	for _, k := range all {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	if int64(len(all)) < count {
+		return redis.NewScanCmdResult(keys, 0, nil)
+	}
+	if c.cursors == nil {
+		c.cursors = map[uint64]string{}
+	}
+	next := uint64(len(c.cursors) + 1)
+	c.cursors[next] = all[len(all)-1]
+	return redis.NewScanCmdResult(keys, next, nil)
+}
+
+func unescapeGlob(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			sb.WriteByte(s[i])
+		case '*', '?', '[', ']':
+			panic(fmt.Sprintf("fakeClient: unsupported SCAN pattern %q", s))
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// Pipelined runs the commands queued by fn immediately. See fakePipeliner for the supported commands.
+func (c *fakeClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	p := &fakePipeliner{c: c}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	return p.cmds, nil
+}
+
+// TxPipelined runs the commands queued by fn immediately, like Pipelined(). A command that
+// fails does not undo the commands before it, but FS never queues commands that fail.
+func (c *fakeClient) TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	p := &fakePipeliner{c: c}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	for _, cmd := range p.cmds {
+		if err := cmd.Err(); err != nil {
+			return p.cmds, err
+		}
+	}
+	return p.cmds, nil
+}
+
+// fakePipeliner is a redis.Pipeliner that runs commands on a fakeClient when they are queued.
+// Calling a command other than Del, HSet, HDel, Expire or Persist will panic.
+type fakePipeliner struct {
+	redis.Pipeliner
+
+	c    *fakeClient
+	cmds []redis.Cmder
+}
+
+func (p *fakePipeliner) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	cmd := p.c.Del(ctx, keys...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *fakePipeliner) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	cmd := p.c.HSet(ctx, key, values...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *fakePipeliner) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	cmd := p.c.HDel(ctx, key, fields...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *fakePipeliner) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	cmd := p.c.Expire(ctx, key, expiration)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *fakePipeliner) Persist(ctx context.Context, key string) *redis.BoolCmd {
+	cmd := p.c.Persist(ctx, key)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (c *fakeClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "exists", keys...)
+
+	var n int64
+	for _, k := range keys {
+		if _, ok := c.values[k]; ok {
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (c *fakeClient) Rename(ctx context.Context, key, newkey string) *redis.StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "rename", key, newkey)
+
+	v, ok := c.values[key]
+	if !ok {
+		return redis.NewStatusResult("", fakeRedisError("ERR no such key"))
+	}
+	delete(c.values, key)
+	c.values[newkey] = v
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (c *fakeClient) RenameNX(ctx context.Context, key, newkey string) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "renamenx", key, newkey)
+
+	v, ok := c.values[key]
+	if !ok {
+		return redis.NewBoolResult(false, fakeRedisError("ERR no such key"))
+	}
+	if _, ok := c.values[newkey]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	delete(c.values, key)
+	c.values[newkey] = v
+	return redis.NewBoolResult(true, nil)
+}
+
+func (c *fakeClient) hash(key string) (map[string]string, error) {
+	v, ok := c.values[key]
+	if !ok {
+		return nil, nil
+	}
+	if v.hash == nil {
+		return nil, errWrongType
+	}
+	return v.hash, nil
+}
+
+func (c *fakeClient) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "hset", key)
+
+	h, err := c.hash(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	if h == nil {
+		h = map[string]string{}
+		c.values[key] = fakeValue{hash: h}
+	}
+	if len(values)%2 != 0 {
+		return redis.NewIntResult(0, fmt.Errorf("fakeClient: HSet received odd number of values"))
+	}
+
+	var n int64
+	for i := 0; i < len(values); i += 2 {
+		field := values[i].(string)
+		if _, ok := h[field]; !ok {
+			n++
+		}
+		switch v := values[i+1].(type) {
+		case []byte:
+			h[field] = string(v)
+		case string:
+			h[field] = v
+		default:
+			return redis.NewIntResult(0, fmt.Errorf("fakeClient: unsupported value type %T", v))
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (c *fakeClient) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "hget", key, field)
+
+	h, err := c.hash(key)
+	if err != nil {
+		return redis.NewStringResult("", err)
+	}
+	v, ok := h[field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (c *fakeClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "hgetall", key)
+
+	h, err := c.hash(key)
+	if err != nil {
+		return redis.NewStringStringMapResult(nil, err)
+	}
+	m := make(map[string]string, len(h))
+	for k, v := range h {
+		m[k] = v
+	}
+	return redis.NewStringStringMapResult(m, nil)
+}
+
+func (c *fakeClient) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "hmget", append([]string{key}, fields...)...)
+
+	h, err := c.hash(key)
+	if err != nil {
+		return redis.NewSliceResult(nil, err)
+	}
+	vals := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if v, ok := h[field]; ok {
+			vals[i] = v
+		}
+	}
+	return redis.NewSliceResult(vals, nil)
+}
+
+func (c *fakeClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "hdel", append([]string{key}, fields...)...)
+
+	h, err := c.hash(key)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, field := range fields {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (c *fakeClient) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "expire", key)
+
+	v, ok := c.values[key]
+	if !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	v.ttl = expiration
+	c.values[key] = v
+	return redis.NewBoolResult(true, nil)
+}
+
+func (c *fakeClient) Persist(ctx context.Context, key string) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "persist", key)
+
+	v, ok := c.values[key]
+	if !ok || v.ttl <= 0 {
+		return redis.NewBoolResult(false, nil)
+	}
+	v.ttl = 0
+	c.values[key] = v
+	return redis.NewBoolResult(true, nil)
+}
+
+func (c *fakeClient) StrLen(ctx context.Context, key string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "strlen", key)
+
+	v, ok := c.values[key]
+	switch {
+	case !ok:
+		return redis.NewIntResult(0, nil)
+	case v.hash != nil:
+		return redis.NewIntResult(0, errWrongType)
+	}
+	return redis.NewIntResult(int64(len(v.content)), nil)
+}
+
+// PTTL returns the TTL the key was set with, as the fake does not expire keys.
+func (c *fakeClient) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "pttl", key)
+
+	v, ok := c.values[key]
+	switch {
+	case !ok:
+		return redis.NewDurationResult(-2, nil)
+	case v.ttl <= 0:
+		return redis.NewDurationResult(-1, nil)
+	}
+	return redis.NewDurationResult(v.ttl, nil)
+}
+
+// EvalSha always reports the script is not loaded, which causes redis.Script.Run() to use Eval().
+func (c *fakeClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "evalsha", keys...)
+
+	return redis.NewCmdResult(nil, fakeRedisError("NOSCRIPT No matching script. Please use EVAL."))
+}
+
+// Eval emulates the scripts used by FS. Any other script returns an error.
+func (c *fakeClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(ctx, "eval", keys...)
+
+	if script != casScriptSrc {
+		return redis.NewCmdResult(nil, fmt.Errorf("fakeClient: unsupported script"))
+	}
+
+	var cur int64
+	if v, ok := c.values[keys[1]]; ok {
+		var err error
+		cur, err = strconv.ParseInt(string(v.content), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, fakeRedisError("ERR value is not an integer"))
+		}
+	}
+	if cur != args[0].(int64) {
+		return redis.NewCmdResult([]interface{}{int64(0), cur}, nil)
+	}
+
+	var ttl time.Duration
+	switch ms := args[3].(int64); {
+	case ms > 0:
+		ttl = time.Duration(ms) * time.Millisecond
+	case ms < 0:
+		ttl = c.values[keys[0]].ttl
+	}
+	c.values[keys[0]] = fakeValue{content: append([]byte{}, args[1].([]byte)...), ttl: ttl}
+	c.values[keys[1]] = fakeValue{content: []byte(strconv.FormatInt(cur+1, 10)), ttl: ttl}
+	c.values[keys[2]] = fakeValue{content: []byte(strconv.FormatInt(args[2].(int64), 10)), ttl: ttl}
+	return redis.NewCmdResult([]interface{}{int64(1), cur + 1}, nil)
+}
+
+// flakyClient is a fakeClient whose Get, Set, Del and Exists commands fail with err
+// until they have been called failures times.
+type flakyClient struct {
+	*fakeClient
+
+	err      error
+	failures int
+	calls    map[string]int
+}
+
+func newFlakyClient(failures int, err error) *flakyClient {
+	return &flakyClient{fakeClient: newFakeClient(), err: err, failures: failures, calls: map[string]int{}}
+}
+
+// fail reports if cmd should fail.
+func (c *flakyClient) fail(cmd string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[cmd]++
+	return c.calls[cmd] <= c.failures
+}
+
+func (c *flakyClient) Get(ctx context.Context, key string) *redis.StringCmd {
+	if c.fail("get") {
+		return redis.NewStringResult("", c.err)
+	}
+	return c.fakeClient.Get(ctx, key)
+}
+
+func (c *flakyClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	if c.fail("set") {
+		return redis.NewStatusResult("", c.err)
+	}
+	return c.fakeClient.Set(ctx, key, value, expiration)
+}
+
+func (c *flakyClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	if c.fail("del") {
+		return redis.NewIntResult(0, c.err)
+	}
+	return c.fakeClient.Del(ctx, keys...)
+}
+
+func (c *flakyClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	if c.fail("exists") {
+		return redis.NewIntResult(0, c.err)
+	}
+	return c.fakeClient.Exists(ctx, keys...)
+}
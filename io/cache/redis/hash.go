@@ -0,0 +1,184 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gopherfs/fs/io/cache"
+)
+
+// Field names used when files are stored as Redis hashes with WithHashStorage().
+const (
+	hashSize        = "size"
+	hashModTime     = "modtime"
+	hashContentType = "content-type"
+	hashChunks      = "chunks"
+	hashChunkPrefix = "chunk:"
+)
+
+const defaultHashChunkSize = 512 * 1024
+
+// WithHashStorage stores each file as a Redis hash instead of a string. The hash holds the
+// content split into chunks along with the size, content type and modification time of the file.
+// This allows Stat() to read the metadata without reading the content. Open() and ReadFile()
+// reassemble the content. Files written in one storage mode cannot be read in the other.
+func WithHashStorage() Option {
+	return func(f *FS) error {
+		f.hashStorage = true
+		f.hashChunkSize = defaultHashChunkSize
+		return nil
+	}
+}
+
+func chunkField(i int) string {
+	return hashChunkPrefix + strconv.Itoa(i)
+}
+
+// openHash implements Open() for files stored as hashes.
+func (f *FS) openHash(ctx context.Context, name string, pool *cache.BufferPool) (fs.File, error) {
+	m, err := f.client.HGetAll(ctx, name).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("file(%s): %w", name, fs.ErrNotExist)
+	}
+
+	fi, err := hashFileInfo(name, m[hashSize], m[hashModTime])
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := strconv.Atoi(m[hashChunks])
+	if err != nil {
+		return nil, fmt.Errorf("file(%s) has invalid %q field: %w", name, hashChunks, err)
+	}
+
+	var (
+		content []byte
+		buf     *[]byte
+	)
+	if pool != nil {
+		buf = pool.Get(int(fi.size))
+		content = (*buf)[:0]
+	} else {
+		content = make([]byte, 0, fi.size)
+	}
+	for i := 0; i < chunks; i++ {
+		chunk, ok := m[chunkField(i)]
+		if !ok {
+			pool.Put(buf)
+			return nil, fmt.Errorf("file(%s) is missing field %q", name, chunkField(i))
+		}
+		content = append(content, chunk...)
+	}
+	if int64(len(content)) != fi.size {
+		pool.Put(buf)
+		return nil, fmt.Errorf("file(%s) content size(%d) does not match stored size(%d)", name, len(content), fi.size)
+	}
+
+	return &readFile{content: content, fi: fi, buf: buf, pool: pool}, nil
+}
+
+// statHash implements Stat() for files stored as hashes. This only reads the metadata fields.
+func (f *FS) statHash(ctx context.Context, name string) (fs.FileInfo, error) {
+	vals, err := f.client.HMGet(ctx, name, hashSize, hashModTime).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != 2 || vals[0] == nil {
+		return nil, fmt.Errorf("file(%s): %w", name, fs.ErrNotExist)
+	}
+	size, _ := vals[0].(string)
+	modTime, _ := vals[1].(string)
+
+	fi, err := hashFileInfo(name, size, modTime)
+	if err != nil {
+		return nil, err
+	}
+	if fi.sys.TTL, err = f.ttl(ctx, name); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func hashFileInfo(name, size, modTime string) (fileInfo, error) {
+	s, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return fileInfo{}, fmt.Errorf("file(%s) has invalid %q field: %w", name, hashSize, err)
+	}
+	fi := fileInfo{name: name, size: s}
+	if modTime != "" {
+		n, err := strconv.ParseInt(modTime, 10, 64)
+		if err != nil {
+			return fileInfo{}, fmt.Errorf("file(%s) has invalid %q field: %w", name, hashModTime, err)
+		}
+		fi.modTime = time.Unix(0, n)
+	}
+	return fi, nil
+}
+
+// writeHash writes the content of f as a hash. Chunk fields left over from a larger
+// previous version of the file are removed.
+func (f *writefile) writeHash(ctx context.Context) error {
+	content := f.content.Bytes()
+
+	contentType := mime.TypeByExtension(path.Ext(f.name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	values := []interface{}{
+		hashSize, strconv.Itoa(len(content)),
+		hashModTime, strconv.FormatInt(f.clock.Now().UnixNano(), 10),
+		hashContentType, contentType,
+	}
+	chunks := 0
+	for i := 0; i < len(content); i += f.chunkSize {
+		end := i + f.chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		values = append(values, chunkField(chunks), content[i:end])
+		chunks++
+	}
+	values = append(values, hashChunks, strconv.Itoa(chunks))
+
+	// Read the old chunk count before writing so that stale chunks can be removed.
+	oldChunks := 0
+	if s, err := f.client.HGet(ctx, f.name, hashChunks).Result(); err == nil {
+		oldChunks, _ = strconv.Atoi(s)
+	} else if err != redis.Nil {
+		return err
+	}
+
+	var stale []string
+	for i := chunks; i < oldChunks; i++ {
+		stale = append(stale, chunkField(i))
+	}
+
+	// MULTI/EXEC keeps a failure between commands from leaving a partial file or one that
+	// does not expire.
+	_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, f.name, values...)
+		if len(stale) > 0 {
+			pipe.HDel(ctx, f.name, stale...)
+		}
+		// HSET keeps the existing TTL of the key, which is what redis.KeepTTL asks for.
+		// SET clears the TTL when passed 0, which PERSIST does for a hash.
+		switch {
+		case f.ttl > 0:
+			pipe.Expire(ctx, f.name, f.ttl)
+		case f.ttl == 0:
+			pipe.Persist(ctx, f.name)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// removeBatchSize is the number of keys requested from each SCAN and the most keys deleted
+// in a pipeline.
+const removeBatchSize = 500
+
+// RemovePrefix removes all files whose names start with prefix and returns the number of
+// files removed. This can be used to evict a whole directory, such as "users/". Keys are
+// found with SCAN and deleted in pipelined batches. Files written while this runs may or
+// may not be removed. An empty prefix removes every file. This is not supported with
+// Redis Cluster, where SCAN only sees the keys on a single node.
+func (f *FS) RemovePrefix(prefix string) (int, error) {
+	match := escapeGlob(prefix) + "*"
+
+	var (
+		cursor  uint64
+		removed int
+	)
+	for {
+		n, next, err := f.removeBatch(match, cursor)
+		removed += n
+		if err != nil {
+			return removed, fmt.Errorf("RemovePrefix(%s): %w", prefix, err)
+		}
+		if next == 0 {
+			return removed, nil
+		}
+		cursor = next
+	}
+}
+
+// removeBatch removes the files from a single SCAN of match at cursor. It returns the number
+// of files removed and the cursor for the next call, which is 0 when the scan is complete.
+func (f *FS) removeBatch(match string, cursor uint64) (int, uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.writeTimeout)
+	defer cancel()
+
+	var keys []string
+	err := f.retry.do(ctx, func() (err error) {
+		keys, cursor, err = f.client.Scan(ctx, cursor, match, removeBatchSize).Result()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var names, others []string
+	for _, k := range keys {
+		// The keys holding modification times and versions are removed with their file.
+		if strings.HasPrefix(k, modTimePrefix) || strings.HasPrefix(k, versionPrefix) {
+			continue
+		}
+		names = append(names, k)
+		if !f.hashStorage {
+			others = append(others, modTimeKey(k), versionKey(k))
+		}
+	}
+	if len(names) == 0 {
+		return 0, cursor, nil
+	}
+
+	var del *redis.IntCmd
+	err = f.retry.do(ctx, func() error {
+		_, err := f.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			del = pipe.Del(ctx, names...)
+			if len(others) > 0 {
+				pipe.Del(ctx, others...)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(del.Val()), cursor, nil
+}
+
+// escapeGlob escapes the characters that have special meaning in a SCAN MATCH pattern.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
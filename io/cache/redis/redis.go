@@ -26,9 +26,11 @@ package redis
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"regexp"
 	"sync"
@@ -40,15 +42,29 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
-var _ cache.CacheFS = &FS{}
+var (
+	_ cache.CacheFS       = &FS{}
+	_ cache.HealthChecker = &FS{}
+)
 
 // Args is arguments to the Redis client.
 type Args = redis.Options
 
 // FS provides an io.FS implementation using Redis.
 type FS struct {
-	client      *redis.Client
-	openTimeout time.Duration
+	client       redis.Cmdable
+	openTimeout  time.Duration
+	writeTimeout time.Duration
+	retry        retrier
+
+	hashStorage   bool
+	hashChunkSize int
+	// maxReadSize is set by WithMaxReadSize(). It is 0 if there is no limit.
+	maxReadSize int64
+	// clock is set by WithClock().
+	clock cache.Clock
+	// bufPool is set by WithBufferPool(). It is nil if buffers are not pooled.
+	bufPool *cache.BufferPool
 
 	writeFileOFOptions []writeFileOptions
 }
@@ -108,13 +124,115 @@ func Flags(flags int) jsfs.OFOption {
 	}
 }
 
+// ErrMaxReadSize is wrapped by the error from Open() and ReadFile() for a file larger than the
+// size set with WithMaxReadSize().
+var ErrMaxReadSize = errors.New("file exceeds max read size")
+
+// WithMaxReadSize causes Open(), ReadFile() and OpenFile() for reading to return an error
+// wrapping ErrMaxReadSize for files larger than n bytes. The size is read with STRLEN, or from
+// the file's metadata if WithHashStorage() is used, before the content is fetched. This costs
+// an extra round trip on every read. Stat() is not limited.
+func WithMaxReadSize(n int64) Option {
+	return func(f *FS) error {
+		if n < 1 {
+			return fmt.Errorf("WithMaxReadSize(%d) must be passed a value > 0", n)
+		}
+		f.maxReadSize = n
+		return nil
+	}
+}
+
+// checkSize returns an error wrapping ErrMaxReadSize if the file at name is larger than max.
+// A file that does not exist passes, so that reading it returns fs.ErrNotExist.
+func (f *FS) checkSize(ctx context.Context, name string, max int64) error {
+	var size int64
+	err := f.retry.do(ctx, func() (err error) {
+		if f.hashStorage {
+			size, err = f.client.HGet(ctx, name, hashSize).Int64()
+		} else {
+			size, err = f.client.StrLen(ctx, name).Result()
+		}
+		return err
+	})
+	switch {
+	case err == redis.Nil:
+		return nil
+	case err != nil:
+		return fmt.Errorf("could not get size of file(%s): %w", name, err)
+	case size > max:
+		return &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("size %d > %d: %w", size, max, ErrMaxReadSize)}
+	}
+	return nil
+}
+
+// WithClock sets the Clock used for the modification time recorded when a file is written.
+// This allows tests to control the ModTime() of files. Files are expired by the redis server,
+// so the Clock does not change when they expire. Defaults to cache.RealClock{}.
+func WithClock(c cache.Clock) Option {
+	return func(f *FS) error {
+		if c == nil {
+			return fmt.Errorf("WithClock() requires a non-nil Clock")
+		}
+		f.clock = c
+		return nil
+	}
+}
+
+// WithBufferPool causes files opened with Open() to hold their content in a buffer from p,
+// which is returned to p on Close(). This reduces allocations when files stored with
+// WithHashStorage() are read at a high rate. Files stored as strings are returned without
+// copying the value read from Redis and do not use p.
+//
+// This is only safe if callers do not use a file or any slice read from it after calling Close(),
+// as the buffer will hold the content of another file. Close() must be called to reuse a buffer.
+// ReadFile() never uses p, as the caller keeps the returned slice.
+func WithBufferPool(p *cache.BufferPool) Option {
+	return func(f *FS) error {
+		if p == nil {
+			return fmt.Errorf("WithBufferPool() requires a non-nil BufferPool")
+		}
+		f.bufPool = p
+		return nil
+	}
+}
+
+// WithOpenTimeout sets the timeout for reading a file or its metadata, such as with Open(),
+// Stat() and OpenFile() checking if a file exists. Defaults to 3 seconds.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(f *FS) error {
+		if d <= 0 {
+			return fmt.Errorf("WithOpenTimeout(%v) must be > 0", d)
+		}
+		f.openTimeout = d
+		return nil
+	}
+}
+
+// WithWriteTimeout sets the timeout for changing a file, such as writing it on Close(),
+// Remove() and Rename(). Defaults to 3 seconds.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(f *FS) error {
+		if d <= 0 {
+			return fmt.Errorf("WithWriteTimeout(%v) must be > 0", d)
+		}
+		f.writeTimeout = d
+		return nil
+	}
+}
+
 // New is the constructor for FS that implements fs.OpenFile and io.FS using Redis.
 func New(args Args, options ...Option) (*FS, error) {
-	c := redis.NewClient(&args)
+	return NewFromClient(redis.NewClient(&args), options...)
+}
 
+// NewFromClient is like New(), but uses an existing Redis client. This can be a *redis.Client,
+// *redis.ClusterClient or a fake used in tests.
+func NewFromClient(client redis.Cmdable, options ...Option) (*FS, error) {
 	r := &FS{
-		client:      c,
-		openTimeout: 3 * time.Second,
+		client:       client,
+		openTimeout:  3 * time.Second,
+		writeTimeout: 3 * time.Second,
+		clock:        cache.RealClock{},
 	}
 
 	for _, o := range options {
@@ -125,13 +243,36 @@ func New(args Args, options ...Option) (*FS, error) {
 	return r, nil
 }
 
-// Open implements fs.FS.Open().
+// Open implements fs.FS.Open(). If name does not exist, the error wraps fs.ErrNotExist.
 func (f *FS) Open(name string) (fs.File, error) {
+	return f.open(name, f.maxReadSize, f.bufPool)
+}
+
+// open opens name for reading. If maxSize > 0, files larger than maxSize are not read.
+// If pool is not nil, the content may be held in a buffer from pool until Close().
+func (f *FS) open(name string, maxSize int64, pool *cache.BufferPool) (fs.File, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
 	defer cancel()
 
-	val, err := f.client.Get(ctx, name).Bytes()
+	if maxSize > 0 {
+		if err := f.checkSize(ctx, name, maxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.hashStorage {
+		return f.openHash(ctx, name, pool)
+	}
+
+	var val []byte
+	err := f.retry.do(ctx, func() (err error) {
+		val, err = f.client.Get(ctx, name).Bytes()
+		return err
+	})
 	if err != nil {
+		if err == redis.Nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
 		return nil, err
 	}
 
@@ -157,7 +298,7 @@ func (f *FS) OpenFile(name string, mode fs.FileMode, options ...jsfs.OFOption) (
 	}
 
 	if !isFlagSet(opts.flags, os.O_WRONLY) {
-		return nil, fmt.Errorf("must set either O_RDONLY or O_WRONLY")
+		return nil, fmt.Errorf("must set either O_RDONLY or O_WRONLY: %w", jsfs.ErrUnsupportedFlag)
 	}
 
 	fileExists, err := f.exists(name)
@@ -170,7 +311,7 @@ func (f *FS) OpenFile(name string, mode fs.FileMode, options ...jsfs.OFOption) (
 			return nil, fs.ErrExist
 		}
 		if !isFlagSet(opts.flags, os.O_TRUNC) {
-			return nil, fmt.Errorf("did not receive O_TRUNC when file exists. Redis only supports truncation")
+			return nil, fmt.Errorf("did not receive O_TRUNC when file exists. Redis only supports truncation: %w", jsfs.ErrUnsupportedFlag)
 		}
 	} else {
 		if !isFlagSet(opts.flags, os.O_CREATE) {
@@ -179,34 +320,132 @@ func (f *FS) OpenFile(name string, mode fs.FileMode, options ...jsfs.OFOption) (
 	}
 
 	return &writefile{
-		name:    name,
-		content: &bytes.Buffer{},
-		ttl:     opts.expireFiles,
-		client:  f.client,
+		name:      name,
+		content:   &bytes.Buffer{},
+		ttl:       opts.expireFiles,
+		client:    f.client,
+		timeout:   f.writeTimeout,
+		retry:     f.retry,
+		hash:      f.hashStorage,
+		chunkSize: f.hashChunkSize,
+		clock:     f.clock,
 	}, nil
 }
 
 // Remove attempts to remove file at name from FS.
 func (f *FS) Remove(name string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), f.writeTimeout)
 	defer cancel()
 
-	result := f.client.Del(ctx, name)
-	return result.Err()
+	keys := []string{name}
+	if !f.hashStorage {
+		keys = append(keys, modTimeKey(name), versionKey(name))
+	}
+	return f.retry.do(ctx, func() error {
+		return f.client.Del(ctx, keys...).Err()
+	})
 }
 
-func (f *FS) exists(name string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// HealthCheck implements cache.HealthChecker by sending a PING to Redis.
+func (f *FS) HealthCheck(ctx context.Context) error {
+	return f.client.Ping(ctx).Err()
+}
+
+// modTimePrefix is prepended to a file's name to get the key that stores the modification
+// time of a file stored as a string. Files stored as hashes keep it in a hash field.
+const modTimePrefix = "__modtime__:"
+
+func modTimeKey(name string) string {
+	return modTimePrefix + name
+}
+
+// RenameOption is an optional argument for Rename().
+type RenameOption func(o *renameOptions)
+
+type renameOptions struct {
+	noOverwrite bool
+}
+
+// NoOverwrite causes Rename() to fail with an error wrapping fs.ErrExist if newName already exists,
+// instead of replacing it. This uses the Redis RENAMENX command.
+func NoOverwrite() RenameOption {
+	return func(o *renameOptions) {
+		o.noOverwrite = true
+	}
+}
+
+// Rename renames the file at oldName to newName using the Redis RENAME command. If newName
+// exists, it is replaced unless NoOverwrite() is passed. The TTL of oldName is kept.
+// If oldName does not exist, the error wraps fs.ErrNotExist.
+func (f *FS) Rename(oldName, newName string, options ...RenameOption) error {
+	opts := renameOptions{}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.writeTimeout)
 	defer cancel()
 
-	result := f.client.Exists(ctx, name)
-	if result.Err() != nil {
-		return false, fmt.Errorf("unable to determine if file(%s) exists: %w", name, result.Err())
+	var err error
+	if opts.noOverwrite {
+		var ok bool
+		ok, err = f.client.RenameNX(ctx, oldName, newName).Result()
+		if err == nil && !ok {
+			return fmt.Errorf("cannot rename file(%s) to file(%s): %w", oldName, newName, fs.ErrExist)
+		}
+	} else {
+		err = f.client.Rename(ctx, oldName, newName).Err()
 	}
-	if result.Val() == 1 {
-		return true, nil
+	if err != nil {
+		if isNoSuchKey(err) {
+			return fmt.Errorf("cannot rename file(%s): %w", oldName, fs.ErrNotExist)
+		}
+		return fmt.Errorf("cannot rename file(%s) to file(%s): %w", oldName, newName, err)
+	}
+
+	if f.hashStorage {
+		return nil
+	}
+	// Files written before modification times were recorded won't have a modtime key.
+	err = f.client.Rename(ctx, modTimeKey(oldName), modTimeKey(newName)).Err()
+	if err != nil && !isNoSuchKey(err) {
+		return fmt.Errorf("renamed file(%s) to file(%s), but could not rename its modification time: %w", oldName, newName, err)
+	}
+
+	// Only files written with WriteFileCAS() have a version. If oldName had none, any version
+	// for the file we replaced must not be kept.
+	err = f.client.Rename(ctx, versionKey(oldName), versionKey(newName)).Err()
+	if err != nil && isNoSuchKey(err) {
+		err = f.client.Del(ctx, versionKey(newName)).Err()
 	}
-	return false, nil
+	if err != nil {
+		return fmt.Errorf("renamed file(%s) to file(%s), but could not rename its version: %w", oldName, newName, err)
+	}
+	return nil
+}
+
+// isNoSuchKey detects the error Redis returns when renaming a key that does not exist.
+func isNoSuchKey(err error) bool {
+	var rerr redis.Error
+	if errors.As(err, &rerr) {
+		return rerr.Error() == "ERR no such key"
+	}
+	return false
+}
+
+func (f *FS) exists(name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
+	defer cancel()
+
+	var n int64
+	err := f.retry.do(ctx, func() (err error) {
+		n, err = f.client.Exists(ctx, name).Result()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to determine if file(%s) exists: %w", name, err)
+	}
+	return n == 1, nil
 }
 
 func isFlagSet(flags, flag int) bool {
@@ -215,7 +454,7 @@ func isFlagSet(flags, flag int) bool {
 
 // ReadFile implements fs.ReadFileFS.ReadFile().
 func (f *FS) ReadFile(name string) ([]byte, error) {
-	file, err := f.Open(name)
+	file, err := f.open(name, f.maxReadSize, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -223,45 +462,96 @@ func (f *FS) ReadFile(name string) ([]byte, error) {
 	return r.content, nil
 }
 
-// Stat implements fs.StatFS.Stat(). The FileInfo returned name and size can be used,
-// but the others are static values. ModTime will always be the zero value. It should
-// be noted that this is simple a bad wrapper on Open(), so the content is read
-// as I did not see a way to query Redis for just the key size (and to be honest,
-// I didn't dig to hard).
-func (f *FS) Stat(name string) (fs.FileInfo, error) {
+// ContentType implements jsfs.ContentTyper.ContentType(). Redis does not store a content type,
+// so it is sniffed from the file's content with http.DetectContentType(). The extension of name
+// is not used.
+func (f *FS) ContentType(name string) (string, error) {
 	file, err := f.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return http.DetectContentType(file.(*readFile).content), nil
+}
+
+// Stat implements fs.StatFS.Stat(). The FileInfo returned name, size and ModTime can be used,
+// but the others are static values. ModTime is the time the file was written, or the zero
+// value for files written before modification times were recorded. Only Stat() provides
+// ModTime, not Open().Stat(). Sys() returns a Sys with the file's TTL. It should be noted
+// that this is simple a bad wrapper on Open(), so the content is read as I did not see a way
+// to query Redis for just the key size (and to be honest, I didn't dig to hard). If
+// WithHashStorage() is used, only the file's metadata is read.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.openTimeout)
+	defer cancel()
+
+	if f.hashStorage {
+		return f.statHash(ctx, name)
+	}
+
+	file, err := f.open(name, 0, nil)
 	if err != nil {
 		return nil, err
 	}
-	rf := file.(*readFile)
-	return rf.fi, nil
+	fi := file.(*readFile).fi
+
+	var mod int64
+	err = f.retry.do(ctx, func() (err error) {
+		mod, err = f.client.Get(ctx, modTimeKey(name)).Int64()
+		return err
+	})
+	switch {
+	case err == nil:
+		fi.modTime = time.Unix(0, mod)
+	case err != redis.Nil:
+		return nil, fmt.Errorf("could not get modification time of file(%s): %w", name, err)
+	}
+
+	if fi.sys.TTL, err = f.ttl(ctx, name); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// ttl returns the time until the key for name expires, or 0 if it does not expire.
+func (f *FS) ttl(ctx context.Context, name string) (time.Duration, error) {
+	var ttl time.Duration
+	err := f.retry.do(ctx, func() (err error) {
+		ttl, err = f.client.PTTL(ctx, name).Result()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not get TTL of file(%s): %w", name, err)
+	}
+	// PTTL returns -1 for a key with no expiration and -2 for a key that no longer exists.
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
 }
 
 // WriteFile writes a file to name with content. This will overrite an existing entry.
-// Passed perm must be 0644.
+// Passed perm must be a regular file mode, but the permission bits are ignored as Redis
+// has no concept of them.
 func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
-	var opts []jsfs.OFOption
+	return f.writeFile(name, content, perm, f.writeOFOptions(name))
+}
+
+// WriteFileWithOptions is like WriteFile(), but applies options to this write instead of the
+// options from WithWriteFileOFOptions(), such as ExpireFiles() to set a one-off TTL.
+// The WithWriteFileOFOptions() rules are not used even if options is empty. Flags() is ignored.
+func (f *FS) WriteFileWithOptions(name string, content []byte, perm fs.FileMode, options ...jsfs.OFOption) error {
+	return f.writeFile(name, content, perm, append([]jsfs.OFOption{}, options...))
+}
 
+// writeFile writes content to name with options. options is appended to.
+func (f *FS) writeFile(name string, content []byte, perm fs.FileMode, options []jsfs.OFOption) error {
 	if !perm.IsRegular() {
 		return fmt.Errorf("non-regular file (perm mode bits are set)")
 	}
 
-	if perm != 0644 {
-		return fmt.Errorf("only support mode 0644")
-	}
-
-	for _, wfo := range f.writeFileOFOptions {
-		if wfo.regex == nil {
-			opts = wfo.options
-			break
-		}
-		if wfo.regex.MatchString(name) {
-			opts = wfo.options
-			break
-		}
-	}
-
-	opts = append(opts, Flags(os.O_WRONLY|os.O_CREATE|os.O_TRUNC))
+	opts := append(options, Flags(os.O_WRONLY|os.O_CREATE|os.O_TRUNC))
 
 	file, err := f.OpenFile(name, 0644, opts...)
 	if err != nil {
@@ -276,10 +566,25 @@ func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 	return wf.Close()
 }
 
+// writeOFOptions returns the options from WithWriteFileOFOptions() that apply to name.
+// The returned slice may be appended to.
+func (f *FS) writeOFOptions(name string) []jsfs.OFOption {
+	for _, wfo := range f.writeFileOFOptions {
+		if wfo.regex == nil || wfo.regex.MatchString(name) {
+			return append([]jsfs.OFOption{}, wfo.options...)
+		}
+	}
+	return nil
+}
+
 type readFile struct {
 	content []byte
 	fi      fileInfo
 	index   int
+
+	// buf holds content if it came from pool. It is returned to pool on Close().
+	buf  *[]byte
+	pool *cache.BufferPool
 }
 
 func (f *readFile) Stat() (fs.FileInfo, error) {
@@ -296,7 +601,28 @@ func (f *readFile) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// ReadAt implements io.ReaderAt. It does not change the offset used by Read().
+func (f *readFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.fi.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(f.content)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, f.content[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
 func (f *readFile) Close() error {
+	if f.buf != nil {
+		f.pool.Put(f.buf)
+		f.buf = nil
+		f.content = nil
+	}
 	return nil
 }
 
@@ -308,7 +634,15 @@ type writefile struct {
 	sync.Mutex
 	closed bool
 
-	client *redis.Client
+	client  redis.Cmdable
+	timeout time.Duration
+	retry   retrier
+
+	// hash indicates the file is stored as a hash, see WithHashStorage().
+	hash      bool
+	chunkSize int
+
+	clock cache.Clock
 }
 
 func (f *writefile) Stat() (fs.FileInfo, error) {
@@ -339,10 +673,23 @@ func (f *writefile) Close() error {
 		return fmt.Errorf("file is closed")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
 	defer cancel()
 
-	err := f.client.Set(ctx, f.name, f.content.Bytes(), f.ttl).Err()
+	var err error
+	if f.hash {
+		err = f.writeHash(ctx)
+	} else {
+		err = f.retry.do(ctx, func() error {
+			return f.client.Set(ctx, f.name, f.content.Bytes(), f.ttl).Err()
+		})
+		if err == nil {
+			modTime := f.clock.Now().UnixNano()
+			err = f.retry.do(ctx, func() error {
+				return f.client.Set(ctx, modTimeKey(f.name), modTime, f.ttl).Err()
+			})
+		}
+	}
 	if err == nil {
 		f.closed = true
 		return nil
@@ -351,8 +698,16 @@ func (f *writefile) Close() error {
 }
 
 type fileInfo struct {
-	name string
-	size int64
+	name    string
+	size    int64
+	modTime time.Time
+	sys     Sys
+}
+
+// Sys is returned by Sys() on the fs.FileInfo from Stat().
+type Sys struct {
+	// TTL is the time remaining until the file expires. It is 0 if the file does not expire.
+	TTL time.Duration
 }
 
 func (f fileInfo) Name() string {
@@ -368,13 +723,14 @@ func (f fileInfo) Mode() fs.FileMode {
 }
 
 func (f fileInfo) ModTime() time.Time {
-	return time.Time{}
+	return f.modTime
 }
 
 func (f fileInfo) IsDir() bool {
 	return false
 }
 
+// Sys returns a Sys. Its TTL is only set on the fs.FileInfo from FS.Stat().
 func (f fileInfo) Sys() interface{} {
-	return nil
+	return f.sys
 }
@@ -1,8 +1,23 @@
 package redis
 
 import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/fstesting"
+	"github.com/gopherfs/fs/io/cache"
 	"github.com/kylelemons/godebug/pretty"
 )
 
@@ -40,3 +55,1027 @@ func TestRedis(t *testing.T) {
 		t.Fatalf("TestRedis(ReadFile): -want/+got:\n%s", diff)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"conformance/path/to/file": []byte("content"),
+		"conformance/root":         []byte("root content"),
+	}
+
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+
+	for name, content := range files {
+		if err := redisFS.WriteFile(name, content, 0644); err != nil {
+			t.Fatalf("TestConformance(WriteFile %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	fstesting.Run(
+		t,
+		redisFS,
+		files,
+		fstesting.NoDirs(),
+		// Missing keys return fs.ErrNotExist, see TestNotExist.
+		fstesting.Skip("FileInfo.Name() is the full key instead of its base name", fstesting.CheckOpen, fstesting.CheckStat),
+	)
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		desc         string
+		existing     map[string]string
+		options      []RenameOption
+		wantCommands []string
+		wantErr      error
+		wantContent  string
+	}{
+		{
+			desc:         "rename",
+			existing:     map[string]string{"old": "content"},
+			wantCommands: []string{"rename[old new]", "rename[__modtime__:old __modtime__:new]", "rename[__version__:old __version__:new]", "del[__version__:new]"},
+			wantContent:  "content",
+		},
+		{
+			desc:         "rename overwrites",
+			existing:     map[string]string{"old": "content", "new": "other"},
+			wantCommands: []string{"rename[old new]", "rename[__modtime__:old __modtime__:new]", "rename[__version__:old __version__:new]", "del[__version__:new]"},
+			wantContent:  "content",
+		},
+		{
+			desc:         "NoOverwrite",
+			existing:     map[string]string{"old": "content"},
+			options:      []RenameOption{NoOverwrite()},
+			wantCommands: []string{"renamenx[old new]", "rename[__modtime__:old __modtime__:new]", "rename[__version__:old __version__:new]", "del[__version__:new]"},
+			wantContent:  "content",
+		},
+		{
+			desc:         "NoOverwrite with existing file",
+			existing:     map[string]string{"old": "content", "new": "other"},
+			options:      []RenameOption{NoOverwrite()},
+			wantCommands: []string{"renamenx[old new]"},
+			wantErr:      fs.ErrExist,
+		},
+		{
+			desc:         "old file does not exist",
+			wantCommands: []string{"rename[old new]"},
+			wantErr:      fs.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		client := newFakeClient()
+		redisFS, err := NewFromClient(client)
+		if err != nil {
+			panic(err)
+		}
+		for k, v := range test.existing {
+			if err := redisFS.WriteFile(k, []byte(v), 0644); err != nil {
+				panic(err)
+			}
+		}
+		client.commands = nil
+
+		err = redisFS.Rename("old", "new", test.options...)
+		if diff := pretty.Compare(test.wantCommands, client.commands); diff != "" {
+			t.Errorf("TestRename(%s): commands -want/+got:\n%s", test.desc, diff)
+		}
+		switch {
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("TestRename(%s): got err == %v, want err wrapping %v", test.desc, err, test.wantErr)
+			continue
+		case test.wantErr == nil && err != nil:
+			t.Errorf("TestRename(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case test.wantErr != nil:
+			continue
+		}
+
+		if _, err := redisFS.ReadFile("old"); err == nil {
+			t.Errorf("TestRename(%s): old file still exists", test.desc)
+		}
+		b, err := redisFS.ReadFile("new")
+		if err != nil {
+			t.Errorf("TestRename(%s): ReadFile(new) got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if string(b) != test.wantContent {
+			t.Errorf("TestRename(%s): got content %q, want %q", test.desc, string(b), test.wantContent)
+		}
+	}
+}
+
+func TestHashStorage(t *testing.T) {
+	client := newFakeClient()
+	redisFS, err := NewFromClient(client, WithHashStorage())
+	if err != nil {
+		panic(err)
+	}
+	// Use a small chunk size so the content is split across several fields.
+	redisFS.hashChunkSize = 4
+
+	const name = "path/to/file.json"
+	contents := []string{`{"Name":"John Doak"}`, `{}`}
+	for _, content := range contents {
+		start := time.Now()
+		if err := redisFS.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("TestHashStorage(WriteFile): got err == %s, want err == nil", err)
+		}
+
+		b, err := redisFS.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestHashStorage(ReadFile): got err == %s, want err == nil", err)
+		}
+		if string(b) != content {
+			t.Errorf("TestHashStorage(ReadFile): got %q, want %q", string(b), content)
+		}
+
+		client.commands = nil
+		fi, err := redisFS.Stat(name)
+		if err != nil {
+			t.Fatalf("TestHashStorage(Stat): got err == %s, want err == nil", err)
+		}
+		wantCommands := []string{"hmget[path/to/file.json size modtime]", "pttl[path/to/file.json]"}
+		if diff := pretty.Compare(wantCommands, client.commands); diff != "" {
+			t.Errorf("TestHashStorage(Stat): should only read metadata, commands -want/+got:\n%s", diff)
+		}
+		if fi.Size() != int64(len(content)) {
+			t.Errorf("TestHashStorage(Stat): got Size() %d, want %d", fi.Size(), len(content))
+		}
+		if fi.ModTime().Before(start) || fi.ModTime().After(time.Now()) {
+			t.Errorf("TestHashStorage(Stat): got ModTime() %v, want between %v and now", fi.ModTime(), start)
+		}
+	}
+
+	// The second write was smaller, so the stale chunks must have been removed.
+	h := client.values[name].hash
+	if _, ok := h[chunkField(1)]; ok {
+		t.Errorf("TestHashStorage: stale chunk field %q was not removed", chunkField(1))
+	}
+	if h[hashContentType] != "application/json" {
+		t.Errorf("TestHashStorage: got content type %q, want %q", h[hashContentType], "application/json")
+	}
+
+	if _, err := redisFS.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestHashStorage(Stat missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+	if _, err := redisFS.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestHashStorage(Open missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestModTime(t *testing.T) {
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	if err := redisFS.WriteFile("file", []byte("content"), 0644); err != nil {
+		t.Fatalf("TestModTime(WriteFile): got err == %s, want err == nil", err)
+	}
+	fi, err := redisFS.Stat("file")
+	if err != nil {
+		t.Fatalf("TestModTime(Stat): got err == %s, want err == nil", err)
+	}
+	if fi.ModTime().Before(start) || fi.ModTime().After(time.Now()) {
+		t.Errorf("TestModTime(Stat): got ModTime() %v, want between %v and now", fi.ModTime(), start)
+	}
+
+	if err := redisFS.Rename("file", "renamed"); err != nil {
+		t.Fatalf("TestModTime(Rename): got err == %s, want err == nil", err)
+	}
+	renamed, err := redisFS.Stat("renamed")
+	if err != nil {
+		t.Fatalf("TestModTime(Stat after Rename): got err == %s, want err == nil", err)
+	}
+	if !renamed.ModTime().Equal(fi.ModTime()) {
+		t.Errorf("TestModTime(Stat after Rename): got ModTime() %v, want %v", renamed.ModTime(), fi.ModTime())
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	const (
+		openTimeout  = 10 * time.Second
+		writeTimeout = 20 * time.Second
+	)
+
+	client := newFakeClient()
+	redisFS, err := NewFromClient(client, WithOpenTimeout(openTimeout), WithWriteTimeout(writeTimeout))
+	if err != nil {
+		t.Fatalf("TestTimeouts: got err == %s, want err == nil", err)
+	}
+
+	tests := []struct {
+		desc string
+		op   func() error
+		want time.Duration
+	}{
+		{
+			desc: "OpenFile",
+			op: func() error {
+				_, err := redisFS.OpenFile("file", 0644, Flags(os.O_WRONLY|os.O_CREATE|os.O_TRUNC))
+				return err
+			},
+			want: openTimeout,
+		},
+		{
+			desc: "WriteFile",
+			op:   func() error { return redisFS.WriteFile("file", []byte("content"), 0644) },
+			want: writeTimeout,
+		},
+		{
+			desc: "Open",
+			op: func() error {
+				_, err := redisFS.Open("file")
+				return err
+			},
+			want: openTimeout,
+		},
+		{
+			desc: "Rename",
+			op:   func() error { return redisFS.Rename("file", "renamed") },
+			want: writeTimeout,
+		},
+		{
+			desc: "Remove",
+			op:   func() error { return redisFS.Remove("renamed") },
+			want: writeTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		client.commands = nil
+		client.timeouts = nil
+		if err := test.op(); err != nil {
+			t.Fatalf("TestTimeouts(%s): got err == %s, want err == nil", test.desc, err)
+		}
+
+		// The last command is the one using the timeout being tested, as WriteFile()
+		// calls OpenFile() before writing.
+		got := client.timeouts[len(client.timeouts)-1]
+		if got > test.want || got < test.want-time.Second {
+			t.Errorf("TestTimeouts(%s): got context deadline in %v, want near %v", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := NewFromClient(client, WithOpenTimeout(0)); err == nil {
+		t.Errorf("TestTimeouts(WithOpenTimeout(0)): got err == nil, want err != nil")
+	}
+	if _, err := NewFromClient(client, WithWriteTimeout(-1)); err == nil {
+		t.Errorf("TestTimeouts(WithWriteTimeout(-1)): got err == nil, want err != nil")
+	}
+}
+
+//go:embed redis.go hash.go
+var embedFS embed.FS
+
+func TestMergeEmbed(t *testing.T) {
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+
+	if err := jsfs.Merge(redisFS, embedFS, ""); err != nil {
+		t.Fatalf("TestMergeEmbed: got err == %s, want err == nil", err)
+	}
+
+	for _, name := range []string{"redis.go", "hash.go"} {
+		want, err := embedFS.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		got, err := redisFS.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestMergeEmbed(%s): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("TestMergeEmbed(%s): content did not match", name)
+		}
+	}
+
+	if err := redisFS.WriteFile("dir", []byte("content"), fs.ModeDir|0755); err == nil {
+		t.Errorf("TestMergeEmbed(WriteFile with fs.ModeDir): got err == nil, want err != nil")
+	}
+}
+
+func TestWriteFileCAS(t *testing.T) {
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+
+	v, err := redisFS.WriteFileCAS("file", []byte("first"), 0, 0644)
+	if err != nil {
+		t.Fatalf("TestWriteFileCAS(create): got err == %s, want err == nil", err)
+	}
+	if v != 1 {
+		t.Fatalf("TestWriteFileCAS(create): got version %d, want 1", v)
+	}
+
+	// Two clients read the file at the same version.
+	readA, err := redisFS.Version("file")
+	if err != nil {
+		t.Fatalf("TestWriteFileCAS(Version): got err == %s, want err == nil", err)
+	}
+	readB, _ := redisFS.Version("file")
+
+	if _, err := redisFS.WriteFileCAS("file", []byte("from a"), readA, 0644); err != nil {
+		t.Fatalf("TestWriteFileCAS(client a): got err == %s, want err == nil", err)
+	}
+
+	// Client b's write is based on a stale version and must not overwrite client a's write.
+	_, err = redisFS.WriteFileCAS("file", []byte("from b"), readB, 0644)
+	var mismatch *VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("TestWriteFileCAS(client b): got err == %v, want *VersionMismatchError", err)
+	}
+	if mismatch.Expected != 1 || mismatch.Current != 2 {
+		t.Errorf("TestWriteFileCAS(client b): got Expected %d, Current %d, want 1, 2", mismatch.Expected, mismatch.Current)
+	}
+	b, err := redisFS.ReadFile("file")
+	if err != nil {
+		t.Fatalf("TestWriteFileCAS(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "from a" {
+		t.Errorf("TestWriteFileCAS(ReadFile): got content %q, want %q", b, "from a")
+	}
+
+	if err := redisFS.Rename("file", "renamed"); err != nil {
+		t.Fatalf("TestWriteFileCAS(Rename): got err == %s, want err == nil", err)
+	}
+	if v, _ := redisFS.Version("renamed"); v != 2 {
+		t.Errorf("TestWriteFileCAS(Rename): got version %d, want 2", v)
+	}
+
+	if err := redisFS.Remove("renamed"); err != nil {
+		t.Fatalf("TestWriteFileCAS(Remove): got err == %s, want err == nil", err)
+	}
+	if v, _ := redisFS.Version("renamed"); v != 0 {
+		t.Errorf("TestWriteFileCAS(Remove): got version %d, want 0", v)
+	}
+
+	hashFS, err := NewFromClient(newFakeClient(), WithHashStorage())
+	if err != nil {
+		panic(err)
+	}
+	if _, err := hashFS.WriteFileCAS("file", []byte("content"), 0, 0644); err == nil {
+		t.Errorf("TestWriteFileCAS(WithHashStorage): got err == nil, want err != nil")
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	content := []byte("the unforgettable fire")
+
+	fsys, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+	if err := fsys.WriteFile("file", content, 0644); err != nil {
+		panic(err)
+	}
+	const name = "file"
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		t.Fatalf("TestReadAt(Open): got err == %s, want err == nil", err)
+	}
+	ra, ok := file.(io.ReaderAt)
+	if !ok {
+		t.Fatalf("TestReadAt: %T does not implement io.ReaderAt", file)
+	}
+
+	tests := []struct {
+		desc    string
+		off     int64
+		size    int
+		wantErr error
+	}{
+		{desc: "start", off: 0, size: 3},
+		{desc: "middle", off: 4, size: 13},
+		{desc: "exactly to end", off: 18, size: 4},
+		{desc: "past end", off: 18, size: 10, wantErr: io.EOF},
+		{desc: "at end", off: int64(len(content)), size: 1, wantErr: io.EOF},
+		{desc: "beyond end", off: 100, size: 1, wantErr: io.EOF},
+	}
+
+	for _, test := range tests {
+		b := make([]byte, test.size)
+		n, err := ra.ReadAt(b, test.off)
+		if err != test.wantErr {
+			t.Errorf("TestReadAt(%s): got err == %v, want err == %v", test.desc, err, test.wantErr)
+		}
+
+		want := []byte{}
+		if test.off < int64(len(content)) {
+			want = content[test.off:]
+			if len(want) > test.size {
+				want = want[:test.size]
+			}
+		}
+		if string(b[:n]) != string(want) {
+			t.Errorf("TestReadAt(%s): got %q, want %q", test.desc, b[:n], want)
+		}
+	}
+
+	if _, err := ra.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("TestReadAt(negative offset): got err == nil, want err != nil")
+	}
+
+	// ReadAt must not change the offset used by Read.
+	all, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("TestReadAt(ReadAll): got err == %s, want err == nil", err)
+	}
+	if string(all) != string(content) {
+		t.Errorf("TestReadAt(ReadAll): got %q, want %q", all, content)
+	}
+}
+
+func TestWriteFileWithOptions(t *testing.T) {
+	const (
+		ruleTTL   = time.Hour
+		oneOffTTL = time.Minute
+	)
+
+	client := newFakeClient()
+	redisFS, err := NewFromClient(client, WithWriteFileOFOptions(regexp.MustCompile(`.*`), ExpireFiles(ruleTTL)))
+	if err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		desc    string
+		write   func(name string) error
+		wantTTL time.Duration
+	}{
+		{
+			desc:    "WriteFile uses rules",
+			write:   func(name string) error { return redisFS.WriteFile(name, []byte("content"), 0644) },
+			wantTTL: ruleTTL,
+		},
+		{
+			desc: "one-off TTL",
+			write: func(name string) error {
+				return redisFS.WriteFileWithOptions(name, []byte("content"), 0644, ExpireFiles(oneOffTTL))
+			},
+			wantTTL: oneOffTTL,
+		},
+		{
+			desc: "no options bypasses rules",
+			write: func(name string) error {
+				return redisFS.WriteFileWithOptions(name, []byte("content"), 0644)
+			},
+			wantTTL: 0,
+		},
+	}
+
+	for i, test := range tests {
+		name := fmt.Sprintf("file%d", i)
+		if err := test.write(name); err != nil {
+			t.Fatalf("TestWriteFileWithOptions(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		for _, key := range []string{name, modTimeKey(name)} {
+			if got := client.values[key].ttl; got != test.wantTTL {
+				t.Errorf("TestWriteFileWithOptions(%s): key(%s) got ttl %v, want %v", test.desc, key, got, test.wantTTL)
+			}
+		}
+		b, err := redisFS.ReadFile(name)
+		if err != nil || string(b) != "content" {
+			t.Errorf("TestWriteFileWithOptions(%s): ReadFile got %q, err == %v", test.desc, b, err)
+		}
+	}
+}
+
+func TestNotExist(t *testing.T) {
+	for _, hash := range []bool{false, true} {
+		var options []Option
+		if hash {
+			options = append(options, WithHashStorage())
+		}
+		redisFS, err := NewFromClient(newFakeClient(), options...)
+		if err != nil {
+			panic(err)
+		}
+
+		if _, err := redisFS.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestNotExist(hash: %v, Open): got err == %v, want fs.ErrNotExist", hash, err)
+		}
+		if _, err := redisFS.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestNotExist(hash: %v, ReadFile): got err == %v, want fs.ErrNotExist", hash, err)
+		}
+		if _, err := redisFS.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestNotExist(hash: %v, Stat): got err == %v, want fs.ErrNotExist", hash, err)
+		}
+		if ok, err := redisFS.exists("missing"); ok || err != nil {
+			t.Errorf("TestNotExist(hash: %v, exists): got %v, %v, want false, nil", hash, ok, err)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		desc    string
+		name    string
+		content []byte
+		want    string
+	}{
+		{desc: "json", name: "data.json", content: []byte(`{"a": 1}`), want: "text/plain; charset=utf-8"},
+		{desc: "png extension", name: "image.png", content: png, want: "image/png"},
+		{desc: "png in a json file", name: "image.json", content: png, want: "image/png"},
+		{desc: "png without extension", name: "image", content: png, want: "image/png"},
+		{desc: "binary without extension", name: "binary", content: []byte{0, 1, 2, 0xff}, want: "application/octet-stream"},
+	}
+
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		if err := redisFS.WriteFile(test.name, test.content, 0644); err != nil {
+			panic(err)
+		}
+		got, err := redisFS.ContentType(test.name)
+		if err != nil {
+			t.Errorf("TestContentType(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestContentType(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := redisFS.ContentType("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestContentType(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	client := newFakeClient()
+	redisFS, err := NewFromClient(client)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := redisFS.HealthCheck(context.Background()); err != nil {
+		t.Errorf("TestHealthCheck(PING succeeds): got err == %s, want err == nil", err)
+	}
+
+	pingErr := errors.New("connection refused")
+	client.pingErr = pingErr
+	if err := redisFS.HealthCheck(context.Background()); !errors.Is(err, pingErr) {
+		t.Errorf("TestHealthCheck(PING fails): got err == %v, want %v", err, pingErr)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	const attempts = 3
+
+	tests := []struct {
+		desc     string
+		failures int
+		err      error
+		wantErr  bool
+	}{
+		{desc: "succeeds on last attempt", failures: attempts - 1, err: io.ErrUnexpectedEOF},
+		{desc: "failover reply is retried", failures: attempts - 1, err: fakeRedisError("READONLY You can't write against a read only replica.")},
+		{desc: "too many failures", failures: attempts, err: io.ErrUnexpectedEOF, wantErr: true},
+		{desc: "other replies are not retried", failures: 1, err: fakeRedisError("ERR unknown command"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		client := newFlakyClient(test.failures, test.err)
+		redisFS, err := NewFromClient(client, WithRetry(attempts, time.Millisecond))
+		if err != nil {
+			panic(err)
+		}
+		client.values["file"] = fakeValue{content: []byte("content")}
+
+		ops := []struct {
+			name string
+			fn   func() error
+		}{
+			{"get", func() error { _, err := redisFS.ReadFile("file"); return err }},
+			{"exists", func() error { _, err := redisFS.exists("file"); return err }},
+			{"set", func() error { return redisFS.WriteFile("file", []byte("content"), 0644) }},
+			{"del", func() error { return redisFS.Remove("file") }},
+		}
+		for _, op := range ops {
+			err := op.fn()
+			switch {
+			case err == nil && test.wantErr:
+				t.Errorf("TestRetry(%s, %s): got err == nil, want err != nil", test.desc, op.name)
+			case err != nil && !test.wantErr:
+				t.Errorf("TestRetry(%s, %s): got err == %s, want err == nil", test.desc, op.name, err)
+			}
+		}
+	}
+}
+
+func TestRetryNotExist(t *testing.T) {
+	client := newFlakyClient(0, nil)
+	redisFS, err := NewFromClient(client, WithRetry(3, time.Millisecond))
+	if err != nil {
+		panic(err)
+	}
+
+	if _, err := redisFS.ReadFile("nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestRetryNotExist: got err == %v, want fs.ErrNotExist", err)
+	}
+	if got := client.calls["get"]; got != 1 {
+		t.Errorf("TestRetryNotExist: got %d Get calls, want 1 as redis.Nil is not retried", got)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	client := newFlakyClient(100, io.ErrUnexpectedEOF)
+	redisFS, err := NewFromClient(client, WithRetry(100, 20*time.Millisecond), WithOpenTimeout(50*time.Millisecond))
+	if err != nil {
+		panic(err)
+	}
+
+	start := time.Now()
+	if _, err := redisFS.ReadFile("file"); err == nil {
+		t.Fatalf("TestRetryDeadline: got err == nil, want err != nil")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("TestRetryDeadline: retries took %v, want them to stop at the open timeout", d)
+	}
+	if got := client.calls["get"]; got >= 100 {
+		t.Errorf("TestRetryDeadline: got %d Get calls, want retries to stop at the open timeout", got)
+	}
+}
+
+func TestRemovePrefix(t *testing.T) {
+	many := []string{}
+	for i := 0; i < 2*removeBatchSize+10; i++ {
+		many = append(many, fmt.Sprintf("big/%d", i))
+	}
+
+	tests := []struct {
+		desc    string
+		options []Option
+		files   []string
+		prefix  string
+		want    []string
+	}{
+		{
+			desc:   "only files under prefix are removed",
+			files:  []string{"users/a", "users/b/c", "usersfile", "other/users/a", "a"},
+			prefix: "users/",
+			want:   []string{"a", "other/users/a", "usersfile"},
+		},
+		{
+			desc:    "hash storage",
+			options: []Option{WithHashStorage()},
+			files:   []string{"users/a", "users/b/c", "other/a"},
+			prefix:  "users/",
+			want:    []string{"other/a"},
+		},
+		{
+			desc:   "glob characters in prefix are literal",
+			files:  []string{"a*b/file", "axb/file", "a?/file"},
+			prefix: "a*b/",
+			want:   []string{"a?/file", "axb/file"},
+		},
+		{
+			desc:   "many batches",
+			files:  append([]string{"small/file"}, many...),
+			prefix: "big/",
+			want:   []string{"small/file"},
+		},
+	}
+
+	for _, test := range tests {
+		client := newFakeClient()
+		redisFS, err := NewFromClient(client, test.options...)
+		if err != nil {
+			panic(err)
+		}
+		for _, name := range test.files {
+			if err := redisFS.WriteFile(name, []byte(name), 0644); err != nil {
+				panic(err)
+			}
+		}
+
+		n, err := redisFS.RemovePrefix(test.prefix)
+		if err != nil {
+			t.Errorf("TestRemovePrefix(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if wantN := len(test.files) - len(test.want); n != wantN {
+			t.Errorf("TestRemovePrefix(%s): got %d removed, want %d", test.desc, n, wantN)
+		}
+
+		var got []string
+		for k := range client.values {
+			got = append(got, k)
+		}
+		want := append([]string{}, test.want...)
+		if len(test.options) == 0 {
+			// Files stored as strings keep their modification time in a second key.
+			for _, name := range test.want {
+				want = append(want, modTimeKey(name))
+			}
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestRemovePrefix(%s): keys left: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestStatTTL(t *testing.T) {
+	const ttl = time.Minute
+
+	for _, hash := range []bool{false, true} {
+		var options []Option
+		if hash {
+			options = append(options, WithHashStorage())
+		}
+		redisFS, err := NewFromClient(newFakeClient(), options...)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := redisFS.WriteFileWithOptions("expires", []byte("content"), 0644, ExpireFiles(ttl)); err != nil {
+			t.Fatalf("TestStatTTL(hash == %v): got err == %s, want err == nil", hash, err)
+		}
+		if err := redisFS.WriteFileWithOptions("forever", []byte("content"), 0644); err != nil {
+			t.Fatalf("TestStatTTL(hash == %v): got err == %s, want err == nil", hash, err)
+		}
+
+		fi, err := redisFS.Stat("expires")
+		if err != nil {
+			t.Fatalf("TestStatTTL(hash == %v): Stat got err == %s, want err == nil", hash, err)
+		}
+		if got := fi.Sys().(Sys).TTL; got <= 0 || got > ttl {
+			t.Errorf("TestStatTTL(hash == %v): got TTL %v, want in (0, %v]", hash, got, ttl)
+		}
+
+		fi, err = redisFS.Stat("forever")
+		if err != nil {
+			t.Fatalf("TestStatTTL(hash == %v): Stat got err == %s, want err == nil", hash, err)
+		}
+		if got := fi.Sys().(Sys).TTL; got != 0 {
+			t.Errorf("TestStatTTL(hash == %v): file without expiration got TTL %v, want 0", hash, got)
+		}
+	}
+}
+
+func TestRewriteTTL(t *testing.T) {
+	const ttl = time.Minute
+
+	tests := []struct {
+		desc    string
+		options []jsfs.OFOption
+		want    time.Duration
+	}{
+		{desc: "KeepTTL keeps the TTL", want: ttl},
+		{desc: "zero clears the TTL", options: []jsfs.OFOption{ExpireFiles(0)}, want: 0},
+		{desc: "new TTL", options: []jsfs.OFOption{ExpireFiles(2 * ttl)}, want: 2 * ttl},
+	}
+
+	for _, hash := range []bool{false, true} {
+		for _, test := range tests {
+			var options []Option
+			if hash {
+				options = append(options, WithHashStorage())
+			}
+			redisFS, err := NewFromClient(newFakeClient(), options...)
+			if err != nil {
+				panic(err)
+			}
+
+			if err := redisFS.WriteFileWithOptions("file", []byte("content"), 0644, ExpireFiles(ttl)); err != nil {
+				panic(err)
+			}
+			if err := redisFS.WriteFileWithOptions("file", []byte("new content"), 0644, test.options...); err != nil {
+				t.Fatalf("TestRewriteTTL(hash == %v, %s): got err == %s, want err == nil", hash, test.desc, err)
+			}
+
+			fi, err := redisFS.Stat("file")
+			if err != nil {
+				t.Fatalf("TestRewriteTTL(hash == %v, %s): Stat got err == %s, want err == nil", hash, test.desc, err)
+			}
+			if got := fi.Sys().(Sys).TTL; got != test.want {
+				t.Errorf("TestRewriteTTL(hash == %v, %s): got TTL %v, want %v", hash, test.desc, got, test.want)
+			}
+		}
+	}
+}
+
+func TestMaxReadSize(t *testing.T) {
+	const max = 10
+
+	files := map[string]string{
+		"under": strings.Repeat("a", max-1),
+		"at":    strings.Repeat("a", max),
+		"over":  strings.Repeat("a", max+1),
+	}
+
+	for _, hash := range []bool{false, true} {
+		options := []Option{WithMaxReadSize(max)}
+		if hash {
+			options = append(options, WithHashStorage())
+		}
+		redisFS, err := NewFromClient(newFakeClient(), options...)
+		if err != nil {
+			panic(err)
+		}
+		for name, content := range files {
+			if err := redisFS.WriteFile(name, []byte(content), 0644); err != nil {
+				panic(err)
+			}
+		}
+
+		for _, name := range []string{"under", "at", "over"} {
+			wantErr := name == "over"
+
+			b, err := redisFS.ReadFile(name)
+			switch {
+			case wantErr && !errors.Is(err, ErrMaxReadSize):
+				t.Errorf("TestMaxReadSize(hash == %v, %s): ReadFile got err == %v, want ErrMaxReadSize", hash, name, err)
+			case !wantErr && err != nil:
+				t.Errorf("TestMaxReadSize(hash == %v, %s): ReadFile got err == %s, want err == nil", hash, name, err)
+			case !wantErr && string(b) != files[name]:
+				t.Errorf("TestMaxReadSize(hash == %v, %s): ReadFile got %q, want %q", hash, name, b, files[name])
+			}
+
+			fi, err := redisFS.Stat(name)
+			if err != nil {
+				t.Errorf("TestMaxReadSize(hash == %v, %s): Stat got err == %s, want err == nil", hash, name, err)
+			} else if fi.Size() != int64(len(files[name])) {
+				t.Errorf("TestMaxReadSize(hash == %v, %s): Stat got Size() %d, want %d", hash, name, fi.Size(), len(files[name]))
+			}
+		}
+
+		if _, err := redisFS.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestMaxReadSize(hash == %v, missing): got err == %v, want fs.ErrNotExist", hash, err)
+		}
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	redisFS, err := NewFromClient(newFakeClient())
+	if err != nil {
+		panic(err)
+	}
+	if err := redisFS.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	tests := []struct {
+		desc    string
+		options []jsfs.OFOption
+	}{
+		{desc: "O_RDWR", options: []jsfs.OFOption{Flags(os.O_RDWR)}},
+		{desc: "existing file without O_TRUNC", options: []jsfs.OFOption{Flags(os.O_WRONLY)}},
+	}
+	for _, test := range tests {
+		_, err := redisFS.OpenFile("file", 0644, test.options...)
+		if !errors.Is(err, jsfs.ErrUnsupportedFlag) {
+			t.Errorf("TestErrorsIs(%s): got err == %v, want jsfs.ErrUnsupportedFlag", test.desc, err)
+		}
+	}
+}
+
+// fixedClock is a cache.Clock that always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestClock(t *testing.T) {
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	redisFS, err := NewFromClient(newFakeClient(), WithClock(fixedClock(want)))
+	if err != nil {
+		panic(err)
+	}
+	hashFS, err := NewFromClient(newFakeClient(), WithClock(fixedClock(want)), WithHashStorage())
+	if err != nil {
+		panic(err)
+	}
+
+	if err := redisFS.WriteFile("file", []byte("content"), 0644); err != nil {
+		t.Fatalf("TestClock(WriteFile): got err == %s, want err == nil", err)
+	}
+	if _, err := redisFS.WriteFileCAS("cas", []byte("content"), 0, 0644); err != nil {
+		t.Fatalf("TestClock(WriteFileCAS): got err == %s, want err == nil", err)
+	}
+	if err := hashFS.WriteFile("file", []byte("content"), 0644); err != nil {
+		t.Fatalf("TestClock(hash WriteFile): got err == %s, want err == nil", err)
+	}
+
+	tests := []struct {
+		desc string
+		fsys *FS
+		name string
+	}{
+		{desc: "WriteFile", fsys: redisFS, name: "file"},
+		{desc: "WriteFileCAS", fsys: redisFS, name: "cas"},
+		{desc: "WithHashStorage", fsys: hashFS, name: "file"},
+	}
+
+	for _, test := range tests {
+		fi, err := test.fsys.Stat(test.name)
+		if err != nil {
+			t.Errorf("TestClock(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if !fi.ModTime().Equal(want) {
+			t.Errorf("TestClock(%s): got ModTime() %v, want %v", test.desc, fi.ModTime(), want)
+		}
+	}
+
+	if _, err := NewFromClient(newFakeClient(), WithClock(nil)); err == nil {
+		t.Errorf("TestClock(nil Clock): got err == nil, want err != nil")
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	if _, err := NewFromClient(newFakeClient(), WithBufferPool(nil)); err == nil {
+		t.Errorf("TestBufferPool(nil pool): got err == nil, want err != nil")
+	}
+
+	redisFS, err := NewFromClient(newFakeClient(), WithHashStorage(), WithBufferPool(&cache.BufferPool{}))
+	if err != nil {
+		panic(err)
+	}
+	redisFS.hashChunkSize = 4
+
+	files := map[string]string{"a": "content of file a", "b": "b"}
+	for name, content := range files {
+		if err := redisFS.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	// ReadFile() must not use the pool, as the returned slice is kept after buffers are reused.
+	kept, err := redisFS.ReadFile("a")
+	if err != nil {
+		t.Fatalf("TestBufferPool(ReadFile): got err == %s, want err == nil", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for name, content := range files {
+			file, err := redisFS.Open(name)
+			if err != nil {
+				t.Fatalf("TestBufferPool(Open(%s)): got err == %s, want err == nil", name, err)
+			}
+			b, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatalf("TestBufferPool(Read(%s)): got err == %s, want err == nil", name, err)
+			}
+			if string(b) != content {
+				t.Errorf("TestBufferPool(Read(%s)): got %q, want %q", name, b, content)
+			}
+			if err := file.Close(); err != nil {
+				t.Errorf("TestBufferPool(Close(%s)): got err == %s, want err == nil", name, err)
+			}
+			// Close() twice must not return the buffer to the pool twice.
+			file.Close()
+		}
+	}
+
+	if string(kept) != files["a"] {
+		t.Errorf("TestBufferPool(ReadFile): content changed after buffers were reused: got %q, want %q", kept, files["a"])
+	}
+}
+
+func BenchmarkOpenHash(b *testing.B) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+
+	for _, pooled := range []bool{false, true} {
+		options := []Option{WithHashStorage()}
+		if pooled {
+			options = append(options, WithBufferPool(&cache.BufferPool{}))
+		}
+		redisFS, err := NewFromClient(newFakeClient(), options...)
+		if err != nil {
+			panic(err)
+		}
+		if err := redisFS.WriteFile("file", content, 0644); err != nil {
+			panic(err)
+		}
+
+		b.Run(fmt.Sprintf("pooled=%v", pooled), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				file, err := redisFS.Open("file")
+				if err != nil {
+					b.Fatal(err)
+				}
+				file.Close()
+			}
+		})
+	}
+}
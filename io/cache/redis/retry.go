@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithRetry retries Get, Set, Del and Exists commands that fail with a retryable error, such
+// as a network error or a Redis failover, up to attempts times in total. The wait between
+// attempts starts at backoff and doubles after each attempt. Retries stop when the timeout set
+// by WithOpenTimeout() or WithWriteTimeout() is reached. redis.Nil is never retried.
+// By default commands are not retried.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(f *FS) error {
+		if attempts < 1 {
+			return fmt.Errorf("WithRetry(%d, %v): attempts must be >= 1", attempts, backoff)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("WithRetry(%d, %v): backoff must be >= 0", attempts, backoff)
+		}
+		f.retry = retrier{attempts: attempts, backoff: backoff}
+		return nil
+	}
+}
+
+// retrier retries Redis commands. The zero value runs a command once.
+type retrier struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// do runs fn until it succeeds, returns an error that is not retryable, ctx is done or
+// all attempts are used. It returns the last error from fn.
+func (r retrier) do(ctx context.Context, fn func() error) error {
+	backoff := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.attempts || !isRetryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// retryablePrefixes are the prefixes of Redis error replies that are sent while a server
+// is loading data or failing over.
+var retryablePrefixes = []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "}
+
+// isRetryable reports if err is a transient error that a command can be retried after.
+func isRetryable(err error) bool {
+	switch {
+	case err == nil, err == redis.Nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+
+	// Errors that are replies from Redis are only retried if they are transient. All other
+	// errors, such as network errors, are retried.
+	var rerr redis.Error
+	if errors.As(err, &rerr) {
+		for _, p := range retryablePrefixes {
+			if strings.HasPrefix(rerr.Error(), p) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
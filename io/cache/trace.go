@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tracer starts spans for tracing operations on an FS, see WithTracer(). This is small enough
+// to wrap OpenTelemetry's trace.Tracer or any other tracing system.
+type Tracer interface {
+	// Start starts a span called name that is a child of any span in ctx. The returned Context
+	// holds the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute on the span.
+	SetAttribute(key, value string)
+	// End ends the span. err is the error of the operation, if any.
+	End(err error)
+}
+
+// Span names and attributes used with a Tracer.
+const (
+	// SpanReadFile covers an FS.ReadFile() call.
+	SpanReadFile = "cache.ReadFile"
+	// SpanWriteFile covers an FS.WriteFile() call.
+	SpanWriteFile = "cache.WriteFile"
+	// SpanLayerReadFile is a child of SpanReadFile that covers the read from a single layer.
+	SpanLayerReadFile = "cache.layer.ReadFile"
+
+	// AttrName is the name of the file.
+	AttrName = "cache.name"
+	// AttrLayer is the type of the layer (such as *redis.FS) that was accessed.
+	AttrLayer = "cache.layer"
+	// AttrResult is ResultHit or ResultMiss. On a SpanReadFile, this is ResultHit only if the
+	// file was served from the cache layer.
+	AttrResult = "cache.result"
+
+	ResultHit  = "hit"
+	ResultMiss = "miss"
+)
+
+// WithTracer causes ReadFile() and WriteFile() to create spans with t. Because fs.FS methods
+// do not take a Context, spans from an FS start new traces and spans from a nested FS are
+// not children of its parent's spans. If not set, no spans are created.
+func WithTracer(t Tracer) Option {
+	return func(f *FS) error {
+		if t == nil {
+			return fmt.Errorf("WithTracer() cannot be passed a nil Tracer")
+		}
+		f.tracer = t
+		return nil
+	}
+}
+
+// noopSpan is used when no Tracer is set.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key, value string) {}
+func (noopSpan) End(err error)                  {}
+
+func (f *FS) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if f.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return f.tracer.Start(ctx, name)
+}
+
+// startLayerSpan starts a SpanLayerReadFile for the layer with type layerType.
+func (f *FS) startLayerSpan(ctx context.Context, layerType string) Span {
+	if f.tracer == nil {
+		return noopSpan{}
+	}
+	_, span := f.tracer.Start(ctx, SpanLayerReadFile)
+	span.SetAttribute(AttrLayer, layerType)
+	return span
+}
+
+// endLayerSpan ends a span from startLayerSpan().
+func endLayerSpan(span Span, err error) {
+	if err == nil {
+		span.SetAttribute(AttrResult, ResultHit)
+	} else {
+		span.SetAttribute(AttrResult, ResultMiss)
+	}
+	span.End(err)
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// writtenHashes remembers a hash of the content last written to storage for each name.
+type writtenHashes struct {
+	mu      sync.Mutex
+	entries map[string]*writtenHash
+}
+
+type writtenHash struct {
+	sum [sha256.Size]byte
+	// has is set if sum is the hash of the content in storage.
+	has bool
+	// inflight is the number of writes to storage for the name that have not finished.
+	inflight int
+	// overlapped is set if writes for the name ran at the same time. We can't know which
+	// content storage ended up with, so sum is not recorded.
+	overlapped bool
+}
+
+func newWrittenHashes() *writtenHashes {
+	return &writtenHashes{entries: map[string]*writtenHash{}}
+}
+
+// unchanged returns true if sum is the hash of the content last written for name and no
+// write for name is in progress.
+func (w *writtenHashes) unchanged(name string, sum [sha256.Size]byte) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[name]
+	return ok && e.has && e.inflight == 0 && e.sum == sum
+}
+
+// start records that a write for name has started. done must be called when it finishes.
+func (w *writtenHashes) start(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e, ok := w.entries[name]
+	if !ok {
+		e = &writtenHash{}
+		w.entries[name] = e
+	}
+	e.has = false
+	if e.inflight > 0 {
+		e.overlapped = true
+	}
+	e.inflight++
+}
+
+// done records that a write for name started with start() has finished. If the write
+// succeeded, sum is recorded for name unless other writes for it overlapped this one.
+func (w *writtenHashes) done(name string, sum [sha256.Size]byte, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	e := w.entries[name]
+	e.inflight--
+	if e.inflight > 0 {
+		return
+	}
+	if ok && !e.overlapped {
+		e.sum = sum
+		e.has = true
+		return
+	}
+	delete(w.entries, name)
+}
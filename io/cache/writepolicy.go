@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// WritePolicy is how WriteFile() writes to the cache and storage layers. See WithWritePolicy().
+type WritePolicy int
+
+const (
+	// WriteAround writes only to storage. The next ReadFile() of the file is a cache miss
+	// that fills the cache. A copy of the file already in the cache is not updated. This is the default.
+	WriteAround WritePolicy = iota
+	// WriteThrough writes to storage and then to the cache before WriteFile() returns. If
+	// writing to storage fails, the cache is not written.
+	WriteThrough
+	// WriteBack writes to the cache before WriteFile() returns and queues the write to storage,
+	// which happens in the background. If writing to the cache fails, storage is not written.
+	// A failed write to storage is logged to FS.Log and is not retried, so storage can lose
+	// writes that the cache has. When there are several queued writes for a file, only the
+	// last is written to storage. Use Wait() to wait for queued writes to finish.
+	WriteBack
+)
+
+func (p WritePolicy) String() string {
+	switch p {
+	case WriteAround:
+		return "WriteAround"
+	case WriteThrough:
+		return "WriteThrough"
+	case WriteBack:
+		return "WriteBack"
+	}
+	return fmt.Sprintf("WritePolicy(%d)", int(p))
+}
+
+// WithWritePolicy sets how WriteFile() writes to the cache and storage layers. Defaults to WriteAround.
+func WithWritePolicy(p WritePolicy) Option {
+	return func(f *FS) error {
+		switch p {
+		case WriteAround, WriteThrough, WriteBack:
+		default:
+			return fmt.Errorf("WithWritePolicy(%v) is not a valid WritePolicy", p)
+		}
+		f.writePolicy = p
+		return nil
+	}
+}
+
+// writeBackQueue holds the writes to storage queued by WriteBack.
+type writeBackQueue struct {
+	mu sync.Mutex
+	// pending has an entry for every name with a write to storage in progress.
+	pending map[string]*pendingWrite
+	wg      sync.WaitGroup
+}
+
+type pendingWrite struct {
+	// next is the content to write once the write in progress finishes. It is only used
+	// if hasNext is set.
+	next    []byte
+	perm    fs.FileMode
+	hasNext bool
+}
+
+// writeBack queues writing content to storage. content must not be modified by the caller.
+func (f *FS) writeBack(name string, content []byte, perm fs.FileMode) {
+	q := &f.writeBacks
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == nil {
+		q.pending = map[string]*pendingWrite{}
+	}
+	if p, ok := q.pending[name]; ok {
+		// The goroutine writing name will write this once its current write finishes.
+		p.next, p.perm, p.hasNext = content, perm, true
+		return
+	}
+	q.pending[name] = &pendingWrite{}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for {
+			if _, err := f.writeStore(name, content, perm); err != nil {
+				f.Log.Printf("problem writing back file(%s) to storage(%T): %s", name, f.store, err)
+			}
+
+			q.mu.Lock()
+			p := q.pending[name]
+			if !p.hasNext {
+				delete(q.pending, name)
+				q.mu.Unlock()
+				return
+			}
+			content, perm = p.next, p.perm
+			p.next, p.hasNext = nil, false
+			q.mu.Unlock()
+		}
+	}()
+}
@@ -90,6 +90,37 @@ Write a string to a file:
 		// Do something
 	}
 
+Append to a log blob and make each line visible to readers as it is written:
+
+	file, err := fsys.OpenFile("logs/app.log", 0644, WithFlags(os.O_WRONLY|os.O_CREATE), WithFlushable())
+	if err != nil {
+		// Do something
+	}
+	defer file.Close()
+
+	for line := range lines {
+		io.WriteString(file.(io.Writer), line)
+		if err := file.(*File).Flush(); err != nil {
+			// Do something
+		}
+	}
+
+Share a container with other applications by using a prefix:
+
+	sub, err := fsys.Sub("app1")
+	if err != nil {
+		// Do something
+	}
+	app1 := sub.(*FS)
+
+Test code that uses an FS without a storage account by using the in-memory
+Container in blob/fake:
+
+	fsys, err := NewFromContainer(fake.New())
+	if err != nil {
+		// Do something
+	}
+
 Walk the file system and log all directories:
 
 	err := fs.WalkDir(
@@ -111,16 +142,20 @@ package blob
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
 	"math"
+	"math/rand"
 	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -132,11 +167,10 @@ import (
 
 // File implements io.FS.File and io.Writer for blobs.
 type File struct {
-	flags   int
-	contURL azblob.ContainerURL // Only set if File is a directory.
-	u       azblob.BlockBlobURL
-	fi      fileInfo
-	path    string // The full path, used for directories
+	flags int
+	cont  Container
+	fi    fileInfo
+	path  string // The full path of the blob or directory.
 
 	// These are related to locking
 	leaseID string
@@ -147,6 +181,8 @@ type File struct {
 
 	// For files that can be read.
 	reader io.ReadCloser
+	// offset is where the next Read() reads from. reader starts at offset.
+	offset int64
 	// For files that can write.
 	writer io.WriteCloser
 	// writeErr indicates if we have an error with writing.
@@ -154,6 +190,17 @@ type File struct {
 	writeWait sync.WaitGroup
 
 	transferManager azblob.TransferManager
+	blockSize       int64
+	progress        func(bytesUploaded int64)
+	ifMatch         azblob.ETag
+	listConcurrency int
+
+	// These are set for files opened WithFlushable().
+	blocks   BlockContainer
+	buf      []byte   // Written content that has not been staged as a block.
+	blockIDs []string // Blocks that have been staged, in order.
+	uploaded int64    // Total bytes that have been staged.
+	dirty    bool     // There are writes that have not been committed.
 
 	dirReader *dirReader // Usee when this represents a directory
 }
@@ -168,12 +215,89 @@ func (f *File) Read(p []byte) (n int, err error) {
 	defer f.mu.Unlock()
 
 	if f.reader == nil {
+		if f.fi.props != nil && f.offset >= f.fi.Size() {
+			return 0, io.EOF
+		}
 		if err := f.fetchReader(); err != nil {
 			return 0, err
 		}
 	}
 
-	return f.reader.Read(p)
+	n, err = f.reader.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.Seek(). Seeking does not download anything. The next Read()
+// downloads the blob starting at the new offset, so only the part of the blob that is read
+// is transferred.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if isFlagSet(f.flags, os.O_WRONLY) {
+		return 0, errors.New("cannot Seek() a file opened with os.O_WRONLY")
+	}
+	if f.fi.dir {
+		return 0, errors.New("cannot Seek() a directory")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.fi.Size()
+	default:
+		return 0, fmt.Errorf("Seek(): invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Seek(): negative position %d", offset)
+	}
+
+	if offset != f.offset && f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.ReadAt() by downloading len(p) bytes of the blob starting
+// at off. It does not change the offset used by Read().
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if isFlagSet(f.flags, os.O_WRONLY) {
+		return 0, errors.New("cannot ReadAt() a file opened with os.O_WRONLY")
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.path, Err: errors.New("negative offset")}
+	}
+	if off >= f.fi.Size() {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if f.fi.gzipped {
+		r, err = gunzip(context.Background(), f.cont, f.path, off)
+	} else {
+		r, err = f.cont.Download(context.Background(), f.path, off, int64(len(p)))
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
 }
 
 // Write implements io.Writer.Write().
@@ -186,30 +310,39 @@ func (f *File) Write(p []byte) (n int, err error) {
 	defer f.mu.Unlock()
 
 	if f.leaseID != "" && time.Now().After(f.expires) {
-		return 0, fmt.Errorf("lost lock on file")
+		return 0, jsfs.ErrLockLost
+	}
+
+	if f.blocks != nil {
+		return f.writeBlocks(p)
 	}
 
 	if f.writer == nil {
 		r, w := io.Pipe()
 		f.writer = w
 
+		var src io.Reader = r
+		if f.progress != nil {
+			src = &progressReader{r: r, progress: f.progress}
+		}
+
 		f.writeWait.Add(1)
 		go func() {
 			defer f.writeWait.Done()
-			_, err := azblob.UploadStreamToBlockBlob(
+			err := f.cont.UploadStream(
 				context.Background(),
-				r,
-				f.u.ToBlockBlobURL(),
-				azblob.UploadStreamToBlockBlobOptions{
+				f.path,
+				src,
+				UploadOptions{
 					TransferManager: f.transferManager,
-					AccessConditions: azblob.BlobAccessConditions{
-						LeaseAccessConditions: azblob.LeaseAccessConditions{
-							LeaseID: f.leaseID,
-						},
-					},
+					BlockSize:       f.blockSize,
+					LeaseID:         f.leaseID,
+					IfMatch:         f.ifMatch,
 				},
 			)
 			if err != nil {
+				// Unblocks any Write() waiting on the pipe, which holds f.mu.
+				r.CloseWithError(err)
 				f.mu.Lock()
 				defer f.mu.Unlock()
 				if f.writeErr == nil {
@@ -219,40 +352,187 @@ func (f *File) Write(p []byte) (n int, err error) {
 		}()
 	}
 	if f.writeErr != nil {
-		return 0, err
+		return 0, f.writeErr
 	}
 
 	return f.writer.Write(p)
 }
 
+// progressReader calls progress with the total number of bytes read after each Read().
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	progress func(bytesUploaded int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.total += int64(n)
+		p.progress(p.total)
+	}
+	return n, err
+}
+
+// defaultBlockSize is the size of the blocks staged by a file opened WithFlushable() if
+// WithBlockSize() is not used. This matches the default of UploadStreamToBlockBlob().
+const defaultBlockSize = 1 << 20
+
+// writeBlocks adds p to the buffered content and stages a block each time the buffer
+// reaches the block size. f.mu must be held.
+func (f *File) writeBlocks(p []byte) (int, error) {
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+
+	size := f.blockSize
+	if size == 0 {
+		size = defaultBlockSize
+	}
+
+	f.buf = append(f.buf, p...)
+	f.dirty = f.dirty || len(p) > 0
+	for int64(len(f.buf)) >= size {
+		if err := f.stageBlock(f.buf[:size]); err != nil {
+			return 0, err
+		}
+		f.buf = append(f.buf[:0], f.buf[size:]...)
+	}
+	return len(p), nil
+}
+
+// stageBlock uploads content as the next block of the file. f.mu must be held.
+func (f *File) stageBlock(content []byte) error {
+	// Block IDs must all be the same length, so the index is zero padded.
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%016d", len(f.blockIDs))))
+	if err := f.blocks.StageBlock(context.Background(), f.path, id, content, f.leaseID); err != nil {
+		f.writeErr = err
+		return err
+	}
+	f.blockIDs = append(f.blockIDs, id)
+	f.uploaded += int64(len(content))
+	if f.progress != nil {
+		f.progress(f.uploaded)
+	}
+	return nil
+}
+
+// Flush commits everything written to the file so far, so that readers of the blob see it,
+// while keeping the file open for more writes. The file must have been opened WithFlushable().
+// This is useful for long-lived writes, such as tailing logs to a blob.
+//
+// Each Flush() stages any buffered writes as a block, even if it is smaller than the block size,
+// and then commits the list of all blocks written so far, which is an extra request. A blob can
+// have at most 50,000 blocks, so flushing often limits how large the file can grow. Compared to
+// the default write path, which uses UploadStreamToBlockBlob(), blocks are uploaded one at a time
+// as Write() fills them instead of concurrently by a TransferManager.
+func (f *File) Flush() error {
+	if f.blocks == nil {
+		return errors.New("Flush() requires a file opened with WithFlushable()")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.leaseID != "" && time.Now().After(f.expires) {
+		return jsfs.ErrLockLost
+	}
+	return f.flush()
+}
+
+// flush stages the buffered content and commits all blocks. f.mu must be held.
+func (f *File) flush() error {
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	if len(f.buf) > 0 {
+		if err := f.stageBlock(f.buf); err != nil {
+			return err
+		}
+		f.buf = f.buf[:0]
+	}
+
+	etag, err := f.blocks.CommitBlockList(
+		context.Background(),
+		f.path,
+		f.blockIDs,
+		UploadOptions{LeaseID: f.leaseID, IfMatch: f.ifMatch},
+	)
+	if err != nil {
+		f.writeErr = err
+		return err
+	}
+	// The blob now has our ETag, later commits must only succeed if no one else has written it.
+	if f.ifMatch != azblob.ETagNone {
+		f.ifMatch = etag
+	}
+	f.dirty = false
+	return nil
+}
+
 // Close implements fs.File.Close().
 func (f *File) Close() error {
 	if f.reader != nil {
 		return f.reader.Close()
 	}
 
+	if f.blocks != nil {
+		f.mu.Lock()
+		err := f.writeErr
+		if err == nil && f.dirty {
+			err = f.flush()
+		}
+		f.mu.Unlock()
+
+		f.stopRenewal()
+		return err
+	}
+
 	if f.writer != nil {
 		f.writer.Close()
 		f.writeWait.Wait()
 
-		if !reflect.ValueOf(f.closed).IsZero() {
-			defer f.closed.Close()
-			f.closed.Signal(nil, signal.Wait())
-			f.releaseLease()
-		}
+		f.stopRenewal()
 		return f.writeErr
 	}
 
+	// A file opened WithLock() holds a lease even if it was never written.
+	f.stopRenewal()
 	return nil
 }
 
+// stopRenewal stops renewing the lease on the file and releases it.
+func (f *File) stopRenewal() {
+	// The renewal goroutine only exists if we hold a lease.
+	if f.leaseID != "" && !reflect.ValueOf(f.closed).IsZero() {
+		defer f.closed.Close()
+		f.closed.Signal(nil, signal.Wait())
+		f.releaseLease()
+		// Close() can be called more than once, but the lease is only released once.
+		f.leaseID = ""
+	}
+}
+
+// abort causes an in progress upload to fail with err, so that the blob is not changed.
+func (f *File) abort(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if w, ok := f.writer.(*io.PipeWriter); ok {
+		w.CloseWithError(err)
+	}
+	if f.blocks != nil && f.writeErr == nil {
+		f.writeErr = err
+	}
+}
+
 // releaseLease will break a file lease or attempt to until the lease expires.
 func (f *File) releaseLease() {
 	releaseCtx, cancel := context.WithDeadline(context.Background(), f.expires)
 	defer cancel()
 
 	for {
-		_, err := f.u.ReleaseLease(releaseCtx, f.leaseID, azblob.ModifiedAccessConditions{})
+		err := f.cont.ReleaseLease(releaseCtx, f.path, f.leaseID)
 		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
 			time.Sleep(1 * time.Second)
 			continue
@@ -266,34 +546,64 @@ func (f *File) Stat() (fs.FileInfo, error) {
 	return f.fi, nil
 }
 
+// fetchReader sets reader to read the blob from offset to the end. If the blob is gzipped
+// and decompressed, offset is in the decompressed content.
 func (f *File) fetchReader() error {
-	resp, err := f.u.Download(context.Background(), 0, 0, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if f.fi.gzipped {
+		r, err = gunzip(context.Background(), f.cont, f.path, f.offset)
+	} else {
+		r, err = f.cont.Download(context.Background(), f.path, f.offset, 0)
+	}
 	if err != nil {
 		return err
 	}
 
-	f.reader = resp.Body(azblob.RetryReaderOptions{})
+	f.reader = r
 	return nil
 }
 
-// renew renews a lease lock on the file if one exists.
-func (f *File) renew() {
-	renewAt := time.Until(f.expires) / 2
-	if renewAt < 0 {
-		return
+// leaseDuration is how long a lease is taken or renewed for. This is a var for tests.
+var leaseDuration = 60 * time.Second
+
+// renewInterval returns how long to wait before renewing a lease that expires in d.
+// This is half of d, minus up to 10% of d of jitter so that many files locked at the
+// same time do not renew at the same time.
+func renewInterval(d time.Duration) time.Duration {
+	i := d / 2
+	if j := int64(d / 10); j > 0 {
+		i -= time.Duration(rand.Int63n(j))
 	}
+	return i
+}
 
+// renew renews a lease lock on the file until the file is closed. If a renewal fails
+// and the lease expires, renewal stops and Write() will report the lost lock.
+func (f *File) renew() {
 	go func() {
-		ticker := time.NewTicker(renewAt)
-		defer ticker.Stop()
 		for {
+			f.mu.Lock()
+			renewAt := renewInterval(time.Until(f.expires))
+			f.mu.Unlock()
+
+			if renewAt <= 0 {
+				log.Printf("(%s) lease expired, no longer renewing", f.path)
+				ack := <-f.closed.Receive()
+				ack.Ack(nil)
+				return
+			}
+
+			timer := time.NewTimer(renewAt)
 			select {
-			case <-ticker.C:
+			case <-timer.C:
 				if err := f.renewLease(); err != nil {
 					log.Printf("(%s) problem renewing lease: %s", f.path, err)
 				}
-				return
 			case ack := <-f.closed.Receive():
+				timer.Stop()
 				ack.Ack(nil)
 				return
 			}
@@ -302,11 +612,15 @@ func (f *File) renew() {
 }
 
 func (f *File) renewLease() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Until(f.expires))
+	f.mu.Lock()
+	expires := f.expires
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), expires)
 	defer cancel()
 
 	for {
-		lease, err := f.u.RenewLease(ctx, f.leaseID, azblob.ModifiedAccessConditions{})
+		err := f.cont.RenewLease(ctx, f.path, f.leaseID)
 		if err != nil {
 			if ctx.Err() != nil {
 				return err
@@ -314,8 +628,8 @@ func (f *File) renewLease() error {
 			continue
 		}
 		f.mu.Lock()
-		f.leaseID = lease.LeaseID()
-		f.expires = lease.Date().Add(60 * time.Second)
+		defer f.mu.Unlock()
+		f.expires = time.Now().Add(leaseDuration)
 		return nil
 	}
 }
@@ -326,11 +640,14 @@ func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
 	defer f.mu.Unlock()
 
 	if !f.fi.dir {
-		return nil, fmt.Errorf("File is not a directory")
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: jsfs.ErrNotDirectory}
 	}
 
 	if f.dirReader == nil {
-		dr, err := newDirReader(f.path, f.contURL)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		dr, err := newDirReader(ctx, f.path, f.cont, f.listConcurrency)
 		if err != nil {
 			return nil, err
 		}
@@ -342,20 +659,26 @@ func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
 type dirReader struct {
 	sync.Mutex
 
-	name    string
-	path    string
-	contURL azblob.ContainerURL
-	items   []fs.DirEntry
-	index   int
+	name        string
+	path        string
+	cont        Container
+	concurrency int
+	items       []fs.DirEntry
+	index       int
 }
 
-func newDirReader(dirPath string, contURL azblob.ContainerURL) (*dirReader, error) {
+// newDirReader lists dirPath. ctx is only used while listing the directory.
+func newDirReader(ctx context.Context, dirPath string, cont Container, concurrency int) (*dirReader, error) {
+	if concurrency < 1 {
+		concurrency = defaultListConcurrency
+	}
 	dr := &dirReader{
-		name:    path.Base(dirPath),
-		path:    dirPath,
-		contURL: contURL,
+		name:        path.Base(dirPath),
+		path:        dirPath,
+		cont:        cont,
+		concurrency: concurrency,
 	}
-	if err := dr.get(); err != nil {
+	if err := dr.get(ctx); err != nil {
 		return nil, err
 	}
 	return dr, nil
@@ -378,10 +701,9 @@ func (d *dirReader) ReadDir(n int) ([]fs.DirEntry, error) {
 	return nil, io.EOF
 }
 
-func (d *dirReader) get() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
+// get lists the directory and gets the properties of every blob in it. If ctx is canceled,
+// this stops getting properties and returns ctx.Err().
+func (d *dirReader) get(ctx context.Context) error {
 	if d.path == "." {
 		d.path = ""
 	} else {
@@ -390,21 +712,23 @@ func (d *dirReader) get() error {
 		d.path += "/"
 	}
 
-	resp, err := d.contURL.ListBlobsHierarchySegment(
-		ctx,
-		azblob.Marker{},
-		"/",
-		azblob.ListBlobsSegmentOptions{
-			Prefix:     d.path,
-			MaxResults: math.MaxInt32,
-		},
-	)
-	if err != nil {
-		return err
+	var prefixes, blobs []string
+	for marker := ""; ; {
+		resp, err := d.cont.ListBlobsHierarchySegment(ctx, marker, d.path, "/", math.MaxInt32)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, resp.Prefixes...)
+		blobs = append(blobs, resp.Blobs...)
+
+		if resp.NextMarker == "" {
+			break
+		}
+		marker = resp.NextMarker
 	}
 
-	for _, prefix := range resp.Segment.BlobPrefixes {
-		n := path.Base(prefix.Name)
+	for _, prefix := range prefixes {
+		n := path.Base(prefix)
 		item := &dirEntry{
 			name: n,
 			fi: fileInfo{
@@ -415,18 +739,26 @@ func (d *dirReader) get() error {
 		d.items = append(d.items, item)
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
-	limiter := make(chan struct{}, 20)
-	for _, blob := range resp.Segment.BlobItems {
-		blob = blob
-		n := path.Base(blob.Name)
+	g, gCtx := errgroup.WithContext(ctx)
+	limiter := make(chan struct{}, d.concurrency)
+blobs:
+	for _, blob := range blobs {
+		blob := blob
+		// The placeholder of this directory is listed as a blob in it.
+		if isPlaceholder(blob) {
+			continue
+		}
+		n := path.Base(blob)
 
-		limiter <- struct{}{}
+		select {
+		case limiter <- struct{}{}:
+		case <-gCtx.Done():
+			break blobs
+		}
 		g.Go(func() error {
 			defer func() { <-limiter }()
 
-			u := d.contURL.NewBlobURL(blob.Name)
-			resp, err := u.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+			resp, err := d.cont.GetProperties(gCtx, blob)
 			if err == nil {
 				d.Lock()
 				defer d.Unlock()
@@ -435,7 +767,19 @@ func (d *dirReader) get() error {
 			return err
 		})
 	}
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Blob properties are fetched concurrently, so we must sort to return entries by name.
+	sort.Slice(d.items, func(i, j int) bool { return d.items[i].Name() < d.items[j].Name() })
+	return nil
 }
 
 type dirEntry struct {
@@ -459,21 +803,118 @@ func (d dirEntry) Info() (fs.FileInfo, error) {
 	return d.fi, nil
 }
 
+// defaultListConcurrency is the number of blobs we get properties for at a time when
+// reading a directory.
+const defaultListConcurrency = 20
+
 // FS implements io/fs.FS
 type FS struct {
-	containerURL azblob.ContainerURL
+	cont Container
+
+	transferManager azblob.TransferManager
+	listConcurrency int
+	pipelineOptions azblob.PipelineOptions
+	autoDecompress  bool
+	// maxReadSize is set by WithMaxReadSize(). It is 0 if there is no limit.
+	maxReadSize int64
+	// dirPlaceholders is set by WithDirectoryPlaceholders().
+	dirPlaceholders bool
+}
+
+// Option is an optional argument for the New() constructor.
+type Option func(f *FS) error
+
+// WithDefaultTransferManager sets the TransferManager used when writing files that are not
+// opened with WithTransferManager(). This allows tuning write throughput for the whole FS.
+// If not set, azblob's default is used for each file.
+func WithDefaultTransferManager(tm azblob.TransferManager) Option {
+	return func(f *FS) error {
+		if tm == nil {
+			return fmt.Errorf("WithDefaultTransferManager() cannot be passed a nil TransferManager")
+		}
+		f.transferManager = tm
+		return nil
+	}
+}
+
+// WithListConcurrency sets how many blob properties are fetched concurrently when reading
+// a directory. Defaults to 20.
+func WithListConcurrency(n int) Option {
+	return func(f *FS) error {
+		if n < 1 {
+			return fmt.Errorf("WithListConcurrency(%d) must be passed a value > 0", n)
+		}
+		f.listConcurrency = n
+		return nil
+	}
+}
+
+// WithPipelineOptions sets the options used to create the azblob pipeline that sends requests
+// to Azure. This controls the retry policy, telemetry, request logging and the HTTPSender used
+// to send requests, which allows setting a custom HTTP transport for proxies, connection pooling
+// or timeouts. This is only used by New(), as NewFromContainer() is passed a Container that
+// already has a pipeline.
+func WithPipelineOptions(o azblob.PipelineOptions) Option {
+	return func(f *FS) error {
+		f.pipelineOptions = o
+		return nil
+	}
+}
+
+// ErrMaxReadSize is wrapped by the error from Open() and ReadFile() for a file larger than the
+// size set with WithMaxReadSize().
+var ErrMaxReadSize = errors.New("file exceeds max read size")
+
+// WithMaxReadSize causes Open(), ReadFile() and OpenFile() for reading to return an error
+// wrapping ErrMaxReadSize for blobs larger than n bytes. The size is checked from the blob's
+// properties before any content is downloaded, which protects against reading unexpectedly
+// large blobs into memory. With WithAutoDecompress(), the decompressed size is checked.
+// Stat() is not limited.
+func WithMaxReadSize(n int64) Option {
+	return func(f *FS) error {
+		if n < 1 {
+			return fmt.Errorf("WithMaxReadSize(%d) must be passed a value > 0", n)
+		}
+		f.maxReadSize = n
+		return nil
+	}
 }
 
 // New is the constructor for FS. It is recommended that you use blob/auth/msi to create
 // the "cred".
-func New(account, container string, cred azblob.Credential) (*FS, error) {
-	p := azblob.NewPipeline(cred, azblob.PipelineOptions{})
+func New(account, container string, cred azblob.Credential, options ...Option) (*FS, error) {
+	// Options are applied here to find the pipeline options and again by NewFromContainer().
+	opts := &FS{}
+	for _, o := range options {
+		if err := o(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	p := azblob.NewPipeline(cred, opts.pipelineOptions)
 	blobPrimaryURL, _ := url.Parse("https://" + account + ".blob.core.windows.net/")
 	bsu := azblob.NewServiceURL(*blobPrimaryURL, p)
 
-	return &FS{
-		containerURL: bsu.NewContainerURL(container),
-	}, nil
+	return NewFromContainer(FromContainerURL(bsu.NewContainerURL(container)), options...)
+}
+
+// NewFromContainer is the constructor for FS when you want to provide the Container. This
+// is generally used to provide a fake Container in tests, such as the one in blob/fake.
+func NewFromContainer(cont Container, options ...Option) (*FS, error) {
+	if cont == nil {
+		return nil, fmt.Errorf("NewFromContainer() cannot be passed a nil Container")
+	}
+
+	f := &FS{
+		cont:            cont,
+		listConcurrency: defaultListConcurrency,
+	}
+	for _, o := range options {
+		if err := o(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
 }
 
 // Open implements fs.FS.Open().
@@ -481,23 +922,28 @@ func (f *FS) Open(name string) (fs.File, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	u := f.containerURL.NewBlobURL(name)
-
-	props, err := u.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	props, err := f.cont.GetProperties(ctx, name)
 	if err != nil {
 		return f.dirFile(ctx, name)
 	}
 
-	switch props.BlobType() {
+	switch props.BlobType {
 	case azblob.BlobBlockBlob:
+		fi, err := f.newReadFileInfo(ctx, path.Base(name), name, props)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if f.maxReadSize > 0 && fi.Size() > f.maxReadSize {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("size %d > %d: %w", fi.Size(), f.maxReadSize, ErrMaxReadSize)}
+		}
 		return &File{
-			contURL: f.containerURL,
-			flags:   os.O_RDONLY,
-			u:       u.ToBlockBlobURL(),
-			fi:      newFileInfo(path.Base(name), props),
+			cont:  f.cont,
+			flags: os.O_RDONLY,
+			path:  name,
+			fi:    fi,
 		}, nil
 	}
-	return nil, fmt.Errorf("%T type blobs are not currently supported", props.BlobType())
+	return nil, fmt.Errorf("%v type blobs are not currently supported", props.BlobType)
 }
 
 // ReadFile implements fs.ReadFileFS.ReadFile.
@@ -509,27 +955,75 @@ func (f *FS) ReadFile(name string) ([]byte, error) {
 	return io.ReadAll(file)
 }
 
-func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+// ContentType implements jsfs.ContentTyper.ContentType(). This returns the Content-Type stored
+// with the blob. If the blob does not have one, the type is detected from the extension of name
+// or the first 512 bytes of the blob with jsfs.DetectContentType().
+func (f *FS) ContentType(name string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	props, err := f.cont.GetProperties(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if props.ContentType != "" {
+		return props.ContentType, nil
+	}
+
+	file, err := f.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := file.(*File).ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", &fs.PathError{Op: "contenttype", Path: name, Err: err}
+	}
+	return jsfs.DetectContentType(name, head[:n]), nil
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir(). Listing the directory times out after 5 minutes.
+// Use ReadDirCtx() to control this.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	return f.ReadDirCtx(ctx, name)
+}
+
+// ReadDirCtx is like ReadDir(), but listing the directory and getting the properties of its
+// blobs stops when ctx is canceled. In that case, ctx.Err() is returned.
+func (f *FS) ReadDirCtx(ctx context.Context, name string) ([]fs.DirEntry, error) {
 	if name == "." {
 		name = ""
 	}
 
-	u := f.containerURL.NewBlobURL(name)
+	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	_, err := u.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
-	if err == nil {
-		return nil, fmt.Errorf("ReadDir(%s) does not appear to be a directory", name)
+	// The root is always a directory. Checking it in an FS from Sub() would find the
+	// placeholder blob of the directory the FS is rooted at.
+	if name != "" {
+		if _, err := f.cont.GetProperties(checkCtx, name); err == nil {
+			return nil, fmt.Errorf("ReadDir(%s) does not appear to be a directory", name)
+		}
 	}
 
-	file, err := f.dirFile(ctx, name)
+	file, err := f.dirFile(checkCtx, name)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
-	return file.ReadDir(-1)
+	dr, err := newDirReader(ctx, file.path, file.cont, file.listConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	return dr.ReadDir(-1)
 }
 
 // Stat implements fs.StatFS.Stat.
@@ -541,21 +1035,24 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 	if err == nil {
 		return dir.fi, nil
 	}
-	u := f.containerURL.NewBlobURL(name)
-
-	props, err := u.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	props, err := f.cont.GetProperties(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return newFileInfo(name, props), nil
+	fi, err := f.newReadFileInfo(ctx, name, name, props)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fi, nil
 }
 
 func (f *FS) dirFile(ctx context.Context, name string) (*File, error) {
 	switch name {
 	case ".", "":
 		return &File{
-			path:    ".",
-			contURL: f.containerURL,
+			path:            ".",
+			cont:            f.cont,
+			listConcurrency: f.listConcurrency,
 			fi: fileInfo{
 				name: ".",
 				dir:  true,
@@ -563,20 +1060,16 @@ func (f *FS) dirFile(ctx context.Context, name string) (*File, error) {
 		}, nil
 	}
 
-	resp, err := f.containerURL.ListBlobsHierarchySegment(
-		ctx,
-		azblob.Marker{},
-		"/",
-		azblob.ListBlobsSegmentOptions{Prefix: name + `/`, MaxResults: math.MaxInt32},
-	)
+	resp, err := f.cont.ListBlobsHierarchySegment(ctx, "", name+`/`, "/", 1)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Segment.BlobPrefixes) > 0 || len(resp.Segment.BlobItems) > 0 {
+	if len(resp.Prefixes) > 0 || len(resp.Blobs) > 0 {
 		return &File{
-			path:    name,
-			contURL: f.containerURL,
+			path:            name,
+			cont:            f.cont,
+			listConcurrency: f.listConcurrency,
 			fi: fileInfo{
 				name: path.Base(name),
 				dir:  true,
@@ -591,10 +1084,98 @@ func (f *FS) dirFile(ctx context.Context, name string) (*File, error) {
 	}
 }
 
+// WalkFiles calls fn for each blob in the directory prefix and all of its sub-directories, in
+// lexical order of the blob names. path is the full name of the blob and fi.Name() is its base name.
+// Use "." or "" for prefix to walk the entire container. If fn returns fs.SkipAll, the walk
+// stops and WalkFiles returns nil. Any other error stops the walk and is returned.
+//
+// This is a faster alternative to fs.WalkDir() when only files are needed. fs.WalkDir()
+// lists each directory and then gets the properties of each blob in it, while WalkFiles()
+// lists all blobs, including their properties, with as few requests as possible.
+func (f *FS) WalkFiles(prefix string, fn func(path string, fi fs.FileInfo) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch prefix {
+	case ".", "", "/":
+		prefix = ""
+	default:
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+
+	for marker := ""; ; {
+		resp, err := f.cont.ListBlobsFlatSegment(ctx, marker, prefix, 5000)
+		if err != nil {
+			return err
+		}
+		for _, b := range resp.Blobs {
+			if isPlaceholder(b.Name) {
+				continue
+			}
+			props := b.Properties
+			if err := fn(b.Name, newFileInfo(path.Base(b.Name), &props)); err != nil {
+				if err == fs.SkipAll {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if resp.NextMarker == "" {
+			return nil
+		}
+		marker = resp.NextMarker
+	}
+}
+
+// Exists returns true if a blob exists at name. Directories are not blobs, so this returns
+// false for them.
+func (f *FS) Exists(name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := f.cont.GetProperties(ctx, name)
+	switch {
+	case err == nil:
+		return true, nil
+	case isNotFound(err):
+		return false, nil
+	}
+	return false, err
+}
+
+// Remove removes the blob at name. If name does not exist, the error wraps fs.ErrNotExist.
+// Directories only exist while they contain blobs, so they cannot be removed and an error
+// is returned. Remove the blobs in a directory to remove it. With WithDirectoryPlaceholders(),
+// an empty directory made by Mkdir() or MkdirAll() can be removed.
+func (f *FS) Remove(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := f.cont.Delete(ctx, name)
+	if err == nil {
+		return nil
+	}
+	if !isNotFound(err) {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if _, derr := f.dirFile(ctx, name); derr == nil {
+		if f.dirPlaceholders {
+			return f.removePlaceholder(ctx, name)
+		}
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("is a directory")}
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
 type rwOptions struct {
-	lock  bool
-	tm    azblob.TransferManager
-	flags int
+	lock      bool
+	tm        azblob.TransferManager
+	blockSize int64
+	progress  func(bytesUploaded int64)
+	ifMatch   azblob.ETag
+	flushable bool
+	flags     int
 }
 
 func (o *rwOptions) defaults() {
@@ -629,6 +1210,71 @@ func WithTransferManager(tm azblob.TransferManager) jsfs.OFOption {
 	}
 }
 
+// WithBlockSize sets the size of each block uploaded when writing a file. This is useful
+// for tuning very large uploads. It is ignored if a TransferManager is used, as the
+// TransferManager controls the buffer sizes. Azure defaults to 1 MiB blocks.
+func WithBlockSize(n int64) jsfs.OFOption {
+	return func(o interface{}) error {
+		opt, ok := o.(*rwOptions)
+		if !ok {
+			return fmt.Errorf("WithBlockSize passed to incorrect function")
+		}
+		if n < 1 || n > math.MaxInt32 {
+			return fmt.Errorf("WithBlockSize(%d) must be > 0 and <= %d", n, math.MaxInt32)
+		}
+		opt.blockSize = n
+		return nil
+	}
+}
+
+// WithProgress has fn called with the total number of bytes consumed by the upload each
+// time the upload reads from the file's writes. fn is called from the upload goroutine,
+// so it must not block.
+func WithProgress(fn func(bytesUploaded int64)) jsfs.OFOption {
+	return func(o interface{}) error {
+		opt, ok := o.(*rwOptions)
+		if !ok {
+			return fmt.Errorf("WithProgress passed to incorrect function")
+		}
+		opt.progress = fn
+		return nil
+	}
+}
+
+// WithIfMatch only writes the file if the blob's ETag is still etag when the file is closed.
+// This allows a read-modify-write without losing another writer's changes: read the ETag
+// from Stat().Sys().(Sys).ETag, read the file and write it back with WithIfMatch(). If the
+// blob was changed in between, Close() returns a *ConflictError. Only valid with os.O_WRONLY.
+func WithIfMatch(etag string) jsfs.OFOption {
+	return func(o interface{}) error {
+		opt, ok := o.(*rwOptions)
+		if !ok {
+			return fmt.Errorf("WithIfMatch passed to incorrect function")
+		}
+		if etag == "" {
+			return fmt.Errorf("WithIfMatch() requires a non-empty etag")
+		}
+		opt.ifMatch = azblob.ETag(etag)
+		return nil
+	}
+}
+
+// WithFlushable opens a file for writing so that File.Flush() can commit what has been written
+// while the file stays open. Writes are staged as blocks of WithBlockSize() (1 MiB by default)
+// instead of being streamed with UploadStreamToBlockBlob(), so WithTransferManager() is ignored.
+// See File.Flush() for the trade-offs. Only valid with os.O_WRONLY and a Container that
+// implements BlockContainer.
+func WithFlushable() jsfs.OFOption {
+	return func(o interface{}) error {
+		opt, ok := o.(*rwOptions)
+		if !ok {
+			return fmt.Errorf("WithFlushable passed to incorrect function")
+		}
+		opt.flushable = true
+		return nil
+	}
+}
+
 func isFlagSet(flags int, flag int) bool {
 	return flags&flag != 0
 }
@@ -645,24 +1291,51 @@ func WithFlags(flags int) jsfs.OFOption {
 	}
 }
 
-// OpenFile implements github.com/gopherfs/fs.OpenFilerFS. When creating a new file, this will always be a block blob.
-func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
-	opts := rwOptions{}
+// rwOptions returns the rwOptions for OpenFile() with the FS defaults applied before options.
+func (f *FS) rwOptions(options []jsfs.OFOption) (rwOptions, error) {
+	opts := rwOptions{tm: f.transferManager}
 	opts.defaults()
 
 	for _, o := range options {
 		if err := o(&opts); err != nil {
-			return nil, err
+			return rwOptions{}, err
 		}
 	}
+	return opts, nil
+}
+
+// OpenFile implements github.com/gopherfs/fs.OpenFilerFS. When creating a new file, this will always be a block blob.
+func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	opts, err := f.rwOptions(options)
+	if err != nil {
+		return nil, err
+	}
 
 	if opts.lock && !isFlagSet(opts.flags, os.O_WRONLY) {
-		return nil, fmt.Errorf("only os.O_WRONLY support for locks")
+		return nil, fmt.Errorf("only os.O_WRONLY support for locks: %w", jsfs.ErrUnsupportedFlag)
+	}
+	if opts.ifMatch != azblob.ETagNone && !isFlagSet(opts.flags, os.O_WRONLY) {
+		return nil, fmt.Errorf("WithIfMatch() requires os.O_WRONLY")
+	}
+	var blocks BlockContainer
+	if opts.flushable {
+		if !isFlagSet(opts.flags, os.O_WRONLY) {
+			return nil, fmt.Errorf("WithFlushable() requires os.O_WRONLY")
+		}
+		var ok bool
+		blocks, ok = f.cont.(BlockContainer)
+		// A prefixContainer from Sub() is only a BlockContainer if the Container it wraps is.
+		if pc, isSub := f.cont.(prefixContainer); isSub {
+			_, ok = pc.cont.(BlockContainer)
+		}
+		if !ok {
+			return nil, fmt.Errorf("WithFlushable() requires a Container that implements BlockContainer, %T does not", f.cont)
+		}
 	}
 
 	if isFlagSet(opts.flags, os.O_RDONLY) {
 		if opts.flags > 0 {
-			return nil, fmt.Errorf("cannot set any other flag if os.O_RDONLY is set")
+			return nil, fmt.Errorf("cannot set any other flag if os.O_RDONLY is set: %w", jsfs.ErrUnsupportedFlag)
 		}
 		file, err := f.Open(name)
 		if err != nil {
@@ -672,7 +1345,7 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 	}
 
 	if isFlagSet(opts.flags, os.O_EXCL) && !isFlagSet(opts.flags, os.O_CREATE) {
-		return nil, fmt.Errorf("cannot set os.O_EXCL without os.O_CREATE")
+		return nil, fmt.Errorf("cannot set os.O_EXCL without os.O_CREATE: %w", jsfs.ErrUnsupportedFlag)
 	}
 	if name == "." {
 		name = ""
@@ -685,21 +1358,19 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 	if err == nil {
 		return dir, nil
 	}
-	u := f.containerURL.NewBlobURL(name)
-
 	var (
-		lresp   *azblob.BlobAcquireLeaseResponse
+		leaseID string
 		expires time.Time
 	)
 	if opts.lock {
-		expires = time.Now().Add(60 * time.Second)
-		lresp, err = u.AcquireLease(propCtx, "", 60, azblob.ModifiedAccessConditions{})
+		expires = time.Now().Add(leaseDuration)
+		leaseID, err = f.cont.AcquireLease(propCtx, name, int32(leaseDuration/time.Second))
 		if err != nil {
 			return nil, fmt.Errorf("could not acquire lease on file(%s): %w", name, err)
 		}
 	}
 
-	props, err := u.GetProperties(propCtx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	props, err := f.cont.GetProperties(propCtx, name)
 
 	// NOTE: These are not fully implemented because I have no idea what all the return
 	// error codes are. So this is generally assuming that the error is that they can't
@@ -721,18 +1392,19 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 		}
 	}
 
-	var leaseID string
-	if lresp != nil {
-		leaseID = lresp.LeaseID()
-	}
-
 	file := &File{
-		flags:   opts.flags,
-		u:       u.ToBlockBlobURL(),
-		fi:      newFileInfo(name, props),
-		leaseID: leaseID,
-		expires: expires,
-		closed:  signal.New(),
+		flags:           opts.flags,
+		cont:            f.cont,
+		path:            name,
+		fi:              newFileInfo(name, props),
+		leaseID:         leaseID,
+		expires:         expires,
+		closed:          signal.New(),
+		transferManager: opts.tm,
+		blockSize:       opts.blockSize,
+		progress:        opts.progress,
+		ifMatch:         opts.ifMatch,
+		blocks:          blocks,
 	}
 
 	if file.leaseID != "" {
@@ -757,22 +1429,64 @@ func (f *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
 	return file.Close()
 }
 
+// WriteFileFrom implements jsfs.StreamWriter.WriteFileFrom(). r is streamed to the blob
+// in blocks like File.Write(), so the content is not held in memory. If reading r fails,
+// the upload is aborted and the blob is not changed. Unlike WriteFile(), this creates the
+// blob if it does not exist. An existing blob is leased while it is written.
+func (f *FS) WriteFileFrom(name string, r io.Reader, perm fs.FileMode) error {
+	options := []jsfs.OFOption{WithFlags(os.O_WRONLY | os.O_CREATE)}
+	// A lease can only be acquired on a blob that exists.
+	if _, err := f.Stat(name); err == nil {
+		options = append(options, WithLock())
+	}
+
+	fsFile, err := f.OpenFile(name, 0644, options...)
+	if err != nil {
+		return err
+	}
+
+	file := fsFile.(*File)
+	// Write() starts the upload, which io.Copy() never calls for an empty r. Without it,
+	// the blob would not be created or truncated.
+	if _, err := file.Write(nil); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write blob(%s): %w", name, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.abort(err)
+		file.Close()
+		return fmt.Errorf("could not write blob(%s): %w", name, err)
+	}
+	return file.Close()
+}
+
 // Sys is returned on a FileInfo.Sys() call.
 type Sys struct {
-	// Props holds propertis of the blobstore file.
+	// Props holds propertis of the blobstore file. This is nil if the FS was not
+	// created with an Azure blob storage Container.
 	Props *azblob.BlobGetPropertiesResponse
+	// Properties holds the properties of the blob returned by the Container.
+	Properties *BlobProperties
+	// ETag is the ETag of the blob when it was stat'd. Pass it to WithIfMatch() to only
+	// write the blob if it has not changed since.
+	ETag azblob.ETag
 }
 
 type fileInfo struct {
-	name string
-	dir  bool
-	resp *azblob.BlobGetPropertiesResponse
+	name  string
+	dir   bool
+	props *BlobProperties
+
+	// gzipped is set if the blob is decompressed when read, see WithAutoDecompress().
+	// size is then the decompressed size.
+	gzipped bool
+	size    int64
 }
 
-func newFileInfo(name string, resp *azblob.BlobGetPropertiesResponse) fileInfo {
+func newFileInfo(name string, props *BlobProperties) fileInfo {
 	return fileInfo{
-		name: name,
-		resp: resp,
+		name:  name,
+		props: props,
 	}
 }
 
@@ -781,12 +1495,16 @@ func (f fileInfo) Name() string {
 	return f.name
 }
 
-// Size implements fs.FileInfo.Size().
+// Size implements fs.FileInfo.Size(). If the blob is decompressed with WithAutoDecompress(),
+// this is the decompressed size.
 func (f fileInfo) Size() int64 {
-	if f.dir {
+	if f.dir || f.props == nil {
 		return 0
 	}
-	return f.resp.ContentLength()
+	if f.gzipped {
+		return f.size
+	}
+	return f.props.ContentLength
 }
 
 // Mode implements fs.FileInfo.Mode(). This always returns 0660.
@@ -800,10 +1518,10 @@ func (f fileInfo) Mode() fs.FileMode {
 // ModTime implements fs.FileInfo.ModTime(). If the blob is a directory, this
 // is always the zero time.
 func (f fileInfo) ModTime() time.Time {
-	if f.dir {
+	if f.dir || f.props == nil {
 		return time.Time{}
 	}
-	return f.resp.LastModified()
+	return f.props.LastModified
 }
 
 // IsDir implements fs.FileInfo.IsDir().
@@ -813,8 +1531,8 @@ func (f fileInfo) IsDir() bool {
 
 // Sys implements fs.FileInfo.Sys(). If this is a dir, this returns nil.
 func (f fileInfo) Sys() interface{} {
-	if f.dir {
+	if f.dir || f.props == nil {
 		return nil
 	}
-	return Sys{Props: f.resp}
+	return Sys{Props: f.props.Raw, Properties: f.props, ETag: f.props.ETag}
 }
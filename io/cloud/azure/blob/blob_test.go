@@ -0,0 +1,311 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	jsfs "github.com/gopherfs/fs"
+)
+
+func mustTM() azblob.TransferManager {
+	tm, err := azblob.NewSyncPool(1<<20, 1)
+	if err != nil {
+		panic(err)
+	}
+	return tm
+}
+
+func TestFSDefaults(t *testing.T) {
+	defaultTM := mustTM()
+	defer defaultTM.Close()
+	perOpenTM := mustTM()
+	defer perOpenTM.Close()
+
+	tests := []struct {
+		desc            string
+		fsOptions       []Option
+		ofOptions       []jsfs.OFOption
+		wantTM          azblob.TransferManager
+		wantConcurrency int
+	}{
+		{
+			desc:            "no options",
+			wantConcurrency: defaultListConcurrency,
+		},
+		{
+			desc:            "FS default TransferManager with no per-open option",
+			fsOptions:       []Option{WithDefaultTransferManager(defaultTM)},
+			ofOptions:       []jsfs.OFOption{WithFlags(os.O_WRONLY)},
+			wantTM:          defaultTM,
+			wantConcurrency: defaultListConcurrency,
+		},
+		{
+			desc:            "per-open TransferManager overrides FS default",
+			fsOptions:       []Option{WithDefaultTransferManager(defaultTM)},
+			ofOptions:       []jsfs.OFOption{WithFlags(os.O_WRONLY), WithTransferManager(perOpenTM)},
+			wantTM:          perOpenTM,
+			wantConcurrency: defaultListConcurrency,
+		},
+		{
+			desc:            "list concurrency",
+			fsOptions:       []Option{WithListConcurrency(5)},
+			wantConcurrency: 5,
+		},
+	}
+
+	for _, test := range tests {
+		fsys, err := New("account", "container", azblob.NewAnonymousCredential(), test.fsOptions...)
+		if err != nil {
+			t.Errorf("TestFSDefaults(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+
+		opts, err := fsys.rwOptions(test.ofOptions)
+		if err != nil {
+			t.Errorf("TestFSDefaults(%s): rwOptions() got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if opts.tm != test.wantTM {
+			t.Errorf("TestFSDefaults(%s): got TransferManager %v, want %v", test.desc, opts.tm, test.wantTM)
+		}
+
+		dir, err := fsys.dirFile(context.Background(), ".")
+		if err != nil {
+			t.Errorf("TestFSDefaults(%s): dirFile() got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if dir.listConcurrency != test.wantConcurrency {
+			t.Errorf("TestFSDefaults(%s): got list concurrency %d, want %d", test.desc, dir.listConcurrency, test.wantConcurrency)
+		}
+	}
+
+	if _, err := New("account", "container", azblob.NewAnonymousCredential(), WithListConcurrency(0)); err == nil {
+		t.Errorf("TestFSDefaults(WithListConcurrency(0)): got err == nil, want err != nil")
+	}
+}
+
+// leaseContainer is a Container that counts lease renewals. Blobs do not exist until uploaded.
+type leaseContainer struct {
+	Container
+
+	mu       sync.Mutex
+	renewals int
+	released bool
+}
+
+func (c *leaseContainer) GetProperties(ctx context.Context, name string) (*BlobProperties, error) {
+	return nil, fs.ErrNotExist
+}
+
+func (c *leaseContainer) ListBlobsHierarchySegment(ctx context.Context, marker, prefix, delimiter string, maxResults int32) (ListResult, error) {
+	return ListResult{}, nil
+}
+
+func (c *leaseContainer) AcquireLease(ctx context.Context, name string, duration int32) (string, error) {
+	return "leaseID", nil
+}
+
+func (c *leaseContainer) RenewLease(ctx context.Context, name, leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renewals++
+	return nil
+}
+
+func (c *leaseContainer) ReleaseLease(ctx context.Context, name, leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.released = true
+	return nil
+}
+
+func (c *leaseContainer) UploadStream(ctx context.Context, name string, r io.Reader, opts UploadOptions) error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	oldDuration := leaseDuration
+	leaseDuration = 100 * time.Millisecond
+	defer func() { leaseDuration = oldDuration }()
+
+	cont := &leaseContainer{}
+	fsys, err := NewFromContainer(cont)
+	if err != nil {
+		panic(err)
+	}
+
+	file, err := fsys.OpenFile("file", 0644, WithFlags(os.O_WRONLY|os.O_CREATE), WithLock())
+	if err != nil {
+		t.Fatalf("TestLeaseRenewal(OpenFile): got err == %s, want err == nil", err)
+	}
+
+	// Hold the lock for several lease durations, writing as we go.
+	for i := 0; i < 5; i++ {
+		time.Sleep(leaseDuration)
+		if _, err := file.(io.Writer).Write([]byte("content")); err != nil {
+			t.Fatalf("TestLeaseRenewal(Write %d): got err == %s, want err == nil", i, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("TestLeaseRenewal(Close): got err == %s, want err == nil", err)
+	}
+
+	cont.mu.Lock()
+	defer cont.mu.Unlock()
+	if cont.renewals < 5 {
+		t.Errorf("TestLeaseRenewal: got %d renewals, want >= 5", cont.renewals)
+	}
+	if !cont.released {
+		t.Errorf("TestLeaseRenewal: lease was not released on Close()")
+	}
+}
+
+func TestRenewInterval(t *testing.T) {
+	const d = 60 * time.Second
+	for i := 0; i < 100; i++ {
+		got := renewInterval(d)
+		if got > d/2 || got <= d/2-d/10 {
+			t.Fatalf("TestRenewInterval: got %v, want in (%v, %v]", got, d/2-d/10, d/2)
+		}
+	}
+}
+
+func TestPipelineOptions(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	sender := pipeline.FactoryFunc(
+		func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+				mu.Lock()
+				requests = append(requests, request.Method+" "+request.URL.Host+request.URL.Path)
+				mu.Unlock()
+
+				resp := &http.Response{
+					Request:    request.Request,
+					StatusCode: http.StatusNotFound,
+					Header:     http.Header{"X-Ms-Error-Code": []string{string(azblob.ServiceCodeBlobNotFound)}},
+					Body:       io.NopCloser(strings.NewReader("")),
+				}
+				return pipeline.NewHTTPResponse(resp), nil
+			}
+		},
+	)
+
+	fsys, err := New(
+		"account",
+		"container",
+		azblob.NewAnonymousCredential(),
+		WithPipelineOptions(azblob.PipelineOptions{
+			Retry:      azblob.RetryOptions{MaxTries: 1},
+			HTTPSender: sender,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("TestPipelineOptions: got err == %s, want err == nil", err)
+	}
+
+	if _, err := fsys.ReadFile("dir/file"); err == nil {
+		t.Fatalf("TestPipelineOptions: got err == nil, want err != nil")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) == 0 {
+		t.Fatalf("TestPipelineOptions: HTTPSender did not receive any requests")
+	}
+	const want = "account.blob.core.windows.net/container"
+	for _, r := range requests {
+		if !strings.Contains(r, want) {
+			t.Errorf("TestPipelineOptions: got request %q, want request to %q", r, want)
+		}
+	}
+}
+
+func TestUploadConditionNotMet(t *testing.T) {
+	var ifMatch []string
+	sender := pipeline.FactoryFunc(
+		func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+				// Staging blocks succeeds, the condition is checked when the block list is committed.
+				if request.URL.Query().Get("comp") == "block" {
+					resp := &http.Response{
+						Request:    request.Request,
+						StatusCode: http.StatusCreated,
+						Header:     http.Header{},
+						Body:       io.NopCloser(strings.NewReader("")),
+					}
+					return pipeline.NewHTTPResponse(resp), nil
+				}
+
+				ifMatch = append(ifMatch, request.Header.Get("If-Match"))
+				resp := &http.Response{
+					Request:    request.Request,
+					StatusCode: http.StatusPreconditionFailed,
+					Header:     http.Header{"X-Ms-Error-Code": []string{string(azblob.ServiceCodeConditionNotMet)}},
+					Body:       io.NopCloser(strings.NewReader("")),
+				}
+				return pipeline.NewHTTPResponse(resp), nil
+			}
+		},
+	)
+
+	p := azblob.NewPipeline(
+		azblob.NewAnonymousCredential(),
+		azblob.PipelineOptions{
+			Retry:      azblob.RetryOptions{MaxTries: 1},
+			HTTPSender: sender,
+		},
+	)
+	u, err := url.Parse("https://account.blob.core.windows.net/container")
+	if err != nil {
+		panic(err)
+	}
+	cont := FromContainerURL(azblob.NewContainerURL(*u, p))
+
+	err = cont.UploadStream(context.Background(), "file", strings.NewReader("content"), UploadOptions{IfMatch: `"etag"`})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("TestUploadConditionNotMet: got err == %v, want *ConflictError", err)
+	}
+	if len(ifMatch) != 1 || ifMatch[0] != `"etag"` {
+		t.Errorf("TestUploadConditionNotMet: got If-Match headers %q, want [%q]", ifMatch, `"etag"`)
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	// A file whose lease has expired.
+	expired := &File{flags: os.O_WRONLY, path: "file", leaseID: "lease", expires: time.Now().Add(-time.Second)}
+	if _, err := expired.Write([]byte("content")); !errors.Is(err, jsfs.ErrLockLost) {
+		t.Errorf("TestErrorsIs(Write with expired lease): got err == %v, want jsfs.ErrLockLost", err)
+	}
+
+	fsys, err := NewFromContainer(&leaseContainer{})
+	if err != nil {
+		panic(err)
+	}
+	if _, err := fsys.OpenFile("file", 0644, WithLock()); !errors.Is(err, jsfs.ErrUnsupportedFlag) {
+		t.Errorf("TestErrorsIs(WithLock and O_RDONLY): got err == %v, want jsfs.ErrUnsupportedFlag", err)
+	}
+	if _, err := fsys.OpenFile("file", 0644, WithFlags(os.O_WRONLY|os.O_EXCL)); !errors.Is(err, jsfs.ErrUnsupportedFlag) {
+		t.Errorf("TestErrorsIs(O_EXCL without O_CREATE): got err == %v, want jsfs.ErrUnsupportedFlag", err)
+	}
+
+	file := &File{flags: os.O_RDONLY, path: "file", fi: fileInfo{name: "file"}}
+	if _, err := file.ReadDir(-1); !errors.Is(err, jsfs.ErrNotDirectory) {
+		t.Errorf("TestErrorsIs(ReadDir on a file): got err == %v, want jsfs.ErrNotDirectory", err)
+	}
+}
@@ -0,0 +1,363 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Container provides the blob container operations used by FS. FromContainerURL() provides
+// a Container for Azure blob storage. Package blob/fake provides an in-memory Container that
+// can be used to test code that uses FS without a storage account.
+type Container interface {
+	// GetProperties returns the properties of the blob at name.
+	GetProperties(ctx context.Context, name string) (*BlobProperties, error)
+	// Download returns a reader for the content of the blob at name starting at offset
+	// and reading count bytes. A count of 0 reads to the end of the blob.
+	Download(ctx context.Context, name string, offset, count int64) (io.ReadCloser, error)
+	// UploadStream writes the content of r to the block blob at name, replacing any existing content.
+	// If opts.IfMatch is set and the blob's ETag does not match it, the error is a *ConflictError.
+	UploadStream(ctx context.Context, name string, r io.Reader, opts UploadOptions) error
+	// ListBlobsHierarchySegment lists the blobs and virtual directories directly under prefix,
+	// using delimiter to separate directories. marker is "" for the first call and
+	// ListResult.NextMarker for following calls. maxResults is the maximum number of
+	// entries to return for this segment.
+	ListBlobsHierarchySegment(ctx context.Context, marker, prefix, delimiter string, maxResults int32) (ListResult, error)
+	// ListBlobsFlatSegment lists all blobs that start with prefix, including those in virtual
+	// sub-directories, along with their properties. marker is "" for the first call and
+	// FlatListResult.NextMarker for following calls. maxResults is the maximum number of
+	// blobs to return for this segment.
+	ListBlobsFlatSegment(ctx context.Context, marker, prefix string, maxResults int32) (FlatListResult, error)
+	// AcquireLease takes out a lease on the blob at name for duration seconds and returns the lease ID.
+	AcquireLease(ctx context.Context, name string, duration int32) (leaseID string, err error)
+	// RenewLease renews the lease on the blob at name.
+	RenewLease(ctx context.Context, name, leaseID string) error
+	// ReleaseLease releases the lease on the blob at name.
+	ReleaseLease(ctx context.Context, name, leaseID string) error
+	// Delete deletes the blob at name and its snapshots. If the blob does not exist, the error
+	// wraps fs.ErrNotExist.
+	Delete(ctx context.Context, name string) error
+}
+
+// BlockContainer is a Container that can stage and commit the blocks of a block blob
+// separately. It is required to open a file WithFlushable(). The Containers returned by
+// FromContainerURL() and blob/fake implement it.
+type BlockContainer interface {
+	Container
+	// StageBlock uploads content as an uncommitted block of the blob at name. blockID must be
+	// base64 encoded and all the block IDs of a blob must have the same length.
+	StageBlock(ctx context.Context, name, blockID string, content []byte, leaseID string) error
+	// CommitBlockList replaces the content of the blob at name with the staged blocks in blockIDs,
+	// in order, and returns the blob's new ETag. opts.LeaseID and opts.IfMatch are used like
+	// UploadStream(). Other fields of opts are ignored.
+	CommitBlockList(ctx context.Context, name string, blockIDs []string, opts UploadOptions) (azblob.ETag, error)
+}
+
+// BlobProperties are the properties of a blob.
+type BlobProperties struct {
+	BlobType      azblob.BlobType
+	ContentLength int64
+	ContentType   string
+	// ContentEncoding is the Content-Encoding of the blob, such as "gzip".
+	ContentEncoding string
+	LastModified    time.Time
+	ETag            azblob.ETag
+
+	// Raw is the response from Azure. This is nil if the Container is not Azure blob storage.
+	Raw *azblob.BlobGetPropertiesResponse
+}
+
+// UploadOptions are options for Container.UploadStream().
+type UploadOptions struct {
+	// TransferManager controls the buffers and goroutines used in the upload. If nil,
+	// the Container's default is used.
+	TransferManager azblob.TransferManager
+	// BlockSize is the size of each uploaded block. If 0, the Container's default is used.
+	// This is ignored if TransferManager is set.
+	BlockSize int64
+	// LeaseID is the lease held on the blob, if any.
+	LeaseID string
+	// IfMatch, if set, causes the upload to fail unless the blob's current ETag matches it.
+	IfMatch azblob.ETag
+}
+
+// ConflictError is returned when writing a blob with an IfMatch condition, such as from
+// WithIfMatch(), and the blob's ETag no longer matches. This means the blob was changed
+// after the ETag was read.
+type ConflictError struct {
+	// Name is the name of the blob.
+	Name string
+	// IfMatch is the ETag that was expected.
+	IfMatch azblob.ETag
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	s := fmt.Sprintf("blob(%s) did not match ETag %s", e.Name, e.IfMatch)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// ListResult is the result of Container.ListBlobsHierarchySegment().
+type ListResult struct {
+	// Prefixes are the full names of the virtual directories, including the trailing delimiter.
+	Prefixes []string
+	// Blobs are the full names of the blobs.
+	Blobs []string
+	// NextMarker is passed to the next call to retrieve more results. If empty, there are no more results.
+	NextMarker string
+}
+
+// FlatListResult is the result of Container.ListBlobsFlatSegment().
+type FlatListResult struct {
+	// Blobs are the blobs in the listing.
+	Blobs []BlobItem
+	// NextMarker is passed to the next call to retrieve more results. If empty, there are no more results.
+	NextMarker string
+}
+
+// BlobItem is a blob returned in a listing.
+type BlobItem struct {
+	// Name is the full name of the blob.
+	Name string
+	// Properties are the properties of the blob. Raw is always nil.
+	Properties BlobProperties
+}
+
+// FromContainerURL returns a Container for the Azure blob storage container at u.
+func FromContainerURL(u azblob.ContainerURL) Container {
+	return containerURL{u: u}
+}
+
+// containerURL implements Container for azblob.ContainerURL.
+type containerURL struct {
+	u azblob.ContainerURL
+}
+
+func (c containerURL) GetProperties(ctx context.Context, name string) (*BlobProperties, error) {
+	resp, err := c.u.NewBlobURL(name).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &BlobProperties{
+		BlobType:        resp.BlobType(),
+		ContentLength:   resp.ContentLength(),
+		ContentType:     resp.ContentType(),
+		ContentEncoding: resp.ContentEncoding(),
+		LastModified:    resp.LastModified(),
+		ETag:            resp.ETag(),
+		Raw:             resp,
+	}, nil
+}
+
+func (c containerURL) Download(ctx context.Context, name string, offset, count int64) (io.ReadCloser, error) {
+	resp, err := c.u.NewBlockBlobURL(name).Download(ctx, offset, count, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+func (c containerURL) UploadStream(ctx context.Context, name string, r io.Reader, opts UploadOptions) error {
+	_, err := azblob.UploadStreamToBlockBlob(
+		ctx,
+		r,
+		c.u.NewBlockBlobURL(name),
+		azblob.UploadStreamToBlockBlobOptions{
+			TransferManager: opts.TransferManager,
+			BufferSize:      int(opts.BlockSize),
+			AccessConditions: azblob.BlobAccessConditions{
+				ModifiedAccessConditions: azblob.ModifiedAccessConditions{
+					IfMatch: opts.IfMatch,
+				},
+				LeaseAccessConditions: azblob.LeaseAccessConditions{
+					LeaseID: opts.LeaseID,
+				},
+			},
+		},
+	)
+	if opts.IfMatch != azblob.ETagNone && isConditionNotMet(err) {
+		return &ConflictError{Name: name, IfMatch: opts.IfMatch, Err: err}
+	}
+	return err
+}
+
+func (c containerURL) StageBlock(ctx context.Context, name, blockID string, content []byte, leaseID string) error {
+	_, err := c.u.NewBlockBlobURL(name).StageBlock(
+		ctx,
+		blockID,
+		bytes.NewReader(content),
+		azblob.LeaseAccessConditions{LeaseID: leaseID},
+		nil,
+		azblob.ClientProvidedKeyOptions{},
+	)
+	return err
+}
+
+func (c containerURL) CommitBlockList(ctx context.Context, name string, blockIDs []string, opts UploadOptions) (azblob.ETag, error) {
+	resp, err := c.u.NewBlockBlobURL(name).CommitBlockList(
+		ctx,
+		blockIDs,
+		azblob.BlobHTTPHeaders{},
+		azblob.Metadata{},
+		azblob.BlobAccessConditions{
+			ModifiedAccessConditions: azblob.ModifiedAccessConditions{
+				IfMatch: opts.IfMatch,
+			},
+			LeaseAccessConditions: azblob.LeaseAccessConditions{
+				LeaseID: opts.LeaseID,
+			},
+		},
+		azblob.DefaultAccessTier,
+		nil,
+		azblob.ClientProvidedKeyOptions{},
+		azblob.ImmutabilityPolicyOptions{},
+	)
+	if err != nil {
+		if opts.IfMatch != azblob.ETagNone && isConditionNotMet(err) {
+			return azblob.ETagNone, &ConflictError{Name: name, IfMatch: opts.IfMatch, Err: err}
+		}
+		return azblob.ETagNone, err
+	}
+	return resp.ETag(), nil
+}
+
+func (c containerURL) ListBlobsHierarchySegment(ctx context.Context, marker, prefix, delimiter string, maxResults int32) (ListResult, error) {
+	m := azblob.Marker{}
+	if marker != "" {
+		m.Val = &marker
+	}
+
+	resp, err := c.u.ListBlobsHierarchySegment(
+		ctx,
+		m,
+		delimiter,
+		azblob.ListBlobsSegmentOptions{
+			Prefix:     prefix,
+			MaxResults: maxResults,
+		},
+	)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result := ListResult{}
+	for _, p := range resp.Segment.BlobPrefixes {
+		result.Prefixes = append(result.Prefixes, p.Name)
+	}
+	for _, b := range resp.Segment.BlobItems {
+		result.Blobs = append(result.Blobs, b.Name)
+	}
+	if resp.NextMarker.NotDone() {
+		result.NextMarker = *resp.NextMarker.Val
+	}
+	return result, nil
+}
+
+func (c containerURL) ListBlobsFlatSegment(ctx context.Context, marker, prefix string, maxResults int32) (FlatListResult, error) {
+	m := azblob.Marker{}
+	if marker != "" {
+		m.Val = &marker
+	}
+
+	resp, err := c.u.ListBlobsFlatSegment(
+		ctx,
+		m,
+		azblob.ListBlobsSegmentOptions{
+			Prefix:     prefix,
+			MaxResults: maxResults,
+		},
+	)
+	if err != nil {
+		return FlatListResult{}, err
+	}
+
+	result := FlatListResult{}
+	for _, b := range resp.Segment.BlobItems {
+		item := BlobItem{
+			Name: b.Name,
+			Properties: BlobProperties{
+				BlobType:     b.Properties.BlobType,
+				LastModified: b.Properties.LastModified,
+				ETag:         b.Properties.Etag,
+			},
+		}
+		if b.Properties.ContentLength != nil {
+			item.Properties.ContentLength = *b.Properties.ContentLength
+		}
+		if b.Properties.ContentType != nil {
+			item.Properties.ContentType = *b.Properties.ContentType
+		}
+		if b.Properties.ContentEncoding != nil {
+			item.Properties.ContentEncoding = *b.Properties.ContentEncoding
+		}
+		result.Blobs = append(result.Blobs, item)
+	}
+	if resp.NextMarker.NotDone() {
+		result.NextMarker = *resp.NextMarker.Val
+	}
+	return result, nil
+}
+
+func (c containerURL) AcquireLease(ctx context.Context, name string, duration int32) (string, error) {
+	resp, err := c.u.NewBlobURL(name).AcquireLease(ctx, "", duration, azblob.ModifiedAccessConditions{})
+	if err != nil {
+		return "", err
+	}
+	return resp.LeaseID(), nil
+}
+
+func (c containerURL) RenewLease(ctx context.Context, name, leaseID string) error {
+	_, err := c.u.NewBlobURL(name).RenewLease(ctx, leaseID, azblob.ModifiedAccessConditions{})
+	return err
+}
+
+func (c containerURL) ReleaseLease(ctx context.Context, name, leaseID string) error {
+	_, err := c.u.NewBlobURL(name).ReleaseLease(ctx, leaseID, azblob.ModifiedAccessConditions{})
+	return err
+}
+
+func (c containerURL) Delete(ctx context.Context, name string) error {
+	_, err := c.u.NewBlobURL(name).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	if isNotFound(err) {
+		return fmt.Errorf("blob(%s): %w", name, fs.ErrNotExist)
+	}
+	return err
+}
+
+// isConditionNotMet returns true if err indicates that an access condition, such as If-Match, failed.
+func isConditionNotMet(err error) bool {
+	var serr azblob.StorageError
+	if errors.As(err, &serr) {
+		return serr.ServiceCode() == azblob.ServiceCodeConditionNotMet
+	}
+	return false
+}
+
+// isNotFound returns true if err indicates that a blob does not exist.
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	var serr azblob.StorageError
+	if errors.As(err, &serr) {
+		return serr.ServiceCode() == azblob.ServiceCodeBlobNotFound
+	}
+	return false
+}
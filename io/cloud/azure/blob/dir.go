@@ -0,0 +1,125 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+)
+
+// WithDirectoryPlaceholders allows Mkdir() and MkdirAll() to create empty directories. Blob
+// storage has no directories, a directory only exists while there are blobs in it. With this
+// option, a directory is created by writing a zero-byte placeholder blob named after the
+// directory with a trailing "/", such as "dir/", which is the convention used by other blob tools.
+//
+// Placeholder blobs are always hidden from ReadDir() and WalkFiles() and their directory is
+// reported instead, so an FS without this option can read directories made by one with it.
+// With this option, Remove() of a directory that only holds its placeholder removes it.
+func WithDirectoryPlaceholders() Option {
+	return func(f *FS) error {
+		f.dirPlaceholders = true
+		return nil
+	}
+}
+
+// isPlaceholder returns true if the blob name is a directory placeholder. In an FS from Sub(),
+// the placeholder of the directory it is rooted at has an empty name.
+func isPlaceholder(name string) bool {
+	return name == "" || strings.HasSuffix(name, "/")
+}
+
+// Mkdir creates an empty directory at name by writing a placeholder blob. The parent directory
+// must exist. perm is ignored. The FS must use WithDirectoryPlaceholders().
+func (f *FS) Mkdir(name string, perm fs.FileMode) error {
+	if err := f.checkMkdir("mkdir", name); err != nil {
+		return err
+	}
+	if name == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := f.dirFile(ctx, name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if _, err := f.cont.GetProperties(ctx, name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if parent := path.Dir(name); parent != "." {
+		if _, err := f.dirFile(ctx, parent); err != nil {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("parent directory(%s): %w", parent, fs.ErrNotExist)}
+		}
+	}
+	return f.putPlaceholder(ctx, "mkdir", name)
+}
+
+// MkdirAll implements jsfs.MkdirAllFS.MkdirAll(). A single placeholder blob is written for
+// name, which also makes any missing parent directories exist. If name is already a directory,
+// this does nothing. perm is ignored. The FS must use WithDirectoryPlaceholders().
+func (f *FS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := f.checkMkdir("mkdir", name); err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := f.dirFile(ctx, name); err == nil {
+		return nil
+	}
+	for p := name; p != "."; p = path.Dir(p) {
+		_, err := f.cont.GetProperties(ctx, p)
+		switch {
+		case err == nil:
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("%s is %w", p, jsfs.ErrNotDirectory)}
+		case !isNotFound(err):
+			return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+		}
+	}
+	return f.putPlaceholder(ctx, "mkdir", name)
+}
+
+func (f *FS) checkMkdir(op, name string) error {
+	if !f.dirPlaceholders {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("creating directories requires WithDirectoryPlaceholders()")}
+	}
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// putPlaceholder writes the placeholder blob for the directory name.
+func (f *FS) putPlaceholder(ctx context.Context, op, name string) error {
+	if err := f.cont.UploadStream(ctx, name+"/", bytes.NewReader(nil), UploadOptions{}); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+// removePlaceholder removes the placeholder blob of the directory name if it is the only blob
+// in the directory.
+func (f *FS) removePlaceholder(ctx context.Context, name string) error {
+	resp, err := f.cont.ListBlobsHierarchySegment(ctx, "", name+"/", "/", 2)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if len(resp.Prefixes) > 0 || len(resp.Blobs) != 1 || resp.Blobs[0] != name+"/" {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	if err := f.cont.Delete(ctx, name+"/"); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
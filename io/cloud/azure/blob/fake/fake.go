@@ -0,0 +1,399 @@
+/*
+Package fake provides an in-memory blob.Container that can be used to test code using
+blob.FS without an Azure storage account.
+
+Example:
+
+	cont := fake.New()
+
+	fsys, err := blob.NewFromContainer(cont)
+	if err != nil {
+		// Do something
+	}
+*/
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/google/uuid"
+	"github.com/gopherfs/fs/io/cloud/azure/blob"
+)
+
+var _ blob.BlockContainer = &Container{}
+
+type item struct {
+	content     []byte
+	contentType string
+	encoding    string
+	modTime     time.Time
+	etag        azblob.ETag
+	// blocks are the committed blocks of the blob by block ID, if it was written with CommitBlockList().
+	blocks map[string][]byte
+
+	leaseID      string
+	leaseExpires time.Time
+}
+
+func (i *item) leased() bool {
+	return i.leaseID != "" && time.Now().Before(i.leaseExpires)
+}
+
+// Container is an in-memory implementation of blob.Container. It is safe for concurrent use.
+type Container struct {
+	mu    sync.Mutex
+	blobs map[string]*item
+	// staged are the uncommitted blocks of a blob by block ID, by blob name.
+	staged map[string]map[string][]byte
+	count  int
+}
+
+// New is the constructor for Container.
+func New() *Container {
+	return &Container{blobs: map[string]*item{}, staged: map[string]map[string][]byte{}}
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("blob(%s): %w", name, fs.ErrNotExist)
+}
+
+// GetProperties implements blob.Container.GetProperties().
+func (c *Container) GetProperties(ctx context.Context, name string) (*blob.BlobProperties, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	return &blob.BlobProperties{
+		BlobType:        azblob.BlobBlockBlob,
+		ContentLength:   int64(len(i.content)),
+		ContentType:     i.contentType,
+		ContentEncoding: i.encoding,
+		LastModified:    i.modTime,
+		ETag:            i.etag,
+	}, nil
+}
+
+// Download implements blob.Container.Download().
+func (c *Container) Download(ctx context.Context, name string, offset, count int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	if offset < 0 || offset > int64(len(i.content)) {
+		return nil, fmt.Errorf("blob(%s): offset(%d) is out of range", name, offset)
+	}
+
+	end := int64(len(i.content))
+	if count > 0 && offset+count < end {
+		end = offset + count
+	}
+	// Content is replaced and not modified on upload, so this slice will not change under the reader.
+	return io.NopCloser(bytes.NewReader(i.content[offset:end])), nil
+}
+
+// UploadStream implements blob.Container.UploadStream(). If the blob has an active lease,
+// opts.LeaseID must match it. If opts.IfMatch is set, the blob must exist and have that ETag.
+func (c *Container) UploadStream(ctx context.Context, name string, r io.Reader, opts blob.UploadOptions) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if opts.IfMatch != azblob.ETagNone && (!ok || i.etag != opts.IfMatch) {
+		return &blob.ConflictError{Name: name, IfMatch: opts.IfMatch}
+	}
+	if !ok {
+		i = &item{}
+		c.blobs[name] = i
+	}
+	if i.leased() && i.leaseID != opts.LeaseID {
+		return fmt.Errorf("blob(%s): there is a lease on the blob and no matching lease ID was specified", name)
+	}
+
+	c.count++
+	i.content = b
+	i.blocks = nil
+	i.encoding = ""
+	i.contentType = ""
+	i.modTime = time.Now()
+	i.etag = azblob.ETag(fmt.Sprintf(`"%d"`, c.count))
+	return nil
+}
+
+// StageBlock implements blob.BlockContainer.StageBlock(). If the blob has an active lease,
+// leaseID must match it.
+func (c *Container) StageBlock(ctx context.Context, name, blockID string, content []byte, leaseID string) error {
+	if _, err := base64.StdEncoding.DecodeString(blockID); err != nil {
+		return fmt.Errorf("blob(%s): block ID(%s) is not base64 encoded", name, blockID)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if i, ok := c.blobs[name]; ok && i.leased() && i.leaseID != leaseID {
+		return fmt.Errorf("blob(%s): there is a lease on the blob and no matching lease ID was specified", name)
+	}
+
+	staged := c.staged[name]
+	if staged == nil {
+		staged = map[string][]byte{}
+		c.staged[name] = staged
+	}
+	staged[blockID] = append([]byte(nil), content...)
+	return nil
+}
+
+// CommitBlockList implements blob.BlockContainer.CommitBlockList(). Each block ID must be a
+// staged block or a block committed by an earlier CommitBlockList(). Uncommitted blocks are
+// discarded. Leases and opts.IfMatch are checked like UploadStream().
+func (c *Container) CommitBlockList(ctx context.Context, name string, blockIDs []string, opts blob.UploadOptions) (azblob.ETag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if opts.IfMatch != azblob.ETagNone && (!ok || i.etag != opts.IfMatch) {
+		return azblob.ETagNone, &blob.ConflictError{Name: name, IfMatch: opts.IfMatch}
+	}
+	if ok && i.leased() && i.leaseID != opts.LeaseID {
+		return azblob.ETagNone, fmt.Errorf("blob(%s): there is a lease on the blob and no matching lease ID was specified", name)
+	}
+
+	var committed map[string][]byte
+	if ok {
+		committed = i.blocks
+	}
+	blocks := map[string][]byte{}
+	content := []byte{}
+	for _, id := range blockIDs {
+		b, found := c.staged[name][id]
+		if !found {
+			b, found = committed[id]
+		}
+		if !found {
+			return azblob.ETagNone, fmt.Errorf("blob(%s): block ID(%s) is not staged or committed", name, id)
+		}
+		blocks[id] = b
+		content = append(content, b...)
+	}
+
+	if !ok {
+		i = &item{}
+		c.blobs[name] = i
+	}
+	delete(c.staged, name)
+
+	c.count++
+	i.content = content
+	i.blocks = blocks
+	i.encoding = ""
+	i.contentType = ""
+	i.modTime = time.Now()
+	i.etag = azblob.ETag(fmt.Sprintf(`"%d"`, c.count))
+	return i.etag, nil
+}
+
+// SetContentEncoding sets the Content-Encoding of the blob at name, such as "gzip". This is
+// like setting the blob's HTTP headers in Azure. Uploading the blob again clears it.
+func (c *Container) SetContentEncoding(name, encoding string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return notFound(name)
+	}
+	i.encoding = encoding
+	return nil
+}
+
+// SetContentType sets the Content-Type of the blob at name, such as "application/json". This is
+// like setting the blob's HTTP headers in Azure. Uploading the blob again clears it.
+func (c *Container) SetContentType(name, contentType string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return notFound(name)
+	}
+	i.contentType = contentType
+	return nil
+}
+
+// ListBlobsHierarchySegment implements blob.Container.ListBlobsHierarchySegment().
+func (c *Container) ListBlobsHierarchySegment(ctx context.Context, marker, prefix, delimiter string, maxResults int32) (blob.ListResult, error) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.blobs))
+	for name := range c.blobs {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	// entries are the blob names or prefixes, in sorted order, that are in this listing.
+	type entry struct {
+		name   string
+		prefix bool
+	}
+	var entries []entry
+
+	seen := map[string]bool{}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		if delimiter != "" {
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				p := prefix + rest[:i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					entries = append(entries, entry{name: p, prefix: true})
+				}
+				continue
+			}
+		}
+		entries = append(entries, entry{name: name})
+	}
+
+	result := blob.ListResult{}
+	for _, e := range entries {
+		if e.name < marker {
+			continue
+		}
+		if maxResults > 0 && int32(len(result.Prefixes)+len(result.Blobs)) == maxResults {
+			result.NextMarker = e.name
+			break
+		}
+		if e.prefix {
+			result.Prefixes = append(result.Prefixes, e.name)
+		} else {
+			result.Blobs = append(result.Blobs, e.name)
+		}
+	}
+	return result, nil
+}
+
+// ListBlobsFlatSegment implements blob.Container.ListBlobsFlatSegment().
+func (c *Container) ListBlobsFlatSegment(ctx context.Context, marker, prefix string, maxResults int32) (blob.FlatListResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.blobs))
+	for name := range c.blobs {
+		if strings.HasPrefix(name, prefix) && name >= marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := blob.FlatListResult{}
+	for _, name := range names {
+		if maxResults > 0 && int32(len(result.Blobs)) == maxResults {
+			result.NextMarker = name
+			break
+		}
+		i := c.blobs[name]
+		result.Blobs = append(
+			result.Blobs,
+			blob.BlobItem{
+				Name: name,
+				Properties: blob.BlobProperties{
+					BlobType:        azblob.BlobBlockBlob,
+					ContentLength:   int64(len(i.content)),
+					ContentType:     i.contentType,
+					ContentEncoding: i.encoding,
+					LastModified:    i.modTime,
+					ETag:            i.etag,
+				},
+			},
+		)
+	}
+	return result, nil
+}
+
+// AcquireLease implements blob.Container.AcquireLease().
+func (c *Container) AcquireLease(ctx context.Context, name string, duration int32) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return "", notFound(name)
+	}
+	if i.leased() {
+		return "", fmt.Errorf("blob(%s): there is already a lease present", name)
+	}
+	i.leaseID = uuid.New().String()
+	i.leaseExpires = time.Now().Add(time.Duration(duration) * time.Second)
+	return i.leaseID, nil
+}
+
+// RenewLease implements blob.Container.RenewLease(). The lease is renewed for 60 seconds.
+func (c *Container) RenewLease(ctx context.Context, name, leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return notFound(name)
+	}
+	if i.leaseID != leaseID {
+		return fmt.Errorf("blob(%s): lease ID does not match", name)
+	}
+	i.leaseExpires = time.Now().Add(60 * time.Second)
+	return nil
+}
+
+// ReleaseLease implements blob.Container.ReleaseLease().
+func (c *Container) ReleaseLease(ctx context.Context, name, leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return notFound(name)
+	}
+	if i.leaseID != leaseID {
+		return fmt.Errorf("blob(%s): lease ID does not match", name)
+	}
+	i.leaseID = ""
+	i.leaseExpires = time.Time{}
+	return nil
+}
+
+// Delete implements blob.Container.Delete(). A blob with an active lease cannot be deleted.
+func (c *Container) Delete(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.blobs[name]
+	if !ok {
+		return notFound(name)
+	}
+	if i.leased() {
+		return fmt.Errorf("blob(%s): there is currently a lease on the blob", name)
+	}
+	delete(c.blobs, name)
+	return nil
+}
@@ -0,0 +1,1271 @@
+package fake
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopherfs/fs/fstesting"
+	"github.com/gopherfs/fs/io/cloud/azure/blob"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func writeFile(fsys *blob.FS, name string, content string) error {
+	file, err := fsys.OpenFile(name, 0644, blob.WithFlags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file.(io.Writer), content); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func TestFS(t *testing.T) {
+	files := map[string]string{
+		"users/jdoak.json":        `{"Name":"John Doak"}`,
+		"users/admins/root.json":  `{"Name":"root"}`,
+		"readme.txt":              "hello world",
+		"users/admins/other.json": `{"Name":"other"}`,
+	}
+
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+
+	for name, content := range files {
+		if err := writeFile(fsys, name, content); err != nil {
+			t.Fatalf("TestFS(write %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	for name, content := range files {
+		b, err := fsys.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestFS(ReadFile %s): got err == %s, want err == nil", name, err)
+		}
+		if string(b) != content {
+			t.Errorf("TestFS(ReadFile %s): got %q, want %q", name, string(b), content)
+		}
+
+		fi, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatalf("TestFS(Stat %s): got err == %s, want err == nil", name, err)
+		}
+		if fi.Size() != int64(len(content)) {
+			t.Errorf("TestFS(Stat %s): got size %d, want %d", name, fi.Size(), len(content))
+		}
+	}
+
+	if _, err := fsys.ReadFile("users/missing.json"); err == nil {
+		t.Errorf("TestFS(ReadFile missing file): got err == nil, want err != nil")
+	}
+
+	// WriteFile() takes a lease on the file, so this tests overwriting with a lease.
+	if err := fsys.WriteFile("readme.txt", []byte("goodbye"), 0644); err != nil {
+		t.Fatalf("TestFS(WriteFile on existing file): got err == %s, want err == nil", err)
+	}
+	b, err := fsys.ReadFile("readme.txt")
+	if err != nil {
+		t.Fatalf("TestFS(ReadFile after WriteFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "goodbye" {
+		t.Errorf("TestFS(ReadFile after WriteFile): got %q, want %q", string(b), "goodbye")
+	}
+
+	entries, err := fsys.ReadDir("users")
+	if err != nil {
+		t.Fatalf("TestFS(ReadDir): got err == %s, want err == nil", err)
+	}
+	got := map[string]bool{}
+	for _, e := range entries {
+		got[e.Name()] = e.IsDir()
+	}
+	want := map[string]bool{"admins": true, "jdoak.json": false}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestFS(ReadDir): -want/+got:\n%s", diff)
+	}
+
+	var walked []string
+	err = fs.WalkDir(
+		fsys,
+		".",
+		func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				walked = append(walked, p)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("TestFS(WalkDir): got err == %s, want err == nil", err)
+	}
+	wantWalked := []string{
+		"readme.txt",
+		"users/admins/other.json",
+		"users/admins/root.json",
+		"users/jdoak.json",
+	}
+	if diff := pretty.Compare(wantWalked, walked); diff != "" {
+		t.Errorf("TestFS(WalkDir): -want/+got:\n%s", diff)
+	}
+}
+
+func TestListBlobsHierarchySegment(t *testing.T) {
+	c := New()
+	fsys, err := blob.NewFromContainer(c)
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"a/1", "a/2", "b", "c/d/e", "d"} {
+		if err := writeFile(fsys, name, "content"); err != nil {
+			panic(err)
+		}
+	}
+
+	var got blob.ListResult
+	for marker := ""; ; {
+		resp, err := c.ListBlobsHierarchySegment(context.Background(), marker, "", "/", 2)
+		if err != nil {
+			t.Fatalf("TestListBlobsHierarchySegment: got err == %s, want err == nil", err)
+		}
+		got.Prefixes = append(got.Prefixes, resp.Prefixes...)
+		got.Blobs = append(got.Blobs, resp.Blobs...)
+		if resp.NextMarker == "" {
+			break
+		}
+		marker = resp.NextMarker
+	}
+
+	want := blob.ListResult{
+		Prefixes: []string{"a/", "c/"},
+		Blobs:    []string{"b", "d"},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestListBlobsHierarchySegment: -want/+got:\n%s", diff)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"root.txt":                []byte("root"),
+		"dir/file.txt":            []byte("file"),
+		"dir/sub/other.txt":       []byte("other"),
+		"dir/sub/deeper/last.txt": []byte("last"),
+	}
+
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	for name, content := range files {
+		if err := writeFile(fsys, name, string(content)); err != nil {
+			t.Fatalf("TestConformance(write %s): got err == %s, want err == nil", name, err)
+		}
+	}
+
+	fstesting.Run(
+		t,
+		fsys,
+		files,
+		fstesting.Skip("missing files do not return fs.ErrNotExist", fstesting.CheckOpen),
+		fstesting.Skip("FileInfo.Name() from Stat() is the full path", fstesting.CheckStat),
+		fstesting.Skip("entry modes do not match file modes and ReadDir(-1) does not report EOF", fstesting.CheckTestFS),
+	)
+}
+
+func TestProgress(t *testing.T) {
+	const size = 8 << 20
+
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		calls int
+		last  int64
+	)
+	file, err := fsys.OpenFile(
+		"large.bin",
+		0644,
+		blob.WithFlags(os.O_WRONLY|os.O_CREATE),
+		blob.WithBlockSize(4<<20),
+		blob.WithProgress(
+			func(n int64) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				last = n
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("TestProgress(OpenFile): got err == %s, want err == nil", err)
+	}
+
+	chunk := bytes.Repeat([]byte("a"), 64*1024)
+	for written := 0; written < size; written += len(chunk) {
+		if _, err := file.(io.Writer).Write(chunk); err != nil {
+			t.Fatalf("TestProgress(Write): got err == %s, want err == nil", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("TestProgress(Close): got err == %s, want err == nil", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls < 2 {
+		t.Errorf("TestProgress: got %d progress calls, want > 1", calls)
+	}
+	if last != size {
+		t.Errorf("TestProgress: got final progress %d, want %d", last, size)
+	}
+
+	fi, err := fsys.Stat("large.bin")
+	if err != nil {
+		t.Fatalf("TestProgress(Stat): got err == %s, want err == nil", err)
+	}
+	if fi.Size() != size {
+		t.Errorf("TestProgress(Stat): got Size() %d, want %d", fi.Size(), size)
+	}
+
+	if _, err := fsys.OpenFile("large.bin", 0644, blob.WithFlags(os.O_WRONLY), blob.WithBlockSize(0)); err == nil {
+		t.Errorf("TestProgress(WithBlockSize(0)): got err == nil, want err != nil")
+	}
+}
+
+var errUpload = errors.New("upload failed")
+
+// failingContainer is a Container whose uploads fail after reading the first write.
+type failingContainer struct {
+	*Container
+}
+
+func (c failingContainer) UploadStream(ctx context.Context, name string, r io.Reader, opts blob.UploadOptions) error {
+	b := make([]byte, 1)
+	r.Read(b)
+	return errUpload
+}
+
+func TestWriteError(t *testing.T) {
+	fsys, err := blob.NewFromContainer(failingContainer{New()})
+	if err != nil {
+		panic(err)
+	}
+
+	file, err := fsys.OpenFile("file", 0644, blob.WithFlags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestWriteError(OpenFile): got err == %s, want err == nil", err)
+	}
+	w := file.(io.Writer)
+
+	// The first Write is handed to the upload before it fails.
+	w.Write([]byte("a"))
+
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write([]byte("content")); !errors.Is(err, errUpload) {
+			t.Errorf("TestWriteError(Write %d after failure): got err == %v, want %v", i, err, errUpload)
+		}
+	}
+	if err := file.Close(); !errors.Is(err, errUpload) {
+		t.Errorf("TestWriteError(Close): got err == %v, want %v", err, errUpload)
+	}
+}
+
+// patternReader returns size bytes of a repeating pattern. If err is set, it is returned
+// instead of io.EOF after size bytes.
+type patternReader struct {
+	size, read int64
+	maxRead    int
+	err        error
+}
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	if p.read >= p.size {
+		if p.err != nil {
+			return 0, p.err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(b)) > p.size-p.read {
+		b = b[:p.size-p.read]
+	}
+	for i := range b {
+		b[i] = byte((p.read + int64(i)) % 251)
+	}
+	p.read += int64(len(b))
+	if len(b) > p.maxRead {
+		p.maxRead = len(b)
+	}
+	return len(b), nil
+}
+
+// streamingContainer is a Container that only counts and hashes what is uploaded,
+// so that the upload is never held in memory.
+type streamingContainer struct {
+	*Container
+
+	size int64
+	hash []byte
+}
+
+func (c *streamingContainer) UploadStream(ctx context.Context, name string, r io.Reader, opts blob.UploadOptions) error {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	c.size = n
+	c.hash = h.Sum(nil)
+	return nil
+}
+
+func TestWriteFileFrom(t *testing.T) {
+	const size = 64 << 20
+
+	cont := &streamingContainer{Container: New()}
+	fsys, err := blob.NewFromContainer(cont)
+	if err != nil {
+		panic(err)
+	}
+
+	src := &patternReader{size: size}
+	if err := fsys.WriteFileFrom("large.bin", src, 0644); err != nil {
+		t.Fatalf("TestWriteFileFrom: got err == %s, want err == nil", err)
+	}
+	if src.maxRead >= size {
+		t.Errorf("TestWriteFileFrom: source was read in a single %d byte read, want streaming", src.maxRead)
+	}
+
+	h := sha256.New()
+	io.Copy(h, &patternReader{size: size})
+	if cont.size != size {
+		t.Errorf("TestWriteFileFrom: uploaded %d bytes, want %d", cont.size, size)
+	}
+	if !bytes.Equal(cont.hash, h.Sum(nil)) {
+		t.Errorf("TestWriteFileFrom: uploaded content did not match the source")
+	}
+
+	// A failed read must not create the blob.
+	fsys, err = blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	readErr := errors.New("read failed")
+	err = fsys.WriteFileFrom("failed.bin", &patternReader{size: 1 << 20, err: readErr}, 0644)
+	if !errors.Is(err, readErr) {
+		t.Errorf("TestWriteFileFrom(read error): got err == %v, want %v", err, readErr)
+	}
+	if _, err := fsys.Stat("failed.bin"); err == nil {
+		t.Errorf("TestWriteFileFrom(read error): blob was created")
+	}
+
+	// An empty reader must truncate an existing blob and release the lease taken on it.
+	cont2 := New()
+	fsys, err = blob.NewFromContainer(cont2)
+	if err != nil {
+		panic(err)
+	}
+	if err := writeFile(fsys, "existing.txt", "old content"); err != nil {
+		panic(err)
+	}
+	if err := fsys.WriteFileFrom("existing.txt", strings.NewReader(""), 0644); err != nil {
+		t.Fatalf("TestWriteFileFrom(empty reader): got err == %s, want err == nil", err)
+	}
+	b, err := fsys.ReadFile("existing.txt")
+	if err != nil {
+		t.Fatalf("TestWriteFileFrom(empty reader): ReadFile got err == %s, want err == nil", err)
+	}
+	if len(b) != 0 {
+		t.Errorf("TestWriteFileFrom(empty reader): got content %q, want it truncated", b)
+	}
+	if _, err := cont2.AcquireLease(context.Background(), "existing.txt", 15); err != nil {
+		t.Errorf("TestWriteFileFrom(empty reader): lease was not released: %s", err)
+	}
+
+	// An empty reader creates a blob that does not exist.
+	if err := fsys.WriteFileFrom("empty.txt", strings.NewReader(""), 0644); err != nil {
+		t.Fatalf("TestWriteFileFrom(empty reader, new blob): got err == %s, want err == nil", err)
+	}
+	if _, err := fsys.Stat("empty.txt"); err != nil {
+		t.Errorf("TestWriteFileFrom(empty reader, new blob): blob was not created: %s", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"file.txt", "dir/file.txt"} {
+		if err := writeFile(fsys, name, "content"); err != nil {
+			panic(err)
+		}
+	}
+
+	ok, err := fsys.Exists("file.txt")
+	if err != nil || !ok {
+		t.Fatalf("TestRemove(Exists before Remove): got %v, %v, want true, nil", ok, err)
+	}
+
+	if err := fsys.Remove("file.txt"); err != nil {
+		t.Fatalf("TestRemove(existing blob): got err == %s, want err == nil", err)
+	}
+	ok, err = fsys.Exists("file.txt")
+	if err != nil || ok {
+		t.Errorf("TestRemove(Exists after Remove): got %v, %v, want false, nil", ok, err)
+	}
+	if _, err := fsys.ReadFile("file.txt"); err == nil {
+		t.Errorf("TestRemove(ReadFile after Remove): got err == nil, want err != nil")
+	}
+
+	if err := fsys.Remove("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestRemove(missing blob): got err == %v, want fs.ErrNotExist", err)
+	}
+
+	err = fsys.Remove("dir")
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestRemove(directory): got err == %v, want directory error", err)
+	}
+	if ok, _ := fsys.Exists("dir/file.txt"); !ok {
+		t.Errorf("TestRemove(directory): blob in directory was removed")
+	}
+	if ok, _ := fsys.Exists("dir"); ok {
+		t.Errorf("TestRemove(Exists on directory): got true, want false")
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	c := New()
+	fsys, err := blob.NewFromContainer(c)
+	if err != nil {
+		panic(err)
+	}
+	files := map[string]string{
+		"a/1":       "1",
+		"a/2":       "22",
+		"a-b":       "333",
+		"b":         "4444",
+		"c/d/e":     "55555",
+		"c/d/f/g":   "666666",
+		"c/readme":  "7777777",
+		"cd/ignore": "88888888",
+	}
+	for name, content := range files {
+		if err := writeFile(fsys, name, content); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, prefix := range []string{".", "c", "c/d/"} {
+		walkRoot := strings.TrimSuffix(prefix, "/")
+
+		want := map[string]int64{}
+		err := fs.WalkDir(fsys, walkRoot, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			want[p] = fi.Size()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("TestWalkFiles(%s): fs.WalkDir got err == %s, want err == nil", prefix, err)
+		}
+
+		got := map[string]int64{}
+		var order []string
+		err = fsys.WalkFiles(prefix, func(p string, fi fs.FileInfo) error {
+			if fi.Name() != path.Base(p) {
+				t.Errorf("TestWalkFiles(%s): got fi.Name() == %q for %q, want %q", prefix, fi.Name(), p, path.Base(p))
+			}
+			got[p] = fi.Size()
+			order = append(order, p)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("TestWalkFiles(%s): got err == %s, want err == nil", prefix, err)
+		}
+
+		if diff := pretty.Compare(want, got); diff != "" {
+			t.Errorf("TestWalkFiles(%s): fs.WalkDir -want/WalkFiles +got:\n%s", prefix, diff)
+		}
+		if !sort.StringsAreSorted(order) {
+			t.Errorf("TestWalkFiles(%s): got paths in order %v, want sorted", prefix, order)
+		}
+	}
+
+	calls := 0
+	err = fsys.WalkFiles(".", func(p string, fi fs.FileInfo) error {
+		calls++
+		return fs.SkipAll
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("TestWalkFiles(SkipAll): got %d calls, err == %v, want 1 call, err == nil", calls, err)
+	}
+
+	var names []string
+	for marker := ""; ; {
+		resp, err := c.ListBlobsFlatSegment(context.Background(), marker, "c/", 2)
+		if err != nil {
+			t.Fatalf("TestWalkFiles(ListBlobsFlatSegment): got err == %s, want err == nil", err)
+		}
+		for _, b := range resp.Blobs {
+			names = append(names, b.Name)
+		}
+		if resp.NextMarker == "" {
+			break
+		}
+		marker = resp.NextMarker
+	}
+	if diff := pretty.Compare([]string{"c/d/e", "c/d/f/g", "c/readme"}, names); diff != "" {
+		t.Errorf("TestWalkFiles(ListBlobsFlatSegment pages): -want/+got:\n%s", diff)
+	}
+}
+
+func TestSub(t *testing.T) {
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"app1/config.json", "app1/data/1", "app2/config.json", "app10/config.json"} {
+		if err := writeFile(fsys, name, name); err != nil {
+			panic(err)
+		}
+	}
+
+	sub, err := fsys.Sub("app1")
+	if err != nil {
+		t.Fatalf("TestSub: got err == %s, want err == nil", err)
+	}
+	app1 := sub.(*blob.FS)
+
+	b, err := app1.ReadFile("config.json")
+	if err != nil {
+		t.Fatalf("TestSub(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "app1/config.json" {
+		t.Errorf("TestSub(ReadFile): got %q, want %q", b, "app1/config.json")
+	}
+	if _, err := app1.ReadFile("app2/config.json"); err == nil {
+		t.Errorf("TestSub(ReadFile sibling): got err == nil, want err != nil")
+	}
+
+	if err := writeFile(app1, "data/2", "new"); err != nil {
+		t.Fatalf("TestSub(write): got err == %s, want err == nil", err)
+	}
+	b, err = fsys.ReadFile("app1/data/2")
+	if err != nil || string(b) != "new" {
+		t.Errorf("TestSub(write): got %q, err == %v from parent, want %q", b, err, "new")
+	}
+
+	entries, err := app1.ReadDir(".")
+	if err != nil {
+		t.Fatalf("TestSub(ReadDir): got err == %s, want err == nil", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	if diff := pretty.Compare([]string{"config.json", "data"}, names); diff != "" {
+		t.Errorf("TestSub(ReadDir): -want/+got:\n%s", diff)
+	}
+
+	var walked []string
+	err = fs.WalkDir(app1, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			walked = append(walked, p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestSub(WalkDir): got err == %s, want err == nil", err)
+	}
+	if diff := pretty.Compare([]string{"config.json", "data/1", "data/2"}, walked); diff != "" {
+		t.Errorf("TestSub(WalkDir): -want/+got:\n%s", diff)
+	}
+
+	nested, err := app1.Sub("data")
+	if err != nil {
+		t.Fatalf("TestSub(nested): got err == %s, want err == nil", err)
+	}
+	b, err = fs.ReadFile(nested, "1")
+	if err != nil || string(b) != "app1/data/1" {
+		t.Errorf("TestSub(nested): got %q, err == %v, want %q", b, err, "app1/data/1")
+	}
+
+	if _, err := fsys.Sub("/app1"); err == nil {
+		t.Errorf("TestSub(invalid dir): got err == nil, want err != nil")
+	}
+}
+
+// slowContainer is a Container whose GetProperties() for blobs in dir/ takes delay unless
+// ctx is canceled.
+type slowContainer struct {
+	*Container
+	delay time.Duration
+}
+
+func (c slowContainer) GetProperties(ctx context.Context, name string) (*blob.BlobProperties, error) {
+	if strings.HasPrefix(name, "dir/") {
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c.Container.GetProperties(ctx, name)
+}
+
+func TestReadDirCtx(t *testing.T) {
+	const blobs = 200
+
+	c := New()
+	fsys, err := blob.NewFromContainer(slowContainer{Container: c, delay: 50 * time.Millisecond})
+	if err != nil {
+		panic(err)
+	}
+	setup, err := blob.NewFromContainer(c)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < blobs; i++ {
+		if err := writeFile(setup, fmt.Sprintf("dir/%03d", i), "content"); err != nil {
+			panic(err)
+		}
+	}
+
+	entries, err := fsys.ReadDirCtx(context.Background(), "dir")
+	if err != nil {
+		t.Fatalf("TestReadDirCtx(not canceled): got err == %s, want err == nil", err)
+	}
+	if len(entries) != blobs {
+		t.Fatalf("TestReadDirCtx(not canceled): got %d entries, want %d", len(entries), blobs)
+	}
+
+	// With 20 concurrent property fetches, the listing takes about 500ms.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(75*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = fsys.ReadDirCtx(ctx, "dir")
+	elapsed := time.Since(start)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("TestReadDirCtx(canceled): got err == %v, want context.Canceled", err)
+	}
+	if elapsed > 250*time.Millisecond {
+		t.Errorf("TestReadDirCtx(canceled): returned after %v, want it to return promptly after cancel", elapsed)
+	}
+}
+
+// rangeContainer is a Container that records the offset and count of each Download().
+type rangeContainer struct {
+	*Container
+
+	mu     sync.Mutex
+	ranges [][2]int64
+}
+
+func (c *rangeContainer) Download(ctx context.Context, name string, offset, count int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	c.ranges = append(c.ranges, [2]int64{offset, count})
+	c.mu.Unlock()
+	return c.Container.Download(ctx, name, offset, count)
+}
+
+func TestRangeRead(t *testing.T) {
+	const size = 4 << 20
+
+	c := &rangeContainer{Container: New()}
+	fsys, err := blob.NewFromContainer(c)
+	if err != nil {
+		panic(err)
+	}
+	want, err := io.ReadAll(&patternReader{size: size})
+	if err != nil {
+		panic(err)
+	}
+	if err := writeFile(fsys, "large.bin", string(want)); err != nil {
+		panic(err)
+	}
+
+	file, err := fsys.Open("large.bin")
+	if err != nil {
+		t.Fatalf("TestRangeRead(Open): got err == %s, want err == nil", err)
+	}
+	defer file.Close()
+	seeker := file.(io.ReadSeeker)
+
+	const off, n = 3<<20 + 17, 1000
+	if pos, err := seeker.Seek(off, io.SeekStart); err != nil || pos != off {
+		t.Fatalf("TestRangeRead(Seek): got %d, err == %v, want %d, err == nil", pos, err, off)
+	}
+	got := make([]byte, n)
+	if _, err := io.ReadFull(seeker, got); err != nil {
+		t.Fatalf("TestRangeRead(Read after Seek): got err == %s, want err == nil", err)
+	}
+	if !bytes.Equal(got, want[off:off+n]) {
+		t.Errorf("TestRangeRead(Read after Seek): content did not match the blob at offset %d", off)
+	}
+	if len(c.ranges) != 1 || c.ranges[0][0] != off {
+		t.Errorf("TestRangeRead(Read after Seek): got downloads %v, want one starting at %d", c.ranges, off)
+	}
+
+	// Seeking relative to the current position and the end.
+	if _, err := seeker.Seek(-n, io.SeekCurrent); err != nil {
+		t.Fatalf("TestRangeRead(Seek SeekCurrent): got err == %s, want err == nil", err)
+	}
+	if _, err := io.ReadFull(seeker, got); err != nil || !bytes.Equal(got, want[off:off+n]) {
+		t.Errorf("TestRangeRead(Read after SeekCurrent): got err == %v or content mismatch", err)
+	}
+	if _, err := seeker.Seek(-n, io.SeekEnd); err != nil {
+		t.Fatalf("TestRangeRead(Seek SeekEnd): got err == %s, want err == nil", err)
+	}
+	tail, err := io.ReadAll(seeker)
+	if err != nil || !bytes.Equal(tail, want[size-n:]) {
+		t.Errorf("TestRangeRead(Read after SeekEnd): got %d bytes, err == %v, want the last %d bytes", len(tail), err, n)
+	}
+
+	ra := file.(io.ReaderAt)
+	c.ranges = nil
+	if _, err := ra.ReadAt(got, 12345); err != nil {
+		t.Fatalf("TestRangeRead(ReadAt): got err == %s, want err == nil", err)
+	}
+	if !bytes.Equal(got, want[12345:12345+n]) {
+		t.Errorf("TestRangeRead(ReadAt): content did not match the blob at offset 12345")
+	}
+	if diff := pretty.Compare([][2]int64{{12345, n}}, c.ranges); diff != "" {
+		t.Errorf("TestRangeRead(ReadAt): downloads -want/+got:\n%s", diff)
+	}
+
+	short := make([]byte, 2*n)
+	if m, err := ra.ReadAt(short, size-n); err != io.EOF || m != n || !bytes.Equal(short[:m], want[size-n:]) {
+		t.Errorf("TestRangeRead(ReadAt past end): got %d, err == %v, want %d, io.EOF", m, err, n)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	if err := writeFile(fsys, "file", "v1"); err != nil {
+		panic(err)
+	}
+
+	fi, err := fsys.Stat("file")
+	if err != nil {
+		t.Fatalf("TestIfMatch(Stat): got err == %s, want err == nil", err)
+	}
+	etag := fi.Sys().(blob.Sys).ETag
+	if etag == "" {
+		t.Fatalf("TestIfMatch(Stat): got empty ETag from Sys()")
+	}
+
+	writeIfMatch := func(etag, content string) error {
+		file, err := fsys.OpenFile("file", 0644, blob.WithFlags(os.O_WRONLY), blob.WithIfMatch(etag))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file.(io.Writer), content); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+
+	// Our read-modify-write succeeds as nobody else wrote the blob.
+	if err := writeIfMatch(string(etag), "v2"); err != nil {
+		t.Fatalf("TestIfMatch(current ETag): got err == %s, want err == nil", err)
+	}
+
+	// A second writer that read the blob at the same time must not overwrite our change.
+	err = writeIfMatch(string(etag), "v2-stale")
+	var conflict *blob.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("TestIfMatch(stale ETag): got err == %v, want *blob.ConflictError", err)
+	}
+	if conflict.Name != "file" || string(conflict.IfMatch) != string(etag) {
+		t.Errorf("TestIfMatch(stale ETag): got ConflictError{Name: %q, IfMatch: %q}, want {Name: %q, IfMatch: %q}", conflict.Name, conflict.IfMatch, "file", etag)
+	}
+
+	b, err := fsys.ReadFile("file")
+	if err != nil {
+		t.Fatalf("TestIfMatch(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "v2" {
+		t.Errorf("TestIfMatch(ReadFile): got %q, want %q", b, "v2")
+	}
+
+	if _, err := fsys.OpenFile("file", 0644, blob.WithIfMatch(string(etag))); err == nil {
+		t.Errorf("TestIfMatch(O_RDONLY): got err == nil, want err != nil")
+	}
+}
+
+func TestAutoDecompress(t *testing.T) {
+	const plain = "hello world, this is some content that was gzipped before it was uploaded"
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, plain); err != nil {
+		panic(err)
+	}
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+	gzipped := buf.String()
+
+	cont := New()
+	setup, err := blob.NewFromContainer(cont)
+	if err != nil {
+		panic(err)
+	}
+	for name, content := range map[string]string{"gzipped": gzipped, "plain": plain, "bad": "not gzip content at all"} {
+		if err := writeFile(setup, name, content); err != nil {
+			panic(err)
+		}
+	}
+	for _, name := range []string{"gzipped", "bad"} {
+		if err := cont.SetContentEncoding(name, "gzip"); err != nil {
+			panic(err)
+		}
+	}
+
+	fsys, err := blob.NewFromContainer(cont, blob.WithAutoDecompress())
+	if err != nil {
+		panic(err)
+	}
+
+	for _, name := range []string{"gzipped", "plain"} {
+		b, err := fsys.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestAutoDecompress(ReadFile %s): got err == %s, want err == nil", name, err)
+		}
+		if string(b) != plain {
+			t.Errorf("TestAutoDecompress(ReadFile %s): got %q, want %q", name, b, plain)
+		}
+
+		fi, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatalf("TestAutoDecompress(Stat %s): got err == %s, want err == nil", name, err)
+		}
+		if fi.Size() != int64(len(plain)) {
+			t.Errorf("TestAutoDecompress(Stat %s): got Size() == %d, want %d", name, fi.Size(), len(plain))
+		}
+	}
+
+	f, err := fsys.Open("gzipped")
+	if err != nil {
+		t.Fatalf("TestAutoDecompress(Open): got err == %s, want err == nil", err)
+	}
+	defer f.Close()
+	file := f.(*blob.File)
+
+	p := make([]byte, 5)
+	if _, err := file.ReadAt(p, 6); err != nil {
+		t.Errorf("TestAutoDecompress(ReadAt): got err == %s, want err == nil", err)
+	}
+	if string(p) != plain[6:11] {
+		t.Errorf("TestAutoDecompress(ReadAt): got %q, want %q", p, plain[6:11])
+	}
+	if _, err := file.Seek(12, io.SeekStart); err != nil {
+		t.Fatalf("TestAutoDecompress(Seek): got err == %s, want err == nil", err)
+	}
+	b, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("TestAutoDecompress(read after Seek): got err == %s, want err == nil", err)
+	}
+	if string(b) != plain[12:] {
+		t.Errorf("TestAutoDecompress(read after Seek): got %q, want %q", b, plain[12:])
+	}
+
+	if _, err := fsys.ReadFile("bad"); err == nil {
+		t.Errorf("TestAutoDecompress(ReadFile of blob that is not gzipped): got err == nil, want err != nil")
+	}
+
+	// Without the option, the gzipped bytes are returned.
+	b, err = setup.ReadFile("gzipped")
+	if err != nil {
+		t.Fatalf("TestAutoDecompress(ReadFile without option): got err == %s, want err == nil", err)
+	}
+	if string(b) != gzipped {
+		t.Errorf("TestAutoDecompress(ReadFile without option): did not get the gzipped content")
+	}
+}
+
+func TestMaxReadSize(t *testing.T) {
+	const max = 10
+
+	cont := New()
+	fsys, err := blob.NewFromContainer(cont, blob.WithMaxReadSize(max))
+	if err != nil {
+		panic(err)
+	}
+	files := map[string]string{
+		"under": strings.Repeat("a", max-1),
+		"at":    strings.Repeat("a", max),
+		"over":  strings.Repeat("a", max+1),
+	}
+	for name, content := range files {
+		if err := writeFile(fsys, name, content); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, name := range []string{"under", "at", "over"} {
+		wantErr := name == "over"
+
+		b, err := fsys.ReadFile(name)
+		switch {
+		case wantErr && !errors.Is(err, blob.ErrMaxReadSize):
+			t.Errorf("TestMaxReadSize(%s): ReadFile got err == %v, want blob.ErrMaxReadSize", name, err)
+		case !wantErr && err != nil:
+			t.Errorf("TestMaxReadSize(%s): ReadFile got err == %s, want err == nil", name, err)
+		case !wantErr && string(b) != files[name]:
+			t.Errorf("TestMaxReadSize(%s): ReadFile got %q, want %q", name, b, files[name])
+		}
+
+		if _, err := fsys.Open(name); wantErr != errors.Is(err, blob.ErrMaxReadSize) {
+			t.Errorf("TestMaxReadSize(%s): Open got err == %v, want ErrMaxReadSize == %v", name, err, wantErr)
+		}
+		if _, err := fsys.Stat(name); err != nil {
+			t.Errorf("TestMaxReadSize(%s): Stat got err == %s, want err == nil", name, err)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	fsys, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+
+	readContent := func() string {
+		if ok, _ := fsys.Exists("logs/app.log"); !ok {
+			return ""
+		}
+		b, err := fsys.ReadFile("logs/app.log")
+		if err != nil {
+			t.Fatalf("TestFlush(ReadFile): got err == %s, want err == nil", err)
+		}
+		return string(b)
+	}
+
+	file, err := fsys.OpenFile(
+		"logs/app.log",
+		0644,
+		blob.WithFlags(os.O_WRONLY|os.O_CREATE),
+		blob.WithFlushable(),
+		blob.WithBlockSize(4),
+	)
+	if err != nil {
+		t.Fatalf("TestFlush(OpenFile): got err == %s, want err == nil", err)
+	}
+	f := file.(*blob.File)
+
+	// Each step writes content and optionally flushes, then checks what a reader sees.
+	steps := []struct {
+		write string
+		flush bool
+		want  string
+	}{
+		{write: "line 1\n", want: ""},
+		{flush: true, want: "line 1\n"},
+		{write: "line 2\n", want: "line 1\n"},
+		{write: "line 3\n", flush: true, want: "line 1\nline 2\nline 3\n"},
+		{flush: true, want: "line 1\nline 2\nline 3\n"},
+	}
+	for i, step := range steps {
+		if _, err := io.WriteString(f, step.write); err != nil {
+			t.Fatalf("TestFlush(step %d): Write got err == %s, want err == nil", i, err)
+		}
+		if step.flush {
+			if err := f.Flush(); err != nil {
+				t.Fatalf("TestFlush(step %d): Flush got err == %s, want err == nil", i, err)
+			}
+		}
+		if got := readContent(); got != step.want {
+			t.Errorf("TestFlush(step %d): reader got %q, want %q", i, got, step.want)
+		}
+	}
+
+	if _, err := io.WriteString(f, "line 4\n"); err != nil {
+		t.Fatalf("TestFlush(final Write): got err == %s, want err == nil", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("TestFlush(Close): got err == %s, want err == nil", err)
+	}
+	if got, want := readContent(), "line 1\nline 2\nline 3\nline 4\n"; got != want {
+		t.Errorf("TestFlush(after Close): got %q, want %q", got, want)
+	}
+
+	// A flushable file opened WithIfMatch() can flush repeatedly, but fails if someone else
+	// writes the blob in between.
+	fi, err := fsys.Stat("logs/app.log")
+	if err != nil {
+		t.Fatalf("TestFlush(Stat): got err == %s, want err == nil", err)
+	}
+	file, err = fsys.OpenFile(
+		"logs/app.log",
+		0644,
+		blob.WithFlags(os.O_WRONLY),
+		blob.WithFlushable(),
+		blob.WithIfMatch(string(fi.Sys().(blob.Sys).ETag)),
+	)
+	if err != nil {
+		t.Fatalf("TestFlush(OpenFile WithIfMatch): got err == %s, want err == nil", err)
+	}
+	f = file.(*blob.File)
+	for _, s := range []string{"a", "b"} {
+		io.WriteString(f, s)
+		if err := f.Flush(); err != nil {
+			t.Fatalf("TestFlush(Flush WithIfMatch): got err == %s, want err == nil", err)
+		}
+	}
+	if err := writeFile(fsys, "logs/app.log", "other writer"); err != nil {
+		panic(err)
+	}
+	io.WriteString(f, "c")
+	var conflict *blob.ConflictError
+	if err := f.Flush(); !errors.As(err, &conflict) {
+		t.Errorf("TestFlush(Flush after other writer): got err == %v, want *blob.ConflictError", err)
+	}
+	f.Close()
+	if got := readContent(); got != "other writer" {
+		t.Errorf("TestFlush(after conflict): got %q, want %q", got, "other writer")
+	}
+
+	// A Sub() FS can also be flushed.
+	sub, err := fsys.Sub("logs")
+	if err != nil {
+		panic(err)
+	}
+	file, err = sub.(*blob.FS).OpenFile("sub.log", 0644, blob.WithFlags(os.O_WRONLY|os.O_CREATE), blob.WithFlushable())
+	if err != nil {
+		t.Fatalf("TestFlush(OpenFile on Sub()): got err == %s, want err == nil", err)
+	}
+	io.WriteString(file.(io.Writer), "sub")
+	if err := file.(*blob.File).Flush(); err != nil {
+		t.Fatalf("TestFlush(Flush on Sub()): got err == %s, want err == nil", err)
+	}
+	file.Close()
+	if b, err := fsys.ReadFile("logs/sub.log"); err != nil || string(b) != "sub" {
+		t.Errorf("TestFlush(Sub()): got %q, err == %v, want %q, err == nil", b, err, "sub")
+	}
+
+	// Flush() requires WithFlushable().
+	file, err = fsys.OpenFile("other.log", 0644, blob.WithFlags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestFlush(OpenFile without WithFlushable): got err == %s, want err == nil", err)
+	}
+	defer file.Close()
+	if err := file.(*blob.File).Flush(); err == nil {
+		t.Errorf("TestFlush(without WithFlushable): got err == nil, want err != nil")
+	}
+
+	if _, err := fsys.OpenFile("logs/app.log", 0644, blob.WithFlushable()); err == nil {
+		t.Errorf("TestFlush(WithFlushable and O_RDONLY): got err == nil, want err != nil")
+	}
+}
+
+func TestDirectoryPlaceholders(t *testing.T) {
+	fsys, err := blob.NewFromContainer(New(), blob.WithDirectoryPlaceholders())
+	if err != nil {
+		panic(err)
+	}
+	if err := writeFile(fsys, "parent/file.txt", "content"); err != nil {
+		panic(err)
+	}
+
+	if err := fsys.Mkdir("parent/empty", 0755); err != nil {
+		t.Fatalf("TestDirectoryPlaceholders(Mkdir): got err == %s, want err == nil", err)
+	}
+	if err := fsys.MkdirAll("a/b/c", 0755); err != nil {
+		t.Fatalf("TestDirectoryPlaceholders(MkdirAll): got err == %s, want err == nil", err)
+	}
+
+	entries, err := fsys.ReadDir("parent")
+	if err != nil {
+		t.Fatalf("TestDirectoryPlaceholders(ReadDir(parent)): got err == %s, want err == nil", err)
+	}
+	got := map[string]bool{}
+	for _, e := range entries {
+		got[e.Name()] = e.IsDir()
+	}
+	if diff := pretty.Compare(map[string]bool{"empty": true, "file.txt": false}, got); diff != "" {
+		t.Errorf("TestDirectoryPlaceholders(ReadDir(parent)): -want/+got:\n%s", diff)
+	}
+
+	// The empty directory lists as empty, its placeholder is hidden.
+	for _, name := range []string{"parent/empty", "a/b/c"} {
+		fi, err := fsys.Stat(name)
+		if err != nil {
+			t.Errorf("TestDirectoryPlaceholders(Stat(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if !fi.IsDir() {
+			t.Errorf("TestDirectoryPlaceholders(Stat(%s)): got IsDir() == false, want true", name)
+		}
+		entries, err := fsys.ReadDir(name)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("TestDirectoryPlaceholders(ReadDir(%s)): got %d entries, err == %v, want 0 entries, err == nil", name, len(entries), err)
+		}
+	}
+	for _, name := range []string{"a", "a/b"} {
+		if fi, err := fsys.Stat(name); err != nil || !fi.IsDir() {
+			t.Errorf("TestDirectoryPlaceholders(Stat(%s)): got %v, err == %v, want a directory", name, fi, err)
+		}
+	}
+
+	// The root of an FS from Sub() of a directory made with MkdirAll() is its placeholder blob.
+	for _, test := range []struct {
+		dir  string
+		want []string
+	}{
+		{dir: "a/b/c"},
+		{dir: "a", want: []string{"b"}},
+	} {
+		sub, err := fsys.Sub(test.dir)
+		if err != nil {
+			t.Fatalf("TestDirectoryPlaceholders(Sub(%s)): got err == %s, want err == nil", test.dir, err)
+		}
+		entries, err := fs.ReadDir(sub, ".")
+		if err != nil {
+			t.Errorf("TestDirectoryPlaceholders(Sub(%s) ReadDir): got err == %s, want err == nil", test.dir, err)
+			continue
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestDirectoryPlaceholders(Sub(%s) ReadDir): -want/+got:\n%s", test.dir, diff)
+		}
+
+		err = sub.(*blob.FS).WalkFiles(".", func(path string, fi fs.FileInfo) error {
+			t.Errorf("TestDirectoryPlaceholders(Sub(%s) WalkFiles): got file %q, want none", test.dir, path)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("TestDirectoryPlaceholders(Sub(%s) WalkFiles): got err == %s, want err == nil", test.dir, err)
+		}
+	}
+
+	var walked []string
+	err = fsys.WalkFiles(".", func(path string, fi fs.FileInfo) error {
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestDirectoryPlaceholders(WalkFiles): got err == %s, want err == nil", err)
+	}
+	if diff := pretty.Compare([]string{"parent/file.txt"}, walked); diff != "" {
+		t.Errorf("TestDirectoryPlaceholders(WalkFiles): -want/+got:\n%s", diff)
+	}
+
+	if err := fsys.Mkdir("parent/empty", 0755); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("TestDirectoryPlaceholders(Mkdir existing): got err == %v, want fs.ErrExist", err)
+	}
+	if err := fsys.Mkdir("missing/dir", 0755); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestDirectoryPlaceholders(Mkdir without parent): got err == %v, want fs.ErrNotExist", err)
+	}
+	if err := fsys.MkdirAll("parent/file.txt/dir", 0755); err == nil {
+		t.Errorf("TestDirectoryPlaceholders(MkdirAll under a file): got err == nil, want err != nil")
+	}
+	if err := fsys.MkdirAll("a/b", 0755); err != nil {
+		t.Errorf("TestDirectoryPlaceholders(MkdirAll existing): got err == %s, want err == nil", err)
+	}
+
+	if err := fsys.Remove("parent"); err == nil {
+		t.Errorf("TestDirectoryPlaceholders(Remove non-empty directory): got err == nil, want err != nil")
+	}
+	if err := fsys.Remove("parent/empty"); err != nil {
+		t.Errorf("TestDirectoryPlaceholders(Remove empty directory): got err == %s, want err == nil", err)
+	}
+	if _, err := fsys.Stat("parent/empty"); err == nil {
+		t.Errorf("TestDirectoryPlaceholders(Stat after Remove): got err == nil, want err != nil")
+	}
+
+	plain, err := blob.NewFromContainer(New())
+	if err != nil {
+		panic(err)
+	}
+	if err := plain.Mkdir("dir", 0755); err == nil {
+		t.Errorf("TestDirectoryPlaceholders(Mkdir without option): got err == nil, want err != nil")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	tests := []struct {
+		desc    string
+		name    string
+		content string
+		stored  string
+		want    string
+	}{
+		{desc: "json extension", name: "data.json", content: `{"a": 1}`, want: "application/json"},
+		{desc: "png extension", name: "image.png", content: png, want: "image/png"},
+		{desc: "png without extension", name: "image", content: png, want: "image/png"},
+		{desc: "binary without extension", name: "binary", content: "\x00\x01\x02\xff", want: "application/octet-stream"},
+		{desc: "stored content type", name: "stored.json", content: `{"a": 1}`, stored: "text/plain", want: "text/plain"},
+	}
+
+	cont := New()
+	fsys, err := blob.NewFromContainer(cont)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, test := range tests {
+		if err := writeFile(fsys, test.name, test.content); err != nil {
+			panic(err)
+		}
+		if test.stored != "" {
+			if err := cont.SetContentType(test.name, test.stored); err != nil {
+				panic(err)
+			}
+		}
+		got, err := fsys.ContentType(test.name)
+		if err != nil {
+			t.Errorf("TestContentType(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestContentType(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := fsys.ContentType("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestContentType(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
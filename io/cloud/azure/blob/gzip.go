@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipMinSize is the size of an empty gzip stream, which is a header and a trailer.
+const gzipMinSize = 18
+
+// WithAutoDecompress transparently decompresses blobs that have a Content-Encoding of "gzip"
+// when they are read with Open(), ReadFile() or OpenFile(). Size() from Stat() and from the
+// Stat() of an opened file is the decompressed size, which is read from the gzip trailer.
+// This is only correct for blobs holding a single gzip stream of less than 4 GiB. Seek()
+// and ReadAt() on these files decompress the blob from the start. The entries from ReadDir()
+// and WalkFiles() report the compressed size.
+func WithAutoDecompress() Option {
+	return func(f *FS) error {
+		f.autoDecompress = true
+		return nil
+	}
+}
+
+func isGzip(props *BlobProperties) bool {
+	return props != nil && strings.EqualFold(strings.TrimSpace(props.ContentEncoding), "gzip")
+}
+
+// newReadFileInfo returns the fileInfo for reading the blob at name. If WithAutoDecompress()
+// is set and the blob is gzipped, this has the decompressed size.
+func (f *FS) newReadFileInfo(ctx context.Context, name, path string, props *BlobProperties) (fileInfo, error) {
+	fi := newFileInfo(name, props)
+	if !f.autoDecompress || !isGzip(props) {
+		return fi, nil
+	}
+
+	size, err := gzipSize(ctx, f.cont, path, props.ContentLength)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	fi.gzipped = true
+	fi.size = size
+	return fi, nil
+}
+
+// gzipSize returns the decompressed size of the gzipped blob at name from the ISIZE field,
+// which is the last 4 bytes of the gzip trailer.
+func gzipSize(ctx context.Context, cont Container, name string, compressed int64) (int64, error) {
+	if compressed < gzipMinSize {
+		return 0, fmt.Errorf("blob(%s) is %d bytes, which is too small to be gzipped", name, compressed)
+	}
+
+	r, err := cont.Download(ctx, name, compressed-4, 4)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, fmt.Errorf("could not read gzip trailer of blob(%s): %w", name, err)
+	}
+	return int64(binary.LittleEndian.Uint32(b[:])), nil
+}
+
+// gunzip returns a reader of the decompressed content of the blob at name, starting at
+// offset in the decompressed content.
+func gunzip(ctx context.Context, cont Container, name string, offset int64) (io.ReadCloser, error) {
+	body, err := cont.Download(ctx, name, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("blob(%s) has Content-Encoding gzip, but is not gzipped: %w", name, err)
+	}
+	r := gzipReadCloser{Reader: zr, body: body}
+
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil && err != io.EOF {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// gzipReadCloser closes the gzip.Reader and the body it reads from.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
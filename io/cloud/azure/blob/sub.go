@@ -0,0 +1,106 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+var _ fs.SubFS = &FS{}
+
+// Sub implements fs.SubFS.Sub(). The returned *FS operates on the blobs whose names start
+// with dir + "/", which allows several applications to share a container using their own prefix.
+// The prefix is added to every blob name used by the returned FS and removed from listings,
+// so it cannot see blobs outside of dir. The returned FS uses the same options as f.
+func (f *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+
+	sub := *f
+	prefix := dir + "/"
+	if pc, ok := f.cont.(prefixContainer); ok {
+		sub.cont = prefixContainer{cont: pc.cont, prefix: pc.prefix + prefix}
+	} else {
+		sub.cont = prefixContainer{cont: f.cont, prefix: prefix}
+	}
+	return &sub, nil
+}
+
+// prefixContainer is a Container that adds prefix to all blob names it is passed and removes
+// it from the names it returns. Markers are passed through unchanged.
+type prefixContainer struct {
+	cont   Container
+	prefix string
+}
+
+func (p prefixContainer) GetProperties(ctx context.Context, name string) (*BlobProperties, error) {
+	return p.cont.GetProperties(ctx, p.prefix+name)
+}
+
+func (p prefixContainer) Download(ctx context.Context, name string, offset, count int64) (io.ReadCloser, error) {
+	return p.cont.Download(ctx, p.prefix+name, offset, count)
+}
+
+func (p prefixContainer) UploadStream(ctx context.Context, name string, r io.Reader, opts UploadOptions) error {
+	return p.cont.UploadStream(ctx, p.prefix+name, r, opts)
+}
+
+// StageBlock implements BlockContainer.StageBlock(). The wrapped Container must be a BlockContainer,
+// which OpenFile() checks with WithFlushable().
+func (p prefixContainer) StageBlock(ctx context.Context, name, blockID string, content []byte, leaseID string) error {
+	return p.cont.(BlockContainer).StageBlock(ctx, p.prefix+name, blockID, content, leaseID)
+}
+
+// CommitBlockList implements BlockContainer.CommitBlockList(). The wrapped Container must be a
+// BlockContainer.
+func (p prefixContainer) CommitBlockList(ctx context.Context, name string, blockIDs []string, opts UploadOptions) (azblob.ETag, error) {
+	return p.cont.(BlockContainer).CommitBlockList(ctx, p.prefix+name, blockIDs, opts)
+}
+
+func (p prefixContainer) ListBlobsHierarchySegment(ctx context.Context, marker, prefix, delimiter string, maxResults int32) (ListResult, error) {
+	resp, err := p.cont.ListBlobsHierarchySegment(ctx, marker, p.prefix+prefix, delimiter, maxResults)
+	if err != nil {
+		return ListResult{}, err
+	}
+	for i, name := range resp.Prefixes {
+		resp.Prefixes[i] = strings.TrimPrefix(name, p.prefix)
+	}
+	for i, name := range resp.Blobs {
+		resp.Blobs[i] = strings.TrimPrefix(name, p.prefix)
+	}
+	return resp, nil
+}
+
+func (p prefixContainer) ListBlobsFlatSegment(ctx context.Context, marker, prefix string, maxResults int32) (FlatListResult, error) {
+	resp, err := p.cont.ListBlobsFlatSegment(ctx, marker, p.prefix+prefix, maxResults)
+	if err != nil {
+		return FlatListResult{}, err
+	}
+	for i := range resp.Blobs {
+		resp.Blobs[i].Name = strings.TrimPrefix(resp.Blobs[i].Name, p.prefix)
+	}
+	return resp, nil
+}
+
+func (p prefixContainer) AcquireLease(ctx context.Context, name string, duration int32) (string, error) {
+	return p.cont.AcquireLease(ctx, p.prefix+name, duration)
+}
+
+func (p prefixContainer) RenewLease(ctx context.Context, name, leaseID string) error {
+	return p.cont.RenewLease(ctx, p.prefix+name, leaseID)
+}
+
+func (p prefixContainer) ReleaseLease(ctx context.Context, name, leaseID string) error {
+	return p.cont.ReleaseLease(ctx, p.prefix+name, leaseID)
+}
+
+func (p prefixContainer) Delete(ctx context.Context, name string) error {
+	return p.cont.Delete(ctx, p.prefix+name)
+}
@@ -0,0 +1,421 @@
+/*
+Package grpc provides an fs.FS backed by a remote file service over gRPC. The client FS
+implements cache.CacheFS so that it can be used as the store for a cache.FS.
+
+The service is defined in pb/fs.proto. NewServer() adapts any fs.FS onto the service, so
+a file service can be exposed with:
+
+	srv := grpc.NewServer()
+	pb.RegisterFSServer(srv, grpcfs.NewServer(fsys))
+
+A gRPC NotFound status is returned as fs.ErrNotExist.
+
+Front the file service with an in-memory cache:
+
+	conn, err := grpc.Dial("files.example.com:443", grpc.WithTransportCredentials(creds))
+	if err != nil {
+		// Do something
+	}
+
+	store, err := grpcfs.New(conn)
+	if err != nil {
+		// Do something
+	}
+
+	cacheFS, err := cache.New(memCache, store)
+	if err != nil {
+		// Do something
+	}
+*/
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/cloud/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ cache.CacheFS = &FS{}
+
+// FS implements fs.FS for a remote file service.
+type FS struct {
+	client  pb.FSClient
+	timeout time.Duration
+}
+
+// Option is an optional argument to New().
+type Option func(f *FS) error
+
+// WithTimeout sets a deadline of d for each call to the file service. By default calls have no deadline.
+func WithTimeout(d time.Duration) Option {
+	return func(f *FS) error {
+		if d <= 0 {
+			return fmt.Errorf("WithTimeout(%v) must be > 0", d)
+		}
+		f.timeout = d
+		return nil
+	}
+}
+
+// New creates a new FS that uses the file service on conn.
+func New(conn grpc.ClientConnInterface, options ...Option) (*FS, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("New() requires a non-nil conn")
+	}
+
+	sys := &FS{client: pb.NewFSClient(conn)}
+	for _, o := range options {
+		if err := o(sys); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+func (f *FS) ctx() (context.Context, context.CancelFunc) {
+	if f.timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), f.timeout)
+}
+
+// Open implements fs.FS.Open(). The content of a file is read when it is opened.
+func (f *FS) Open(name string) (fs.File, error) {
+	resp, err := f.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fi := newFileInfo(resp.Info)
+	if fi.IsDir() {
+		return &dirFile{fs: f, name: name, fi: fi}, nil
+	}
+	return &readFile{Reader: bytes.NewReader(resp.Content), fi: fi}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	resp, err := f.get("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Info.GetIsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return resp.Content, nil
+}
+
+func (f *FS) get(op, name string) (*pb.GetResponse, error) {
+	if err := validPath(op, name); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := f.ctx()
+	defer cancel()
+
+	resp, err := f.client.Get(ctx, &pb.GetRequest{Name: name})
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	return resp, nil
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if err := validPath("stat", name); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := f.ctx()
+	defer cancel()
+
+	resp, err := f.client.Stat(ctx, &pb.StatRequest{Name: name})
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(resp.Info), nil
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir().
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := validPath("readdir", name); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := f.ctx()
+	defer cancel()
+
+	resp, err := f.client.List(ctx, &pb.ListRequest{Name: name})
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	out := make([]fs.DirEntry, 0, len(resp.Entries))
+	for _, e := range resp.Entries {
+		out = append(out, newFileInfo(e))
+	}
+	return out, nil
+}
+
+type ofOptions struct {
+	flags int
+}
+
+func (o *ofOptions) defaults() {
+	o.flags = os.O_RDONLY
+}
+
+// WithFlags sets the flags used when opening a file with OpenFile().
+func WithFlags(flags int) jsfs.OFOption {
+	return func(o interface{}) error {
+		v, ok := o.(*ofOptions)
+		if !ok {
+			return fmt.Errorf("grpc.WithFlags received wrong type %T", o)
+		}
+		v.flags = flags
+		return nil
+	}
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile(). Files opened for writing are not written
+// to the file service until Close() is called.
+func (f *FS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	opts := ofOptions{}
+	opts.defaults()
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f.Open(name)
+	}
+	if opts.flags&os.O_RDWR != 0 {
+		return nil, fmt.Errorf("grpc.FS does not support opening files with O_RDWR: %w", jsfs.ErrUnsupportedFlag)
+	}
+	if err := validPath("open", name); err != nil {
+		return nil, err
+	}
+	return &writeFile{fs: f, name: name, perm: perm, content: &bytes.Buffer{}}, nil
+}
+
+// WriteFile implements jsfs.Writer.WriteFile(). The file service returns an error if
+// the fs.FS it serves cannot be written to.
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	if err := validPath("write", name); err != nil {
+		return err
+	}
+
+	ctx, cancel := f.ctx()
+	defer cancel()
+
+	_, err := f.client.Put(ctx, &pb.PutRequest{Name: name, Content: content, Mode: uint32(perm)})
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	return nil
+}
+
+func validPath(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// pathError converts an error from the file service into an *fs.PathError. gRPC status
+// codes that have an fs equivalent, such as NotFound, are converted to that error.
+func pathError(op, name string, err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	var target error
+	switch s.Code() {
+	case codes.NotFound:
+		target = fs.ErrNotExist
+	case codes.AlreadyExists:
+		target = fs.ErrExist
+	case codes.PermissionDenied, codes.Unauthenticated:
+		target = fs.ErrPermission
+	case codes.InvalidArgument:
+		target = fs.ErrInvalid
+	case codes.Unimplemented:
+		target = errors.ErrUnsupported
+	default:
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: %w", s.Message(), target)}
+}
+
+type readFile struct {
+	*bytes.Reader
+	fi fileInfo
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *readFile) Close() error {
+	return nil
+}
+
+// dirFile is a directory opened with Open(). The entries are read on the first call to ReadDir().
+type dirFile struct {
+	fs   *FS
+	name string
+	fi   fileInfo
+
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.fi, nil
+}
+
+func (d *dirFile) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.ReadDir().
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+type writeFile struct {
+	fs      *FS
+	name    string
+	perm    fs.FileMode
+	content *bytes.Buffer
+
+	sync.Mutex
+	closed bool
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	return nil, fmt.Errorf("Stat() not supported on a writeable fs.File")
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	return 0, fmt.Errorf("Read() not supported on writeable fs.File")
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.content.Write(b)
+}
+
+// Close writes the content to the file service.
+func (f *writeFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("file is closed")
+	}
+	f.closed = true
+	return f.fs.WriteFile(f.name, f.content.Bytes(), f.perm)
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry for a pb.FileInfo.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func newFileInfo(fi *pb.FileInfo) fileInfo {
+	out := fileInfo{
+		name: fi.GetName(),
+		size: fi.GetSize(),
+		mode: fs.FileMode(fi.GetMode()),
+	}
+	if fi.GetIsDir() {
+		out.mode |= fs.ModeDir
+	}
+	if fi.GetModTime() != nil {
+		out.modTime = fi.GetModTime().AsTime()
+	}
+	return out
+}
+
+func (f fileInfo) Name() string {
+	return f.name
+}
+
+func (f fileInfo) Size() int64 {
+	return f.size
+}
+
+func (f fileInfo) Mode() fs.FileMode {
+	return f.mode
+}
+
+func (f fileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f fileInfo) IsDir() bool {
+	return f.mode.IsDir()
+}
+
+func (f fileInfo) Sys() interface{} {
+	return nil
+}
+
+// Type implements fs.DirEntry.Type().
+func (f fileInfo) Type() fs.FileMode {
+	return f.mode.Type()
+}
+
+// Info implements fs.DirEntry.Info().
+func (f fileInfo) Info() (fs.FileInfo, error) {
+	return f, nil
+}
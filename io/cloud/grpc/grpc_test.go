@@ -0,0 +1,182 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gopherfs/fs/fstesting"
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/cloud/grpc/pb"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// setup starts an in-process file service serving fsys and returns a client FS for it.
+func setup(fsys fs.FS, options ...Option) (*FS, func()) {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterFSServer(srv, NewServer(fsys))
+	go srv.Serve(lis)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	client, err := New(conn, options...)
+	if err != nil {
+		panic(err)
+	}
+	return client, func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func newSimple(files map[string][]byte) *simple.FS {
+	fsys := simple.New()
+	for name, content := range files {
+		if err := fsys.WriteFile(name, content, 0644); err != nil {
+			panic(err)
+		}
+	}
+	return fsys
+}
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":          []byte("hello"),
+		"dir/b.txt":      []byte("world"),
+		"dir/sub/c.json": []byte(`{"Name":"John Doak"}`),
+		"empty":          {},
+	}
+	fsys, closer := setup(newSimple(files))
+	defer closer()
+
+	fstesting.Run(t, fsys, files)
+}
+
+// readOnly hides the jsfs.Writer of an fs.FS.
+type readOnly struct {
+	fs.FS
+}
+
+func TestErrors(t *testing.T) {
+	fsys, closer := setup(readOnly{fstest.MapFS{"file": {Data: []byte("content")}}})
+	defer closer()
+
+	tests := []struct {
+		desc string
+		fn   func() error
+		want error
+	}{
+		{
+			desc: "ReadFile missing file",
+			fn:   func() error { _, err := fsys.ReadFile("nope"); return err },
+			want: fs.ErrNotExist,
+		},
+		{
+			desc: "Stat missing file",
+			fn:   func() error { _, err := fsys.Stat("nope"); return err },
+			want: fs.ErrNotExist,
+		},
+		{
+			desc: "ReadDir missing dir",
+			fn:   func() error { _, err := fsys.ReadDir("nope"); return err },
+			want: fs.ErrNotExist,
+		},
+		{
+			desc: "Open invalid path",
+			fn:   func() error { _, err := fsys.Open("../file"); return err },
+			want: fs.ErrInvalid,
+		},
+		{
+			desc: "WriteFile to an fs.FS without WriteFile()",
+			fn:   func() error { return fsys.WriteFile("file", []byte("new"), 0644) },
+			want: errors.ErrUnsupported,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.fn()
+		if !errors.Is(err, test.want) {
+			t.Errorf("TestErrors(%s): got err == %v, want %v", test.desc, err, test.want)
+		}
+		var pe *fs.PathError
+		if !errors.As(err, &pe) {
+			t.Errorf("TestErrors(%s): got err of type %T, want *fs.PathError", test.desc, err)
+		}
+	}
+}
+
+func TestPut(t *testing.T) {
+	mem := simple.New()
+	fsys, closer := setup(mem)
+	defer closer()
+
+	if err := fsys.WriteFile("dir/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestPut(WriteFile): got err == %s, want err == nil", err)
+	}
+	if b, err := mem.ReadFile("dir/file"); err != nil || string(b) != "hello" {
+		t.Errorf("TestPut(WriteFile): server has %q, %v, want %q", b, err, "hello")
+	}
+
+	f, err := fsys.OpenFile("other", 0644, WithFlags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestPut(OpenFile): got err == %s, want err == nil", err)
+	}
+	if _, err := io.WriteString(f.(io.Writer), "world"); err != nil {
+		t.Fatalf("TestPut(Write): got err == %s, want err == nil", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("TestPut(Close): got err == %s, want err == nil", err)
+	}
+
+	b, err := fsys.ReadFile("other")
+	if err != nil {
+		t.Fatalf("TestPut(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "world" {
+		t.Errorf("TestPut(ReadFile): got %q, want %q", b, "world")
+	}
+}
+
+func TestCache(t *testing.T) {
+	store, closer := setup(newSimple(map[string][]byte{"file": []byte("content")}))
+	defer closer()
+
+	mem := simple.New()
+	c, err := cache.New(mem, store)
+	if err != nil {
+		panic(err)
+	}
+
+	b, err := c.ReadFile("file")
+	if err != nil {
+		t.Fatalf("TestCache(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Fatalf("TestCache(ReadFile): got %q, want %q", b, "content")
+	}
+	c.Wait()
+
+	if b, err := mem.ReadFile("file"); err != nil || string(b) != "content" {
+		t.Errorf("TestCache: cache has %q, %v, want %q", b, err, "content")
+	}
+	if _, err := c.ReadFile("nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestCache(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
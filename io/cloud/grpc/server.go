@@ -0,0 +1,119 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cloud/grpc/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements pb.FSServer for an fs.FS. Register it with pb.RegisterFSServer().
+type Server struct {
+	pb.UnimplementedFSServer
+
+	fsys fs.FS
+}
+
+// NewServer creates a Server that serves fsys. Put is only supported if fsys implements
+// jsfs.Writer, otherwise it returns codes.Unimplemented.
+func NewServer(fsys fs.FS) *Server {
+	return &Server{fsys: fsys}
+}
+
+// Get implements pb.FSServer.Get().
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	fi, err := fs.Stat(s.fsys, req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.GetResponse{Info: toFileInfo(fi)}
+	if fi.IsDir() {
+		return resp, nil
+	}
+
+	resp.Content, err = fs.ReadFile(s.fsys, req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return resp, nil
+}
+
+// Put implements pb.FSServer.Put().
+func (s *Server) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	w, ok := s.fsys.(jsfs.Writer)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%T does not implement jsfs.Writer", s.fsys)
+	}
+	if !fs.ValidPath(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid name %q", req.Name)
+	}
+	if err := w.WriteFile(req.Name, req.Content, fs.FileMode(req.Mode)); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+// Stat implements pb.FSServer.Stat().
+func (s *Server) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	fi, err := fs.Stat(s.fsys, req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.StatResponse{Info: toFileInfo(fi)}, nil
+}
+
+// List implements pb.FSServer.List().
+func (s *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	entries, err := fs.ReadDir(s.fsys, req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.ListResponse{Entries: make([]*pb.FileInfo, 0, len(entries))}
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		resp.Entries = append(resp.Entries, toFileInfo(fi))
+	}
+	return resp, nil
+}
+
+func toFileInfo(fi fs.FileInfo) *pb.FileInfo {
+	out := &pb.FileInfo{
+		Name:  fi.Name(),
+		Size:  fi.Size(),
+		Mode:  uint32(fi.Mode()),
+		IsDir: fi.IsDir(),
+	}
+	if !fi.ModTime().IsZero() {
+		out.ModTime = timestamppb.New(fi.ModTime())
+	}
+	return out
+}
+
+// toStatus converts an error from the fs.FS into a gRPC status. This is the reverse of pathError().
+func toStatus(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = codes.NotFound
+	case errors.Is(err, fs.ErrExist):
+		code = codes.AlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		code = codes.PermissionDenied
+	case errors.Is(err, fs.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, errors.ErrUnsupported):
+		code = codes.Unimplemented
+	default:
+		code = codes.Unknown
+	}
+	return status.Error(code, err.Error())
+}
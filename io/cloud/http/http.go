@@ -0,0 +1,350 @@
+/*
+Package http provides an fs.FS backed by an HTTP origin, such as a CDN. It implements
+cache.CacheFS so that it can be used as the store for a cache.FS.
+
+A file is read by doing a GET of the base URL joined with the file's name. A 404 is
+returned as fs.ErrNotExist. Files are only written with PUT if WithPut() is passed,
+as most origins do not support it.
+
+Front a CDN with an in-memory cache:
+
+	origin, err := http.New("https://cdn.example.com/assets")
+	if err != nil {
+		// Do something
+	}
+
+	cacheFS, err := cache.New(memCache, origin)
+	if err != nil {
+		// Do something
+	}
+*/
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+)
+
+var _ cache.CacheFS = &FS{}
+
+// FS implements fs.FS for an HTTP origin.
+type FS struct {
+	base    *url.URL
+	client  *http.Client
+	put     bool
+	headers http.Header
+}
+
+// Option is an optional argument to New().
+type Option func(f *FS) error
+
+// WithClient sets the *http.Client used for requests. Defaults to http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(f *FS) error {
+		if client == nil {
+			return fmt.Errorf("WithClient() requires a non-nil client")
+		}
+		f.client = client
+		return nil
+	}
+}
+
+// WithHeader adds a header that is sent with every request, such as an Authorization header.
+func WithHeader(key, value string) Option {
+	return func(f *FS) error {
+		f.headers.Add(key, value)
+		return nil
+	}
+}
+
+// WithPut allows writing files with WriteFile() and OpenFile() by doing a PUT to the origin.
+// Without this, writes return an error.
+func WithPut() Option {
+	return func(f *FS) error {
+		f.put = true
+		return nil
+	}
+}
+
+// New creates a new FS that reads files from baseURL, which must be an http or https URL.
+func New(baseURL string, options ...Option) (*FS, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("baseURL(%s) is invalid: %w", baseURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("baseURL(%s) must have scheme http or https", baseURL)
+	}
+
+	sys := &FS{
+		base:    u,
+		client:  http.DefaultClient,
+		headers: http.Header{},
+	}
+	for _, o := range options {
+		if err := o(sys); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+// Open implements fs.FS.Open(). The returned fs.File streams the body of the response.
+func (f *FS) Open(name string) (fs.File, error) {
+	return f.open(context.Background(), "open", name)
+}
+
+func (f *FS) open(ctx context.Context, op, name string) (*readFile, error) {
+	resp, err := f.do(ctx, op, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &readFile{body: resp.Body, fi: newFileInfo(name, resp)}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	file, err := f.open(context.Background(), "read", name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// Stat implements fs.StatFS.Stat(). This does a HEAD request and uses the Content-Length
+// and Last-Modified headers of the response.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	resp, err := f.do(context.Background(), "stat", http.MethodHead, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return newFileInfo(name, resp), nil
+}
+
+type ofOptions struct {
+	flags int
+}
+
+func (o *ofOptions) defaults() {
+	o.flags = os.O_RDONLY
+}
+
+// WithFlags sets the flags used when opening a file with OpenFile(). Opening a file for
+// writing requires WithPut() to have been passed to New().
+func WithFlags(flags int) jsfs.OFOption {
+	return func(o interface{}) error {
+		v, ok := o.(*ofOptions)
+		if !ok {
+			return fmt.Errorf("http.WithFlags received wrong type %T", o)
+		}
+		v.flags = flags
+		return nil
+	}
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile(). Files opened for writing are not written
+// to the origin until Close() is called.
+func (f *FS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	opts := ofOptions{}
+	opts.defaults()
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.flags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f.Open(name)
+	}
+	if opts.flags&os.O_RDWR != 0 {
+		return nil, fmt.Errorf("http.FS does not support opening files with O_RDWR: %w", jsfs.ErrUnsupportedFlag)
+	}
+	if err := f.canPut("open", name); err != nil {
+		return nil, err
+	}
+	return &writeFile{fs: f, name: name, content: &bytes.Buffer{}}, nil
+}
+
+// WriteFile implements jsfs.Writer.WriteFile(). This requires WithPut() to have been
+// passed to New(). perm is ignored.
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	if err := f.canPut("write", name); err != nil {
+		return err
+	}
+	resp, err := f.do(context.Background(), "write", http.MethodPut, name, content)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (f *FS) canPut(op, name string) error {
+	if !f.put {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("writing requires WithPut(): %w", errors.ErrUnsupported)}
+	}
+	return nil
+}
+
+// do does a request with method for name. Responses with status codes other than 2xx
+// are returned as errors, with 404 being fs.ErrNotExist. The caller must close the body
+// of the returned response.
+func (f *FS) do(ctx context.Context, op, method, name string, content []byte) (*http.Response, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	u := f.base.JoinPath(name)
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	for k, v := range f.headers {
+		req.Header[k] = v
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s: %w", resp.Status, fs.ErrPermission)}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%s %s returned %s", method, u.Redacted(), resp.Status)}
+}
+
+type readFile struct {
+	body io.ReadCloser
+	fi   fileInfo
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *readFile) Read(b []byte) (int, error) {
+	return f.body.Read(b)
+}
+
+func (f *readFile) Close() error {
+	return f.body.Close()
+}
+
+type writeFile struct {
+	fs      *FS
+	name    string
+	content *bytes.Buffer
+
+	sync.Mutex
+	closed bool
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	return nil, fmt.Errorf("Stat() not supported on a writeable fs.File")
+}
+
+func (f *writeFile) Read(b []byte) (int, error) {
+	return 0, fmt.Errorf("Read() not supported on writeable fs.File")
+}
+
+func (f *writeFile) Write(b []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.content.Write(b)
+}
+
+// Close writes the content to the origin.
+func (f *writeFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return fmt.Errorf("file is closed")
+	}
+	f.closed = true
+	return f.fs.WriteFile(f.name, f.content.Bytes(), 0)
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func newFileInfo(name string, resp *http.Response) fileInfo {
+	fi := fileInfo{name: path.Base(name), size: resp.ContentLength}
+	if fi.size < 0 {
+		fi.size = 0
+	}
+	if lm := strings.TrimSpace(resp.Header.Get("Last-Modified")); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			fi.modTime = t
+		}
+	}
+	return fi
+}
+
+func (f fileInfo) Name() string {
+	return f.name
+}
+
+// Size returns the Content-Length of the response. It is 0 if the origin did not send one.
+func (f fileInfo) Size() int64 {
+	return f.size
+}
+
+func (f fileInfo) Mode() fs.FileMode {
+	return 0444
+}
+
+// ModTime returns the Last-Modified time of the response, if the origin sent one.
+func (f fileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f fileInfo) IsDir() bool {
+	return false
+}
+
+func (f fileInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopherfs/fs/fstesting"
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/mem/simple"
+)
+
+var modTime = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// origin is an HTTP origin that serves files from a map.
+type origin struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	gets  int
+	// auth, if set, is the Authorization header that must be sent.
+	auth string
+}
+
+func newOrigin(files map[string][]byte) *origin {
+	o := &origin{files: map[string][]byte{}}
+	for k, v := range files {
+		o.files[k] = v
+	}
+	return o
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.auth != "" && r.Header.Get("Authorization") != o.auth {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/base/")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if r.Method == http.MethodGet {
+			o.gets++
+		}
+		b, ok := o.files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, name, modTime, strings.NewReader(string(b)))
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		o.files[name] = b
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func setup(files map[string][]byte, options ...Option) (*origin, *FS, func()) {
+	o := newOrigin(files)
+	srv := httptest.NewServer(o)
+
+	fsys, err := New(srv.URL+"/base", options...)
+	if err != nil {
+		panic(err)
+	}
+	return o, fsys, srv.Close
+}
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt":          []byte("hello"),
+		"dir/b.txt":      []byte("world"),
+		"dir/sub/c.json": []byte(`{"Name":"John Doak"}`),
+		"empty":          {},
+	}
+	_, fsys, closer := setup(files)
+	defer closer()
+
+	fstesting.Run(t, fsys, files, fstesting.NoDirs())
+}
+
+func TestStat(t *testing.T) {
+	_, fsys, closer := setup(map[string][]byte{"dir/file": []byte("content")})
+	defer closer()
+
+	fi, err := fsys.Stat("dir/file")
+	if err != nil {
+		t.Fatalf("TestStat: got err == %s, want err == nil", err)
+	}
+	if fi.Name() != "file" || fi.Size() != 7 || !fi.ModTime().Equal(modTime) {
+		t.Errorf("TestStat: got Name() %q, Size() %d, ModTime() %v, want %q, 7, %v", fi.Name(), fi.Size(), fi.ModTime(), "file", modTime)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	o, fsys, closer := setup(map[string][]byte{"file": []byte("content")}, WithHeader("Authorization", "Bearer token"))
+	defer closer()
+	o.auth = "Bearer token"
+
+	if _, err := fsys.ReadFile("file"); err != nil {
+		t.Errorf("TestErrors(with auth header): got err == %s, want err == nil", err)
+	}
+
+	tests := []struct {
+		desc string
+		fn   func() error
+		want error
+	}{
+		{
+			desc: "ReadFile missing file",
+			fn:   func() error { _, err := fsys.ReadFile("nope"); return err },
+			want: fs.ErrNotExist,
+		},
+		{
+			desc: "Stat missing file",
+			fn:   func() error { _, err := fsys.Stat("nope"); return err },
+			want: fs.ErrNotExist,
+		},
+		{
+			desc: "Open invalid path",
+			fn:   func() error { _, err := fsys.Open("../file"); return err },
+			want: fs.ErrInvalid,
+		},
+		{
+			desc: "WriteFile without WithPut",
+			fn:   func() error { return fsys.WriteFile("file", []byte("new"), 0644) },
+			want: errors.ErrUnsupported,
+		},
+		{
+			desc: "OpenFile for writing without WithPut",
+			fn:   func() error { _, err := fsys.OpenFile("file", 0644, WithFlags(os.O_WRONLY)); return err },
+			want: errors.ErrUnsupported,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.fn()
+		if !errors.Is(err, test.want) {
+			t.Errorf("TestErrors(%s): got err == %v, want %v", test.desc, err, test.want)
+		}
+		var pe *fs.PathError
+		if !errors.As(err, &pe) {
+			t.Errorf("TestErrors(%s): got err of type %T, want *fs.PathError", test.desc, err)
+		}
+	}
+
+	o.auth = "something else"
+	if _, err := fsys.ReadFile("file"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("TestErrors(wrong auth header): got err == %v, want fs.ErrPermission", err)
+	}
+}
+
+func TestPut(t *testing.T) {
+	o, fsys, closer := setup(nil, WithPut())
+	defer closer()
+
+	if err := fsys.WriteFile("dir/file", []byte("hello"), 0644); err != nil {
+		t.Fatalf("TestPut(WriteFile): got err == %s, want err == nil", err)
+	}
+	if got := string(o.files["dir/file"]); got != "hello" {
+		t.Errorf("TestPut(WriteFile): origin has %q, want %q", got, "hello")
+	}
+
+	f, err := fsys.OpenFile("other", 0644, WithFlags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestPut(OpenFile): got err == %s, want err == nil", err)
+	}
+	if _, err := io.WriteString(f.(io.Writer), "world"); err != nil {
+		t.Fatalf("TestPut(Write): got err == %s, want err == nil", err)
+	}
+	if _, ok := o.files["other"]; ok {
+		t.Errorf("TestPut(before Close): file was written before Close()")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("TestPut(Close): got err == %s, want err == nil", err)
+	}
+
+	b, err := fsys.ReadFile("other")
+	if err != nil {
+		t.Fatalf("TestPut(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "world" {
+		t.Errorf("TestPut(ReadFile): got %q, want %q", b, "world")
+	}
+}
+
+func TestCache(t *testing.T) {
+	o, origin, closer := setup(map[string][]byte{"file": []byte("content")})
+	defer closer()
+
+	c, err := cache.New(simple.New(), origin)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		b, err := c.ReadFile("file")
+		if err != nil {
+			t.Fatalf("TestCache(ReadFile): got err == %s, want err == nil", err)
+		}
+		if string(b) != "content" {
+			t.Fatalf("TestCache(ReadFile): got %q, want %q", b, "content")
+		}
+		// Wait for the cache fill from the first read.
+		c.Wait()
+	}
+
+	if o.gets != 1 {
+		t.Errorf("TestCache: got %d GETs to the origin, want 1", o.gets)
+	}
+	if _, err := c.ReadFile("nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestCache(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
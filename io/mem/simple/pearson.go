@@ -24,6 +24,13 @@ var lookupTable = [...]uint8{
 	43, 119, 224, 71, 122, 142, 42, 160, 104, 48, 247, 103, 15, 11, 138, 239, // 16
 }
 
+// pearsonHasher is the Hasher used by WithPearson().
+type pearsonHasher struct{}
+
+func (pearsonHasher) Hash(path string) uint64 {
+	return uint64(pearson([]byte(path)))
+}
+
 func pearson(origin []byte) uint8 {
 	var h uint8
 
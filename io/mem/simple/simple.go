@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
@@ -26,63 +27,117 @@ type FS struct {
 	writeMu sync.Mutex
 	ro      bool
 
-	pearson bool
-	cache   []*file
-	items   int
+	hasher     Hasher
+	cache      [][]lookupEntry
+	items      int
+	copyOnRead bool
+
+	// maxTotalBytes is set by WithMaxTotalBytes(). It is 0 if there is no limit.
+	maxTotalBytes int64
+	// totalBytes is the size of the content of all files. It is protected by writeMu.
+	totalBytes int64
 }
 
+// ErrMaxTotalBytes is wrapped by the error returned when a write would make the content
+// stored in the FS larger than the size set with WithMaxTotalBytes().
+var ErrMaxTotalBytes = errors.New("write exceeds max total bytes")
+
 // SimpleOption provides an optional argument to NewSimple().
 type SimpleOption func(s *FS)
 
+// WithMaxTotalBytes limits the total size of the content of all files in the FS to n bytes.
+// A WriteFile(), Truncate() or WRFile.Close() that would go over the limit returns an error
+// wrapping ErrMaxTotalBytes and leaves the FS unchanged. Content written to a file opened
+// with OpenFile() is checked when the file is closed. Removing files frees their space.
+// This allows safely using an FS as the destination of a Merge() from an untrusted source.
+// If n <= 0, there is no limit.
+func WithMaxTotalBytes(n int64) SimpleOption {
+	return func(s *FS) {
+		if n > 0 {
+			s.maxTotalBytes = n
+		}
+	}
+}
+
+// Hasher hashes a file path to a bucket in the lookup cache created by RO(). See WithHasher().
+type Hasher interface {
+	// Hash returns the bucket for path. Buckets larger than the number of buckets in the
+	// cache are wrapped around.
+	Hash(path string) (bucket uint64)
+}
+
 // WithPearson will create a lookup cache using Pearson hashing to make lookups actually happen
 // at O(1) (after the hash calc) instead of walking the file system tree after various strings
-// splits. When using this, realize that you MUST be using ASCII characters.
+// splits. When using this, realize that you MUST be using ASCII characters. Pearson hashing
+// only has 256 buckets, so large filesystems should use WithHasher() instead.
 func WithPearson() SimpleOption {
+	return WithHasher(pearsonHasher{})
+}
+
+// WithHasher is like WithPearson(), but uses h to create the lookup cache. This allows using
+// hashes such as FNV or xxhash that support non-ASCII paths and have fewer collisions.
+// Paths that hash to the same bucket are chained in the bucket.
+func WithHasher(h Hasher) SimpleOption {
+	return func(s *FS) {
+		s.hasher = h
+	}
+}
+
+// WithCopyOnRead causes ReadFile() to return a copy of the file's content instead of the
+// stored slice. This prevents callers from modifying the content stored in the FS, at the
+// cost of an allocation and copy on every ReadFile() call.
+func WithCopyOnRead() SimpleOption {
 	return func(s *FS) {
-		s.pearson = true
+		s.copyOnRead = true
 	}
 }
 
 // New is the constructor for Simple.
 func New(options ...SimpleOption) *FS {
-	return &FS{root: &file{name: ".", time: time.Now(), isDir: true}}
+	s := &FS{root: &file{name: ".", time: time.Now(), isDir: true}}
+	for _, o := range options {
+		o(s)
+	}
+	return s
 }
 
-// Open implements fs.FS.Open().
+// Open implements fs.FS.Open(). If there is an error, it will be of type *fs.PathError.
 func (s *FS) Open(name string) (fs.File, error) {
 	if name == "/" || name == "" || name == "." {
-		return s.root, nil
+		return s.root.getCopy(), nil
 	}
+	fullName := name
 
 	name = strings.TrimPrefix(name, ".")
 	name = strings.TrimPrefix(name, "/")
 
 	sp := strings.Split(name, "/")
 
-	if s.pearson && s.ro {
-		h := pearson([]byte(name))
-		i := int(h) % (len(s.cache) + 1)
-		if i >= len(s.cache) {
-			return nil, fs.ErrNotExist
+	if s.hasher != nil && s.ro && s.cache != nil {
+		// Directories are not stored in the cache, so misses fall back to walking the tree.
+		for _, e := range s.cache[s.hasher.Hash(name)%uint64(len(s.cache))] {
+			if e.path == name {
+				return e.file.getCopy(), nil
+			}
 		}
-		return s.cache[i].getCopy(), nil
 	}
 
 	dir := s.root
 	for _, p := range sp {
 		f, err := dir.Search(p)
 		if err != nil {
-			return nil, err
+			return nil, &fs.PathError{Op: "open", Path: fullName, Err: err}
 		}
 		dir = f
 	}
 	return dir.getCopy(), nil
 }
 
+// ReadDir implements fs.ReadDirFS.ReadDir(). If there is an error, it will be of type *fs.PathError.
 func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
 	dir, err := s.findDir(name)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
 	}
 	return dir.objects, nil
 }
@@ -101,6 +156,25 @@ func (s *FS) MkdirAll(path string, perm fs.FileMode) error {
 	return nil
 }
 
+// findFile returns the stored file at name. Unlike Open(), this is not a copy.
+func (s *FS) findFile(name string) (*file, error) {
+	name = strings.TrimPrefix(name, ".")
+	name = strings.TrimPrefix(name, "/")
+
+	dir := s.root
+	for _, p := range strings.Split(name, "/") {
+		f, err := dir.Search(p)
+		if err != nil {
+			return nil, err
+		}
+		dir = f
+	}
+	if dir.isDir {
+		return nil, fmt.Errorf("name(%s) is a directory", name)
+	}
+	return dir, nil
+}
+
 func (s *FS) findDir(name string) (*file, error) {
 	switch name {
 	case ".", "", "/":
@@ -124,7 +198,7 @@ func (s *FS) findDir(name string) (*file, error) {
 		dir = f
 	}
 	if !dir.isDir {
-		return nil, fmt.Errorf("path(%s) is not a directory", name)
+		return nil, errors.New("not a directory")
 	}
 
 	return dir, nil
@@ -132,7 +206,8 @@ func (s *FS) findDir(name string) (*file, error) {
 
 // ReadFile implememnts ReadFileFS.ReadFile(). The slice returned by ReadFile is not
 // a copy of the file's contents like Open().File.Read() returns. Modifying it will
-// modifiy the content so BE CAREFUL.
+// modifiy the content so BE CAREFUL. Use WithCopyOnRead() if callers may modify the result.
+// If there is an error, it will be of type *fs.PathError.
 func (s *FS) ReadFile(name string) ([]byte, error) {
 	f, err := s.Open(name)
 	if err != nil {
@@ -140,12 +215,28 @@ func (s *FS) ReadFile(name string) ([]byte, error) {
 	}
 	r := f.(*file)
 	if r.IsDir() {
-		return nil, errors.New("cannot read a directory")
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("cannot read a directory")}
+	}
+	if s.copyOnRead {
+		b := make([]byte, len(r.content))
+		copy(b, r.content)
+		return b, nil
 	}
 	return r.content, nil
 }
 
-// Stat implements fs.StatFS.Stat().
+// ContentType implements jsfs.ContentTyper.ContentType(). The content type is sniffed from the
+// file's content with http.DetectContentType(), the extension of name is not used.
+// If there is an error, it will be of type *fs.PathError.
+func (s *FS) ContentType(name string) (string, error) {
+	b, err := s.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(b), nil
+}
+
+// Stat implements fs.StatFS.Stat(). If there is an error, it will be of type *fs.PathError.
 func (s *FS) Stat(name string) (fs.FileInfo, error) {
 	f, err := s.Open(name)
 	if err == nil {
@@ -153,7 +244,7 @@ func (s *FS) Stat(name string) (fs.FileInfo, error) {
 	}
 	d, err := s.findDir(name)
 	if err != nil {
-		return nil, fs.ErrNotExist
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
 	}
 	return d.Info()
 }
@@ -199,10 +290,10 @@ func (s *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 		return s.Open(name)
 	}
 	if s.ro {
-		return nil, fmt.Errorf("in RO mode")
+		return nil, fmt.Errorf("in RO mode: %w", jsfs.ErrReadOnly)
 	}
 	if !isFlagSet(opts.flags, os.O_WRONLY) {
-		return nil, fmt.Errorf("only support O_RDONLY and O_WRONLY")
+		return nil, fmt.Errorf("only support O_RDONLY and O_WRONLY: %w", jsfs.ErrUnsupportedFlag)
 	}
 
 	// The file already exists.
@@ -218,24 +309,34 @@ func (s *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 			return nil, fs.ErrExist
 		}
 		if isFlagSet(opts.flags, os.O_TRUNC) {
-			return nil, fmt.Errorf("Simple only supports writing when a file exists if O_TRUNC set")
+			return nil, fmt.Errorf("Simple only supports writing when a file exists if O_TRUNC set: %w", jsfs.ErrUnsupportedFlag)
 		}
-		return &WRFile{f: f.(*file)}, nil
+		return s.wrFile(name)
 	}
 
 	if !isFlagSet(opts.flags, os.O_CREATE) {
 		return nil, fs.ErrNotExist
 	}
 
-	if err := s.WriteFile(name, []byte{}, 0660); err != nil {
+	if err := s.WriteFile(name, []byte{}, perms); err != nil {
 		return nil, err
 	}
 
-	f, err := s.Open(name)
+	wr, err := s.wrFile(name)
 	if err != nil {
 		return nil, fmt.Errorf("bug: we just wrote a file(%s) and then couldn't open it: %s", name, err)
 	}
-	return &WRFile{f: f.(*file)}, nil
+	return wr, nil
+}
+
+// wrFile returns a WRFile that writes to the stored file at name. Open() cannot be used
+// as it returns a copy of the file.
+func (s *FS) wrFile(name string) (*WRFile, error) {
+	f, err := s.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &WRFile{fs: s, f: f}, nil
 }
 
 func isFlagSet(flags int, flag int) bool {
@@ -243,10 +344,11 @@ func isFlagSet(flags int, flag int) bool {
 }
 
 // WriteFile implememnts Writer. The content reference is copied, so modifying the original will
-// modify it here. perm is ignored. WriteFile is not thread-safe.
+// modify it here. perm's permission bits are reported by Stat(), defaulting to 0444 if
+// they are not set. WriteFile is not thread-safe.
 func (s *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 	if s.ro {
-		return fmt.Errorf("Simple is locked from writing")
+		return fmt.Errorf("Simple is locked from writing: %w", jsfs.ErrReadOnly)
 	}
 	if name == "" {
 		panic("can't write a file at root")
@@ -262,6 +364,10 @@ func (s *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
 
+	if err := s.checkTotal(int64(len(content))); err != nil {
+		return &fs.PathError{Op: "WriteFile", Path: name, Err: err}
+	}
+
 	dir := s.root
 	sp := strings.Split(name, "/")
 	for i := 0; i < len(sp)-1; i++ {
@@ -276,7 +382,7 @@ func (s *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 			continue
 		}
 		if !f.isDir {
-			return fmt.Errorf("name(%s) contains element(%d)(%s) that is not a directory", name, i, sp[i])
+			return fmt.Errorf("name(%s) contains element(%d)(%s) that is %w", name, i, sp[i], jsfs.ErrNotDirectory)
 		}
 		dir = f
 	}
@@ -286,29 +392,117 @@ func (s *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
 		return fs.ErrExist
 	}
 
-	dir.addFile(&file{name: n, content: content, time: time.Now()})
+	dir.addFile(&file{name: n, content: content, time: time.Now(), mode: perm.Perm()})
 	s.items++
+	s.totalBytes += int64(len(content))
+
+	return nil
+}
+
+// Truncate changes the size of the file at name. If the file is made larger, it is padded
+// with zero bytes. If there is an error, it will be of type *fs.PathError.
+func (s *FS) Truncate(name string, size int64) error {
+	if s.ro {
+		return &fs.PathError{Op: "Truncate", Path: name, Err: fmt.Errorf("Simple is locked from writing: %w", jsfs.ErrReadOnly)}
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "Truncate", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	f, err := s.findFile(name)
+	if err != nil {
+		return &fs.PathError{Op: "Truncate", Path: name, Err: err}
+	}
+	delta := size - int64(len(f.content))
+	if err := s.checkTotal(delta); err != nil {
+		return &fs.PathError{Op: "Truncate", Path: name, Err: err}
+	}
+	s.totalBytes += delta
+	f.content = truncate(f.content, size)
+	f.time = time.Now()
+	return nil
+}
+
+// checkTotal returns an error if adding delta bytes to the FS would go over the size set
+// by WithMaxTotalBytes(). s.writeMu must be held.
+func (s *FS) checkTotal(delta int64) error {
+	if s.maxTotalBytes == 0 || delta <= 0 {
+		return nil
+	}
+	if s.totalBytes+delta > s.maxTotalBytes {
+		return fmt.Errorf("%d bytes stored + %d bytes > %d: %w", s.totalBytes, delta, s.maxTotalBytes, ErrMaxTotalBytes)
+	}
+	return nil
+}
+
+// truncate returns b resized to size. b is never modified, as the caller may hold a
+// reference to it from ReadFile().
+func truncate(b []byte, size int64) []byte {
+	if size <= int64(len(b)) {
+		return b[:size:size]
+	}
+	n := make([]byte, size)
+	copy(n, b)
+	return n
+}
+
+// Clear removes all files and directories from the FS so that it can be reused. It returns an
+// error if RO() has been called.
+func (s *FS) Clear() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.ro {
+		return fmt.Errorf("cannot Clear(): %w", jsfs.ErrReadOnly)
+	}
 
+	s.root = &file{name: ".", time: time.Now(), isDir: true}
+	s.items = 0
+	s.totalBytes = 0
+	s.cache = nil
 	return nil
 }
 
+// Clone returns a deep copy of the FS. The clone shares no file content with s, so changes to
+// either FS (or to content returned by ReadFile()) are not seen by the other. The clone keeps the
+// options of s but is writeable, even if RO() has been called on s.
+func (s *FS) Clone() *FS {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return &FS{
+		root:          s.root.clone(),
+		hasher:        s.hasher,
+		items:         s.items,
+		copyOnRead:    s.copyOnRead,
+		maxTotalBytes: s.maxTotalBytes,
+		totalBytes:    s.totalBytes,
+	}
+}
+
 // RO locks the file system from writing.
 func (s *FS) RO() {
 	s.ro = true
 
-	if s.pearson {
-		sl := make([]*file, s.items)
+	if s.hasher != nil {
+		buckets := len(lookupTable)
+		if s.items > buckets {
+			buckets = s.items
+		}
+		sl := make([][]lookupEntry, buckets)
 
 		fs.WalkDir(
 			s,
 			".",
 			func(path string, d fs.DirEntry, err error) error {
-				if d.IsDir() {
+				if err != nil || d.IsDir() {
 					return nil
 				}
-				h := pearson([]byte(path))
-				i := int(h) % (len(s.cache) + 1)
-				sl[i] = d.(*file)
+				h := s.hasher.Hash(path) % uint64(len(sl))
+				sl[h] = append(sl[h], lookupEntry{path: path, file: d.(*file)})
 				return nil
 			},
 		)
@@ -316,6 +510,12 @@ func (s *FS) RO() {
 	}
 }
 
+// lookupEntry is an entry in the cache created by WithPearson() or WithHasher().
+type lookupEntry struct {
+	path string
+	file *file
+}
+
 // Remove removes the named file or (empty) directory. If there is an error, it will be of type *PathError.
 func (s *FS) Remove(name string) error {
 	return s.remove(name, false)
@@ -339,14 +539,17 @@ func (s *FS) remove(name string, removeAll bool) error {
 
 	sp := strings.Split(name, "/")
 
-	if s.pearson && s.ro {
+	if s.hasher != nil && s.ro {
 		return &fs.PathError{
 			Op:   "Remove",
 			Path: name,
-			Err:  fmt.Errorf("read only filesystem set"),
+			Err:  jsfs.ErrReadOnly,
 		}
 	}
 
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	parent := s.root
 	var f *file
 	for i, p := range sp {
@@ -371,6 +574,8 @@ func (s *FS) remove(name string, removeAll bool) error {
 			if err := parent.remove(p, removeAll); err != nil {
 				return &fs.PathError{Op: "Remove", Path: name, Err: err}
 			}
+			s.totalBytes -= f.size()
+			return nil
 		}
 
 		// Only the last entry can be a file.
@@ -380,16 +585,23 @@ func (s *FS) remove(name string, removeAll bool) error {
 
 		parent = f
 	}
-	if err := parent.remove(name, removeAll); err != nil {
-		return &fs.PathError{Op: "Remove", Path: name, Err: err}
-	}
 	return nil
 }
 
-// WRFile provides an io.WriteCloser implementation.
+// WRFile provides an io.WriteCloser implementation. Writes are buffered in the WRFile and
+// are not visible to readers of the file until Close() is called, which replaces the file's
+// content with everything written. A WRFile can only be closed once. Writing to or closing
+// a closed WRFile returns an error wrapping fs.ErrClosed.
+//
+// A WRFile starts out empty. Like an os.File, Write() writes at the current offset, which
+// Seek() changes, overwriting any content there and growing the file as needed. Seeking
+// past the end and writing fills the gap with zero bytes.
 type WRFile struct {
 	content []byte
+	offset  int64
+	fs      *FS
 	f       *file
+	closed  bool
 }
 
 func (w *WRFile) Read(b []byte) (n int, err error) {
@@ -401,11 +613,72 @@ func (w *WRFile) Stat() (fs.FileInfo, error) {
 }
 
 func (w *WRFile) Write(b []byte) (n int, err error) {
-	w.content = append(w.content, b...)
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.f.name, Err: fs.ErrClosed}
+	}
+	end := w.offset + int64(len(b))
+	if end > int64(len(w.content)) {
+		// append() grows the capacity geometrically, so sequential writes are not quadratic.
+		w.content = append(w.content, make([]byte, end-int64(len(w.content)))...)
+	}
+	copy(w.content[w.offset:], b)
+	w.offset = end
 	return len(b), nil
 }
 
+// Seek implements io.Seeker. It sets the offset of the next Write(). io.SeekEnd is relative
+// to the content written so far.
+func (w *WRFile) Seek(offset int64, whence int) (int64, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "seek", Path: w.f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += w.offset
+	case io.SeekEnd:
+		offset += int64(len(w.content))
+	default:
+		return 0, fmt.Errorf("whence value was invalid(%d)", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("can't seek beyond start of file")
+	}
+	w.offset = offset
+	return w.offset, nil
+}
+
+// Truncate changes the size of the content that will be written on Close(). If the content
+// is made larger, it is padded with zero bytes. The offset is moved to size, so following
+// writes are appended after size.
+func (w *WRFile) Truncate(size int64) error {
+	if size < 0 {
+		return &fs.PathError{Op: "Truncate", Path: w.f.name, Err: fs.ErrInvalid}
+	}
+	if w.closed {
+		return &fs.PathError{Op: "Truncate", Path: w.f.name, Err: fs.ErrClosed}
+	}
+	w.content = truncate(w.content, size)
+	w.offset = size
+	return nil
+}
+
+// Close makes the content written visible to readers of the file.
 func (w *WRFile) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.f.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+
+	w.fs.writeMu.Lock()
+	defer w.fs.writeMu.Unlock()
+
+	delta := int64(len(w.content)) - int64(len(w.f.content))
+	if err := w.fs.checkTotal(delta); err != nil {
+		return &fs.PathError{Op: "close", Path: w.f.name, Err: err}
+	}
+	w.fs.totalBytes += delta
 	w.f.content = w.content
 	return nil
 }
@@ -416,8 +689,12 @@ type file struct {
 	offset  int64
 	time    time.Time
 	isDir   bool
+	// mode holds the permission bits the file was written with. If zero, fileMode is used.
+	mode fs.FileMode
 
 	objects []fs.DirEntry
+	// dirOffset is the index in objects of the next entry returned by ReadDir().
+	dirOffset int
 }
 
 func (f *file) getCopy() *file {
@@ -425,6 +702,37 @@ func (f *file) getCopy() *file {
 	return &n
 }
 
+// clone returns a copy of f with its content and any contained files copied. Unlike getCopy(),
+// the returned *file shares nothing with f.
+func (f *file) clone() *file {
+	n := &file{
+		name:  f.name,
+		time:  f.time,
+		isDir: f.isDir,
+		mode:  f.mode,
+	}
+	if f.content != nil {
+		n.content = make([]byte, len(f.content))
+		copy(n.content, f.content)
+	}
+	if f.objects != nil {
+		n.objects = make([]fs.DirEntry, 0, len(f.objects))
+		for _, o := range f.objects {
+			n.objects = append(n.objects, o.(*file).clone())
+		}
+	}
+	return n
+}
+
+// size returns the size of the content of f and any files it contains.
+func (f *file) size() int64 {
+	n := int64(len(f.content))
+	for _, o := range f.objects {
+		n += o.(*file).size()
+	}
+	return n
+}
+
 // createDir creates a new *file representing a dir inside this file (which must represent a dir).
 func (f *file) createDir(name string) {
 	if !f.isDir {
@@ -461,7 +769,7 @@ func (f *file) remove(name string, removeAll bool) error {
 	}
 
 	if !f.isDir {
-		return fmt.Errorf("not a directory")
+		return jsfs.ErrNotDirectory
 	}
 
 	x := sort.Search(
@@ -481,7 +789,7 @@ func (f *file) remove(name string, removeAll bool) error {
 
 	if removeAll {
 		if !found.isDir {
-			return fmt.Errorf("not a directory")
+			return jsfs.ErrNotDirectory
 		}
 	} else {
 		if found.isDir {
@@ -536,10 +844,22 @@ func (f *file) IsDir() bool {
 	return f.isDir
 }
 
+// fileMode is the mode of directories and of files that were written without permission bits.
 const fileMode fs.FileMode = 0444
 
+// perm returns the permission bits of the file.
+func (f *file) perm() fs.FileMode {
+	if f.mode == 0 {
+		return fileMode
+	}
+	return f.mode
+}
+
 func (f *file) Type() fs.FileMode {
-	return fileMode
+	if f.isDir {
+		return f.perm() | fs.ModeDir
+	}
+	return f.perm()
 }
 
 func (f *file) Info() (fs.FileInfo, error) {
@@ -553,6 +873,7 @@ func (f *file) Stat() (fs.FileInfo, error) {
 		size:  int64(len(f.content)),
 		time:  f.time,
 		isDir: f.isDir,
+		mode:  f.perm(),
 	}, nil
 }
 
@@ -597,6 +918,29 @@ func (f *file) Seek(offset int64, whence int) (int64, error) {
 	return 0, fmt.Errorf("whence value was invalid(%d)", whence)
 }
 
+// ReadDir implements fs.ReadDirFile.ReadDir(). Entries are returned in name order. If n > 0,
+// at most n entries are returned and io.EOF is returned once there are no more entries.
+// If n <= 0, all remaining entries are returned.
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: jsfs.ErrNotDirectory}
+	}
+
+	remaining := f.objects[f.dirOffset:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(remaining) {
+			remaining = remaining[:n]
+		}
+	}
+	f.dirOffset += len(remaining)
+
+	// Copy the entries so that the caller cannot change the directory.
+	return append([]fs.DirEntry(nil), remaining...), nil
+}
+
 // Close implememnts io.Closer.
 func (f *file) Close() error {
 	return nil
@@ -612,6 +956,7 @@ type fileInfo struct {
 	size  int64
 	time  time.Time
 	isDir bool
+	mode  fs.FileMode
 }
 
 func (f fileInfo) Name() string {
@@ -622,7 +967,10 @@ func (f fileInfo) Size() int64 {
 	return f.size
 }
 func (f fileInfo) Mode() fs.FileMode {
-	return fileMode
+	if f.isDir {
+		return f.mode | fs.ModeDir
+	}
+	return f.mode
 }
 func (f fileInfo) ModTime() time.Time {
 	return f.time
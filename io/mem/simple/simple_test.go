@@ -5,13 +5,18 @@ import (
 	"compress/gzip"
 	"crypto/md5"
 	"embed"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/fs"
 	"log"
+	"os"
+	"strings"
 	"testing"
 
 	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/fstesting"
 	"github.com/kylelemons/godebug/pretty"
 )
 
@@ -133,6 +138,98 @@ func TestTransform(t *testing.T) {
 	}
 }
 
+func TestMergeDryRun(t *testing.T) {
+	from := New()
+	for _, name := range []string{"js/app.js", "js/app_test.go", "css/site.css", "index.html"} {
+		if err := from.WriteFile(name, []byte(name), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	into := New()
+	if err := into.WriteFile("static/index.html", []byte("existing"), 0644); err != nil {
+		panic(err)
+	}
+
+	type action struct {
+		Action, Path string
+	}
+	var got []action
+	err := jsfs.Merge(
+		into,
+		from,
+		"/static/",
+		jsfs.WithTransform(
+			func(name string, content []byte) ([]byte, error) {
+				if strings.HasSuffix(name, ".go") {
+					return nil, nil
+				}
+				return content, nil
+			},
+		),
+		jsfs.WithDryRun(
+			func(a, p string) {
+				got = append(got, action{a, p})
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("TestMergeDryRun: got err == %s, want err == nil", err)
+	}
+
+	want := []action{
+		{jsfs.DryRunWrite, "static/css/site.css"},
+		{jsfs.DryRunConflict, "static/index.html"},
+		{jsfs.DryRunWrite, "static/js/app.js"},
+		{jsfs.DryRunSkip, "static/js/app_test.go"},
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestMergeDryRun: -want/+got:\n%s", diff)
+	}
+
+	files, err := jsfs.List(into, ".")
+	if err != nil {
+		panic(err)
+	}
+	if diff := pretty.Compare([]string{"static/index.html"}, files); diff != "" {
+		t.Errorf("TestMergeDryRun: destination was modified: -want/+got:\n%s", diff)
+	}
+	b, err := into.ReadFile("static/index.html")
+	if err != nil || string(b) != "existing" {
+		t.Errorf("TestMergeDryRun: existing file was modified: got %q, err == %v", b, err)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	transformErr := errors.New("bad content")
+	err := jsfs.Merge(
+		New(),
+		FSM,
+		"",
+		jsfs.WithTransform(
+			func(name string, content []byte) ([]byte, error) {
+				if name == "pearson.go" {
+					return nil, transformErr
+				}
+				return content, nil
+			},
+		),
+	)
+	if !errors.Is(err, transformErr) {
+		t.Errorf("TestMergeErrors(transform): got err == %v, want it to wrap %v", err, transformErr)
+	}
+	if err == nil || !strings.Contains(err.Error(), `"pearson.go"`) {
+		t.Errorf("TestMergeErrors(transform): got err == %v, want it to name pearson.go", err)
+	}
+
+	ro := New()
+	ro.RO()
+	err = jsfs.Merge(ro, FSM, "/dst/")
+	if err == nil || !strings.Contains(err.Error(), `"dst/`) {
+		t.Errorf("TestMergeErrors(write): got err == %v, want it to name the destination path", err)
+	}
+}
+
 func TestStat(t *testing.T) {
 	systems := []*FS{}
 
@@ -153,6 +250,498 @@ func TestStat(t *testing.T) {
 		if !stat.IsDir() {
 			t.Fatalf("TestStat: dir did not show as IsDir()")
 		}
+		if !stat.Mode().IsDir() {
+			t.Fatalf("TestStat: dir Mode() did not have fs.ModeDir set")
+		}
+
+		stat, err = system.Stat("/some/dir/file.txt")
+		if err != nil {
+			t.Fatalf("TestStat: could not Stat the file: %s", err)
+		}
+		if stat.Mode() != 0660 {
+			t.Fatalf("TestStat: file Mode(): got %v, want %v", stat.Mode(), fs.FileMode(0660))
+		}
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	mem := New()
+	mem.WriteFile("dir/file.txt", []byte("content"), 0660)
+
+	tests := []struct {
+		desc   string
+		call   func() error
+		wantOp string
+		wantIs error
+	}{
+		{
+			desc:   "Open missing file",
+			call:   func() error { _, err := mem.Open("dir/missing"); return err },
+			wantOp: "open",
+			wantIs: fs.ErrNotExist,
+		},
+		{
+			desc:   "ReadFile missing file",
+			call:   func() error { _, err := mem.ReadFile("dir/missing"); return err },
+			wantOp: "open",
+			wantIs: fs.ErrNotExist,
+		},
+		{
+			desc:   "ReadFile directory",
+			call:   func() error { _, err := mem.ReadFile("dir"); return err },
+			wantOp: "read",
+		},
+		{
+			desc:   "Stat missing file",
+			call:   func() error { _, err := mem.Stat("dir/missing"); return err },
+			wantOp: "stat",
+			wantIs: fs.ErrNotExist,
+		},
+		{
+			desc:   "ReadDir missing dir",
+			call:   func() error { _, err := mem.ReadDir("missing"); return err },
+			wantOp: "readdir",
+			wantIs: fs.ErrNotExist,
+		},
+		{
+			desc:   "ReadDir file",
+			call:   func() error { _, err := mem.ReadDir("dir/file.txt"); return err },
+			wantOp: "readdir",
+		},
+	}
+
+	for _, test := range tests {
+		err := test.call()
+		pe, ok := err.(*fs.PathError)
+		if !ok {
+			t.Errorf("TestPathErrors(%s): got err == %T(%v), want *fs.PathError", test.desc, err, err)
+			continue
+		}
+		if pe.Op != test.wantOp {
+			t.Errorf("TestPathErrors(%s): got Op == %q, want %q", test.desc, pe.Op, test.wantOp)
+		}
+		if pe.Path == "" {
+			t.Errorf("TestPathErrors(%s): got empty Path", test.desc)
+		}
+		if test.wantIs != nil && !errors.Is(err, test.wantIs) {
+			t.Errorf("TestPathErrors(%s): got err == %v, want it to wrap %v", test.desc, err, test.wantIs)
+		}
+	}
+}
+
+type fnvHasher struct{}
+
+func (fnvHasher) Hash(path string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return h.Sum64()
+}
+
+// constHasher puts every path in the same bucket.
+type constHasher struct{}
+
+func (constHasher) Hash(path string) uint64 {
+	return 7
+}
+
+func TestHasher(t *testing.T) {
+	files := map[string]string{
+		"música/canción.txt": "uno",
+		"日本/ファイル.txt":        "二",
+		"emoji/🐹.txt":        "gopher",
+		"ascii/file.txt":     "ascii",
+	}
+
+	tests := []struct {
+		desc   string
+		hasher Hasher
+	}{
+		{desc: "fnv", hasher: fnvHasher{}},
+		{desc: "all paths collide", hasher: constHasher{}},
+	}
+
+	for _, test := range tests {
+		mem := New(WithHasher(test.hasher))
+		for name, content := range files {
+			if err := mem.WriteFile(name, []byte(content), 0644); err != nil {
+				panic(err)
+			}
+		}
+		mem.RO()
+
+		for name, content := range files {
+			b, err := mem.ReadFile(name)
+			if err != nil {
+				t.Errorf("TestHasher(%s, %s): got err == %s, want err == nil", test.desc, name, err)
+				continue
+			}
+			if string(b) != content {
+				t.Errorf("TestHasher(%s, %s): got %q, want %q", test.desc, name, b, content)
+			}
+		}
+		if _, err := mem.ReadFile("música/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestHasher(%s, missing file): got err == %v, want fs.ErrNotExist", test.desc, err)
+		}
+		if _, err := mem.ReadDir("日本"); err != nil {
+			t.Errorf("TestHasher(%s, ReadDir): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	mem := New()
+	names := []string{"file.txt", "dir/file.txt", "dir/sub/file.txt"}
+	for _, name := range names {
+		if err := mem.WriteFile(name, []byte("content"), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := mem.Clear(); err != nil {
+		t.Fatalf("TestClear: got err == %s, want err == nil", err)
+	}
+
+	for _, name := range append(names, "dir", "dir/sub") {
+		if _, err := mem.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestClear(Stat(%s)): got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	for _, name := range names {
+		if _, err := mem.ReadFile(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestClear(ReadFile(%s)): got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	entries, err := mem.ReadDir(".")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("TestClear(ReadDir): got %d entries, err == %v, want 0 entries, err == nil", len(entries), err)
+	}
+
+	// The FS can be written to again.
+	if err := mem.WriteFile("dir/file.txt", []byte("new"), 0644); err != nil {
+		t.Errorf("TestClear(WriteFile after Clear): got err == %s, want err == nil", err)
+	}
+
+	mem.RO()
+	if err := mem.Clear(); err == nil {
+		t.Errorf("TestClear(RO): got err == nil, want err != nil")
+	}
+}
+
+func TestClone(t *testing.T) {
+	mem := New()
+	files := map[string]string{
+		"file.txt":         "hello",
+		"dir/file.txt":     "world",
+		"dir/sub/file.txt": "joshua tree",
+	}
+	for name, content := range files {
+		if err := mem.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	clone := mem.Clone()
+
+	// Mutate the original: change stored content in place (ReadFile() returns the stored slice)
+	// and add a new file.
+	for name := range files {
+		b, err := mem.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		b[0] = 'X'
+	}
+	if err := mem.WriteFile("dir/new.txt", []byte("new"), 0644); err != nil {
+		panic(err)
+	}
+
+	for name, want := range files {
+		got, err := clone.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestClone(ReadFile(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("TestClone(ReadFile(%s)): got %q, want %q", name, got, want)
+		}
+	}
+	if _, err := clone.Stat("dir/new.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestClone(Stat(dir/new.txt)): got err == %v, want fs.ErrNotExist", err)
+	}
+
+	// The clone is writeable even if the original is read only, and writes do not reach the original.
+	mem.RO()
+	clone = mem.Clone()
+	if err := clone.WriteFile("dir/clone.txt", []byte("clone"), 0644); err != nil {
+		t.Fatalf("TestClone(WriteFile to clone of RO FS): got err == %s, want err == nil", err)
+	}
+	if _, err := mem.Stat("dir/clone.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestClone(Stat(dir/clone.txt) on original): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	mem := New(WithMaxTotalBytes(10))
+
+	if err := mem.WriteFile("dir/a.txt", []byte("123456"), 0644); err != nil {
+		t.Fatalf("TestMaxTotalBytes(WriteFile under the limit): got err == %s, want err == nil", err)
+	}
+
+	// Writes that go over the limit fail and do not change the FS.
+	err := mem.WriteFile("other/b.txt", []byte("12345"), 0644)
+	if !errors.Is(err, ErrMaxTotalBytes) {
+		t.Errorf("TestMaxTotalBytes(WriteFile over the limit): got err == %v, want ErrMaxTotalBytes", err)
+	}
+	for _, name := range []string{"other/b.txt", "other"} {
+		if _, err := mem.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestMaxTotalBytes(Stat(%s) after failed WriteFile): got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if err := mem.Truncate("dir/a.txt", 11); !errors.Is(err, ErrMaxTotalBytes) {
+		t.Errorf("TestMaxTotalBytes(Truncate over the limit): got err == %v, want ErrMaxTotalBytes", err)
+	}
+
+	f, err := mem.OpenFile("dir/a.txt", 0644, Flags(os.O_WRONLY))
+	if err != nil {
+		t.Fatalf("TestMaxTotalBytes(OpenFile): got err == %s, want err == nil", err)
+	}
+	if _, err := f.(io.Writer).Write([]byte("12345678901")); err != nil {
+		t.Fatalf("TestMaxTotalBytes(Write): got err == %s, want err == nil", err)
+	}
+	if err := f.Close(); !errors.Is(err, ErrMaxTotalBytes) {
+		t.Errorf("TestMaxTotalBytes(Close over the limit): got err == %v, want ErrMaxTotalBytes", err)
+	}
+	if got := string(mustRead(mem, "dir/a.txt")); got != "123456" {
+		t.Errorf("TestMaxTotalBytes(content after failed writes): got %q, want %q", got, "123456")
+	}
+
+	// Writes up to the limit succeed, and replacing content only counts the difference.
+	if err := mem.WriteFile("dir/b.txt", []byte("1234"), 0644); err != nil {
+		t.Errorf("TestMaxTotalBytes(WriteFile to the limit): got err == %s, want err == nil", err)
+	}
+	if err := mem.Truncate("dir/a.txt", 2); err != nil {
+		t.Errorf("TestMaxTotalBytes(Truncate smaller): got err == %s, want err == nil", err)
+	}
+	if err := mem.WriteFile("dir/c.txt", []byte("1234"), 0644); err != nil {
+		t.Errorf("TestMaxTotalBytes(WriteFile after Truncate): got err == %s, want err == nil", err)
+	}
+
+	// Removing files frees space.
+	if err := mem.WriteFile("d.txt", []byte("1"), 0644); !errors.Is(err, ErrMaxTotalBytes) {
+		t.Errorf("TestMaxTotalBytes(WriteFile when full): got err == %v, want ErrMaxTotalBytes", err)
+	}
+	if err := mem.Remove("dir/b.txt"); err != nil {
+		t.Fatalf("TestMaxTotalBytes(Remove): got err == %s, want err == nil", err)
+	}
+	if err := mem.WriteFile("d.txt", []byte("1234"), 0644); err != nil {
+		t.Errorf("TestMaxTotalBytes(WriteFile after Remove): got err == %s, want err == nil", err)
+	}
+	if err := mem.RemoveAll("dir"); err != nil {
+		t.Fatalf("TestMaxTotalBytes(RemoveAll): got err == %s, want err == nil", err)
+	}
+	if err := mem.WriteFile("e.txt", []byte("123456"), 0644); err != nil {
+		t.Errorf("TestMaxTotalBytes(WriteFile after RemoveAll): got err == %s, want err == nil", err)
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	mem := New()
+	if err := mem.WriteFile("dir/file.txt", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	ro := New()
+	if err := ro.WriteFile("file.txt", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	ro.RO()
+
+	tests := []struct {
+		desc string
+		fn   func() error
+		want error
+	}{
+		{
+			desc: "WriteFile after RO()",
+			fn:   func() error { return ro.WriteFile("new.txt", []byte("new"), 0644) },
+			want: jsfs.ErrReadOnly,
+		},
+		{
+			desc: "OpenFile for writing after RO()",
+			fn:   func() error { _, err := ro.OpenFile("new.txt", 0644, Flags(os.O_WRONLY|os.O_CREATE)); return err },
+			want: jsfs.ErrReadOnly,
+		},
+		{
+			desc: "Clear after RO()",
+			fn:   func() error { return ro.Clear() },
+			want: jsfs.ErrReadOnly,
+		},
+		{
+			desc: "OpenFile with O_RDWR",
+			fn:   func() error { _, err := mem.OpenFile("dir/file.txt", 0644, Flags(os.O_RDWR)); return err },
+			want: jsfs.ErrUnsupportedFlag,
+		},
+		{
+			desc: "WriteFile under a file",
+			fn:   func() error { return mem.WriteFile("dir/file.txt/other.txt", []byte("new"), 0644) },
+			want: jsfs.ErrNotDirectory,
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.fn(); !errors.Is(err, test.want) {
+			t.Errorf("TestErrorsIs(%s): got err == %v, want %v", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	mem := New()
+	if err := mem.WriteFile("private.txt", []byte("content"), 0600); err != nil {
+		panic(err)
+	}
+	if err := mem.WriteFile("default.txt", []byte("content"), 0); err != nil {
+		panic(err)
+	}
+	f, err := mem.OpenFile("created.txt", 0600, Flags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name string
+		want fs.FileMode
+	}{
+		{name: "private.txt", want: 0600},
+		{name: "default.txt", want: fileMode},
+		{name: "created.txt", want: 0600},
+	}
+
+	for _, test := range tests {
+		stat, err := mem.Stat(test.name)
+		if err != nil {
+			t.Fatalf("TestFileMode(%s): Stat() error: %s", test.name, err)
+		}
+		if stat.Mode().Perm() != test.want {
+			t.Errorf("TestFileMode(%s): got %v, want %v", test.name, stat.Mode().Perm(), test.want)
+		}
+		if !stat.Mode().IsRegular() {
+			t.Errorf("TestFileMode(%s): Mode() was not regular: %v", test.name, stat.Mode())
+		}
+	}
+}
+
+func TestCopyOnRead(t *testing.T) {
+	const content = "joshua tree"
+
+	tests := []struct {
+		desc      string
+		options   []SimpleOption
+		wantAlias bool
+	}{
+		{desc: "default returns stored content", wantAlias: true},
+		{desc: "WithCopyOnRead returns a copy", options: []SimpleOption{WithCopyOnRead()}},
+		{desc: "WithCopyOnRead and WithPearson returns a copy", options: []SimpleOption{WithCopyOnRead(), WithPearson()}},
+	}
+
+	for _, test := range tests {
+		mem := New(test.options...)
+		if err := mem.WriteFile("dir/file.txt", []byte(content), 0660); err != nil {
+			t.Fatalf("TestCopyOnRead(%s): WriteFile got err == %s, want err == nil", test.desc, err)
+		}
+		mem.RO()
+
+		b, err := mem.ReadFile("dir/file.txt")
+		if err != nil {
+			t.Fatalf("TestCopyOnRead(%s): ReadFile got err == %s, want err == nil", test.desc, err)
+		}
+		b[0] = 'X'
+
+		got := string(mustRead(mem, "dir/file.txt"))
+		if test.wantAlias {
+			if got == content {
+				t.Errorf("TestCopyOnRead(%s): modifying ReadFile result did not change stored content", test.desc)
+			}
+			continue
+		}
+		if got != content {
+			t.Errorf("TestCopyOnRead(%s): got stored content %q, want %q", test.desc, got, content)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		desc string
+		size int64
+		want string
+	}{
+		{desc: "shrink", size: 6, want: "joshua"},
+		{desc: "grow", size: 14, want: "joshua tree\x00\x00\x00"},
+		{desc: "zero", size: 0, want: ""},
+	}
+
+	for _, test := range tests {
+		mem := New()
+		if err := mem.WriteFile("dir/file.txt", []byte("joshua tree"), 0660); err != nil {
+			t.Fatalf("TestTruncate(%s): WriteFile got err == %s, want err == nil", test.desc, err)
+		}
+		if err := mem.Truncate("dir/file.txt", test.size); err != nil {
+			t.Errorf("TestTruncate(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got := string(mustRead(mem, "dir/file.txt")); got != test.want {
+			t.Errorf("TestTruncate(%s): got content %q, want %q", test.desc, got, test.want)
+		}
+		fi, err := mem.Stat("dir/file.txt")
+		if err != nil {
+			t.Fatalf("TestTruncate(%s): Stat got err == %s, want err == nil", test.desc, err)
+		}
+		if fi.Size() != test.size {
+			t.Errorf("TestTruncate(%s): got Stat().Size() %d, want %d", test.desc, fi.Size(), test.size)
+		}
+
+		// Same test via the writable file handle.
+		f, err := mem.OpenFile("dir/other.txt", 0660, Flags(os.O_WRONLY|os.O_CREATE))
+		if err != nil {
+			t.Fatalf("TestTruncate(%s): OpenFile got err == %s, want err == nil", test.desc, err)
+		}
+		wr := f.(*WRFile)
+		if _, err := wr.Write([]byte("joshua tree")); err != nil {
+			t.Fatalf("TestTruncate(%s): Write got err == %s, want err == nil", test.desc, err)
+		}
+		if err := wr.Truncate(test.size); err != nil {
+			t.Errorf("TestTruncate(%s): WRFile.Truncate got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatalf("TestTruncate(%s): Close got err == %s, want err == nil", test.desc, err)
+		}
+		if got := string(mustRead(mem, "dir/other.txt")); got != test.want {
+			t.Errorf("TestTruncate(%s): WRFile got content %q, want %q", test.desc, got, test.want)
+		}
+		fi, err = mem.Stat("dir/other.txt")
+		if err != nil {
+			t.Fatalf("TestTruncate(%s): Stat got err == %s, want err == nil", test.desc, err)
+		}
+		if fi.Size() != test.size {
+			t.Errorf("TestTruncate(%s): WRFile got Stat().Size() %d, want %d", test.desc, fi.Size(), test.size)
+		}
+	}
+
+	mem := New()
+	if err := mem.WriteFile("file.txt", []byte("content"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Truncate("file.txt", -1); err == nil {
+		t.Errorf("TestTruncate(negative size): got err == nil, want err != nil")
+	}
+	if err := mem.Truncate("missing.txt", 1); err == nil {
+		t.Errorf("TestTruncate(missing file): got err == nil, want err != nil")
+	}
+	mem.RO()
+	if err := mem.Truncate("file.txt", 1); err == nil {
+		t.Errorf("TestTruncate(RO): got err == nil, want err != nil")
 	}
 }
 
@@ -197,3 +786,385 @@ func TestSeek(t *testing.T) {
 		t.Fatalf("TestSeek: got string %q, want 'lo world'", string(b))
 	}
 }
+
+func TestList(t *testing.T) {
+	mem := New()
+	mem.WriteFile("/where/the/streets/have/no/name/u2.txt", []byte("joshua tree"), 0660)
+
+	if err := jsfs.Merge(mem, FSM, "/songs/"); err != nil {
+		panic(err)
+	}
+	mem.RO()
+
+	tests := []struct {
+		desc     string
+		root     string
+		wantFile []string
+		wantDir  []string
+	}{
+		{
+			desc: "from root",
+			root: ".",
+			wantFile: []string{
+				"songs/pearson.go",
+				"songs/simple.go",
+				"where/the/streets/have/no/name/u2.txt",
+			},
+			wantDir: []string{
+				"songs",
+				"where",
+				"where/the",
+				"where/the/streets",
+				"where/the/streets/have",
+				"where/the/streets/have/no",
+				"where/the/streets/have/no/name",
+			},
+		},
+		{
+			desc:     "from sub-directory",
+			root:     "where/the/streets",
+			wantFile: []string{"have/no/name/u2.txt"},
+			wantDir:  []string{"have", "have/no", "have/no/name"},
+		},
+		{
+			desc:     "directory with no sub-directories",
+			root:     "songs",
+			wantFile: []string{"pearson.go", "simple.go"},
+			wantDir:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		gotFile, err := jsfs.List(mem, test.root)
+		if err != nil {
+			t.Errorf("TestList(%s): List() got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.wantFile, gotFile); diff != "" {
+			t.Errorf("TestList(%s): List() -want/+got:\n%s", test.desc, diff)
+		}
+
+		gotDir, err := jsfs.ListDirs(mem, test.root)
+		if err != nil {
+			t.Errorf("TestList(%s): ListDirs() got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.wantDir, gotDir); diff != "" {
+			t.Errorf("TestList(%s): ListDirs() -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	if _, err := jsfs.List(mem, "does/not/exist"); err == nil {
+		t.Errorf("TestList(non-existent root): got err == nil, want err != nil")
+	}
+}
+
+var conformanceFiles = map[string][]byte{
+	"root.txt":                []byte("hello world"),
+	"dir/file.txt":            []byte("joshua tree"),
+	"dir/sub/other.txt":       []byte("the unforgettable fire"),
+	"dir/sub/deeper/last.txt": []byte("war"),
+}
+
+func TestConformance(t *testing.T) {
+	mem := New()
+	for name, content := range conformanceFiles {
+		if err := mem.WriteFile(name, content, 0644); err != nil {
+			panic(err)
+		}
+	}
+	fstesting.Run(
+		t,
+		mem,
+		conformanceFiles,
+		fstesting.Skip("file modes and invalid paths do not follow the fs.FS contract", fstesting.CheckTestFS),
+	)
+}
+
+func TestWRFileClose(t *testing.T) {
+	mem := New()
+
+	f, err := mem.OpenFile("dir/file", 0660, Flags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestWRFileClose(OpenFile): got err == %s, want err == nil", err)
+	}
+	w := f.(*WRFile)
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatalf("TestWRFileClose(Write): got err == %s, want err == nil", err)
+	}
+	if got := string(mustRead(mem, "dir/file")); got != "" {
+		t.Errorf("TestWRFileClose(before Close): got content %q, want %q", got, "")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("TestWRFileClose(Close): got err == %s, want err == nil", err)
+	}
+	if got := string(mustRead(mem, "dir/file")); got != "first" {
+		t.Errorf("TestWRFileClose(after Close): got content %q, want %q", got, "first")
+	}
+
+	// Another writer changes the file, which a second Close() of the first writer must not undo.
+	f2, err := mem.OpenFile("dir/file", 0660, Flags(os.O_WRONLY))
+	if err != nil {
+		t.Fatalf("TestWRFileClose(OpenFile second writer): got err == %s, want err == nil", err)
+	}
+	if _, err := f2.(*WRFile).Write([]byte("second")); err != nil {
+		t.Fatalf("TestWRFileClose(Write second writer): got err == %s, want err == nil", err)
+	}
+	if err := f2.Close(); err != nil {
+		t.Fatalf("TestWRFileClose(Close second writer): got err == %s, want err == nil", err)
+	}
+
+	if err := w.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("TestWRFileClose(second Close): got err == %v, want fs.ErrClosed", err)
+	}
+	if _, err := w.Write([]byte("late")); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("TestWRFileClose(Write after Close): got err == %v, want fs.ErrClosed", err)
+	}
+	if err := w.Truncate(0); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("TestWRFileClose(Truncate after Close): got err == %v, want fs.ErrClosed", err)
+	}
+	if got := string(mustRead(mem, "dir/file")); got != "second" {
+		t.Errorf("TestWRFileClose(after second Close): got content %q, want %q", got, "second")
+	}
+}
+
+func TestWRFileSeek(t *testing.T) {
+	tests := []struct {
+		desc string
+		ops  func(w *WRFile) error
+		want string
+	}{
+		{
+			desc: "overwrite the middle",
+			ops: func(w *WRFile) error {
+				if _, err := w.Write([]byte("hello world")); err != nil {
+					return err
+				}
+				if _, err := w.Seek(6, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte("WORLD"))
+				return err
+			},
+			want: "hello WORLD",
+		},
+		{
+			desc: "overwrite past the end grows the file",
+			ops: func(w *WRFile) error {
+				if _, err := w.Write([]byte("hello")); err != nil {
+					return err
+				}
+				if _, err := w.Seek(-2, io.SeekEnd); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte("p me"))
+				return err
+			},
+			want: "help me",
+		},
+		{
+			desc: "seek relative to the current offset",
+			ops: func(w *WRFile) error {
+				if _, err := w.Write([]byte("abcdef")); err != nil {
+					return err
+				}
+				if _, err := w.Seek(-4, io.SeekCurrent); err != nil {
+					return err
+				}
+				if _, err := w.Write([]byte("X")); err != nil {
+					return err
+				}
+				if _, err := w.Seek(1, io.SeekCurrent); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte("Y"))
+				return err
+			},
+			want: "abXdYf",
+		},
+		{
+			desc: "seek past the end fills with zeros",
+			ops: func(w *WRFile) error {
+				if _, err := w.Write([]byte("ab")); err != nil {
+					return err
+				}
+				if _, err := w.Seek(4, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte("cd"))
+				return err
+			},
+			want: "ab\x00\x00cd",
+		},
+	}
+
+	for _, test := range tests {
+		mem := New()
+		f, err := mem.OpenFile("file", 0660, Flags(os.O_WRONLY|os.O_CREATE))
+		if err != nil {
+			t.Fatalf("TestWRFileSeek(%s): OpenFile got err == %s, want err == nil", test.desc, err)
+		}
+		w := f.(*WRFile)
+		if err := test.ops(w); err != nil {
+			t.Errorf("TestWRFileSeek(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("TestWRFileSeek(%s): Close got err == %s, want err == nil", test.desc, err)
+		}
+		if got := string(mustRead(mem, "file")); got != test.want {
+			t.Errorf("TestWRFileSeek(%s): got content %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	mem := New()
+	f, err := mem.OpenFile("file", 0660, Flags(os.O_WRONLY|os.O_CREATE))
+	if err != nil {
+		t.Fatalf("TestWRFileSeek(negative offset): OpenFile got err == %s, want err == nil", err)
+	}
+	if _, err := f.(*WRFile).Seek(-1, io.SeekStart); err == nil {
+		t.Errorf("TestWRFileSeek(negative offset): got err == nil, want err != nil")
+	}
+}
+
+func TestReadDirFile(t *testing.T) {
+	mem := New()
+	for _, name := range []string{"dir/a", "dir/b", "dir/c", "dir/sub/d", "file"} {
+		if err := mem.WriteFile(name, []byte("content"), 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	tests := []struct {
+		desc  string
+		name  string
+		n     int
+		pages [][]string
+	}{
+		{desc: "n == 2", name: "dir", n: 2, pages: [][]string{{"a", "b"}, {"c", "sub"}}},
+		{desc: "n == 3", name: "dir", n: 3, pages: [][]string{{"a", "b", "c"}, {"sub"}}},
+		{desc: "n larger than the directory", name: "dir", n: 10, pages: [][]string{{"a", "b", "c", "sub"}}},
+		{desc: "root", name: ".", n: 1, pages: [][]string{{"dir"}, {"file"}}},
+	}
+
+	for _, test := range tests {
+		f, err := mem.Open(test.name)
+		if err != nil {
+			panic(err)
+		}
+		dir, ok := f.(fs.ReadDirFile)
+		if !ok {
+			t.Fatalf("TestReadDirFile(%s): got %T, want fs.ReadDirFile", test.desc, f)
+		}
+
+		var got [][]string
+		for {
+			entries, err := dir.ReadDir(test.n)
+			if err == io.EOF {
+				if len(entries) != 0 {
+					t.Errorf("TestReadDirFile(%s): got %d entries with io.EOF, want 0", test.desc, len(entries))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("TestReadDirFile(%s): got err == %s, want err == nil", test.desc, err)
+			}
+			var page []string
+			for _, e := range entries {
+				page = append(page, e.Name())
+			}
+			got = append(got, page)
+		}
+		if diff := pretty.Compare(test.pages, got); diff != "" {
+			t.Errorf("TestReadDirFile(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	// n <= 0 returns the remaining entries without io.EOF, even at the end of the directory.
+	f, _ := mem.Open("dir")
+	dir := f.(fs.ReadDirFile)
+	if _, err := dir.ReadDir(1); err != nil {
+		t.Fatalf("TestReadDirFile(ReadDir(1)): got err == %s, want err == nil", err)
+	}
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		t.Fatalf("TestReadDirFile(ReadDir(-1)): got err == %s, want err == nil", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("TestReadDirFile(ReadDir(-1)): got %d entries, want 3", len(entries))
+	}
+	entries, err = dir.ReadDir(0)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("TestReadDirFile(ReadDir(0) at end): got %d entries, err == %v, want 0 entries, err == nil", len(entries), err)
+	}
+
+	// Each Open() reads the directory from the start.
+	f, _ = mem.Open("dir")
+	if entries, _ := f.(fs.ReadDirFile).ReadDir(-1); len(entries) != 4 {
+		t.Errorf("TestReadDirFile(second Open): got %d entries, want 4", len(entries))
+	}
+
+	f, _ = mem.Open("file")
+	if _, err := f.(fs.ReadDirFile).ReadDir(-1); !errors.Is(err, jsfs.ErrNotDirectory) {
+		t.Errorf("TestReadDirFile(file): got err == %v, want jsfs.ErrNotDirectory", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	fsys := New()
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		desc    string
+		name    string
+		content []byte
+		want    string
+	}{
+		{desc: "json", name: "data.json", content: []byte(`{"a": 1}`), want: "text/plain; charset=utf-8"},
+		{desc: "png extension", name: "image.png", content: png, want: "image/png"},
+		{desc: "png in a json file", name: "image.json", content: png, want: "image/png"},
+		{desc: "png without extension", name: "image", content: png, want: "image/png"},
+		{desc: "binary without extension", name: "binary", content: []byte{0, 1, 2, 0xff}, want: "application/octet-stream"},
+	}
+
+	for _, test := range tests {
+		if err := fsys.WriteFile(test.name, test.content, 0644); err != nil {
+			panic(err)
+		}
+		got, err := fsys.ContentType(test.name)
+		if err != nil {
+			t.Errorf("TestContentType(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestContentType(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := fsys.ContentType("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestContentType(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func BenchmarkWriteSequential(b *testing.B) {
+	content := bytes.Repeat([]byte("x"), 8<<20)
+
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mem := New()
+		f, err := mem.OpenFile("file", 0644, Flags(os.O_WRONLY|os.O_CREATE))
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := f.(*WRFile)
+		for buf := content; len(buf) > 0; buf = buf[32<<10:] {
+			if _, err := w.Write(buf[:32<<10]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
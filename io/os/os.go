@@ -3,9 +3,11 @@ package os
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	jsfs "github.com/gopherfs/fs"
 )
@@ -76,13 +78,19 @@ type fileInfo struct {
 // using functions defined in the "os" and "filepath" packages. In addition
 // this supports:
 //   - gfs.Writer
+//   - gfs.StreamWriter
 //   - gfs.MkdirAllFS
 //   - gfs.Remove
 //
 // Where "gfs" is github.com/gopherfs/fs .
 type FS struct {
 	rootedAt string
-	logger   jsfs.Logger
+	confined bool
+	// validPaths requires names to pass fs.ValidPath(), see DirFS().
+	validPaths bool
+	// defaultPerm is set by WithDefaultPerm(). It is 0 if not set.
+	defaultPerm fs.FileMode
+	logger      jsfs.Logger
 }
 
 // Option is an optional argumetn for FS.
@@ -95,6 +103,37 @@ func WithLogger(l jsfs.Logger) Option {
 	}
 }
 
+// WithRoot roots the FS at path, so that all names passed to the FS are relative to path.
+// Unlike Sub(), path does not need to exist, which allows it to be created with MkdirAll(".").
+// Calling Sub() on the FS returns an FS rooted at dir inside path.
+func WithRoot(path string) Option {
+	return func(f *FS) {
+		f.rootedAt = path
+	}
+}
+
+// WithConfinement rejects any name that is an absolute path or that resolves to a path
+// outside of the FS root (such as "../../etc/passwd") with an *fs.PathError wrapping
+// fs.ErrPermission. This should be used when names come from untrusted input. This does not
+// protect against symlinks inside the root that point outside of it.
+func WithConfinement() Option {
+	return func(f *FS) {
+		f.confined = true
+	}
+}
+
+// WithDefaultPerm causes WriteFile() and WriteFileFrom() to create files with perm instead of
+// the perm they are passed. This keeps files writable when callers pass the mode of a read-only
+// source, such as a file from an embed.FS (0444), which would otherwise fail to be written
+// over later. As with os.WriteFile(), perm is only used when a file is created and is reduced
+// by the process's umask, so perm should include the bits that the umask will leave in place,
+// such as 0644 with the common umask of 022. OpenFile() is not affected.
+func WithDefaultPerm(perm fs.FileMode) Option {
+	return func(f *FS) {
+		f.defaultPerm = perm.Perm()
+	}
+}
+
 // New is the constructor for FS.
 func New(options ...Option) (*FS, error) {
 	f := &FS{logger: jsfs.DefaultLogger{}}
@@ -104,9 +143,57 @@ func New(options ...Option) (*FS, error) {
 	return f, nil
 }
 
+// DirFS returns an FS rooted at root, similar to os.DirFS(). Like os.DirFS(), names must
+// satisfy fs.ValidPath() or an *fs.PathError wrapping fs.ErrInvalid is returned, so names
+// cannot escape root. Unlike os.DirFS(), the returned FS also supports writing files and
+// creating directories. root must not be empty, but does not need to exist.
+func DirFS(root string, options ...Option) (*FS, error) {
+	if root == "" {
+		return nil, fmt.Errorf("DirFS() cannot be passed an empty root")
+	}
+
+	f, err := New(options...)
+	if err != nil {
+		return nil, err
+	}
+	f.rootedAt = root
+	f.confined = true
+	f.validPaths = true
+	return f, nil
+}
+
+// path returns the os path for name. If the FS is confined, this returns an error if name
+// is absolute or escapes the root.
+func (f *FS) path(op, name string) (string, error) {
+	if f.validPaths && !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	p := filepath.Join(f.rootedAt, name)
+	if !f.confined {
+		return p, nil
+	}
+
+	if filepath.IsAbs(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	root := f.rootedAt
+	if root == "" {
+		root = "."
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	}
+	return p, nil
+}
+
 // Open implements fs.FS.Open().
 func (f *FS) Open(name string) (fs.File, error) {
-	file, err := os.Open(filepath.Join(f.rootedAt, name))
+	p, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
 	if err != nil {
 		return nil, err
 	}
@@ -115,12 +202,20 @@ func (f *FS) Open(name string) (fs.File, error) {
 
 // ReadDir implements fs.ReadDirFS.ReadDir().
 func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
-	return os.ReadDir(name)
+	p, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
 }
 
 // Stat implememnts fs.StatFS.Stat().
 func (f *FS) Stat(name string) (fs.FileInfo, error) {
-	fi, err := os.Stat(filepath.Join(f.rootedAt, name))
+	p, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
 	if err != nil {
 		return nil, err
 	}
@@ -129,24 +224,147 @@ func (f *FS) Stat(name string) (fs.FileInfo, error) {
 
 // ReadFile implements fs.ReadFileFS.ReadFile().
 func (f *FS) ReadFile(name string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(f.rootedAt, name))
+	p, err := f.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
 }
 
+// ContentType implements jsfs.ContentTyper.ContentType() with jsfs.DetectContentType(), which
+// uses the extension of name and, if it is not known, the first 512 bytes of the file.
+func (f *FS) ContentType(name string) (string, error) {
+	p, err := f.path("contenttype", name)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", &fs.PathError{Op: "contenttype", Path: name, Err: err}
+	}
+	return jsfs.DetectContentType(name, head[:n]), nil
+}
+
+// parentDirPerm is the permission that WriteFile() and WriteFileFrom() create missing
+// parent directories with.
+const parentDirPerm fs.FileMode = 0755
+
 // WriteFile implements jsfs.Writer.WriteFile(). If the file exists this will
-// attempt to write over it.
+// attempt to write over it. Missing parent directories are created with 0755 permissions,
+// like simple.FS.WriteFile() does.
 func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
-	p := filepath.Join(f.rootedAt, name)
+	p, err := f.path("writefile", name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), parentDirPerm); err != nil {
+		return err
+	}
+	return os.WriteFile(p, content, f.perm(perm))
+}
 
-	return os.WriteFile(p, content, perm)
+// perm returns the permission to create a file with when perm was requested.
+func (f *FS) perm(perm fs.FileMode) fs.FileMode {
+	if f.defaultPerm != 0 {
+		return f.defaultPerm
+	}
+	return perm
+}
+
+// WriteFileFrom implements jsfs.StreamWriter.WriteFileFrom() by copying r to a temporary file
+// in the same directory, which is renamed over the file once all of r was copied. Until then
+// readers see the previous content of the file, if any. If reading r fails, only the temporary
+// file is removed. Missing parent directories are created like WriteFile().
+func (f *FS) WriteFileFrom(name string, r io.Reader, perm fs.FileMode) error {
+	p, err := f.path("writefile", name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), parentDirPerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return &fs.PathError{Op: "writefile", Path: name, Err: err}
+	}
+	if err := file.Chmod(f.perm(perm)); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
 
-// Glob implements fs.GlobFS.Glob().
+// AppendFile appends content to the file, creating it with perm if it does not exist. This is
+// useful for log-style accumulation where WriteFile() would write over the file. Missing parent
+// directories are created like WriteFile().
+func (f *FS) AppendFile(name string, content []byte, perm fs.FileMode) error {
+	p, err := f.path("appendfile", name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), parentDirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, f.perm(perm))
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Glob implements fs.GlobFS.Glob(). Matches are relative to the root of the FS.
 func (f *FS) Glob(pattern string) (matches []string, err error) {
-	return filepath.Glob(filepath.Join(f.rootedAt, pattern))
+	p, err := f.path("glob", pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err = filepath.Glob(p)
+	if err != nil || f.rootedAt == "" {
+		return matches, err
+	}
+	for i, m := range matches {
+		rel, err := filepath.Rel(f.rootedAt, m)
+		if err != nil {
+			return nil, err
+		}
+		matches[i] = filepath.ToSlash(rel)
+	}
+	return matches, nil
 }
 
 type ofOptions struct {
 	flags int
+
+	// mkdirAll is set by WithMkdirAll() and creates the parent directory with dirPerm.
+	mkdirAll bool
+	dirPerm  fs.FileMode
 }
 
 func (o *ofOptions) defaults() {
@@ -167,6 +385,20 @@ func WithFlags(flags int) jsfs.OFOption {
 	}
 }
 
+// WithMkdirAll causes OpenFile() to create the parent directory of the file and any missing
+// directories above it with perm before opening the file, like MkdirAll().
+func WithMkdirAll(perm fs.FileMode) jsfs.OFOption {
+	return func(i interface{}) error {
+		v, ok := i.(*ofOptions)
+		if !ok {
+			return fmt.Errorf("WithMkdirAll() call received %T, expected *os.ofOptions", i)
+		}
+		v.mkdirAll = true
+		v.dirPerm = perm
+		return nil
+	}
+}
+
 // OpenFile opens a file with the set flags and fs.FileMode. If you want to use the fs.File
 // to write, you need to type assert if to *os.File. If Opening a file for
 func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
@@ -179,7 +411,16 @@ func (f *FS) OpenFile(name string, perms fs.FileMode, options ...jsfs.OFOption)
 		}
 	}
 
-	file, err := os.OpenFile(filepath.Join(f.rootedAt, name), opts.flags, perms)
+	p, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if opts.mkdirAll {
+		if err := os.MkdirAll(filepath.Dir(p), opts.dirPerm); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(p, opts.flags, perms)
 	if err != nil {
 		return nil, err
 	}
@@ -193,27 +434,50 @@ func (f *FS) Sub(dir string) (fs.FS, error) {
 		return nil, err
 	}
 	if !stat.IsDir() {
-		return nil, fmt.Errorf("%q is not a directory", dir)
+		return nil, fmt.Errorf("%q is %w", dir, jsfs.ErrNotDirectory)
 	}
-	return &FS{logger: f.logger, rootedAt: filepath.Join(f.rootedAt, dir)}, nil
+	p, err := f.path("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	// The options f was created with, such as WithDefaultPerm(), also apply to the sub FS.
+	sub := *f
+	sub.rootedAt = p
+	return &sub, nil
 }
 
 // Mkdir implements os.Mkdir().
 func (f *FS) Mkdir(path string, perm fs.FileMode) error {
-	return os.Mkdir(filepath.Join(f.rootedAt, path), perm)
+	p, err := f.path("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, perm)
 }
 
 // MkdirAll implements os.MkdirAll().
 func (f *FS) MkdirAll(path string, perm fs.FileMode) error {
-	return os.MkdirAll(filepath.Join(f.rootedAt, path), perm)
+	p, err := f.path("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
 }
 
 // Remove implements os.Remove().
 func (f *FS) Remove(name string) error {
-	return os.Remove(filepath.Join(f.rootedAt, name))
+	p, err := f.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
 }
 
 // RemoveAll implements os.RemoveAll().
 func (f *FS) RemoveAll(path string) error {
-	return os.RemoveAll(filepath.Join(f.rootedAt, path))
+	p, err := f.path("unlinkat", path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
 }
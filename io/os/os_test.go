@@ -1,6 +1,21 @@
 package os
 
-import "io/fs"
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/fstesting"
+)
 
 var (
 	_ fs.ReadDirFile = &File{}
@@ -9,4 +24,547 @@ var (
 	_ fs.StatFS     = &FS{}
 	_ fs.ReadFileFS = &FS{}
 	_ fs.GlobFS     = &FS{}
+
+	_ jsfs.StreamWriter = &FS{}
+	_ jsfs.ContentTyper = &FS{}
 )
+
+func TestConformance(t *testing.T) {
+	files := map[string][]byte{
+		"root.txt":                []byte("hello world"),
+		"dir/file.txt":            []byte("joshua tree"),
+		"dir/sub/other.txt":       []byte("the unforgettable fire"),
+		"dir/sub/deeper/last.txt": []byte("war"),
+	}
+
+	fsys, err := New()
+	if err != nil {
+		panic(err)
+	}
+	sub, err := fsys.Sub(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+	fsys = sub.(*FS)
+
+	for name, content := range files {
+		if err := fsys.MkdirAll(path.Dir(name), 0700); err != nil {
+			panic(err)
+		}
+		if err := fsys.WriteFile(name, content, 0644); err != nil {
+			panic(err)
+		}
+	}
+
+	fstesting.Run(
+		t,
+		fsys,
+		files,
+		fstesting.Skip("FS does not reject paths that fail fs.ValidPath()", fstesting.CheckTestFS),
+	)
+}
+
+func TestWithRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "does", "not", "exist")
+
+	fsys, err := New(WithRoot(root))
+	if err != nil {
+		t.Fatalf("TestWithRoot: got err == %s, want err == nil", err)
+	}
+
+	if err := fsys.MkdirAll("dir", 0700); err != nil {
+		t.Fatalf("TestWithRoot(MkdirAll): got err == %s, want err == nil", err)
+	}
+	if err := fsys.WriteFile("dir/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("TestWithRoot(WriteFile): got err == %s, want err == nil", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, "dir", "file.txt"))
+	if err != nil {
+		t.Fatalf("TestWithRoot: file was not written inside the root: %s", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestWithRoot: got content %q, want %q", string(b), "content")
+	}
+
+	sub, err := fsys.Sub("dir")
+	if err != nil {
+		t.Fatalf("TestWithRoot(Sub): got err == %s, want err == nil", err)
+	}
+	b, err = fs.ReadFile(sub, "file.txt")
+	if err != nil {
+		t.Fatalf("TestWithRoot(Sub ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestWithRoot(Sub ReadFile): got content %q, want %q", string(b), "content")
+	}
+}
+
+func TestConfinement(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	if err := os.Mkdir(root, 0700); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	fsys, err := New(WithRoot(root), WithConfinement())
+	if err != nil {
+		panic(err)
+	}
+
+	blocked := []string{
+		"../secret.txt",
+		"../../etc/passwd",
+		"dir/../../secret.txt",
+		filepath.Join(parent, "secret.txt"),
+		"..",
+	}
+
+	for _, name := range blocked {
+		ops := map[string]error{}
+		_, ops["Open"] = fsys.Open(name)
+		_, ops["OpenFile"] = fsys.OpenFile(name, 0644, WithFlags(os.O_WRONLY|os.O_CREATE))
+		_, ops["ReadFile"] = fsys.ReadFile(name)
+		_, ops["Stat"] = fsys.Stat(name)
+		_, ops["ReadDir"] = fsys.ReadDir(name)
+		ops["WriteFile"] = fsys.WriteFile(name, []byte("overwritten"), 0644)
+		ops["Remove"] = fsys.Remove(name)
+		ops["RemoveAll"] = fsys.RemoveAll(name)
+		ops["Mkdir"] = fsys.Mkdir(name, 0700)
+		ops["MkdirAll"] = fsys.MkdirAll(name, 0700)
+
+		for op, err := range ops {
+			if !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("TestConfinement(%s(%s)): got err == %v, want fs.ErrPermission", op, name, err)
+			}
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(parent, "secret.txt"))
+	if err != nil || string(b) != "secret" {
+		t.Errorf("TestConfinement: file outside the root was modified: %q, %v", b, err)
+	}
+
+	allowed := []string{"file.txt", "./file.txt", "dir/../file.txt"}
+	for _, name := range allowed {
+		b, err := fsys.ReadFile(name)
+		if err != nil {
+			t.Errorf("TestConfinement(ReadFile(%s)): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != "content" {
+			t.Errorf("TestConfinement(ReadFile(%s)): got %q, want %q", name, b, "content")
+		}
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	if _, err := DirFS(""); err == nil {
+		t.Errorf("TestDirFS(empty root): got err == nil, want err != nil")
+	}
+
+	root := t.TempDir()
+	fsys, err := DirFS(root)
+	if err != nil {
+		t.Fatalf("TestDirFS: got err == %s, want err == nil", err)
+	}
+
+	files := map[string][]byte{
+		"root.txt":          []byte("hello world"),
+		"dir/file.txt":      []byte("joshua tree"),
+		"dir/sub/other.txt": []byte("the unforgettable fire"),
+	}
+	for name, content := range files {
+		if err := fsys.MkdirAll(path.Dir(name), 0700); err != nil {
+			t.Fatalf("TestDirFS(MkdirAll): got err == %s, want err == nil", err)
+		}
+		if err := fsys.WriteFile(name, content, 0644); err != nil {
+			t.Fatalf("TestDirFS(WriteFile): got err == %s, want err == nil", err)
+		}
+		b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("TestDirFS(%s): file was not written through to disk: %s", name, err)
+		}
+		if string(b) != string(content) {
+			t.Errorf("TestDirFS(%s): got content on disk %q, want %q", name, b, content)
+		}
+	}
+
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "dir/../root.txt", "./root.txt"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestDirFS(Open(%s)): got err == %v, want fs.ErrInvalid", name, err)
+		}
+		if err := fsys.WriteFile(name, []byte("content"), 0644); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("TestDirFS(WriteFile(%s)): got err == %v, want fs.ErrInvalid", name, err)
+		}
+	}
+
+	fstesting.Run(t, fsys, files)
+}
+
+// patternReader returns size bytes of a repeating pattern. If err is set, it is returned
+// instead of io.EOF after size bytes.
+type patternReader struct {
+	size, read int64
+	maxRead    int
+	err        error
+}
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	if p.read >= p.size {
+		if p.err != nil {
+			return 0, p.err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(b)) > p.size-p.read {
+		b = b[:p.size-p.read]
+	}
+	for i := range b {
+		b[i] = byte((p.read + int64(i)) % 251)
+	}
+	p.read += int64(len(b))
+	if len(b) > p.maxRead {
+		p.maxRead = len(b)
+	}
+	return len(b), nil
+}
+
+func TestWriteFileFrom(t *testing.T) {
+	const size = 64 << 20
+
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+
+	src := &patternReader{size: size}
+	if err := fsys.WriteFileFrom("large.bin", src, 0644); err != nil {
+		t.Fatalf("TestWriteFileFrom: got err == %s, want err == nil", err)
+	}
+	if src.maxRead >= size {
+		t.Errorf("TestWriteFileFrom: source was read in a single %d byte read, want streaming", src.maxRead)
+	}
+
+	file, err := fsys.Open("large.bin")
+	if err != nil {
+		t.Fatalf("TestWriteFileFrom(Open): got err == %s, want err == nil", err)
+	}
+	defer file.Close()
+	got, want := sha256.New(), sha256.New()
+	n, err := io.Copy(got, file)
+	if err != nil {
+		t.Fatalf("TestWriteFileFrom(Read): got err == %s, want err == nil", err)
+	}
+	io.Copy(want, &patternReader{size: size})
+	if n != size {
+		t.Errorf("TestWriteFileFrom: wrote %d bytes, want %d", n, size)
+	}
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		t.Errorf("TestWriteFileFrom: written content did not match the source")
+	}
+
+	readErr := errors.New("read failed")
+	err = fsys.WriteFileFrom("failed.bin", &patternReader{size: 1 << 20, err: readErr}, 0644)
+	if !errors.Is(err, readErr) {
+		t.Errorf("TestWriteFileFrom(read error): got err == %v, want %v", err, readErr)
+	}
+	if _, err := fsys.Stat("failed.bin"); err == nil {
+		t.Errorf("TestWriteFileFrom(read error): partial file was not removed")
+	}
+}
+
+func TestWriteFileFromExisting(t *testing.T) {
+	dir := t.TempDir()
+	fsys, err := DirFS(dir)
+	if err != nil {
+		panic(err)
+	}
+	if err := fsys.WriteFile("file.txt", []byte("old"), 0644); err != nil {
+		panic(err)
+	}
+
+	check := func(desc string) {
+		t.Helper()
+		b, err := fsys.ReadFile("file.txt")
+		if err != nil {
+			t.Fatalf("TestWriteFileFromExisting(%s): got err == %s, want err == nil", desc, err)
+		}
+		if string(b) != "old" {
+			t.Errorf("TestWriteFileFromExisting(%s): got content %q, want %q", desc, b, "old")
+		}
+	}
+
+	// The write stalls after the first part of the content.
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fsys.WriteFileFrom("file.txt", pr, 0644)
+	}()
+	if _, err := pw.Write([]byte("new")); err != nil {
+		t.Fatalf("TestWriteFileFromExisting(Write): got err == %s, want err == nil", err)
+	}
+	check("stalled write")
+
+	readErr := errors.New("aborted")
+	pw.CloseWithError(readErr)
+	if err := <-done; !errors.Is(err, readErr) {
+		t.Errorf("TestWriteFileFromExisting(aborted write): got err == %v, want %v", err, readErr)
+	}
+	check("aborted write")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		panic(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("TestWriteFileFromExisting(aborted write): got %d files in the directory, want 1", len(entries))
+	}
+}
+
+func TestOpenFileMkdirAll(t *testing.T) {
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+
+	const name = "a/b/c/file.txt"
+	if _, err := fsys.OpenFile(name, 0644, WithFlags(os.O_WRONLY|os.O_CREATE)); err == nil {
+		t.Fatalf("TestOpenFileMkdirAll(without option): got err == nil, want err != nil")
+	}
+
+	file, err := fsys.OpenFile(name, 0644, WithFlags(os.O_WRONLY|os.O_CREATE|os.O_EXCL), WithMkdirAll(0755))
+	if err != nil {
+		t.Fatalf("TestOpenFileMkdirAll: got err == %s, want err == nil", err)
+	}
+	if _, err := file.(*File).Write([]byte("content")); err != nil {
+		t.Fatalf("TestOpenFileMkdirAll(Write): got err == %s, want err == nil", err)
+	}
+	file.Close()
+
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		fi, err := fsys.Stat(dir)
+		if err != nil {
+			t.Errorf("TestOpenFileMkdirAll(Stat(%s)): got err == %s, want err == nil", dir, err)
+			continue
+		}
+		if !fi.IsDir() {
+			t.Errorf("TestOpenFileMkdirAll(Stat(%s)): got IsDir() == false, want true", dir)
+		}
+	}
+	b, err := fsys.ReadFile(name)
+	if err != nil || string(b) != "content" {
+		t.Errorf("TestOpenFileMkdirAll(ReadFile): got %q, err == %v, want %q, err == nil", b, err, "content")
+	}
+
+	// O_EXCL still applies when the directories exist.
+	if _, err := fsys.OpenFile(name, 0644, WithFlags(os.O_WRONLY|os.O_CREATE|os.O_EXCL), WithMkdirAll(0755)); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("TestOpenFileMkdirAll(O_EXCL): got err == %v, want fs.ErrExist", err)
+	}
+}
+
+func TestWriteFileParents(t *testing.T) {
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+
+	writes := []struct {
+		desc  string
+		name  string
+		write func(name string) error
+	}{
+		{
+			desc:  "WriteFile",
+			name:  "a/b/c/file.txt",
+			write: func(name string) error { return fsys.WriteFile(name, []byte("content"), 0644) },
+		},
+		{
+			desc:  "WriteFileFrom",
+			name:  "d/e/f/file.txt",
+			write: func(name string) error { return fsys.WriteFileFrom(name, bytes.NewReader([]byte("content")), 0644) },
+		},
+	}
+
+	for _, w := range writes {
+		if err := w.write(w.name); err != nil {
+			t.Errorf("TestWriteFileParents(%s): got err == %s, want err == nil", w.desc, err)
+			continue
+		}
+		b, err := fsys.ReadFile(w.name)
+		if err != nil || string(b) != "content" {
+			t.Errorf("TestWriteFileParents(%s): got %q, err == %v, want %q, err == nil", w.desc, b, err, "content")
+		}
+		fi, err := fsys.Stat(path.Dir(w.name))
+		if err != nil {
+			t.Errorf("TestWriteFileParents(%s): could not Stat parent: %s", w.desc, err)
+			continue
+		}
+		if !fi.IsDir() {
+			t.Errorf("TestWriteFileParents(%s): parent is not a directory", w.desc)
+		}
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+
+	lines := []string{"first\n", "second\n", "third\n"}
+	want := ""
+	for _, line := range lines {
+		if err := fsys.AppendFile("logs/app.log", []byte(line), 0644); err != nil {
+			t.Fatalf("TestAppendFile(%q): got err == %s, want err == nil", line, err)
+		}
+		want += line
+
+		b, err := fsys.ReadFile("logs/app.log")
+		if err != nil {
+			t.Fatalf("TestAppendFile(ReadFile): got err == %s, want err == nil", err)
+		}
+		if string(b) != want {
+			t.Errorf("TestAppendFile(after %q): got %q, want %q", line, b, want)
+		}
+	}
+
+	// WriteFile still replaces the content.
+	if err := fsys.WriteFile("logs/app.log", []byte("reset\n"), 0644); err != nil {
+		t.Fatalf("TestAppendFile(WriteFile): got err == %s, want err == nil", err)
+	}
+	if err := fsys.AppendFile("logs/app.log", []byte("more\n"), 0644); err != nil {
+		t.Fatalf("TestAppendFile(AppendFile after WriteFile): got err == %s, want err == nil", err)
+	}
+	b, err := fsys.ReadFile("logs/app.log")
+	if err != nil || string(b) != "reset\nmore\n" {
+		t.Errorf("TestAppendFile(AppendFile after WriteFile): got %q, err == %v, want %q, err == nil", b, err, "reset\nmore\n")
+	}
+
+	if err := fsys.AppendFile("../escape.log", []byte("x"), 0644); err == nil {
+		t.Errorf("TestAppendFile(invalid path): got err == nil, want err != nil")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		desc    string
+		name    string
+		content []byte
+		want    string
+	}{
+		{desc: "json extension", name: "data.json", content: []byte(`{"a": 1}`), want: "application/json"},
+		{desc: "png extension", name: "image.png", content: png, want: "image/png"},
+		{desc: "png without extension", name: "image", content: png, want: "image/png"},
+		{desc: "binary without extension", name: "binary", content: []byte{0, 1, 2, 0xff}, want: "application/octet-stream"},
+	}
+
+	for _, test := range tests {
+		if err := fsys.WriteFile(test.name, test.content, 0644); err != nil {
+			panic(err)
+		}
+		got, err := fsys.ContentType(test.name)
+		if err != nil {
+			t.Errorf("TestContentType(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestContentType(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+
+	if _, err := fsys.ContentType("missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestContentType(missing file): got err == %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMergeStreams(t *testing.T) {
+	from := fstest.MapFS{
+		"file.txt":     &fstest.MapFile{Data: []byte("joshua tree")},
+		"dir/file.txt": &fstest.MapFile{Data: []byte("war")},
+	}
+
+	fsys, err := DirFS(t.TempDir())
+	if err != nil {
+		panic(err)
+	}
+	if err := jsfs.Merge(fsys, from, "/merged/"); err != nil {
+		t.Fatalf("TestMergeStreams: got err == %s, want err == nil", err)
+	}
+
+	for name, f := range from {
+		b, err := fsys.ReadFile(path.Join("merged", name))
+		if err != nil {
+			t.Errorf("TestMergeStreams(%s): got err == %s, want err == nil", name, err)
+			continue
+		}
+		if string(b) != string(f.Data) {
+			t.Errorf("TestMergeStreams(%s): got content %q, want %q", name, b, f.Data)
+		}
+	}
+}
+
+//go:embed os.go
+var embedFS embed.FS
+
+func TestDefaultPerm(t *testing.T) {
+	fsys, err := DirFS(t.TempDir(), WithDefaultPerm(0600))
+	if err != nil {
+		panic(err)
+	}
+
+	// Merging twice writes over the files from the first merge.
+	for i := 0; i < 2; i++ {
+		if err := jsfs.Merge(fsys, embedFS, "/merged/"); err != nil {
+			t.Fatalf("TestDefaultPerm(merge %d): got err == %s, want err == nil", i, err)
+		}
+	}
+	// A read-only perm, like that of a file from an embed.FS, is replaced.
+	if err := fsys.WriteFile("readonly.txt", []byte("hello"), 0444); err != nil {
+		t.Fatalf("TestDefaultPerm(WriteFile): got err == %s, want err == nil", err)
+	}
+
+	for _, name := range []string{"merged/os.go", "readonly.txt"} {
+		fi, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatalf("TestDefaultPerm(%s): got err == %s, want err == nil", name, err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("TestDefaultPerm(%s): got perm %v, want %v", name, fi.Mode().Perm(), fs.FileMode(0600))
+		}
+		if err := fsys.WriteFile(name, []byte("rewritten"), 0444); err != nil {
+			t.Errorf("TestDefaultPerm(%s): rewrite got err == %s, want err == nil", name, err)
+		}
+	}
+
+	// A Sub() of the FS keeps the default perm.
+	sub, err := fsys.Sub("merged")
+	if err != nil {
+		t.Fatalf("TestDefaultPerm(Sub): got err == %s, want err == nil", err)
+	}
+	subFS := sub.(*FS)
+	for i := 0; i < 2; i++ {
+		if err := subFS.WriteFile("sub.txt", []byte("hello"), 0444); err != nil {
+			t.Fatalf("TestDefaultPerm(Sub write %d): got err == %s, want err == nil", i, err)
+		}
+	}
+	fi, err := fsys.Stat("merged/sub.txt")
+	if err != nil {
+		t.Fatalf("TestDefaultPerm(Sub): got err == %s, want err == nil", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("TestDefaultPerm(Sub): got perm %v, want %v", fi.Mode().Perm(), fs.FileMode(0600))
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Package readonly provides an io/fs.FS wrapper that guarantees no writes are made to the
+filesystem it wraps. This is useful when exposing a cache or os filesystem to code that
+should not be able to modify it.
+
+Wrap a filesystem so that it can only be read:
+
+	osFS, err := os.New()
+	if err != nil {
+		// Do something
+	}
+
+	ro := readonly.New(osFS)
+
+If code expects an fs.Writer, use NewWriter() instead. All of its write methods return
+fs.ErrPermission:
+
+	ro := readonly.NewWriter(osFS)
+
+	// err wraps fs.ErrPermission.
+	err := ro.WriteFile("file", []byte("content"), 0644)
+*/
+package readonly
+
+import (
+	"io"
+	"io/fs"
+
+	jsfs "github.com/gopherfs/fs"
+)
+
+// Simply here to make sure our types implement these interfaces.
+var (
+	_ fs.ReadFileFS     = &FS{}
+	_ fs.StatFS         = &FS{}
+	_ fs.ReadDirFS      = &FS{}
+	_ jsfs.Writer       = &Writer{}
+	_ jsfs.StreamWriter = &Writer{}
+	_ jsfs.MkdirAllFS   = &Writer{}
+	_ jsfs.Remove       = &Writer{}
+)
+
+// FS wraps an fs.FS and only exposes the methods used to read it. Files returned by Open()
+// are the files returned by the wrapped FS.Open(), which should not allow writes.
+type FS struct {
+	fsys fs.FS
+}
+
+// New wraps fsys so that it can only be read.
+func New(fsys fs.FS) *FS {
+	return &FS{fsys: fsys}
+}
+
+// Open implements fs.FS.Open().
+func (f *FS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, name)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir().
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, name)
+}
+
+// Writer is an FS that implements fs.Writer, fs.StreamWriter, fs.MkdirAllFS and fs.Remove
+// so that it can be used where those are expected, but rejects all writes with an
+// *fs.PathError wrapping fs.ErrPermission.
+type Writer struct {
+	*FS
+}
+
+// NewWriter wraps fsys so that it can only be read, but can be substituted where a writable
+// filesystem is expected.
+func NewWriter(fsys fs.FS) *Writer {
+	return &Writer{FS: New(fsys)}
+}
+
+func denied(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+}
+
+// OpenFile implements fs.OpenFiler.OpenFile(). Options are implementation specific and may
+// open the file for writing, so this always returns fs.ErrPermission. Use Open() instead.
+func (w *Writer) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	return nil, denied("openfile", name)
+}
+
+// WriteFile implements fs.Writer.WriteFile(). It always returns fs.ErrPermission.
+func (w *Writer) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return denied("writefile", name)
+}
+
+// WriteFileFrom implements fs.StreamWriter.WriteFileFrom(). It always returns fs.ErrPermission.
+func (w *Writer) WriteFileFrom(name string, r io.Reader, perm fs.FileMode) error {
+	return denied("writefilefrom", name)
+}
+
+// Mkdir always returns fs.ErrPermission.
+func (w *Writer) Mkdir(name string, perm fs.FileMode) error {
+	return denied("mkdir", name)
+}
+
+// MkdirAll implements fs.MkdirAllFS.MkdirAll(). It always returns fs.ErrPermission.
+func (w *Writer) MkdirAll(path string, perm fs.FileMode) error {
+	return denied("mkdirall", path)
+}
+
+// Remove implements fs.Remove.Remove(). It always returns fs.ErrPermission.
+func (w *Writer) Remove(name string) error {
+	return denied("remove", name)
+}
+
+// RemoveAll implements fs.Remove.RemoveAll(). It always returns fs.ErrPermission.
+func (w *Writer) RemoveAll(path string) error {
+	return denied("removeall", path)
+}
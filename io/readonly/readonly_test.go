@@ -0,0 +1,68 @@
+package readonly
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/mem/simple"
+)
+
+func TestReadOnly(t *testing.T) {
+	mem := simple.New()
+	if err := mem.WriteFile("dir/file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+
+	ro := NewWriter(mem)
+
+	b, err := ro.ReadFile("dir/file")
+	if err != nil {
+		t.Fatalf("TestReadOnly(ReadFile): got err == %s, want err == nil", err)
+	}
+	if string(b) != "content" {
+		t.Errorf("TestReadOnly(ReadFile): got %q, want %q", b, "content")
+	}
+	if _, err := ro.Stat("dir/file"); err != nil {
+		t.Errorf("TestReadOnly(Stat): got err == %s, want err == nil", err)
+	}
+	entries, err := ro.ReadDir("dir")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("TestReadOnly(ReadDir): got %d entries, err == %v, want 1 entry", len(entries), err)
+	}
+
+	var w jsfs.Writer = ro
+	writes := []struct {
+		desc string
+		fn   func() error
+	}{
+		{"WriteFile", func() error { return w.WriteFile("dir/file", []byte("new"), 0644) }},
+		{"OpenFile", func() error { _, err := w.OpenFile("dir/file", 0644); return err }},
+		{"WriteFileFrom", func() error { return ro.WriteFileFrom("new", bytes.NewReader([]byte("new")), 0644) }},
+		{"Mkdir", func() error { return ro.Mkdir("newdir", 0755) }},
+		{"MkdirAll", func() error { return ro.MkdirAll("newdir/sub", 0755) }},
+		{"Remove", func() error { return ro.Remove("dir/file") }},
+		{"RemoveAll", func() error { return ro.RemoveAll("dir") }},
+	}
+	for _, test := range writes {
+		if err := test.fn(); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("TestReadOnly(%s): got err == %v, want fs.ErrPermission", test.desc, err)
+		}
+	}
+
+	b, err = mem.ReadFile("dir/file")
+	if err != nil || string(b) != "content" {
+		t.Errorf("TestReadOnly: wrapped FS was modified: got %q, err == %v", b, err)
+	}
+
+	// The wrapper returned by New() does not expose any write methods.
+	var plain fs.FS = New(mem)
+	if _, ok := plain.(jsfs.Writer); ok {
+		t.Errorf("TestReadOnly: New() returned a jsfs.Writer")
+	}
+	if _, ok := plain.(jsfs.Remove); ok {
+		t.Errorf("TestReadOnly: New() returned a jsfs.Remove")
+	}
+}
@@ -0,0 +1,260 @@
+/*
+Package resilience provides a cache.CacheFS that wraps another cache.CacheFS with a circuit
+breaker, so that a flaky remote backend fails fast instead of making every request wait for it
+to time out.
+
+After a number of consecutive failures the circuit opens. While it is open, every call returns
+an error wrapping ErrOpen without calling the wrapped FS. When used as the cache layer of a
+cache.FS, reads then fall through to the storage layer immediately. After a cooldown the circuit
+is half-open: a single call is let through to probe the wrapped FS. If it succeeds the circuit
+closes, otherwise it opens for another cooldown.
+
+Example use:
+
+	breaker, err := resilience.New(redisFS, resilience.WithThreshold(3), resilience.WithCooldown(10*time.Second))
+	if err != nil {
+		// Do something
+	}
+
+	cacheFS, err := cache.New(breaker, blobStore)
+	if err != nil {
+		// Do something
+	}
+*/
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+)
+
+var _ cache.CacheFS = &FS{}
+
+// ErrOpen is wrapped by the errors returned while the circuit is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of the circuit breaker.
+type State int
+
+const (
+	// Closed passes calls to the wrapped FS.
+	Closed State = iota
+	// Open fails calls without calling the wrapped FS.
+	Open
+	// HalfOpen lets a single call through to see if the wrapped FS has recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "Closed"
+	case Open:
+		return "Open"
+	case HalfOpen:
+		return "HalfOpen"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// FS implements cache.CacheFS by passing calls to a wrapped cache.CacheFS through a circuit breaker.
+type FS struct {
+	inner     cache.CacheFS
+	threshold int
+	cooldown  time.Duration
+	isFailure func(err error) bool
+	// now is time.Now(), except in tests.
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// probing is set while the call that is let through in the HalfOpen state runs.
+	probing bool
+}
+
+// Option is an optional argument to New().
+type Option func(f *FS) error
+
+// WithThreshold sets the number of consecutive failures that open the circuit. Defaults to 5.
+func WithThreshold(n int) Option {
+	return func(f *FS) error {
+		if n < 1 {
+			return fmt.Errorf("WithThreshold(%d) must have n > 0", n)
+		}
+		f.threshold = n
+		return nil
+	}
+}
+
+// WithCooldown sets how long the circuit stays open before a call is let through to see if
+// the wrapped FS has recovered. Defaults to 30 seconds.
+func WithCooldown(d time.Duration) Option {
+	return func(f *FS) error {
+		if d <= 0 {
+			return fmt.Errorf("WithCooldown(%v) must be > 0", d)
+		}
+		f.cooldown = d
+		return nil
+	}
+}
+
+// WithIsFailure sets the function that decides if an error from the wrapped FS is a failure
+// that counts towards opening the circuit. By default every error is a failure except those
+// wrapping fs.ErrNotExist, fs.ErrExist, fs.ErrInvalid or fs.ErrPermission, which are answers
+// from a healthy backend.
+func WithIsFailure(fn func(err error) bool) Option {
+	return func(f *FS) error {
+		if fn == nil {
+			return fmt.Errorf("WithIsFailure() requires a non-nil fn")
+		}
+		f.isFailure = fn
+		return nil
+	}
+}
+
+// New creates a new FS that wraps inner with a circuit breaker.
+func New(inner cache.CacheFS, options ...Option) (*FS, error) {
+	f := &FS{
+		inner:     inner,
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		isFailure: isFailure,
+		now:       time.Now,
+	}
+	for _, o := range options {
+		if err := o(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func isFailure(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrExist), errors.Is(err, fs.ErrInvalid), errors.Is(err, fs.ErrPermission):
+		return false
+	}
+	return true
+}
+
+// State returns the current state of the circuit breaker.
+func (f *FS) State() State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.state == Open && f.now().Sub(f.openedAt) >= f.cooldown {
+		return HalfOpen
+	}
+	return f.state
+}
+
+// allow reports if a call may be made to the wrapped FS. If probe is true, the call is the
+// one let through while HalfOpen and its result decides the state.
+func (f *FS) allow() (ok, probe bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.state {
+	case Closed:
+		return true, false
+	case Open:
+		if f.now().Sub(f.openedAt) < f.cooldown {
+			return false, false
+		}
+		f.state = HalfOpen
+	}
+	if f.probing {
+		return false, false
+	}
+	f.probing = true
+	return true, true
+}
+
+// record records the result of a call to the wrapped FS.
+func (f *FS) record(err error, probe bool) {
+	failed := f.isFailure(err)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if probe {
+		f.probing = false
+	}
+	if !failed {
+		if probe || f.state == Closed {
+			f.state = Closed
+			f.failures = 0
+		}
+		return
+	}
+
+	f.failures++
+	if probe || (f.state == Closed && f.failures >= f.threshold) {
+		f.state = Open
+		f.openedAt = f.now()
+	}
+}
+
+// do calls fn if the circuit allows it.
+func (f *FS) do(op, name string, fn func() error) error {
+	ok, probe := f.allow()
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: ErrOpen}
+	}
+	err := fn()
+	f.record(err, probe)
+	return err
+}
+
+// Open implements fs.FS.Open().
+func (f *FS) Open(name string) (file fs.File, err error) {
+	err = f.do("open", name, func() error {
+		file, err = f.inner.Open(name)
+		return err
+	})
+	return file, err
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile().
+func (f *FS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (file fs.File, err error) {
+	err = f.do("openfile", name, func() error {
+		file, err = f.inner.OpenFile(name, perm, options...)
+		return err
+	})
+	return file, err
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) (b []byte, err error) {
+	err = f.do("readfile", name, func() error {
+		b, err = f.inner.ReadFile(name)
+		return err
+	})
+	return b, err
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *FS) Stat(name string) (fi fs.FileInfo, err error) {
+	err = f.do("stat", name, func() error {
+		fi, err = f.inner.Stat(name)
+		return err
+	})
+	return fi, err
+}
+
+// WriteFile implements jsfs.Writer.WriteFile().
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	return f.do("writefile", name, func() error {
+		return f.inner.WriteFile(name, content, perm)
+	})
+}
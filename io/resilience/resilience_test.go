@@ -0,0 +1,189 @@
+package resilience
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/mem/simple"
+)
+
+// flakyFS is a simple.FS that fails every call with err while err is set.
+type flakyFS struct {
+	*simple.FS
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (f *flakyFS) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *flakyFS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	f.calls++
+	err := f.err
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return f.FS.ReadFile(name)
+}
+
+// clock is a fake time.Now().
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func setup(options ...Option) (*FS, *flakyFS, *clock) {
+	inner := &flakyFS{FS: simple.New()}
+	if err := inner.WriteFile("file", []byte("content"), 0644); err != nil {
+		panic(err)
+	}
+	f, err := New(inner, options...)
+	if err != nil {
+		panic(err)
+	}
+	c := &clock{t: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	f.now = c.now
+	return f, inner, c
+}
+
+func TestBreaker(t *testing.T) {
+	f, inner, clock := setup(WithThreshold(3), WithCooldown(time.Minute))
+	errDown := errors.New("backend is down")
+
+	inner.setErr(errDown)
+	for i := 0; i < 3; i++ {
+		if f.State() != Closed {
+			t.Fatalf("TestBreaker(failure %d): got state %v, want %v", i, f.State(), Closed)
+		}
+		if _, err := f.ReadFile("file"); !errors.Is(err, errDown) {
+			t.Fatalf("TestBreaker(failure %d): got err == %v, want %v", i, err, errDown)
+		}
+	}
+
+	// The circuit is open, calls fail without reaching the backend.
+	if f.State() != Open {
+		t.Fatalf("TestBreaker(tripped): got state %v, want %v", f.State(), Open)
+	}
+	inner.calls = 0
+	for i := 0; i < 10; i++ {
+		if _, err := f.ReadFile("file"); !errors.Is(err, ErrOpen) {
+			t.Fatalf("TestBreaker(open): got err == %v, want ErrOpen", err)
+		}
+	}
+	if inner.calls != 0 {
+		t.Errorf("TestBreaker(open): backend got %d calls, want 0", inner.calls)
+	}
+
+	// After the cooldown, a failed probe opens the circuit again.
+	clock.t = clock.t.Add(time.Minute)
+	if f.State() != HalfOpen {
+		t.Fatalf("TestBreaker(cooldown): got state %v, want %v", f.State(), HalfOpen)
+	}
+	if _, err := f.ReadFile("file"); !errors.Is(err, errDown) {
+		t.Fatalf("TestBreaker(failed probe): got err == %v, want %v", err, errDown)
+	}
+	if f.State() != Open {
+		t.Fatalf("TestBreaker(failed probe): got state %v, want %v", f.State(), Open)
+	}
+	clock.t = clock.t.Add(30 * time.Second)
+	if _, err := f.ReadFile("file"); !errors.Is(err, ErrOpen) {
+		t.Fatalf("TestBreaker(failed probe): got err == %v, want ErrOpen for a new cooldown", err)
+	}
+
+	// Once the backend recovers, a successful probe closes the circuit.
+	inner.setErr(nil)
+	clock.t = clock.t.Add(30 * time.Second)
+	if b, err := f.ReadFile("file"); err != nil || string(b) != "content" {
+		t.Fatalf("TestBreaker(probe): got %q, %v, want %q", b, err, "content")
+	}
+	if f.State() != Closed {
+		t.Fatalf("TestBreaker(recovered): got state %v, want %v", f.State(), Closed)
+	}
+}
+
+func TestHalfOpenSingleProbe(t *testing.T) {
+	f, inner, clock := setup(WithThreshold(1), WithCooldown(time.Minute))
+
+	inner.setErr(errors.New("down"))
+	f.ReadFile("file")
+	clock.t = clock.t.Add(time.Minute)
+
+	// While the probe is running, other calls fail fast.
+	ok, probe := f.allow()
+	if !ok || !probe {
+		t.Fatalf("TestHalfOpenSingleProbe: got allow() == %v, %v, want true, true", ok, probe)
+	}
+	if _, err := f.ReadFile("file"); !errors.Is(err, ErrOpen) {
+		t.Errorf("TestHalfOpenSingleProbe: got err == %v, want ErrOpen during the probe", err)
+	}
+	f.record(nil, true)
+	if f.State() != Closed {
+		t.Errorf("TestHalfOpenSingleProbe: got state %v, want %v", f.State(), Closed)
+	}
+}
+
+func TestNotFailures(t *testing.T) {
+	f, _, _ := setup(WithThreshold(1))
+
+	// fs.ErrNotExist is an answer from a healthy backend.
+	for i := 0; i < 5; i++ {
+		if _, err := f.ReadFile("nope"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("TestNotFailures: got err == %v, want fs.ErrNotExist", err)
+		}
+	}
+	if f.State() != Closed {
+		t.Errorf("TestNotFailures: got state %v, want %v", f.State(), Closed)
+	}
+
+	// A success resets the count of consecutive failures.
+	f, inner, _ := setup(WithThreshold(2))
+	for i := 0; i < 3; i++ {
+		inner.setErr(errors.New("down"))
+		f.ReadFile("file")
+		inner.setErr(nil)
+		f.ReadFile("file")
+	}
+	if f.State() != Closed {
+		t.Errorf("TestNotFailures(interleaved): got state %v, want %v", f.State(), Closed)
+	}
+}
+
+func TestCacheFallthrough(t *testing.T) {
+	breaker, inner, _ := setup(WithThreshold(1), WithCooldown(time.Hour))
+	inner.setErr(errors.New("down"))
+
+	store := simple.New()
+	if err := store.WriteFile("other", []byte("from store"), 0644); err != nil {
+		panic(err)
+	}
+	c, err := cache.New(breaker, store)
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		b, err := c.ReadFile("other")
+		if err != nil || string(b) != "from store" {
+			t.Fatalf("TestCacheFallthrough: got %q, %v, want %q", b, err, "from store")
+		}
+		c.Wait()
+	}
+	if inner.calls != 1 {
+		t.Errorf("TestCacheFallthrough: cache layer got %d reads, want 1 before the circuit opened", inner.calls)
+	}
+}
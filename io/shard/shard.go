@@ -0,0 +1,228 @@
+/*
+Package shard provides a cache.CacheFS that shards files across several backends, such as
+multiple Redis servers or blob containers, so that a dataset can be spread across more
+backends as it grows.
+
+Each file is stored on a single backend that is chosen by rendezvous hashing (also called
+highest random weight hashing) of its name. When a backend is added, only the files that
+move to the new backend change location. When a backend is removed, only the files that
+were on it move. Files on other backends are not reshuffled.
+
+Every backend has an ID that is used in the hash. Processes that share a set of backends
+must use the same IDs, hasher and backends to find the same files. Files are not moved
+between backends when the set changes; a file that now hashes to another backend is not
+found until it is written again, which is what a cache wants.
+
+Example use:
+
+	fsys := shard.New(nil, redis1, redis2, redis3)
+
+	// Written to and read from the same one of the three backends.
+	if err := fsys.WriteFile("users/john", content, 0644); err != nil {
+		// Do something
+	}
+*/
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"strconv"
+	"sync"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/cache"
+)
+
+var _ cache.CacheFS = &FS{}
+
+// Hasher hashes a string to a uint64. Implementations must return the same value for the
+// same string in every process.
+type Hasher interface {
+	Hash(s string) uint64
+}
+
+// FNV is a Hasher that uses 64 bit FNV-1a. This is the Hasher used if New() is passed nil.
+type FNV struct{}
+
+// Hash implements Hasher.Hash().
+func (FNV) Hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// ErrNoBackends is returned by operations when the FS has no backends.
+var ErrNoBackends = errors.New("shard.FS has no backends")
+
+type backend struct {
+	id   string
+	fsys cache.CacheFS
+}
+
+// FS implements cache.CacheFS by routing each file to one of a set of backends.
+type FS struct {
+	hasher Hasher
+
+	mu       sync.RWMutex
+	backends []backend
+}
+
+// New creates a new FS that shards files across backends using hasher. If hasher is nil, FNV
+// is used. The backends are given the IDs "0", "1", "2", ... in the order they are passed.
+// More backends can be added with AddBackend().
+func New(hasher Hasher, backends ...cache.CacheFS) *FS {
+	if hasher == nil {
+		hasher = FNV{}
+	}
+	f := &FS{hasher: hasher}
+	for i, b := range backends {
+		f.backends = append(f.backends, backend{id: strconv.Itoa(i), fsys: b})
+	}
+	return f
+}
+
+// AddBackend adds fsys to the set of backends with id. id must not already be used.
+// Files that hash to the new backend are no longer found on their previous backend.
+func (f *FS) AddBackend(id string, fsys cache.CacheFS) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, b := range f.backends {
+		if b.id == id {
+			return fmt.Errorf("shard.FS already has a backend with id %q", id)
+		}
+	}
+	f.backends = append(f.backends, backend{id: id, fsys: fsys})
+	return nil
+}
+
+// RemoveBackend removes the backend with id from the set of backends. The files on it are
+// then routed to the remaining backends. The files are not removed from the backend.
+func (f *FS) RemoveBackend(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, b := range f.backends {
+		if b.id == id {
+			f.backends = append(f.backends[:i:i], f.backends[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("shard.FS has no backend with id %q", id)
+}
+
+// Backend returns the ID of the backend that name is routed to.
+func (f *FS) Backend(name string) (string, error) {
+	b, err := f.route("backend", name)
+	if err != nil {
+		return "", err
+	}
+	return b.id, nil
+}
+
+// route returns the backend with the highest weight for name.
+func (f *FS) route(op, name string) (backend, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.backends) == 0 {
+		return backend{}, &fs.PathError{Op: op, Path: name, Err: ErrNoBackends}
+	}
+
+	var (
+		best backend
+		max  uint64
+	)
+	for i, b := range f.backends {
+		w := f.weight(b.id, name)
+		// Ties are broken by ID so that the order backends were added in does not matter.
+		if i == 0 || w > max || (w == max && b.id < best.id) {
+			best, max = b, w
+		}
+	}
+	return best, nil
+}
+
+// weight is the rendezvous hashing weight of name on the backend with id.
+func (f *FS) weight(id, name string) uint64 {
+	return mix(f.hasher.Hash(id + "\x00" + name))
+}
+
+// mix is the splitmix64 finalizer. It spreads hashes such as FNV, whose high bits change
+// little when only the end of the input changes, across all 64 bits.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Open implements fs.FS.Open().
+func (f *FS) Open(name string) (fs.File, error) {
+	b, err := f.route("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.fsys.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	b, err := f.route("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.fsys.ReadFile(name)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	b, err := f.route("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.fsys.Stat(name)
+}
+
+// WriteFile implements jsfs.Writer.WriteFile().
+func (f *FS) WriteFile(name string, content []byte, perm fs.FileMode) error {
+	b, err := f.route("writefile", name)
+	if err != nil {
+		return err
+	}
+	return b.fsys.WriteFile(name, content, perm)
+}
+
+// OpenFile implements jsfs.OpenFiler.OpenFile(). options are passed to the backend, so all
+// backends should be the same type.
+func (f *FS) OpenFile(name string, perm fs.FileMode, options ...jsfs.OFOption) (fs.File, error) {
+	b, err := f.route("openfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return b.fsys.OpenFile(name, perm, options...)
+}
+
+// remover is implemented by backends that can remove files, such as the redis FS.
+type remover interface {
+	Remove(name string) error
+}
+
+// Remove removes name from the backend it is routed to. The backend must have a
+// Remove(name string) error method or an error wrapping errors.ErrUnsupported is returned.
+func (f *FS) Remove(name string) error {
+	b, err := f.route("remove", name)
+	if err != nil {
+		return err
+	}
+	r, ok := b.fsys.(remover)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("backend(%s) %T does not support Remove(): %w", b.id, b.fsys, errors.ErrUnsupported)}
+	}
+	return r.Remove(name)
+}
@@ -0,0 +1,186 @@
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/gopherfs/fs/io/cache"
+	"github.com/gopherfs/fs/io/mem/simple"
+	osfs "github.com/gopherfs/fs/io/os"
+)
+
+func newBackends(n int) []cache.CacheFS {
+	out := make([]cache.CacheFS, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, simple.New())
+	}
+	return out
+}
+
+func keys(n int) []string {
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, fmt.Sprintf("users/%d/profile.json", i))
+	}
+	return out
+}
+
+// routes returns the backend ID of every name.
+func routes(f *FS, names []string) map[string]string {
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		id, err := f.Backend(name)
+		if err != nil {
+			panic(err)
+		}
+		m[name] = id
+	}
+	return m
+}
+
+func TestRouting(t *testing.T) {
+	var backends []cache.CacheFS
+	for i := 0; i < 3; i++ {
+		fsys, err := osfs.DirFS(t.TempDir())
+		if err != nil {
+			panic(err)
+		}
+		backends = append(backends, fsys)
+	}
+	f := New(nil, backends...)
+
+	for _, name := range keys(100) {
+		if err := f.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("TestRouting(%s): WriteFile got err == %s, want err == nil", name, err)
+		}
+		b, err := f.ReadFile(name)
+		if err != nil {
+			t.Fatalf("TestRouting(%s): ReadFile got err == %s, want err == nil", name, err)
+		}
+		if string(b) != name {
+			t.Errorf("TestRouting(%s): got %q, want %q", name, b, name)
+		}
+
+		found := 0
+		for _, backend := range backends {
+			if _, err := backend.Stat(name); err == nil {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("TestRouting(%s): file was on %d backends, want 1", name, found)
+		}
+
+		if err := f.Remove(name); err != nil {
+			t.Fatalf("TestRouting(%s): Remove got err == %s, want err == nil", name, err)
+		}
+		if _, err := f.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("TestRouting(%s): Stat after Remove got err == %v, want fs.ErrNotExist", name, err)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	f := New(nil, newBackends(4)...)
+
+	counts := map[string]int{}
+	for _, id := range routes(f, keys(10000)) {
+		counts[id]++
+	}
+	// Each backend should get about 2500 keys.
+	for id, n := range counts {
+		if n < 2000 || n > 3000 {
+			t.Errorf("TestDistribution: backend(%s) got %d of 10000 keys, want about 2500", id, n)
+		}
+	}
+	if len(counts) != 4 {
+		t.Errorf("TestDistribution: keys went to %d backends, want 4", len(counts))
+	}
+}
+
+func TestStability(t *testing.T) {
+	names := keys(10000)
+	f := New(nil, newBackends(4)...)
+	before := routes(f, names)
+
+	// Adding a backend only moves keys to the new backend, about 1/5th of them.
+	if err := f.AddBackend("new", simple.New()); err != nil {
+		panic(err)
+	}
+	added := routes(f, names)
+	moved := 0
+	for _, name := range names {
+		if added[name] == before[name] {
+			continue
+		}
+		moved++
+		if added[name] != "new" {
+			t.Fatalf("TestStability(add): %s moved from backend(%s) to backend(%s), want backend(new)", name, before[name], added[name])
+		}
+	}
+	if moved < 1500 || moved > 2500 {
+		t.Errorf("TestStability(add): %d of 10000 keys moved, want about 2000", moved)
+	}
+
+	// Removing the new backend returns every key to where it was.
+	if err := f.RemoveBackend("new"); err != nil {
+		panic(err)
+	}
+	for name, id := range routes(f, names) {
+		if id != before[name] {
+			t.Fatalf("TestStability(remove new): %s is on backend(%s), want backend(%s)", name, id, before[name])
+		}
+	}
+
+	// Removing an original backend only moves the keys that were on it.
+	if err := f.RemoveBackend("2"); err != nil {
+		panic(err)
+	}
+	for name, id := range routes(f, names) {
+		if before[name] != "2" && id != before[name] {
+			t.Fatalf("TestStability(remove 2): %s moved from backend(%s) to backend(%s)", name, before[name], id)
+		}
+		if id == "2" {
+			t.Fatalf("TestStability(remove 2): %s is still on the removed backend", name)
+		}
+	}
+
+	// The order backends are in does not matter.
+	backends := newBackends(3)
+	a := New(nil)
+	b := New(nil)
+	for i := range backends {
+		if err := a.AddBackend(fmt.Sprint(i), backends[i]); err != nil {
+			panic(err)
+		}
+		j := len(backends) - 1 - i
+		if err := b.AddBackend(fmt.Sprint(j), backends[j]); err != nil {
+			panic(err)
+		}
+	}
+	routesA, routesB := routes(a, names), routes(b, names)
+	for _, name := range names {
+		if routesA[name] != routesB[name] {
+			t.Fatalf("TestStability(order): %s is on backend(%s) and backend(%s), want the same", name, routesA[name], routesB[name])
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := New(nil)
+	if _, err := f.ReadFile("file"); !errors.Is(err, ErrNoBackends) {
+		t.Errorf("TestErrors(no backends): got err == %v, want ErrNoBackends", err)
+	}
+
+	if err := f.AddBackend("a", simple.New()); err != nil {
+		t.Fatalf("TestErrors(AddBackend): got err == %s, want err == nil", err)
+	}
+	if err := f.AddBackend("a", simple.New()); err == nil {
+		t.Errorf("TestErrors(AddBackend duplicate id): got err == nil, want err != nil")
+	}
+	if err := f.RemoveBackend("b"); err == nil {
+		t.Errorf("TestErrors(RemoveBackend unknown id): got err == nil, want err != nil")
+	}
+}
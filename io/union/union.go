@@ -0,0 +1,180 @@
+/*
+Package union provides an io/fs.FS that is a live, read-only view of several fs.FS layered
+on top of each other. This is useful for combining an embed.FS of assets with a directory
+on disk that overrides some of those assets.
+
+Layers are consulted in the order they are given. A file in an earlier layer shadows a file
+with the same name in later layers. Directory listings are the union of the directory in
+every layer, where an entry in an earlier layer wins over an entry with the same name in a
+later layer.
+
+Unlike fs.Merge(), which copies files from one filesystem into another, changes to a layer
+are seen by the union immediately.
+
+Example use:
+
+	overrides := os.DirFS("/path/to/overrides")
+
+	fsys := union.New(overrides, somePkg.Embedded)
+
+	// Reads from overrides if the file exists there, otherwise from the embed.FS.
+	b, err := fsys.ReadFile("js/app.js")
+	if err != nil {
+		// Do something
+	}
+*/
+package union
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// Simply here to make sure our FS implements these interfaces.
+var (
+	_ fs.ReadFileFS = &FS{}
+	_ fs.StatFS     = &FS{}
+	_ fs.ReadDirFS  = &FS{}
+)
+
+// FS implements io/fs.FS by consulting a set of layers in order.
+type FS struct {
+	layers []fs.FS
+}
+
+// New creates a new FS from layers. Earlier layers shadow later layers.
+func New(layers ...fs.FS) *FS {
+	return &FS{layers: layers}
+}
+
+// find returns the first layer that has name and the fs.FileInfo of name in that layer.
+func (u *FS) find(op, name string) (fs.FS, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	for _, layer := range u.layers {
+		fi, err := fs.Stat(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, nil, err
+		}
+		return layer, fi, nil
+	}
+	return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// Open implements fs.FS.Open(). If name is a directory, the fs.File returned implements
+// fs.ReadDirFile with the union of the directory in all layers.
+func (u *FS) Open(name string) (fs.File, error) {
+	layer, fi, err := u.find("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := layer.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return f, nil
+	}
+
+	entries, err := u.ReadDir(name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &dirFile{File: f, entries: entries}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.ReadFile().
+func (u *FS) ReadFile(name string) ([]byte, error) {
+	layer, _, err := u.find("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(layer, name)
+}
+
+// Stat implements fs.StatFS.Stat().
+func (u *FS) Stat(name string) (fs.FileInfo, error) {
+	_, fi, err := u.find("stat", name)
+	return fi, err
+}
+
+// ReadDir implements fs.ReadDirFS.ReadDir(). The entries are sorted by name. If a later layer
+// has a file with the same name as the directory, that layer is not included.
+func (u *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	seen := map[string]bool{}
+	var out []fs.DirEntry
+	found := false
+	for _, layer := range u.layers {
+		fi, err := fs.Stat(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if !fi.IsDir() {
+			if !found {
+				return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+			}
+			continue
+		}
+		found = true
+
+		entries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if seen[e.Name()] {
+				continue
+			}
+			seen[e.Name()] = true
+			out = append(out, e)
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// dirFile is a directory opened with Open(). Stat() and Close() are provided by the
+// directory in the first layer that has it.
+type dirFile struct {
+	fs.File
+
+	entries []fs.DirEntry
+	offset  int
+}
+
+// ReadDir implements fs.ReadDirFile.ReadDir().
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,111 @@
+package union
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	jsfs "github.com/gopherfs/fs"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func newLayer(files map[string]string) *simple.FS {
+	s := simple.New()
+	for name, content := range files {
+		if err := s.WriteFile(name, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+	s.RO()
+	return s
+}
+
+func TestUnion(t *testing.T) {
+	top := newLayer(map[string]string{
+		"shadowed.txt":   "top",
+		"dir/top.txt":    "top",
+		"dir/shared.txt": "top",
+	})
+	bottom := newLayer(map[string]string{
+		"shadowed.txt":   "bottom",
+		"bottom.txt":     "bottom",
+		"dir/bottom.txt": "bottom",
+		"dir/shared.txt": "bottom",
+		"other/file.txt": "bottom",
+	})
+
+	u := New(top, bottom)
+
+	readTests := []struct {
+		name string
+		want string
+	}{
+		{name: "shadowed.txt", want: "top"},
+		{name: "bottom.txt", want: "bottom"},
+		{name: "dir/shared.txt", want: "top"},
+		{name: "dir/bottom.txt", want: "bottom"},
+	}
+	for _, test := range readTests {
+		b, err := u.ReadFile(test.name)
+		if err != nil {
+			t.Errorf("TestUnion(ReadFile %s): got err == %s, want err == nil", test.name, err)
+			continue
+		}
+		if string(b) != test.want {
+			t.Errorf("TestUnion(ReadFile %s): got %q, want %q", test.name, b, test.want)
+		}
+	}
+
+	if _, err := u.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("TestUnion(ReadFile missing): got err == %v, want fs.ErrNotExist", err)
+	}
+
+	got, err := jsfs.List(u, ".")
+	if err != nil {
+		t.Fatalf("TestUnion(List): got err == %s, want err == nil", err)
+	}
+	want := []string{"bottom.txt", "dir/bottom.txt", "dir/shared.txt", "dir/top.txt", "other/file.txt", "shadowed.txt"}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestUnion(List): -want/+got:\n%s", diff)
+	}
+
+	f, err := u.Open("dir")
+	if err != nil {
+		t.Fatalf("TestUnion(Open dir): got err == %s, want err == nil", err)
+	}
+	defer f.Close()
+	entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil {
+		t.Fatalf("TestUnion(Open dir): ReadDir got err == %s, want err == nil", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want = []string{"bottom.txt", "shared.txt", "top.txt"}
+	if diff := pretty.Compare(want, names); diff != "" {
+		t.Errorf("TestUnion(Open dir): -want/+got:\n%s", diff)
+	}
+}
+
+func TestReadDirFileInLayer(t *testing.T) {
+	u := New(
+		newLayer(map[string]string{"dir/top.txt": "top"}),
+		newLayer(map[string]string{"dir": "file"}),
+		newLayer(map[string]string{"dir/bottom.txt": "bottom"}),
+	)
+
+	entries, err := u.ReadDir("dir")
+	if err != nil {
+		t.Fatalf("TestReadDirFileInLayer: got err == %s, want err == nil", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{"bottom.txt", "top.txt"}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestReadDirFileInLayer: -want/+got:\n%s", diff)
+	}
+}
@@ -3,12 +3,16 @@ package fs
 import (
 	"fmt"
 	"io/fs"
+	"mime"
+	"net/http"
 	"path"
+	"sort"
 	"strings"
 )
 
 type mergeOptions struct {
 	fileTransform FileTransform
+	dryRun        func(action, path string)
 }
 
 // MergeOption is an optional argument for Merge().
@@ -27,10 +31,33 @@ func WithTransform(ft FileTransform) MergeOption {
 	}
 }
 
+// These are the actions passed to the report function of WithDryRun().
+const (
+	// DryRunWrite indicates the file would be written.
+	DryRunWrite = "write"
+	// DryRunSkip indicates the FileTransform returned nil for the file, so it would not be written.
+	DryRunSkip = "skip"
+	// DryRunConflict indicates the file already exists in the destination.
+	DryRunConflict = "conflict"
+)
+
+// WithDryRun causes Merge() to call report with the action it would take for each file
+// instead of writing to the destination. action is one of DryRunWrite, DryRunSkip or DryRunConflict
+// and path is the file's path in the destination. The destination is never modified, but it
+// is read to find conflicts. Files are still read and passed to the FileTransform, if one is set,
+// to find out which would be skipped.
+func WithDryRun(report func(action, path string)) MergeOption {
+	return func(o *mergeOptions) {
+		o.dryRun = report
+	}
+}
+
 // Merge will merge "from" into "into" by walking "from" the root "/". Each file will be
 // prepended with "prepend" which must start and end with "/". If into does not
 // implement Writer, this will panic. If the file already exists, this will error and
-// leave a partial copied fs.FS.
+// leave a partial copied fs.FS. Files are always written with mode 0644, as the modes
+// reported by "from" (such as an embed.FS) are often not usable by "into". If into implements
+// StreamWriter and no FileTransform is used, files are streamed instead of read into memory.
 func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) error {
 	// Note: Testing this is done inside simple_test.go, to avoid some recursive imports
 	opt := mergeOptions{}
@@ -57,6 +84,46 @@ func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) erro
 		if d.IsDir() {
 			return nil
 		}
+
+		intoPath := path.Join(prepend, p)
+		mkdir := func() error {
+			if i, ok := into.(MkdirAllFS); ok {
+				parentDir := path.Dir(intoPath)
+				if err := i.MkdirAll(parentDir, 0700+fs.ModeDir); err != nil {
+					return fmt.Errorf("unable to create Dir(%s): %w", parentDir, err)
+				}
+			}
+			return nil
+		}
+
+		// report reports the action for intoPath if this is a dry run.
+		report := func() {
+			if _, err := fs.Stat(into, intoPath); err == nil {
+				opt.dryRun(DryRunConflict, intoPath)
+				return
+			}
+			opt.dryRun(DryRunWrite, intoPath)
+		}
+		if opt.dryRun != nil && opt.fileTransform == nil {
+			report()
+			return nil
+		}
+
+		if sw, ok := into.(StreamWriter); ok && opt.fileTransform == nil {
+			if err := mkdir(); err != nil {
+				return err
+			}
+			f, err := from.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := sw.WriteFileFrom(intoPath, f, mergeFileMode); err != nil {
+				return fmt.Errorf("write failed for %q: %w", intoPath, err)
+			}
+			return nil
+		}
+
 		b, err := fs.ReadFile(from, p)
 		if err != nil {
 			return err
@@ -65,23 +132,122 @@ func Merge(into Writer, from fs.FS, prepend string, options ...MergeOption) erro
 		if opt.fileTransform != nil {
 			b, err = opt.fileTransform(path.Base(p), b)
 			if err != nil {
-				return err
+				return fmt.Errorf("transform failed for %q: %w", p, err)
 			}
 			if b == nil {
+				if opt.dryRun != nil {
+					opt.dryRun(DryRunSkip, intoPath)
+				}
 				return nil
 			}
 		}
-
-		intoPath := path.Join(prepend, p)
-		if i, ok := into.(MkdirAllFS); ok {
-			parentDir := path.Dir(intoPath)
-			if err := i.MkdirAll(parentDir, 0700+fs.ModeDir); err != nil {
-				return fmt.Errorf("unable to create Dir(%s): %w", parentDir, err)
-			}
+		if opt.dryRun != nil {
+			report()
+			return nil
 		}
 
-		return into.WriteFile(intoPath, b, d.Type())
+		if err := mkdir(); err != nil {
+			return err
+		}
+		if err := into.WriteFile(intoPath, b, mergeFileMode); err != nil {
+			return fmt.Errorf("write failed for %q: %w", intoPath, err)
+		}
+		return nil
 	}
 
 	return fs.WalkDir(from, ".", fn)
 }
+
+// mergeFileMode is the mode used to write all files in Merge().
+const mergeFileMode fs.FileMode = 0644
+
+// List returns the paths of all files beneath root in fsys, sorted and relative to root.
+// The root itself is not included. If fsys implements fs.ReadDirFS, that is used to
+// read each directory, otherwise this falls back to fs.WalkDir().
+func List(fsys fs.FS, root string) ([]string, error) {
+	return list(fsys, root, false)
+}
+
+// ListDirs is the same as List() except that it returns the directories beneath root
+// instead of files.
+func ListDirs(fsys fs.FS, root string) ([]string, error) {
+	return list(fsys, root, true)
+}
+
+func list(fsys fs.FS, root string, dirs bool) ([]string, error) {
+	switch root {
+	case "", "/":
+		root = "."
+	}
+	root = strings.TrimSuffix(root, "/")
+
+	out := []string{}
+	add := func(p string, d fs.DirEntry) {
+		if p == root || d.IsDir() != dirs {
+			return
+		}
+		if root != "." {
+			p = strings.TrimPrefix(p, root+"/")
+		}
+		out = append(out, p)
+	}
+
+	if rd, ok := fsys.(fs.ReadDirFS); ok {
+		if err := readDirAll(rd, root, add); err != nil {
+			return nil, err
+		}
+	} else {
+		err := fs.WalkDir(
+			fsys,
+			root,
+			func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				add(p, d)
+				return nil
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+// readDirAll calls fn for every entry beneath dir, recursing into sub-directories.
+func readDirAll(fsys fs.ReadDirFS, dir string, fn func(p string, d fs.DirEntry)) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		fn(p, entry)
+		if entry.IsDir() {
+			if err := readDirAll(fsys, p, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sniffLen is the number of bytes used by http.DetectContentType().
+const sniffLen = 512
+
+// DetectContentType returns the content type of the file at name from its extension using
+// mime.TypeByExtension(). If the extension is not known, content is sniffed with
+// http.DetectContentType(), which only uses the first 512 bytes of content and returns
+// "application/octet-stream" if it cannot determine a more specific type.
+func DetectContentType(name string, content []byte) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	if len(content) > sniffLen {
+		content = content[:sniffLen]
+	}
+	return http.DetectContentType(content)
+}